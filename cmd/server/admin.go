@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/zqz/web/backend/internal/config"
+	"github.com/zqz/web/backend/internal/domain"
+	"github.com/zqz/web/backend/internal/repository"
+	"github.com/zqz/web/backend/internal/server"
+	"github.com/zqz/web/backend/internal/service"
+)
+
+// thumbnailProcessor is the name the thumbnail processor registers its jobs under
+const thumbnailProcessor = "thumbnail"
+
+// Kinds of value a site setting takes
+const (
+	settingBool = "true or false"
+	settingInt  = "a non-negative integer"
+)
+
+// siteSettings are the site_settings keys the server reads and the kind of value each takes
+var siteSettings = map[string]string{
+	"public_uploads_enabled":      settingBool,
+	"default_private_upload":      settingBool,
+	"default_max_file_size":       settingInt, // bytes
+	"default_storage_quota":       settingInt, // bytes; 0 = unlimited
+	"default_file_ttl_hours":      settingInt, // 0 = files don't expire by default
+	"api_rate_limit_rps":          settingInt, // 0 = unlimited
+	"incomplete_upload_ttl_hours": settingInt, // 0 = never sweep stale uploads
+}
+
+// admin runs the maintenance commands against the same database and storage as serve
+type admin struct {
+	repo     *repository.Repository
+	files    *service.FileService
+	users    *service.UserService
+	settings *service.SettingsService
+	out      io.Writer
+}
+
+// runAdmin connects to the database and storage and runs one maintenance command
+func runAdmin(ctx context.Context, cfg *config.Config, args []string, out io.Writer) error {
+	pool, err := server.OpenDatabase(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("database: %w", err)
+	}
+	defer pool.Close()
+
+	stor, err := server.OpenStorage(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("storage: %w", err)
+	}
+
+	repo := repository.NewRepository(pool)
+	a := &admin{
+		repo:     repo,
+		files:    server.NewFileService(cfg, repo, stor),
+		users:    service.NewUserService(repo),
+		settings: service.NewSettingsService(repo),
+		out:      out,
+	}
+	return a.run(ctx, args)
+}
+
+func (a *admin) run(ctx context.Context, args []string) error {
+	if len(args) < 2 {
+		return usageError(fmt.Sprintf("%s needs a subcommand", args[0]))
+	}
+	switch args[0] + " " + args[1] {
+	case "user promote":
+		return a.setUser(ctx, args[2:], func(id int32) (*domain.User, error) { return a.users.SetRole(ctx, id, domain.RoleAdmin) })
+	case "user demote":
+		return a.setUser(ctx, args[2:], func(id int32) (*domain.User, error) { return a.users.SetRole(ctx, id, domain.RoleMember) })
+	case "user role":
+		if len(args) != 4 {
+			return usageError("expected a user ID or email and a role")
+		}
+		role := args[3]
+		return a.setUser(ctx, args[2:3], func(id int32) (*domain.User, error) { return a.users.SetRole(ctx, id, role) })
+	case "user ban":
+		return a.setUser(ctx, args[2:], func(id int32) (*domain.User, error) { return a.users.SetBanned(ctx, id, true) })
+	case "user unban":
+		return a.setUser(ctx, args[2:], func(id int32) (*domain.User, error) { return a.users.SetBanned(ctx, id, false) })
+	case "thumbnails rebuild":
+		return a.rebuildThumbnails(ctx, args[2:])
+	case "storage verify":
+		return a.verifyStorage(ctx, args[2:])
+	case "storage scrub":
+		return a.scrubStorage(ctx, args[2:])
+	case "settings get":
+		return a.getSettings(ctx, args[2:])
+	case "settings set":
+		return a.setSetting(ctx, args[2:])
+	}
+	return usageError(fmt.Sprintf("unknown command %q", args[0]+" "+args[1]))
+}
+
+// setUser applies change to the user named by an ID or email address and prints the result
+func (a *admin) setUser(ctx context.Context, args []string, change func(id int32) (*domain.User, error)) error {
+	if len(args) != 1 {
+		return usageError("expected one user ID or email")
+	}
+	user, err := a.lookupUser(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	if user, err = change(user.ID); err != nil {
+		return err
+	}
+	fmt.Fprintf(a.out, "user %d (%s): role=%s banned=%t\n", user.ID, user.Email, user.Role, user.Banned)
+	return nil
+}
+
+func (a *admin) lookupUser(ctx context.Context, idOrEmail string) (*domain.User, error) {
+	if id, err := strconv.ParseInt(idOrEmail, 10, 32); err == nil {
+		return a.users.GetUserByID(ctx, int32(id))
+	}
+	return a.users.GetUserByEmail(ctx, idOrEmail)
+}
+
+// rebuildThumbnails queues thumbnail jobs for images that lack one (or all images with -all).
+// Running servers pick the jobs up; -run processes them here instead.
+func (a *admin) rebuildThumbnails(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("thumbnails rebuild", flag.ContinueOnError)
+	all := fs.Bool("all", false, "regenerate thumbnails that already exist too")
+	runNow := fs.Bool("run", false, "process the queued jobs in this process and wait for them")
+	if err := fs.Parse(args); err != nil {
+		return usageError(err.Error())
+	}
+
+	queued, err := a.files.RequeueImages(ctx, thumbnailProcessor, !*all)
+	if errors.Is(err, service.ErrUnknownProcessor) {
+		return errors.New("thumbnails are disabled (ENABLE_THUMBNAILS=false)")
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(a.out, "queued %d thumbnail jobs\n", queued)
+	if !*runNow {
+		return nil
+	}
+
+	processed, failed := 0, 0
+	for {
+		ran, err := a.files.ProcessNextJob(ctx)
+		if !ran {
+			if err != nil {
+				return err
+			}
+			break
+		}
+		processed++
+		if err != nil {
+			failed++
+			fmt.Fprintln(a.out, err)
+		}
+	}
+	fmt.Fprintf(a.out, "processed %d jobs, %d failed (failures are retried with backoff)\n", processed, failed)
+	return nil
+}
+
+// verifyStorage reports blobs whose data is missing or damaged. It fails if it finds any.
+func (a *admin) verifyStorage(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("storage verify", flag.ContinueOnError)
+	checkHash := fs.Bool("hash", false, "also re-hash every file (reads all stored data)")
+	if err := fs.Parse(args); err != nil {
+		return usageError(err.Error())
+	}
+
+	report, err := a.files.VerifyStorage(ctx, *checkHash)
+	if err != nil {
+		return err
+	}
+	a.printProblems(report.Problems)
+	fmt.Fprintf(a.out, "checked %d blobs, %d problems\n", report.Checked, len(report.Problems))
+	if len(report.Problems) > 0 {
+		return fmt.Errorf("storage verification found %d problems", len(report.Problems))
+	}
+	return nil
+}
+
+// scrubStorage reports (and with -apply deletes) orphaned stored files and dangling thumbnail rows
+func (a *admin) scrubStorage(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("storage scrub", flag.ContinueOnError)
+	checkHash := fs.Bool("hash", false, "also re-hash every file (reads all stored data)")
+	apply := fs.Bool("apply", false, "delete orphans and thumbnail rows without data (default: dry run)")
+	minAge := fs.Duration("min-age", service.DefaultScrubMinAge, "ignore stored files modified more recently than this")
+	if err := fs.Parse(args); err != nil {
+		return usageError(err.Error())
+	}
+
+	report, err := a.files.Scrub(ctx, service.ScrubOptions{CheckHash: *checkHash, Apply: *apply, MinAge: *minAge})
+	if err != nil {
+		return err
+	}
+	a.printProblems(report.Problems)
+	for _, o := range report.Orphans {
+		fmt.Fprintf(a.out, "%s: orphan (%d bytes, modified %s)\n", o.Key, o.Size, o.ModTime.UTC().Format(time.RFC3339))
+	}
+	fmt.Fprintf(a.out, "checked %d blobs and %d stored files: %d problems, %d orphans (%d bytes)\n",
+		report.Checked, report.Objects, len(report.Problems), len(report.Orphans), report.OrphanBytes)
+	if *apply {
+		fmt.Fprintf(a.out, "deleted %d orphans and %d thumbnail rows\n", report.DeletedOrphans, report.DeletedThumbnails)
+	}
+	return nil
+}
+
+func (a *admin) printProblems(problems []service.StorageProblem) {
+	for _, p := range problems {
+		fmt.Fprintf(a.out, "%s: %s", p.Hash, p.Problem)
+		if p.Detail != "" {
+			fmt.Fprintf(a.out, " (%s)", p.Detail)
+		}
+		fmt.Fprintln(a.out)
+	}
+}
+
+// getSettings prints one setting, or every known and stored setting
+func (a *admin) getSettings(ctx context.Context, args []string) error {
+	if len(args) > 1 {
+		return usageError("expected at most one key")
+	}
+
+	stored, err := a.repo.Settings.List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list settings: %w", err)
+	}
+	values := make(map[string]string, len(stored))
+	for _, s := range stored {
+		values[s.Key] = s.Value
+	}
+
+	if len(args) == 1 {
+		v, ok := values[args[0]]
+		if !ok {
+			return fmt.Errorf("%s is not set", args[0])
+		}
+		fmt.Fprintln(a.out, v)
+		return nil
+	}
+
+	keys := make([]string, 0, len(siteSettings)+len(values))
+	for k := range siteSettings {
+		keys = append(keys, k)
+	}
+	for k := range values {
+		if _, known := siteSettings[k]; !known {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+
+	tw := tabwriter.NewWriter(a.out, 0, 0, 2, ' ', 0)
+	for _, k := range keys {
+		v, ok := values[k]
+		if !ok {
+			v = "(unset)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\n", k, v)
+	}
+	return tw.Flush()
+}
+
+// setSetting changes a known setting after checking the value suits it
+func (a *admin) setSetting(ctx context.Context, args []string) error {
+	if len(args) != 2 {
+		return usageError("expected KEY VALUE")
+	}
+	key, value := args[0], args[1]
+	if err := validateSetting(key, value); err != nil {
+		return err
+	}
+	if err := a.settings.Set(ctx, key, value); err != nil {
+		return fmt.Errorf("failed to set %s: %w", key, err)
+	}
+	fmt.Fprintf(a.out, "%s = %s\n", key, value)
+	return nil
+}
+
+func validateSetting(key, value string) error {
+	kind, ok := siteSettings[key]
+	if !ok {
+		return fmt.Errorf("unknown setting %q", key)
+	}
+	switch kind {
+	case settingBool:
+		if value == "true" || value == "false" {
+			return nil
+		}
+	case settingInt:
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil && n >= 0 {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s must be %s", key, kind)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateSetting(t *testing.T) {
+	assert.NoError(t, validateSetting("public_uploads_enabled", "false"))
+	assert.NoError(t, validateSetting("default_max_file_size", "1048576"))
+	assert.NoError(t, validateSetting("api_rate_limit_rps", "0"))
+
+	assert.EqualError(t, validateSetting("public_uploads_enabled", "yes"), "public_uploads_enabled must be true or false")
+	assert.EqualError(t, validateSetting("default_storage_quota", "-1"), "default_storage_quota must be a non-negative integer")
+	assert.EqualError(t, validateSetting("default_file_ttl_hours", "1.5"), "default_file_ttl_hours must be a non-negative integer")
+	assert.EqualError(t, validateSetting("no_such_key", "1"), `unknown setting "no_such_key"`)
+}
+
+func TestAdminUsageErrors(t *testing.T) {
+	a := &admin{}
+	var ue usageError
+	for _, args := range [][]string{
+		{"user"},
+		{"user", "rename", "1"},
+		{"user", "promote"},
+		{"user", "role", "1"},
+		{"settings", "set", "api_rate_limit_rps"},
+		{"storage", "verify", "-bogus"},
+	} {
+		assert.ErrorAs(t, a.run(context.Background(), args), &ue, args)
+	}
+}
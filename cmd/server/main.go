@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
@@ -13,25 +15,84 @@ import (
 
 	"github.com/zqz/web/backend/internal/config"
 	"github.com/zqz/web/backend/internal/server"
+	"github.com/zqz/web/backend/internal/telemetry"
 )
 
-func main() {
-	logger := setupLogger()
+const usage = `usage: server [command]
 
-	logger.Info().Msg("starting application")
+commands:
+  serve                              run the HTTP server (the default)
+  migrate [up|down|status|version]   apply or inspect database migrations (default up)
+  user promote|demote|ban|unban USER set a user's role or ban status (USER is an ID or email)
+  user role USER ROLE                set a user's role: admin, moderator, member or readonly
+  thumbnails rebuild [-all] [-run]   queue thumbnail jobs for images missing one
+  storage verify [-hash]             check stored data against the database
+  storage scrub [-hash] [-apply]     also find orphaned stored files; -apply deletes them
+  settings get [KEY]                 show site settings
+  settings set KEY VALUE             change a site setting
+
+Configuration comes from the environment (and .env outside production), as for serve.
+`
+
+// usageError is a mistake in the command line; it exits with status 2
+type usageError string
+
+func (e usageError) Error() string { return string(e) }
+
+func main() {
+	args := os.Args[1:]
+	if len(args) == 0 {
+		args = []string{"serve"}
+	}
+	if args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		fmt.Print(usage)
+		return
+	}
 
+	logger := setupLogger()
 	cfg, err := config.Load()
 	if err != nil {
 		logger.Fatal().Err(err).Msg("failed to load config")
 	}
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	switch args[0] {
+	case "serve":
+		err = serve(cfg, &logger)
+	case "migrate":
+		err = migrate(ctx, cfg, args[1:])
+	case "user", "thumbnails", "storage", "settings":
+		err = runAdmin(ctx, cfg, args, os.Stdout)
+	default:
+		err = usageError(fmt.Sprintf("unknown command %q", args[0]))
+	}
+
+	var ue usageError
+	switch {
+	case err == nil:
+	case errors.As(err, &ue):
+		fmt.Fprintf(os.Stderr, "server: %s\n\n%s", ue, usage)
+		stop()
+		os.Exit(2)
+	default:
+		fmt.Fprintln(os.Stderr, "server:", err)
+		stop()
+		os.Exit(1)
+	}
+}
+
+// serve runs the HTTP server until SIGINT or SIGTERM
+func serve(cfg *config.Config, logger *zerolog.Logger) error {
+	logger.Info().Msg("starting application")
 	logger.Info().
 		Str("env", cfg.Env).
 		Int("port", cfg.Port).
 		Msg("config loaded")
 
 	ctx := context.Background()
-	srv, err := server.New(ctx, cfg, &logger)
+	srv, err := server.New(ctx, cfg, logger)
 	if err != nil {
 		logger.Fatal().Err(err).Msg("failed to setup server")
 	}
@@ -44,7 +105,11 @@ func main() {
 	}()
 
 	logger.Info().Msg("database connected")
-	logger.Info().Str("path", cfg.FilesPath).Msg("storage initialized")
+	if cfg.StorageBackend == "s3" {
+		logger.Info().Str("backend", cfg.StorageBackend).Str("endpoint", cfg.S3Endpoint).Str("bucket", cfg.S3Bucket).Msg("storage initialized")
+	} else {
+		logger.Info().Str("backend", cfg.StorageBackend).Str("path", cfg.FilesPath).Msg("storage initialized")
+	}
 
 	go func() {
 		logger.Info().Str("address", cfg.Address()).Msg("starting HTTP server")
@@ -58,11 +123,12 @@ func main() {
 	<-quit
 
 	logger.Info().Msg("shutting down server...")
+	return nil
 }
 
 func setupLogger() zerolog.Logger {
 	if os.Getenv("ENV") == "production" {
-		return zerolog.New(os.Stdout).With().Timestamp().Logger()
+		return zerolog.New(os.Stdout).With().Timestamp().Logger().Hook(telemetry.LogHook{})
 	}
 
 	zerolog.ErrorStackMarshaler = pkgerrors.MarshalStack
@@ -71,5 +137,5 @@ func setupLogger() zerolog.Logger {
 		TimeFormat: time.RFC3339,
 	}
 
-	return zerolog.New(output).With().Timestamp().Caller().Logger()
+	return zerolog.New(output).With().Timestamp().Caller().Logger().Hook(telemetry.LogHook{})
 }
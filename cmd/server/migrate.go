@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+
+	_ "github.com/lib/pq"
+	"github.com/pressly/goose/v3"
+
+	"github.com/zqz/web/backend/internal/config"
+)
+
+// migrate runs a goose command (up, down, status, version, ...) against cfg.DatabaseURL
+func migrate(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	dir := fs.String("dir", "db/migrations", "directory holding the migration files")
+	if err := fs.Parse(args); err != nil {
+		return usageError(err.Error())
+	}
+	command := "up"
+	if fs.NArg() > 0 {
+		command = fs.Arg(0)
+	}
+	if _, err := os.Stat(*dir); err != nil {
+		return fmt.Errorf("migrations directory: %w", err)
+	}
+
+	db, err := sql.Open("postgres", cfg.DatabaseURL)
+	if err != nil {
+		return fmt.Errorf("open database: %w", err)
+	}
+	defer db.Close()
+
+	if err := goose.SetDialect("postgres"); err != nil {
+		return err
+	}
+	return goose.RunContext(ctx, command, db, *dir, fs.Args()[min(1, fs.NArg()):]...)
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	v1 "github.com/zqz/web/backend/internal/handler/api/v1"
+)
+
+const apiPrefix = "/api/v1"
+
+// client calls the /api/v1 endpoints with a personal API token
+type client struct {
+	server string
+	token  string
+	http   *http.Client
+}
+
+func newClient(cfg *config, httpClient *http.Client) *client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &client{server: cfg.Server, token: cfg.Token, http: httpClient}
+}
+
+// apiError is a non-2xx response from the server
+type apiError struct {
+	Status  int
+	Message string
+}
+
+func (e *apiError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("server returned %d %s", e.Status, http.StatusText(e.Status))
+	}
+	return fmt.Sprintf("server returned %d: %s", e.Status, e.Message)
+}
+
+// temporary reports whether retrying the same request might succeed
+func (e *apiError) temporary() bool {
+	return e.Status >= 500 || e.Status == http.StatusTooManyRequests
+}
+
+// sizedBody is a request body of known length, so it is sent with a Content-Length
+// instead of chunked (the server needs the length of each upload chunk)
+type sizedBody struct {
+	io.Reader
+	size int64
+}
+
+// do sends a request to path under /api/v1. Error statuses are turned into *apiError
+// and the body is closed; otherwise the caller closes it.
+func (c *client) do(ctx context.Context, method, path string, body io.Reader, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.server+apiPrefix+path, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if b, ok := body.(sizedBody); ok {
+		req.ContentLength = b.size
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		apiErr := &apiError{Status: resp.StatusCode}
+		var errResp v1.ErrorResponse
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		if json.Unmarshal(data, &errResp) == nil && errResp.Error != "" {
+			apiErr.Message = errResp.Error
+		} else {
+			apiErr.Message = strings.TrimSpace(string(data))
+		}
+		return nil, apiErr
+	}
+	return resp, nil
+}
+
+// doJSON sends in (if not nil) as JSON and decodes the response into out (if not nil)
+func (c *client) doJSON(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	header := http.Header{"Accept": {"application/json"}}
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+		header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.do(ctx, method, path, body, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// listFiles returns a page of the files visible to the token's user, filtered by name when query is set
+func (c *client) listFiles(ctx context.Context, query string, limit, offset int) ([]v1.FileResponse, error) {
+	params := url.Values{}
+	params.Set("limit", fmt.Sprint(limit))
+	params.Set("offset", fmt.Sprint(offset))
+	if query != "" {
+		params.Set("q", query)
+	}
+	var files []v1.FileResponse
+	if err := c.doJSON(ctx, http.MethodGet, "/files?"+params.Encode(), nil, &files); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func (c *client) createFile(ctx context.Context, req v1.CreateFileRequest) (*v1.FileResponse, error) {
+	var file v1.FileResponse
+	if err := c.doJSON(ctx, http.MethodPost, "/files", req, &file); err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// getFileByHash returns the caller's record for hash, including the ranges received so far
+func (c *client) getFileByHash(ctx context.Context, hash string) (*v1.FileResponse, error) {
+	var file v1.FileResponse
+	if err := c.doJSON(ctx, http.MethodGet, "/meta/"+hash, nil, &file); err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// uploadChunk sends length bytes of data as the chunk starting at offset of a size-byte file
+func (c *client) uploadChunk(ctx context.Context, hash string, offset, length, size int64, data io.Reader) (*v1.FileResponse, error) {
+	header := http.Header{
+		"Content-Type":  {"application/octet-stream"},
+		"Content-Range": {fmt.Sprintf("bytes %d-%d/%d", offset, offset+length-1, size)},
+	}
+	resp, err := c.do(ctx, http.MethodPost, "/meta/"+hash, sizedBody{data, length}, header)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var file v1.FileResponse
+	if err := json.NewDecoder(resp.Body).Decode(&file); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &file, nil
+}
+
+func (c *client) updateFile(ctx context.Context, slug string, req v1.UpdateFileRequest) (*v1.FileResponse, error) {
+	var file v1.FileResponse
+	if err := c.doJSON(ctx, http.MethodPut, "/files/"+url.PathEscape(slug), req, &file); err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+func (c *client) deleteFile(ctx context.Context, slug string) error {
+	return c.doJSON(ctx, http.MethodDelete, "/files/"+url.PathEscape(slug), nil, nil)
+}
+
+// download opens a file's contents. password is sent as X-File-Password when set.
+func (c *client) download(ctx context.Context, slug, password string) (*http.Response, error) {
+	header := http.Header{}
+	if password != "" {
+		header.Set("X-File-Password", password)
+	}
+	return c.do(ctx, http.MethodGet, "/files/"+url.PathEscape(slug), nil, header)
+}
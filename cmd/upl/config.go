@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const defaultServer = "http://localhost:3000"
+
+// config is the saved login: which server to talk to and the personal API token to send
+type config struct {
+	Server string `json:"server"`
+	Token  string `json:"token"`
+}
+
+// configPath returns $UPL_CONFIG, or upl/config.json under the user's config directory
+func configPath() (string, error) {
+	if p := os.Getenv("UPL_CONFIG"); p != "" {
+		return p, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find config directory: %w", err)
+	}
+	return filepath.Join(dir, "upl", "config.json"), nil
+}
+
+// loadConfig reads the config file. A missing file is an empty config.
+func loadConfig(path string) (*config, error) {
+	cfg := &config{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return cfg, nil
+		}
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// save writes the config readable only by the current user, since it holds the token
+func (c *config) save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o600); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	return nil
+}
+
+// applyEnv lets UPL_SERVER and UPL_TOKEN override the saved values (handy in CI) and fills in the default server
+func (c *config) applyEnv() {
+	if s := os.Getenv("UPL_SERVER"); s != "" {
+		c.Server = s
+	}
+	if t := os.Getenv("UPL_TOKEN"); t != "" {
+		c.Token = t
+	}
+	if c.Server == "" {
+		c.Server = defaultServer
+	}
+	c.Server = strings.TrimRight(c.Server, "/")
+}
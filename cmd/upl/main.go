@@ -0,0 +1,452 @@
+// Command upl uploads, lists, downloads, edits and deletes files on a zqz server through
+// its /api/v1 endpoints, authenticating with a personal API token.
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	v1 "github.com/zqz/web/backend/internal/handler/api/v1"
+)
+
+const usage = `usage: upl <command> [flags] [args]
+
+commands:
+  login [-server URL] [token]    save a personal API token (read from stdin if omitted)
+  upload [flags] file...         upload files and print their share URLs
+  list [-limit N] [-offset N]    list your files
+  search [flags] query           list files whose name matches query
+  download [-o path] slug        download a file
+  edit [flags] slug              change a file's name, visibility or comment
+  delete slug...                 delete files
+
+Run "upl <command> -h" for a command's flags. UPL_SERVER and UPL_TOKEN override the
+saved login; UPL_CONFIG changes where it is saved.
+`
+
+// usageError is a mistake in the command line; it exits with status 2
+type usageError string
+
+func (e usageError) Error() string { return string(e) }
+
+// app runs commands against the configured server. Its I/O is swappable so tests can run it in-process.
+type app struct {
+	stdin      io.Reader
+	stdout     io.Writer
+	stderr     io.Writer
+	progress   io.Writer // nil disables progress bars
+	httpClient *http.Client
+	configPath string
+}
+
+func main() {
+	path, err := configPath()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "upl:", err)
+		os.Exit(1)
+	}
+	a := &app{
+		stdin:      os.Stdin,
+		stdout:     os.Stdout,
+		stderr:     os.Stderr,
+		progress:   progressOutput(false),
+		configPath: path,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	code := a.run(ctx, os.Args[1:])
+	stop()
+	os.Exit(code)
+}
+
+// run executes one command and returns the process exit status
+func (a *app) run(ctx context.Context, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(a.stderr, usage)
+		return 2
+	}
+
+	var cmd func(context.Context, []string) error
+	switch args[0] {
+	case "login":
+		cmd = a.login
+	case "upload", "up":
+		cmd = a.upload
+	case "list", "ls":
+		cmd = a.list
+	case "search":
+		cmd = a.search
+	case "download", "get":
+		cmd = a.download
+	case "edit":
+		cmd = a.edit
+	case "delete", "rm":
+		cmd = a.delete
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(a.stdout, usage)
+		return 0
+	default:
+		fmt.Fprintf(a.stderr, "upl: unknown command %q\n\n%s", args[0], usage)
+		return 2
+	}
+
+	err := cmd(ctx, args[1:])
+	var ue usageError
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.As(err, &ue):
+		fmt.Fprintf(a.stderr, "upl %s: %s\n", args[0], ue)
+		return 2
+	default:
+		fmt.Fprintln(a.stderr, "upl:", err)
+		return 1
+	}
+}
+
+// flagSet returns a FlagSet for a command that reports errors to stderr
+func (a *app) flagSet(name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(a.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(a.stderr, "usage: upl %s [flags] %s\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseArgs parses flags appearing anywhere among the positional arguments, which it returns
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, err
+			}
+			return nil, usageError(err.Error())
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// client returns an API client for the saved login
+func (a *app) client() (*client, error) {
+	cfg, err := loadConfig(a.configPath)
+	if err != nil {
+		return nil, err
+	}
+	cfg.applyEnv()
+	if cfg.Token == "" {
+		return nil, errors.New(`not logged in: run "upl login" with a token from your account page, or set UPL_TOKEN`)
+	}
+	return newClient(cfg, a.httpClient), nil
+}
+
+func (a *app) login(ctx context.Context, args []string) error {
+	fs := a.flagSet("login", "[token]")
+	server := fs.String("server", "", "server URL (default "+defaultServer+")")
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) > 1 {
+		return usageError("expected at most one token")
+	}
+
+	cfg, err := loadConfig(a.configPath)
+	if err != nil {
+		return err
+	}
+	if *server != "" {
+		cfg.Server = *server
+	}
+	if len(pos) == 1 {
+		cfg.Token = pos[0]
+	} else {
+		fmt.Fprint(a.stderr, "token: ")
+		line, err := bufio.NewReader(a.stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return fmt.Errorf("failed to read token: %w", err)
+		}
+		cfg.Token = strings.TrimSpace(line)
+	}
+	if cfg.Token == "" {
+		return usageError("token is required")
+	}
+	if cfg.Server == "" {
+		cfg.Server = defaultServer
+	}
+	cfg.Server = strings.TrimRight(cfg.Server, "/")
+
+	// A token without the read scope can't list files, but a 403 still means it was accepted
+	var apiErr *apiError
+	if _, err := newClient(cfg, a.httpClient).listFiles(ctx, "", 1, 0); err != nil &&
+		!(errors.As(err, &apiErr) && apiErr.Status == http.StatusForbidden) {
+		return fmt.Errorf("token check failed: %w", err)
+	}
+
+	if err := cfg.save(a.configPath); err != nil {
+		return err
+	}
+	fmt.Fprintf(a.stdout, "Logged in to %s (saved to %s)\n", cfg.Server, a.configPath)
+	return nil
+}
+
+func (a *app) upload(ctx context.Context, args []string) error {
+	fs := a.flagSet("upload", "file...")
+	expires := fs.Duration("expires", 0, "delete the file after this long, e.g. 24h (default: the site's default lifetime)")
+	maxDownloads := fs.Int("max-downloads", 0, "delete the file after this many downloads")
+	chunkSize := fs.Int64("chunk-size", defaultChunkSize, "bytes per upload request")
+	quiet := fs.Bool("q", false, "don't show progress")
+	files, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return usageError("no files given")
+	}
+	if *expires < 0 || *maxDownloads < 0 || *chunkSize <= 0 {
+		return usageError("-expires, -max-downloads and -chunk-size can't be negative")
+	}
+
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+	opts := uploadOptions{chunkSize: *chunkSize, expiresIn: *expires, maxDownloads: *maxDownloads, progress: a.progress}
+	if *quiet {
+		opts.progress = nil
+	}
+	for _, path := range files {
+		file, err := uploadFile(ctx, c, path, opts)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		fmt.Fprintln(a.stdout, c.server+"/view/"+file.Slug)
+	}
+	return nil
+}
+
+func (a *app) list(ctx context.Context, args []string) error {
+	return a.listFiles(ctx, "list", "", args)
+}
+
+func (a *app) search(ctx context.Context, args []string) error {
+	return a.listFiles(ctx, "search", "query", args)
+}
+
+// listFiles implements list and search, which differ only in taking a query
+func (a *app) listFiles(ctx context.Context, name, argsUsage string, args []string) error {
+	fs := a.flagSet(name, argsUsage)
+	limit := fs.Int("limit", 50, "number of files to show")
+	offset := fs.Int("offset", 0, "number of files to skip")
+	asJSON := fs.Bool("json", false, "print the API response as JSON")
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	query := strings.Join(pos, " ")
+	switch {
+	case argsUsage == "" && query != "":
+		return usageError("unexpected arguments; use upl search to filter by name")
+	case argsUsage != "" && query == "":
+		return usageError("query is required")
+	}
+
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+	files, err := c.listFiles(ctx, query, *limit, *offset)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(a.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(files)
+	}
+	tw := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SLUG\tSIZE\tUPLOADED\tFLAGS\tNAME")
+	for _, f := range files {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", f.Slug, formatBytes(f.Size), f.CreatedAt.Local().Format(time.DateTime), fileFlags(f), f.Name)
+	}
+	return tw.Flush()
+}
+
+// fileFlags summarises a file's state for list output
+func fileFlags(f v1.FileResponse) string {
+	var flags []string
+	if f.Private {
+		flags = append(flags, "private")
+	}
+	if f.PasswordProtected {
+		flags = append(flags, "password")
+	}
+	if f.BytesReceived < f.Size {
+		flags = append(flags, "incomplete")
+	}
+	if f.ExpiresAt != nil {
+		flags = append(flags, "expires")
+	}
+	if len(flags) == 0 {
+		return "-"
+	}
+	return strings.Join(flags, ",")
+}
+
+func (a *app) download(ctx context.Context, args []string) error {
+	fs := a.flagSet("download", "slug")
+	out := fs.String("o", "", `output path, or "-" for stdout (default: the file's name)`)
+	password := fs.String("password", "", "the file's share password, if it has one")
+	quiet := fs.Bool("q", false, "don't show progress")
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 1 {
+		return usageError("expected one slug")
+	}
+
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+	resp, err := c.download(ctx, pos[0], *password)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if *out == "-" {
+		_, err := io.Copy(a.stdout, resp.Body)
+		return err
+	}
+	path := *out
+	if path == "" {
+		path = attachmentName(resp.Header.Get("Content-Disposition"), pos[0])
+	}
+
+	var progressOut io.Writer
+	if !*quiet {
+		progressOut = a.progress
+	}
+	bar := newProgress(progressOut, filepath.Base(path), resp.ContentLength)
+
+	// Write beside the destination and rename, so an interrupted download leaves no partial file under its name
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.part")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, bar.reader(resp.Body))
+	bar.done()
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to download: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	fmt.Fprintln(a.stdout, path)
+	return nil
+}
+
+// attachmentName returns the file name from a Content-Disposition header, reduced to
+// a bare name so a hostile server can't write outside the current directory
+func attachmentName(disposition, fallback string) string {
+	_, params, err := mime.ParseMediaType(disposition)
+	if err == nil {
+		if name := filepath.Base(filepath.Clean("/" + params["filename"])); name != "/" && name != "." {
+			return name
+		}
+	}
+	return fallback
+}
+
+func (a *app) edit(ctx context.Context, args []string) error {
+	fs := a.flagSet("edit", "slug")
+	name := fs.String("name", "", "new file name")
+	private := fs.Bool("private", false, "hide the file from other users' lists (-private=false to show it)")
+	comment := fs.String("comment", "", "comment shown on the file's page")
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 1 {
+		return usageError("expected one slug")
+	}
+
+	// Only send the fields given on the command line
+	var req v1.UpdateFileRequest
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "name":
+			req.Name = name
+		case "private":
+			req.Private = private
+		case "comment":
+			req.Comment = comment
+		}
+	})
+	if req.Name == nil && req.Private == nil && req.Comment == nil {
+		return usageError("nothing to change: pass -name, -private or -comment")
+	}
+
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+	file, err := c.updateFile(ctx, pos[0], req)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(a.stdout, "Updated %s (%s)\n", file.Slug, file.Name)
+	return nil
+}
+
+func (a *app) delete(ctx context.Context, args []string) error {
+	fs := a.flagSet("delete", "slug...")
+	slugs, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(slugs) == 0 {
+		return usageError("no slugs given")
+	}
+
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+	for _, slug := range slugs {
+		if err := c.deleteFile(ctx, slug); err != nil {
+			return fmt.Errorf("%s: %w", slug, err)
+		}
+		fmt.Fprintln(a.stdout, "Deleted", slug)
+	}
+	return nil
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	serverconfig "github.com/zqz/web/backend/internal/config"
+	"github.com/zqz/web/backend/internal/domain"
+	v1 "github.com/zqz/web/backend/internal/handler/api/v1"
+	"github.com/zqz/web/backend/internal/handler/auth"
+	"github.com/zqz/web/backend/internal/repository"
+	"github.com/zqz/web/backend/internal/service"
+	"github.com/zqz/web/backend/internal/service/storage"
+	"github.com/zqz/web/backend/internal/tests"
+)
+
+// setupServer starts an httptest server running the real /api/v1 router and returns a token for a new user
+func setupServer(t *testing.T, ctx context.Context) (*httptest.Server, string) {
+	t.Helper()
+
+	pg, cleanup := tests.SetupTestDB(t, ctx)
+	t.Cleanup(cleanup)
+	repo := repository.NewRepository(pg.Pool)
+	stor, err := storage.NewDiskStorage(t.TempDir())
+	require.NoError(t, err)
+
+	fileSvc := service.NewFileService(repo, stor)
+	userSvc := service.NewUserService(repo)
+	logger := zerolog.Nop()
+	cfg := &serverconfig.Config{SessionSecret: "test-secret", Env: "development"}
+	authHandler := auth.NewAuthHandler(userSvc, &logger, cfg)
+
+	r := chi.NewRouter()
+	r.Use(authHandler.AuthMiddleware)
+	fileHandler := v1.NewFileHandler(fileSvc)
+	albumHandler := v1.NewAlbumHandler(service.NewAlbumService(repo, fileSvc), fileHandler)
+	r.Mount("/api/v1", v1.NewRouter(fileHandler, albumHandler, v1.NewUserHandler(userSvc, fileSvc), v1.NewAuditHandler(service.NewAuditService(repo)), authHandler))
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+
+	user, err := repo.Users.Create(ctx, repository.CreateUserParams{
+		Name: "cli", Email: "cli@example.com", Provider: "google", ProviderID: "cli-id", Role: "member",
+	})
+	require.NoError(t, err)
+	token, _, err := userSvc.CreateAPIToken(ctx, user.ID, domain.CreateAPITokenRequest{Name: "upl"})
+	require.NoError(t, err)
+
+	return srv, token
+}
+
+// testApp returns an app with a fresh config file and captured output
+func testApp(t *testing.T, httpClient *http.Client) (*app, *bytes.Buffer, *bytes.Buffer) {
+	t.Helper()
+	t.Setenv("UPL_SERVER", "")
+	t.Setenv("UPL_TOKEN", "")
+	var stdout, stderr bytes.Buffer
+	return &app{
+		stdin:      strings.NewReader(""),
+		stdout:     &stdout,
+		stderr:     &stderr,
+		httpClient: httpClient,
+		configPath: filepath.Join(t.TempDir(), "config.json"),
+	}, &stdout, &stderr
+}
+
+func TestCLI(t *testing.T) {
+	ctx := context.Background()
+	srv, token := setupServer(t, ctx)
+	a, stdout, stderr := testApp(t, srv.Client())
+
+	run := func(args ...string) string {
+		t.Helper()
+		stdout.Reset()
+		stderr.Reset()
+		require.Equal(t, 0, a.run(ctx, args), stderr.String())
+		return stdout.String()
+	}
+
+	// Commands need a login; a bad token is rejected before it is saved
+	assert.Equal(t, 1, a.run(ctx, []string{"list"}))
+	assert.Contains(t, stderr.String(), "not logged in")
+	assert.Equal(t, 1, a.run(ctx, []string{"login", "-server", srv.URL, "zqz_bogus"}))
+	_, err := os.Stat(a.configPath)
+	assert.True(t, os.IsNotExist(err))
+
+	a.stdin = strings.NewReader(token + "\n")
+	run("login", "-server", srv.URL)
+	cfg, err := loadConfig(a.configPath)
+	require.NoError(t, err)
+	assert.Equal(t, token, cfg.Token)
+
+	// Upload in several chunks
+	content := bytes.Repeat([]byte("0123456789"), 10)
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	require.NoError(t, os.WriteFile(path, content, 0o600))
+	out := run("upload", path, "-chunk-size", "16", "-max-downloads", "5")
+	require.True(t, strings.HasPrefix(out, srv.URL+"/view/"), out)
+	slug := strings.TrimSpace(strings.TrimPrefix(out, srv.URL+"/view/"))
+
+	out = run("list")
+	assert.Contains(t, out, slug)
+	assert.Contains(t, out, "notes.txt")
+	out = run("search", "notes")
+	assert.Contains(t, out, slug)
+	out = run("search", "nothing-like-it")
+	assert.NotContains(t, out, slug)
+
+	run("edit", slug, "-name", "renamed.txt", "-private", "-comment", "from the cli")
+	out = run("list", "-json")
+	assert.Contains(t, out, `"name": "renamed.txt"`)
+	assert.Contains(t, out, `"private": true`)
+	assert.Contains(t, out, `"comment": "from the cli"`)
+
+	dir := t.TempDir()
+	out = run("download", slug, "-o", filepath.Join(dir, "copy.txt"))
+	assert.Equal(t, filepath.Join(dir, "copy.txt")+"\n", out)
+	got, err := os.ReadFile(filepath.Join(dir, "copy.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, content, got)
+	assert.Equal(t, string(content), run("download", "-o", "-", slug))
+
+	run("delete", slug)
+	assert.NotContains(t, run("list"), slug)
+	assert.Equal(t, 1, a.run(ctx, []string{"download", "-o", "-", slug}))
+	assert.Contains(t, stderr.String(), "404")
+}
+
+// failingTransport cancels the upload after a number of chunk requests have gone through
+type failingTransport struct {
+	next   http.RoundTripper
+	chunks atomic.Int32
+	limit  int32
+	cancel context.CancelFunc
+}
+
+func (f *failingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.Method == http.MethodPost && strings.Contains(r.URL.Path, "/meta/") && f.chunks.Add(1) > f.limit {
+		f.cancel()
+		return nil, context.Canceled
+	}
+	return f.next.RoundTrip(r)
+}
+
+func TestCLIUploadResume(t *testing.T) {
+	ctx := context.Background()
+	srv, token := setupServer(t, ctx)
+
+	content := bytes.Repeat([]byte("resumable "), 20)
+	path := filepath.Join(t.TempDir(), "big.bin")
+	require.NoError(t, os.WriteFile(path, content, 0o600))
+
+	cfg := &config{Server: srv.URL, Token: token}
+
+	// The first attempt dies after two chunks
+	cancelCtx, cancel := context.WithCancel(ctx)
+	transport := &failingTransport{next: srv.Client().Transport, limit: 2, cancel: cancel}
+	c := newClient(cfg, &http.Client{Transport: transport})
+	_, err := uploadFile(cancelCtx, c, path, uploadOptions{chunkSize: 32})
+	require.Error(t, err)
+
+	c = newClient(cfg, srv.Client())
+	file, err := c.getFileByHash(ctx, mustHash(t, path))
+	require.NoError(t, err)
+	assert.Equal(t, int64(64), file.BytesReceived)
+
+	// Running it again sends only the rest
+	transport = &failingTransport{next: srv.Client().Transport, limit: 100, cancel: func() {}}
+	c = newClient(cfg, &http.Client{Transport: transport})
+	file, err = uploadFile(ctx, c, path, uploadOptions{chunkSize: 32})
+	require.NoError(t, err)
+	assert.Equal(t, file.Size, file.BytesReceived)
+	assert.Equal(t, int32(5), transport.chunks.Load()) // 136 remaining bytes in 32-byte chunks
+}
+
+func mustHash(t *testing.T, path string) string {
+	t.Helper()
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	hash, err := hashFile(f, nil)
+	require.NoError(t, err)
+	return hash
+}
+
+func TestMissingRanges(t *testing.T) {
+	file := &v1.FileResponse{Size: 100, BytesReceived: 10}
+	assert.Equal(t, []v1.ByteRangeResponse{{Start: 10, End: 100}}, missingRanges(file))
+
+	file.ReceivedRanges = []v1.ByteRangeResponse{{Start: 0, End: 10}, {Start: 40, End: 60}, {Start: 90, End: 100}}
+	assert.Equal(t, []v1.ByteRangeResponse{{Start: 10, End: 40}, {Start: 60, End: 90}}, missingRanges(file))
+
+	assert.Equal(t, []v1.ByteRangeResponse{{Start: 0, End: 5}}, missingRanges(&v1.FileResponse{Size: 5}))
+}
+
+func TestParseArgs(t *testing.T) {
+	a, _, _ := testApp(t, nil)
+	fs := a.flagSet("upload", "file...")
+	quiet := fs.Bool("q", false, "")
+	limit := fs.Int("limit", 0, "")
+
+	pos, err := parseArgs(fs, []string{"a.txt", "-q", "b.txt", "-limit", "3"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a.txt", "b.txt"}, pos)
+	assert.True(t, *quiet)
+	assert.Equal(t, 3, *limit)
+
+	_, err = parseArgs(fs, []string{"-nope"})
+	var ue usageError
+	assert.ErrorAs(t, err, &ue)
+}
+
+func TestConfigSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "config.json")
+
+	cfg, err := loadConfig(path)
+	require.NoError(t, err)
+	assert.Empty(t, cfg.Token)
+
+	cfg = &config{Server: "https://example.com", Token: "zqz_secret"}
+	require.NoError(t, cfg.save(path))
+	fi, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), fi.Mode().Perm())
+
+	loaded, err := loadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, cfg, loaded)
+
+	t.Setenv("UPL_SERVER", "http://override:3000/")
+	t.Setenv("UPL_TOKEN", "")
+	loaded.applyEnv()
+	assert.Equal(t, "http://override:3000", loaded.Server)
+	assert.Equal(t, "zqz_secret", loaded.Token)
+}
+
+func TestAttachmentName(t *testing.T) {
+	assert.Equal(t, "photo.png", attachmentName(`attachment; filename="photo.png"`, "slug"))
+	assert.Equal(t, "passwd", attachmentName(`attachment; filename="../../etc/passwd"`, "slug"))
+	assert.Equal(t, "slug", attachmentName(`attachment; filename=""`, "slug"))
+	assert.Equal(t, "slug", attachmentName("", "slug"))
+}
+
+func TestFormatBytes(t *testing.T) {
+	assert.Equal(t, "512 B", formatBytes(512))
+	assert.Equal(t, "1.5 KiB", formatBytes(1536))
+	assert.Equal(t, "3.0 MiB", formatBytes(3<<20))
+	assert.Equal(t, "2.0 GiB", formatBytes(2<<30))
+}
+
+func TestProgress(t *testing.T) {
+	var nilBar *progress
+	nilBar.add(10) // A disabled bar is a no-op
+	nilBar.done()
+
+	var buf bytes.Buffer
+	bar := newProgress(&buf, "x", 4<<10)
+	bar.add(2 << 10)
+	bar.done()
+	assert.Contains(t, buf.String(), " 50% 2.0 KiB / 4.0 KiB")
+}
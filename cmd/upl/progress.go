@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	progressBarWidth = 30
+	progressInterval = 100 * time.Millisecond
+)
+
+// progress draws a single-line progress bar. A nil *progress draws nothing, so callers
+// don't need to check whether output is enabled.
+type progress struct {
+	w       io.Writer
+	label   string
+	total   int64
+	current int64
+	drawn   time.Time
+}
+
+// newProgress returns a bar on w, or nil when w is nil
+func newProgress(w io.Writer, label string, total int64) *progress {
+	if w == nil {
+		return nil
+	}
+	return &progress{w: w, label: label, total: total}
+}
+
+// add advances the bar by n bytes
+func (p *progress) add(n int64) {
+	if p == nil {
+		return
+	}
+	p.set(p.current + n)
+}
+
+// set moves the bar to n bytes, e.g. back to the start of a chunk being retried
+func (p *progress) set(n int64) {
+	if p == nil {
+		return
+	}
+	p.current = n
+	if time.Since(p.drawn) >= progressInterval {
+		p.draw()
+	}
+}
+
+// done draws the final state and ends the line
+func (p *progress) done() {
+	if p == nil {
+		return
+	}
+	p.draw()
+	fmt.Fprintln(p.w)
+}
+
+func (p *progress) draw() {
+	p.drawn = time.Now()
+	fraction := 1.0
+	if p.total > 0 {
+		fraction = min(float64(p.current)/float64(p.total), 1)
+	}
+	filled := int(fraction * progressBarWidth)
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", progressBarWidth-filled)
+	fmt.Fprintf(p.w, "\r%s [%s] %3.0f%% %s / %s ", p.label, bar, fraction*100, formatBytes(p.current), formatBytes(p.total))
+}
+
+// reader counts bytes read from r on the bar
+func (p *progress) reader(r io.Reader) io.Reader {
+	if p == nil {
+		return r
+	}
+	return &progressReader{r: r, p: p}
+}
+
+type progressReader struct {
+	r io.Reader
+	p *progress
+}
+
+func (pr *progressReader) Read(b []byte) (int, error) {
+	n, err := pr.r.Read(b)
+	pr.p.add(int64(n))
+	return n, err
+}
+
+// progressOutput returns stderr when it is a terminal and progress isn't disabled, otherwise nil
+func progressOutput(quiet bool) io.Writer {
+	if quiet {
+		return nil
+	}
+	fi, err := os.Stderr.Stat()
+	if err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return nil
+	}
+	return os.Stderr
+}
+
+// formatBytes renders n with a binary unit, e.g. 1.5 MiB
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
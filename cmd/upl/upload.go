@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	v1 "github.com/zqz/web/backend/internal/handler/api/v1"
+)
+
+const (
+	defaultChunkSize = 8 << 20
+	// chunkAttempts is how many times one chunk is sent before giving up on a network or server error
+	chunkAttempts = 3
+)
+
+// uploadOptions configure uploadFile
+type uploadOptions struct {
+	chunkSize    int64
+	expiresIn    time.Duration
+	maxDownloads int
+	// progress receives the progress bars; nil disables them
+	progress io.Writer
+}
+
+// uploadFile hashes the file at path, creates its record and sends whatever bytes the server
+// is missing in chunks addressed by offset. Running it again after an interruption resumes:
+// the server hands back the existing record along with the ranges it already has.
+func uploadFile(ctx context.Context, c *client, path string, opts uploadOptions) (*v1.FileResponse, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", path)
+	}
+	name := filepath.Base(path)
+	size := fi.Size()
+
+	hash, err := hashFile(f, newProgress(opts.progress, "hashing "+name, size))
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+
+	req := v1.CreateFileRequest{
+		Name:        name,
+		Hash:        hash,
+		Size:        size,
+		ContentType: detectContentType(f, name),
+		ExpiresIn:   int64(opts.expiresIn / time.Second),
+	}
+	if opts.maxDownloads > 0 {
+		m := int32(opts.maxDownloads)
+		req.MaxDownloads = &m
+	}
+	file, err := c.createFile(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if file.BytesReceived >= file.Size {
+		return file, nil // Already stored, by us or anyone else
+	}
+
+	chunkSize := opts.chunkSize
+	if chunkSize <= 0 {
+		chunkSize = defaultChunkSize
+	}
+	missing := missingRanges(file)
+	sent := size
+	for _, r := range missing {
+		sent -= r.End - r.Start
+	}
+
+	bar := newProgress(opts.progress, name, size)
+	bar.set(sent)
+	for _, r := range missing {
+		for offset := r.Start; offset < r.End; offset += chunkSize {
+			length := min(chunkSize, r.End-offset)
+			if file, err = sendChunk(ctx, c, f, hash, offset, length, size, bar, sent); err != nil {
+				bar.done()
+				return nil, err
+			}
+			sent += length
+		}
+	}
+	bar.done()
+
+	if file.BytesReceived < file.Size {
+		return nil, fmt.Errorf("upload incomplete: server has %d of %d bytes", file.BytesReceived, file.Size)
+	}
+	return file, nil
+}
+
+// sendChunk uploads one chunk, retrying network errors and 5xx responses. sent is the
+// progress to rewind the bar to before each attempt.
+func sendChunk(ctx context.Context, c *client, f *os.File, hash string, offset, length, size int64, bar *progress, sent int64) (*v1.FileResponse, error) {
+	var err error
+	for attempt := 1; ; attempt++ {
+		bar.set(sent)
+		section := io.NewSectionReader(f, offset, length)
+		var file *v1.FileResponse
+		if file, err = c.uploadChunk(ctx, hash, offset, length, size, bar.reader(section)); err == nil {
+			return file, nil
+		}
+
+		var apiErr *apiError
+		if ctx.Err() != nil || errors.As(err, &apiErr) && !apiErr.temporary() || attempt == chunkAttempts {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Duration(attempt) * time.Second):
+		}
+	}
+	return nil, fmt.Errorf("failed to upload bytes %d-%d (run the same command again to resume): %w", offset, offset+length-1, err)
+}
+
+// missingRanges lists the byte ranges the server doesn't have yet
+func missingRanges(file *v1.FileResponse) []v1.ByteRangeResponse {
+	received := file.ReceivedRanges
+	if len(received) == 0 && file.BytesReceived > 0 {
+		received = []v1.ByteRangeResponse{{Start: 0, End: file.BytesReceived}}
+	}
+
+	var missing []v1.ByteRangeResponse
+	next := int64(0)
+	for _, r := range received {
+		if r.Start > next {
+			missing = append(missing, v1.ByteRangeResponse{Start: next, End: r.Start})
+		}
+		next = max(next, r.End)
+	}
+	if next < file.Size {
+		missing = append(missing, v1.ByteRangeResponse{Start: next, End: file.Size})
+	}
+	return missing
+}
+
+// hashFile returns the hex SHA-256 of f and leaves it rewound
+func hashFile(f *os.File, bar *progress) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, bar.reader(f)); err != nil {
+		return "", err
+	}
+	bar.done()
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// detectContentType guesses a file's type from its extension, falling back to sniffing its first bytes
+func detectContentType(f *os.File, name string) string {
+	if t := mime.TypeByExtension(filepath.Ext(name)); t != "" {
+		return t
+	}
+	head := make([]byte, 512)
+	n, _ := f.ReadAt(head, 0)
+	return http.DetectContentType(head[:n])
+}
@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Personal API tokens. Only the SHA-256 of the token is stored; the plaintext is shown once on creation.
+-- Empty scopes means the token may do anything its owner can.
+CREATE TABLE api_tokens (
+    id SERIAL NOT NULL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    token_hash TEXT NOT NULL,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    expires_at TIMESTAMP WITHOUT TIME ZONE,
+    last_used_at TIMESTAMP WITHOUT TIME ZONE,
+    created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX idx_token_hash_on_api_tokens ON api_tokens (token_hash);
+CREATE INDEX idx_user_id_on_api_tokens ON api_tokens (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS api_tokens;
+-- +goose StatementEnd
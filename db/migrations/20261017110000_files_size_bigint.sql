@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+-- INTEGER capped files at 2 GiB. Widening to BIGINT rewrites the table but keeps every row.
+ALTER TABLE files
+    ALTER COLUMN size TYPE BIGINT,
+    ALTER COLUMN bytes_received TYPE BIGINT;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+-- Fails if any file is 2 GiB or larger; remove those rows first.
+ALTER TABLE files
+    ALTER COLUMN size TYPE INTEGER,
+    ALTER COLUMN bytes_received TYPE INTEGER;
+-- +goose StatementEnd
@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+-- One row per (file, processor). Workers claim pending rows with FOR UPDATE SKIP LOCKED,
+-- so any number of server processes can share the queue.
+CREATE TABLE processing_jobs (
+    id SERIAL NOT NULL PRIMARY KEY,
+    file_id INTEGER NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+    processor TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL DEFAULT 5,
+    last_error TEXT NOT NULL DEFAULT '',
+    run_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now(),
+    locked_at TIMESTAMP WITHOUT TIME ZONE,
+    created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now(),
+    updated_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX idx_file_id_processor_on_processing_jobs ON processing_jobs (file_id, processor);
+CREATE INDEX idx_pending_run_at_on_processing_jobs ON processing_jobs (run_at) WHERE status = 'pending';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS processing_jobs;
+-- +goose StatementEnd
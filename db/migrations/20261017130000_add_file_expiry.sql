@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Self-destructing files: gone after expires_at, or once download_count reaches max_downloads.
+ALTER TABLE files ADD COLUMN expires_at TIMESTAMP WITHOUT TIME ZONE;
+ALTER TABLE files ADD COLUMN max_downloads INTEGER;
+ALTER TABLE files ADD COLUMN download_count INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX idx_expires_at_on_files ON files (expires_at) WHERE expires_at IS NOT NULL;
+
+INSERT INTO site_settings (key, value) VALUES ('default_file_ttl_hours', '0')
+ON CONFLICT (key) DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM site_settings WHERE key = 'default_file_ttl_hours';
+DROP INDEX IF EXISTS idx_expires_at_on_files;
+ALTER TABLE files DROP COLUMN download_count;
+ALTER TABLE files DROP COLUMN max_downloads;
+ALTER TABLE files DROP COLUMN expires_at;
+-- +goose StatementEnd
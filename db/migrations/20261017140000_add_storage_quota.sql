@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Default total storage per user in bytes (0 = unlimited). Stored in site_settings.
+INSERT INTO site_settings (key, value) VALUES ('default_storage_quota', '0')
+ON CONFLICT (key) DO NOTHING;
+
+-- Per-user override (null = use site default). Only settable by admins.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS storage_quota_override BIGINT;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM site_settings WHERE key = 'default_storage_quota';
+ALTER TABLE users DROP COLUMN IF EXISTS storage_quota_override;
+-- +goose StatementEnd
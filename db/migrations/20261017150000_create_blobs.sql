@@ -0,0 +1,30 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Content-addressed storage: one blob per distinct SHA-256, shared by every file
+-- record with that hash. The blob's data is deleted when ref_count drops to zero.
+CREATE TABLE blobs (
+    hash TEXT NOT NULL PRIMARY KEY,
+    size BIGINT NOT NULL,
+    ref_count INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT NOW(),
+    completed_at TIMESTAMP WITHOUT TIME ZONE
+);
+
+INSERT INTO blobs (hash, size, ref_count, created_at, completed_at)
+SELECT
+    hash,
+    MAX(size),
+    COUNT(*),
+    COALESCE(MIN(created_at), NOW()),
+    CASE WHEN BOOL_OR(bytes_received >= size) THEN NOW() END
+FROM files
+GROUP BY hash;
+
+CREATE INDEX idx_hash_on_thumbnails ON thumbnails (hash);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_hash_on_thumbnails;
+DROP TABLE blobs;
+-- +goose StatementEnd
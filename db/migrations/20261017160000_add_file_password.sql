@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Optional share password (bcrypt hash); NULL means no password.
+ALTER TABLE files ADD COLUMN password_hash TEXT;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE files DROP COLUMN password_hash;
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Nonces of single-use signed download URLs that have been used. Rows are only
+-- needed until the URL would have expired anyway.
+CREATE TABLE signed_url_uses (
+    nonce TEXT NOT NULL PRIMARY KEY,
+    expires_at TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_expires_at_on_signed_url_uses ON signed_url_uses (expires_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE signed_url_uses;
+-- +goose StatementEnd
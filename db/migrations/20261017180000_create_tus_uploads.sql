@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Uploads created through the tus protocol. hash is set once the upload is
+-- attached to a file record: up front when the client sends a sha256 in
+-- Upload-Metadata, otherwise after the staged data is complete.
+CREATE TABLE tus_uploads (
+    id TEXT NOT NULL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    hash TEXT,
+    size BIGINT NOT NULL,
+    name TEXT NOT NULL,
+    content_type TEXT NOT NULL,
+    created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT NOW()
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE tus_uploads;
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Chunks that arrived ahead of the contiguous data for a hash. Each is parked in
+-- storage under its own key until the gap before it is filled.
+CREATE TABLE upload_chunks (
+    hash TEXT NOT NULL,
+    start_offset BIGINT NOT NULL,
+    size BIGINT NOT NULL,
+    created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (hash, start_offset)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE upload_chunks;
+-- +goose StatementEnd
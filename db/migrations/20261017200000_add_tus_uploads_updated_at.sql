@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Last time data arrived for a staged tus upload, so abandoned uploads can be swept
+ALTER TABLE tus_uploads ADD COLUMN updated_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT NOW();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE tus_uploads DROP COLUMN updated_at;
+-- +goose StatementEnd
@@ -0,0 +1,37 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Append-only log of security-relevant changes. actor_id has no foreign key
+-- so events outlive the users they mention; NULL means the change came from
+-- the server itself or a maintenance command. before/after hold the changed
+-- fields as JSON.
+CREATE TABLE audit_events (
+    id BIGSERIAL NOT NULL PRIMARY KEY,
+    actor_id INTEGER,
+    action TEXT NOT NULL,
+    target_type TEXT NOT NULL,
+    target_id TEXT NOT NULL,
+    before JSONB,
+    after JSONB,
+    ip TEXT,
+    created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT NOW()
+);
+CREATE INDEX idx_actor_id_on_audit_events ON audit_events(actor_id);
+CREATE INDEX idx_action_on_audit_events ON audit_events(action);
+CREATE INDEX idx_target_on_audit_events ON audit_events(target_type, target_id);
+
+CREATE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_append_only
+    BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE audit_events;
+DROP FUNCTION audit_events_append_only();
+-- +goose StatementEnd
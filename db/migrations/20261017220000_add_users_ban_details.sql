@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+-- A ban lasts until banned_until (forever when NULL). While it lasts,
+-- ban_hides_files hides the user's files from everyone but admins.
+ALTER TABLE users ADD COLUMN ban_reason TEXT;
+ALTER TABLE users ADD COLUMN banned_until TIMESTAMP WITHOUT TIME ZONE;
+ALTER TABLE users ADD COLUMN ban_hides_files BOOLEAN NOT NULL DEFAULT false;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users DROP COLUMN ban_hides_files;
+ALTER TABLE users DROP COLUMN banned_until;
+ALTER TABLE users DROP COLUMN ban_reason;
+-- +goose StatementEnd
@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Login identities. A user can sign in with any identity linked to them; users.provider and
+-- users.provider_id keep the identity the account was created with.
+-- Local (email and password) identities use the lowercased email as provider_id and store an argon2id hash.
+CREATE TABLE user_identities (
+    id SERIAL NOT NULL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider TEXT NOT NULL,
+    provider_id TEXT NOT NULL,
+    email TEXT NOT NULL DEFAULT '',
+    password_hash TEXT,
+    created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX idx_provider_provider_id_on_user_identities ON user_identities (provider, provider_id);
+CREATE INDEX idx_user_id_on_user_identities ON user_identities (user_id);
+
+INSERT INTO user_identities (user_id, provider, provider_id, email, created_at)
+SELECT id, provider, provider_id, email, created_at FROM users
+ON CONFLICT DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS user_identities;
+-- +goose StatementEnd
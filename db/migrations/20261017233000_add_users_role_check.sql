@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Roles map to permissions in code (domain.RolePermissions); anything else would
+-- silently grant nothing, so fold unknown values into member and refuse new ones.
+UPDATE users SET role = 'member' WHERE role NOT IN ('admin', 'moderator', 'member', 'readonly');
+ALTER TABLE users ADD CONSTRAINT users_role_check CHECK (role IN ('admin', 'moderator', 'member', 'readonly'));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users DROP CONSTRAINT users_role_check;
+-- +goose StatementEnd
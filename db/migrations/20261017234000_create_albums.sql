@@ -0,0 +1,36 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Albums group a user's files behind one share slug. A private album is only
+-- visible to its owner (and moderators); a public one still only shows each
+-- viewer the files they could open on their own. Files are kept in position
+-- order and leave their albums when deleted.
+CREATE TABLE albums (
+    id SERIAL NOT NULL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    slug TEXT NOT NULL,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    private BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now(),
+    updated_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX idx_slug_on_albums ON albums (slug);
+CREATE INDEX idx_user_id_on_albums ON albums (user_id);
+
+CREATE TABLE album_files (
+    album_id INTEGER NOT NULL REFERENCES albums(id) ON DELETE CASCADE,
+    file_id INTEGER NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    added_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now(),
+    PRIMARY KEY (album_id, file_id)
+);
+
+CREATE INDEX idx_file_id_on_album_files ON album_files (file_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS album_files;
+DROP TABLE IF EXISTS albums;
+-- +goose StatementEnd
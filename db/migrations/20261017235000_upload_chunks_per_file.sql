@@ -0,0 +1,40 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Each file record now uploads into its own storage key, so parked chunks belong to a
+-- record instead of being shared by every record for a hash. Uploads in progress start
+-- over: their data and chunks were stored under the hash. Those storage keys are queued
+-- in legacy_upload_objects for the reaper to delete.
+CREATE TABLE legacy_upload_objects (
+    key TEXT PRIMARY KEY,
+    hash TEXT NOT NULL
+);
+
+INSERT INTO legacy_upload_objects (key, hash)
+SELECT hash || '.chunk-' || start_offset, hash FROM upload_chunks
+UNION
+SELECT hash, hash FROM blobs WHERE completed_at IS NULL;
+
+DROP TABLE upload_chunks;
+CREATE TABLE upload_chunks (
+    file_id INTEGER NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+    start_offset BIGINT NOT NULL,
+    size BIGINT NOT NULL,
+    created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (file_id, start_offset)
+);
+
+UPDATE files SET bytes_received = 0 WHERE bytes_received < size;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE legacy_upload_objects;
+DROP TABLE upload_chunks;
+CREATE TABLE upload_chunks (
+    hash TEXT NOT NULL,
+    start_offset BIGINT NOT NULL,
+    size BIGINT NOT NULL,
+    created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (hash, start_offset)
+);
+-- +goose StatementEnd
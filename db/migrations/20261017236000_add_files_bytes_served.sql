@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Download limits are metered in bytes: download_count is bytes_served / size, and a
+-- request is refused once it would take bytes_served past max_downloads * size.
+ALTER TABLE files ADD COLUMN bytes_served BIGINT NOT NULL DEFAULT 0;
+UPDATE files SET bytes_served = download_count::bigint * GREATEST(size, 1) WHERE download_count > 0;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE files DROP COLUMN bytes_served;
+-- +goose StatementEnd
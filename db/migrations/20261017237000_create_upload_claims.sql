@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Upload data is written by whichever request holds the claim on its storage key: a row
+-- the writer keeps extending while it streams, instead of an advisory lock (and so a
+-- connection) held for the whole write. A claim left by a crashed writer expires.
+CREATE TABLE upload_claims (
+    key TEXT PRIMARY KEY,
+    token TEXT NOT NULL,
+    expires_at TIMESTAMP WITHOUT TIME ZONE NOT NULL
+);
+
+-- Every parked chunk is stored under a key of its own, so resends never share one
+ALTER TABLE upload_chunks ADD COLUMN key TEXT;
+UPDATE upload_chunks SET key = 'partial-' || file_id || '.chunk-' || start_offset;
+ALTER TABLE upload_chunks ALTER COLUMN key SET NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE upload_claims;
+DELETE FROM upload_chunks WHERE key <> 'partial-' || file_id || '.chunk-' || start_offset;
+ALTER TABLE upload_chunks DROP COLUMN key;
+-- +goose StatementEnd
@@ -2,7 +2,9 @@ package config
 
 import (
 	"fmt"
+	"net/netip"
 	"os"
+	"time"
 
 	"github.com/caarlos0/env/v10"
 	"github.com/joho/godotenv"
@@ -15,23 +17,69 @@ type Config struct {
 	Host string `env:"HOST" envDefault:"0.0.0.0"`
 	Env  string `env:"ENV" envDefault:"development"`
 
+	// Reverse proxies (CIDR ranges) whose X-Forwarded-For header is believed when working out
+	// the client address for rate limits and the audit log
+	TrustedProxies []netip.Prefix `env:"TRUSTED_PROXIES" envDefault:"127.0.0.0/8,::1/128"`
+
 	// Database
 	DatabaseURL string `env:"DATABASE_URL,required"`
 
 	// Storage
-	FilesPath string `env:"FILES_PATH" envDefault:"./files"`
+	StorageBackend string `env:"STORAGE_BACKEND" envDefault:"disk"` // "disk" or "s3"
+	FilesPath      string `env:"FILES_PATH" envDefault:"./files"`
+
+	// S3-compatible object storage (used when STORAGE_BACKEND=s3)
+	S3Endpoint  string `env:"S3_ENDPOINT"`
+	S3Bucket    string `env:"S3_BUCKET"`
+	S3AccessKey string `env:"S3_ACCESS_KEY"`
+	S3SecretKey string `env:"S3_SECRET_KEY"`
+	S3Region    string `env:"S3_REGION"`
+	S3UseSSL    bool   `env:"S3_USE_SSL" envDefault:"true"`
+	S3Prefix    string `env:"S3_PREFIX"`
+	S3PartSize  int64  `env:"S3_PART_SIZE" envDefault:"8388608"`
 
 	// OAuth (Google)
 	GoogleClientID     string `env:"GOOGLE_CLIENT_ID"`
 	GoogleClientSecret string `env:"GOOGLE_CLIENT_SECRET"`
 	GoogleCallbackURL  string `env:"GOOGLE_CALLBACK_URL"`
 
+	// OAuth (GitHub)
+	GitHubClientID     string `env:"GITHUB_CLIENT_ID"`
+	GitHubClientSecret string `env:"GITHUB_CLIENT_SECRET"`
+	GitHubCallbackURL  string `env:"GITHUB_CALLBACK_URL"`
+
+	// OpenID Connect (any issuer that supports discovery)
+	OIDCIssuer       string `env:"OIDC_ISSUER"`
+	OIDCClientID     string `env:"OIDC_CLIENT_ID"`
+	OIDCClientSecret string `env:"OIDC_CLIENT_SECRET"`
+	OIDCCallbackURL  string `env:"OIDC_CALLBACK_URL"`
+	OIDCName         string `env:"OIDC_NAME" envDefault:"OpenID Connect"` // Shown on the login page
+
+	// Local accounts (email and password)
+	LocalLogin  bool `env:"LOCAL_LOGIN" envDefault:"false"`
+	LocalSignup bool `env:"LOCAL_SIGNUP" envDefault:"false"` // Anyone can create an account; needs LOCAL_LOGIN
+
 	// Session
 	SessionSecret string `env:"SESSION_SECRET,required"`
 
 	// Feature flags
 	EnableThumbnails bool `env:"ENABLE_THUMBNAILS" envDefault:"true"`
 	ThumbnailSize    int  `env:"THUMBNAIL_SIZE" envDefault:"256"`
+
+	// Background processing (thumbnails etc.). 0 workers = this process only enqueues jobs.
+	ProcessingWorkers      int           `env:"PROCESSING_WORKERS" envDefault:"2"`
+	ProcessingPollInterval time.Duration `env:"PROCESSING_POLL_INTERVAL" envDefault:"2s"`
+
+	// How often expired files and stale incomplete uploads are deleted. 0 disables the reaper in this process.
+	ReaperInterval time.Duration `env:"REAPER_INTERVAL" envDefault:"1m"`
+
+	// Prometheus /metrics: "admin" (signed-in admins or METRICS_TOKEN), "public" or "off"
+	MetricsAccess string `env:"METRICS_ACCESS" envDefault:"admin"`
+	MetricsToken  string `env:"METRICS_TOKEN"` // Bearer token for scrapers; optional
+
+	// OpenTelemetry tracing: "none", "otlp" (configured by the standard OTEL_EXPORTER_OTLP_* variables) or "stdout"
+	TracingExporter    string  `env:"TRACING_EXPORTER" envDefault:"none"`
+	TracingSampleRatio float64 `env:"TRACING_SAMPLE_RATIO" envDefault:"1"` // Fraction of new traces recorded
 }
 
 // Load loads configuration from environment variables
@@ -72,6 +120,48 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("PORT must be between 1 and 65535")
 	}
 
+	if c.ProcessingWorkers < 0 {
+		return fmt.Errorf("PROCESSING_WORKERS must not be negative")
+	}
+
+	if c.ReaperInterval < 0 {
+		return fmt.Errorf("REAPER_INTERVAL must not be negative")
+	}
+
+	switch c.MetricsAccess {
+	case "admin", "public", "off":
+	default:
+		return fmt.Errorf("METRICS_ACCESS must be \"admin\", \"public\" or \"off\"")
+	}
+
+	switch c.TracingExporter {
+	case "none", "otlp", "stdout":
+	default:
+		return fmt.Errorf("TRACING_EXPORTER must be \"none\", \"otlp\" or \"stdout\"")
+	}
+
+	if c.TracingSampleRatio < 0 || c.TracingSampleRatio > 1 {
+		return fmt.Errorf("TRACING_SAMPLE_RATIO must be between 0 and 1")
+	}
+
+	if c.OIDCIssuer != "" && (c.OIDCClientID == "" || c.OIDCCallbackURL == "") {
+		return fmt.Errorf("OIDC_CLIENT_ID and OIDC_CALLBACK_URL are required when OIDC_ISSUER is set")
+	}
+
+	if c.LocalSignup && !c.LocalLogin {
+		return fmt.Errorf("LOCAL_SIGNUP requires LOCAL_LOGIN")
+	}
+
+	switch c.StorageBackend {
+	case "disk":
+	case "s3":
+		if c.S3Endpoint == "" || c.S3Bucket == "" {
+			return fmt.Errorf("S3_ENDPOINT and S3_BUCKET are required when STORAGE_BACKEND=s3")
+		}
+	default:
+		return fmt.Errorf("STORAGE_BACKEND must be \"disk\" or \"s3\"")
+	}
+
 	return nil
 }
 
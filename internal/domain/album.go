@@ -0,0 +1,50 @@
+package domain
+
+import (
+	"time"
+)
+
+// Album is a named, ordered collection of one user's files, shared through its slug (domain model)
+type Album struct {
+	ID          int32
+	UserID      int32
+	Slug        string
+	Name        string
+	Description string
+	Private     bool
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+
+	// FileCount is every file in the album; only set when listing albums
+	FileCount int64
+	// Files are the album's files the viewer can open, in album order; only loaded for single-album lookups
+	Files []*File
+}
+
+// IsOwnedBy checks if the album belongs to the given user ID
+func (a *Album) IsOwnedBy(userID int32) bool {
+	return a.UserID == userID
+}
+
+// CanBeAccessedBy checks if a user can see the album. Public albums can be seen
+// by anyone; private albums only by their owner. Each file still has its own visibility.
+func (a *Album) CanBeAccessedBy(userID *int32) bool {
+	if !a.Private {
+		return true
+	}
+	return userID != nil && a.IsOwnedBy(*userID)
+}
+
+// CreateAlbumRequest represents a request to create an album
+type CreateAlbumRequest struct {
+	Name        string
+	Description string
+	Private     bool
+}
+
+// UpdateAlbumRequest represents a request to update an album; nil fields are left unchanged
+type UpdateAlbumRequest struct {
+	Name        *string
+	Description *string
+	Private     *bool
+}
@@ -0,0 +1,45 @@
+package domain
+
+import (
+	"slices"
+	"time"
+)
+
+// API token scopes
+const (
+	ScopeUpload = "upload"
+	ScopeRead   = "read"
+	ScopeDelete = "delete"
+)
+
+// APITokenScopes lists every scope a personal API token may be granted
+var APITokenScopes = []string{ScopeUpload, ScopeRead, ScopeDelete}
+
+// APIToken represents a personal API token (domain model). The plaintext token
+// is only ever shown once at creation; only its hash is stored.
+type APIToken struct {
+	ID         int32
+	UserID     int32
+	Name       string
+	Scopes     []string   // empty = all scopes
+	ExpiresAt  *time.Time // nil = never expires
+	LastUsedAt *time.Time
+	CreatedAt  time.Time
+}
+
+// HasScope returns true if the token grants the given scope
+func (t *APIToken) HasScope(scope string) bool {
+	return len(t.Scopes) == 0 || slices.Contains(t.Scopes, scope)
+}
+
+// IsExpired returns true if the token has an expiry that has passed
+func (t *APIToken) IsExpired(now time.Time) bool {
+	return t.ExpiresAt != nil && !now.Before(*t.ExpiresAt)
+}
+
+// CreateAPITokenRequest represents a request to mint a personal API token
+type CreateAPITokenRequest struct {
+	Name      string
+	Scopes    []string
+	ExpiresAt *time.Time
+}
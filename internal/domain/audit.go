@@ -0,0 +1,60 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Audit log actions
+const (
+	AuditUserRole         = "user.role"
+	AuditUserBan          = "user.ban"
+	AuditUserUnban        = "user.unban"
+	AuditUserMaxFileSize  = "user.max_file_size"
+	AuditUserStorageQuota = "user.storage_quota"
+	AuditUserProfile      = "user.profile"
+	AuditIdentityLink     = "identity.link"
+	AuditIdentityUnlink   = "identity.unlink"
+	AuditIdentityPassword = "identity.password"
+	AuditAPITokenCreate   = "api_token.create"
+	AuditAPITokenRevoke   = "api_token.revoke"
+	AuditSettingUpdate    = "setting.update"
+	AuditFileUpdate       = "file.update"
+	AuditFileDelete       = "file.delete"
+)
+
+// AuditActions lists every action the audit log records, for filtering
+var AuditActions = []string{
+	AuditUserRole, AuditUserBan, AuditUserUnban, AuditUserMaxFileSize, AuditUserStorageQuota,
+	AuditUserProfile, AuditIdentityLink, AuditIdentityUnlink, AuditIdentityPassword,
+	AuditAPITokenCreate, AuditAPITokenRevoke, AuditSettingUpdate, AuditFileUpdate, AuditFileDelete,
+}
+
+// Kinds of object an audit event targets
+const (
+	AuditTargetUser     = "user"
+	AuditTargetAPIToken = "api_token"
+	AuditTargetSetting  = "setting"
+	AuditTargetFile     = "file"
+)
+
+// AuditEvent is one entry of the append-only audit log
+type AuditEvent struct {
+	ID         int64
+	ActorID    *int32 // nil = the server itself or a maintenance command
+	Action     string
+	TargetType string
+	TargetID   string
+	Before     json.RawMessage // nil when there was no prior state
+	After      json.RawMessage // nil when the target was removed
+	IP         string
+	CreatedAt  time.Time
+}
+
+// AuditFilter narrows an audit log listing; zero fields match everything
+type AuditFilter struct {
+	ActorID    *int32
+	Action     string
+	TargetType string
+	TargetID   string
+}
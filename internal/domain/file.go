@@ -7,7 +7,7 @@ import (
 // File represents a file in the system (domain model)
 type File struct {
 	ID          int32
-	Size        int32
+	Size        int64
 	Name        string
 	Alias       string
 	Hash        string
@@ -19,9 +19,28 @@ type File struct {
 	Private     bool
 	Comment     string
 
+	// Self-destruct: the file is gone after ExpiresAt or once DownloadCount reaches MaxDownloads
+	ExpiresAt     *time.Time
+	MaxDownloads  *int32
+	DownloadCount int32
+
+	// PasswordHash is the bcrypt hash of the optional share password
+	PasswordHash *string
+
 	// Additional fields not in DB
-	BytesReceived int32
+	BytesReceived int64
 	Thumbnail     *Thumbnail
+	Processing    []*ProcessingJob // only loaded for single-file lookups
+
+	// ReceivedRanges is every range stored so far, including chunks that arrived ahead
+	// of BytesReceived. Only loaded for incomplete uploads looked up by hash.
+	ReceivedRanges []ByteRange
+}
+
+// ByteRange is the half-open byte range [Start, End)
+type ByteRange struct {
+	Start int64
+	End   int64
 }
 
 // Finished returns true if the file upload is complete
@@ -29,6 +48,14 @@ func (f *File) Finished() bool {
 	return f.Size == f.BytesReceived
 }
 
+// IsExpired returns true if the file has passed its expiry time or download limit
+func (f *File) IsExpired(now time.Time) bool {
+	if f.ExpiresAt != nil && !now.Before(*f.ExpiresAt) {
+		return true
+	}
+	return f.MaxDownloads != nil && f.DownloadCount >= *f.MaxDownloads
+}
+
 // IsOwnedBy checks if the file is owned by the given user ID
 func (f *File) IsOwnedBy(userID int32) bool {
 	return f.UserID != nil && *f.UserID == userID
@@ -54,6 +81,11 @@ func (f *File) CanBeAccessedBy(userID *int32) bool {
 	return f.IsOwnedBy(*userID)
 }
 
+// HasPassword returns true if the file is protected by a share password
+func (f *File) HasPassword() bool {
+	return f.PasswordHash != nil
+}
+
 // Thumbnail represents a thumbnail for a file
 type Thumbnail struct {
 	ID        int32
@@ -68,11 +100,14 @@ type Thumbnail struct {
 type CreateFileRequest struct {
 	Name        string
 	Hash        string
-	Size        int32
+	Size        int64
 	ContentType string
 	UserID      *int32
 	Private     bool
 	Comment     string
+
+	ExpiresAt    *time.Time // nil = site default TTL (if any)
+	MaxDownloads *int32     // nil = unlimited
 }
 
 // UpdateFileRequest represents a request to update a file
@@ -0,0 +1,32 @@
+package domain
+
+import (
+	"time"
+)
+
+// Login providers
+const (
+	ProviderGoogle = "google"
+	ProviderGitHub = "github"
+	ProviderOIDC   = "oidc"
+	ProviderLocal  = "local"
+)
+
+// Identity is a way of signing in linked to a user (domain model). A user can have
+// one identity per provider account; local identities are keyed by lowercased email.
+type Identity struct {
+	ID          int32
+	UserID      int32
+	Provider    string
+	ProviderID  string
+	Email       string
+	HasPassword bool // local identities only
+	CreatedAt   time.Time
+}
+
+// RegisterLocalRequest represents a request to create an email and password account
+type RegisterLocalRequest struct {
+	Name     string
+	Email    string
+	Password string
+}
@@ -0,0 +1,50 @@
+package domain
+
+// Permission is a named capability granted to users through their role
+type Permission string
+
+// Permissions checked by handlers and services
+const (
+	PermUploadFiles    Permission = "files.upload"    // upload and manage their own files
+	PermModerateFiles  Permission = "files.moderate"  // see, edit, hide and delete anyone's files
+	PermUnlimitedFiles Permission = "files.unlimited" // exempt from file size and storage limits
+	PermViewUsers      Permission = "users.view"      // list users and their files on /users
+	PermBanUsers       Permission = "users.ban"       // ban and unban users
+	PermManageUsers    Permission = "users.manage"    // roles, display tags and per-user limits
+	PermManageSettings Permission = "settings.manage" // site settings, storage scrubs and metrics
+	PermViewAudit      Permission = "audit.view"      // read the audit log
+)
+
+// Roles lists every role, most privileged first
+var Roles = []string{RoleAdmin, RoleModerator, RoleMember, RoleReadOnly}
+
+var rolePermissions = map[string][]Permission{
+	RoleAdmin: {
+		PermUploadFiles, PermModerateFiles, PermUnlimitedFiles, PermViewUsers, PermBanUsers,
+		PermManageUsers, PermManageSettings, PermViewAudit,
+	},
+	RoleModerator: {PermUploadFiles, PermModerateFiles, PermViewUsers, PermBanUsers},
+	RoleMember:    {PermUploadFiles},
+	RoleReadOnly:  {},
+}
+
+// ValidRole returns true if role is one of Roles
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// RoleCan returns true if role grants p. Unknown roles grant nothing.
+func RoleCan(role string, p Permission) bool {
+	for _, granted := range rolePermissions[role] {
+		if granted == p {
+			return true
+		}
+	}
+	return false
+}
+
+// RolePermissions returns the permissions role grants
+func RolePermissions(role string) []Permission {
+	return append([]Permission(nil), rolePermissions[role]...)
+}
@@ -0,0 +1,29 @@
+package domain
+
+import "time"
+
+// Processing job statuses
+const (
+	JobStatusPending   = "pending"
+	JobStatusRunning   = "running"
+	JobStatusSucceeded = "succeeded"
+	JobStatusFailed    = "failed" // gave up after MaxAttempts
+)
+
+// ProcessingJob is the state of one processor for one file (domain model)
+type ProcessingJob struct {
+	ID          int32
+	FileID      int32
+	Processor   string
+	Status      string
+	Attempts    int32
+	MaxAttempts int32
+	LastError   string
+	RunAt       time.Time // next attempt, while pending
+	UpdatedAt   time.Time
+}
+
+// Done returns true if the job will not run again
+func (j *ProcessingJob) Done() bool {
+	return j.Status == JobStatusSucceeded || j.Status == JobStatusFailed
+}
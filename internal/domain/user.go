@@ -4,30 +4,83 @@ import (
 	"time"
 )
 
+// User roles. RolePermissions lists what each grants.
+const (
+	RoleAdmin     = "admin"
+	RoleModerator = "moderator"
+	RoleMember    = "member" // uploads and manages their own files; the default
+	RoleReadOnly  = "readonly"
+)
+
 // User represents a user in the system (domain model)
 type User struct {
-	ID                  int32
-	Name                string
-	Email               string
-	Provider            string
-	ProviderID          string
-	Role                string
-	DisplayTag          string // 1-3 char tag for display; empty if not set
-	Colour              string // hex e.g. #RRGGBB; empty if not set
-	Banned              bool
-	MaxFileSizeOverride *int64 // bytes; nil = use site default. Admin-set only.
-	CreatedAt           time.Time
-	UpdatedAt           time.Time
+	ID                   int32
+	Name                 string
+	Email                string
+	Provider             string
+	ProviderID           string
+	Role                 string
+	DisplayTag           string // 1-3 char tag for display; empty if not set
+	Colour               string // hex e.g. #RRGGBB; empty if not set
+	Banned               bool
+	BanReason            string     // shown to the user; empty if none was given
+	BannedUntil          *time.Time // nil = banned until unbanned
+	BanHidesFiles        bool       // while banned, only moderators can see the user's files
+	MaxFileSizeOverride  *int64     // bytes; nil = use site default. Admin-set only.
+	StorageQuotaOverride *int64     // total bytes; nil = use site default. Admin-set only.
+	CreatedAt            time.Time
+	UpdatedAt            time.Time
 }
 
 // IsAdmin returns true if the user is an admin
 func (u *User) IsAdmin() bool {
-	return u.Role == "admin"
+	return u.Role == RoleAdmin
+}
+
+// Can returns true if the user's role grants p. A nil user (anonymous) has no permissions.
+func (u *User) Can(p Permission) bool {
+	return u != nil && RoleCan(u.Role, p)
+}
+
+// IsBanned returns true if the user is banned and the ban has not expired
+func (u *User) IsBanned(now time.Time) bool {
+	return u.Banned && (u.BannedUntil == nil || now.Before(*u.BannedUntil))
 }
 
 // IsMember returns true if the user is a regular member
 func (u *User) IsMember() bool {
-	return u.Role == "member"
+	return u.Role == RoleMember
+}
+
+// StorageUsage is a user's total stored bytes against their quota
+type StorageUsage struct {
+	Used  int64
+	Quota int64 // 0 = unlimited
+}
+
+// Unlimited returns true if the user has no storage quota
+func (u StorageUsage) Unlimited() bool {
+	return u.Quota <= 0
+}
+
+// Allows returns true if another size bytes fit within the quota
+func (u StorageUsage) Allows(size int64) bool {
+	return u.Unlimited() || u.Used+size <= u.Quota
+}
+
+// Percent returns usage as a whole percentage of the quota (0 when unlimited)
+func (u StorageUsage) Percent() int {
+	if u.Unlimited() {
+		return 0
+	}
+	return int(u.Used * 100 / u.Quota)
+}
+
+// BanRequest represents an admin's request to ban a user
+type BanRequest struct {
+	Reason    string
+	Until     *time.Time // nil = until unbanned
+	HideFiles bool
 }
 
 // CreateUserRequest represents a request to create a user
@@ -0,0 +1,278 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/zqz/web/backend/internal/domain"
+	"github.com/zqz/web/backend/internal/handler/auth"
+	"github.com/zqz/web/backend/internal/service"
+)
+
+// AlbumHandler handles album HTTP requests
+type AlbumHandler struct {
+	albumSvc *service.AlbumService
+	files    *FileHandler
+}
+
+// NewAlbumHandler creates a new album handler. Album ZIPs are streamed through files.
+func NewAlbumHandler(albumSvc *service.AlbumService, files *FileHandler) *AlbumHandler {
+	return &AlbumHandler{albumSvc: albumSvc, files: files}
+}
+
+// AlbumResponse represents an album in API responses. Files are only included for a
+// single album, and only those the caller can open.
+type AlbumResponse struct {
+	ID          int32          `json:"id"`
+	Slug        string         `json:"slug"`
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Private     bool           `json:"private"`
+	UserID      int32          `json:"user_id"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	FileCount   int64          `json:"file_count"`
+	URL         string         `json:"url"`
+	ZipURL      string         `json:"zip_url"`
+	CanEdit     bool           `json:"can_edit"`
+	Files       []FileResponse `json:"files,omitzero"`
+}
+
+func toAlbumResponse(a *domain.Album, userID *int32, moderator bool) AlbumResponse {
+	resp := AlbumResponse{
+		ID:          a.ID,
+		Slug:        a.Slug,
+		Name:        a.Name,
+		Description: a.Description,
+		Private:     a.Private,
+		UserID:      a.UserID,
+		CreatedAt:   a.CreatedAt,
+		UpdatedAt:   a.UpdatedAt,
+		FileCount:   a.FileCount,
+		URL:         "/albums/" + a.Slug,
+		ZipURL:      "/api/v1/albums/" + a.Slug + "/zip",
+		CanEdit:     moderator || (userID != nil && a.IsOwnedBy(*userID)),
+	}
+	if a.Files != nil {
+		resp.Files = make([]FileResponse, len(a.Files))
+		for i, f := range a.Files {
+			resp.Files[i] = toFileResponse(f)
+			resp.Files[i].CanEdit = canEditFile(f, userID, moderator)
+		}
+	}
+	return resp
+}
+
+// handleAlbumServiceError writes the appropriate HTTP error for album and file service errors.
+// Returns true if the error was handled, false otherwise.
+func handleAlbumServiceError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, service.ErrAlbumNotFound):
+		Error(w, http.StatusNotFound, err)
+	case errors.Is(err, service.ErrInvalidAlbumName), errors.Is(err, service.ErrAlbumDescriptionTooLong),
+		errors.Is(err, service.ErrInvalidAlbumOrder):
+		Error(w, http.StatusBadRequest, err)
+	default:
+		return handleFileServiceError(w, err)
+	}
+	return true
+}
+
+// CreateAlbumRequest is the JSON body for POST /albums
+type CreateAlbumRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Private     bool   `json:"private"`
+}
+
+// CreateAlbum creates an empty album owned by the caller
+func (h *AlbumHandler) CreateAlbum(w http.ResponseWriter, r *http.Request) {
+	var req CreateAlbumRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		Error(w, http.StatusBadRequest, err)
+		return
+	}
+	userID := auth.GetUserIDFromContext(r.Context())
+	user := auth.GetUserFromContext(r.Context())
+
+	album, err := h.albumSvc.CreateAlbum(r.Context(), *userID, domain.CreateAlbumRequest{
+		Name:        req.Name,
+		Description: req.Description,
+		Private:     req.Private,
+	})
+	if err != nil {
+		if handleAlbumServiceError(w, err) {
+			return
+		}
+		Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	JSON(w, http.StatusCreated, toAlbumResponse(album, userID, user.Can(domain.PermModerateFiles)))
+}
+
+// ListAlbums lists the caller's albums, newest first
+func (h *AlbumHandler) ListAlbums(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	user := auth.GetUserFromContext(r.Context())
+
+	albums, err := h.albumSvc.ListAlbums(r.Context(), *userID)
+	if err != nil {
+		Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	response := make([]AlbumResponse, len(albums))
+	for i, a := range albums {
+		response[i] = toAlbumResponse(a, userID, user.Can(domain.PermModerateFiles))
+	}
+	JSON(w, http.StatusOK, response)
+}
+
+// GetAlbum returns an album and the files in it the caller can open
+func (h *AlbumHandler) GetAlbum(w http.ResponseWriter, r *http.Request) {
+	slug := chi.URLParam(r, "slug")
+	userID := auth.GetUserIDFromContext(r.Context())
+	user := auth.GetUserFromContext(r.Context())
+	moderator := user.Can(domain.PermModerateFiles)
+
+	album, err := h.albumSvc.GetAlbum(r.Context(), slug, userID, moderator)
+	if err != nil {
+		if handleAlbumServiceError(w, err) {
+			return
+		}
+		Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	JSON(w, http.StatusOK, toAlbumResponse(album, userID, moderator))
+}
+
+// UpdateAlbumRequest is the JSON body for PUT /albums/{slug}; omitted fields are left unchanged
+type UpdateAlbumRequest struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	Private     *bool   `json:"private"`
+}
+
+// UpdateAlbum changes an album's name, description or visibility
+func (h *AlbumHandler) UpdateAlbum(w http.ResponseWriter, r *http.Request) {
+	slug := chi.URLParam(r, "slug")
+	var req UpdateAlbumRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		Error(w, http.StatusBadRequest, err)
+		return
+	}
+	userID := auth.GetUserIDFromContext(r.Context())
+	user := auth.GetUserFromContext(r.Context())
+	moderator := user.Can(domain.PermModerateFiles)
+
+	album, err := h.albumSvc.UpdateAlbum(r.Context(), slug, domain.UpdateAlbumRequest{
+		Name:        req.Name,
+		Description: req.Description,
+		Private:     req.Private,
+	}, userID, moderator)
+	if err != nil {
+		if handleAlbumServiceError(w, err) {
+			return
+		}
+		Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	JSON(w, http.StatusOK, toAlbumResponse(album, userID, moderator))
+}
+
+// DeleteAlbum deletes an album; its files are kept
+func (h *AlbumHandler) DeleteAlbum(w http.ResponseWriter, r *http.Request) {
+	slug := chi.URLParam(r, "slug")
+	userID := auth.GetUserIDFromContext(r.Context())
+	user := auth.GetUserFromContext(r.Context())
+
+	if err := h.albumSvc.DeleteAlbum(r.Context(), slug, userID, user.Can(domain.PermModerateFiles)); err != nil {
+		if handleAlbumServiceError(w, err) {
+			return
+		}
+		Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AlbumFilesRequest is the JSON body for adding files to an album (POST) or reordering it (PUT):
+// a list of file slugs
+type AlbumFilesRequest struct {
+	Files []string `json:"files"`
+}
+
+// AddAlbumFiles appends files to the end of an album
+func (h *AlbumHandler) AddAlbumFiles(w http.ResponseWriter, r *http.Request) {
+	h.changeFiles(w, r, h.albumSvc.AddFiles)
+}
+
+// ReorderAlbumFiles moves the listed files to the front of the album in the given order
+func (h *AlbumHandler) ReorderAlbumFiles(w http.ResponseWriter, r *http.Request) {
+	h.changeFiles(w, r, h.albumSvc.ReorderFiles)
+}
+
+type albumFilesChange func(ctx context.Context, slug string, fileSlugs []string, userID *int32, moderator bool) (*domain.Album, error)
+
+func (h *AlbumHandler) changeFiles(w http.ResponseWriter, r *http.Request, change albumFilesChange) {
+	slug := chi.URLParam(r, "slug")
+	var req AlbumFilesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		Error(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(req.Files) == 0 {
+		ErrorMessage(w, http.StatusBadRequest, "files must list at least one file slug")
+		return
+	}
+	userID := auth.GetUserIDFromContext(r.Context())
+	user := auth.GetUserFromContext(r.Context())
+	moderator := user.Can(domain.PermModerateFiles)
+
+	album, err := change(r.Context(), slug, req.Files, userID, moderator)
+	if err != nil {
+		if handleAlbumServiceError(w, err) {
+			return
+		}
+		Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	JSON(w, http.StatusOK, toAlbumResponse(album, userID, moderator))
+}
+
+// RemoveAlbumFile takes a file out of an album; the file itself is kept
+func (h *AlbumHandler) RemoveAlbumFile(w http.ResponseWriter, r *http.Request) {
+	slug := chi.URLParam(r, "slug")
+	fileSlug := chi.URLParam(r, "fileSlug")
+	userID := auth.GetUserIDFromContext(r.Context())
+	user := auth.GetUserFromContext(r.Context())
+
+	if err := h.albumSvc.RemoveFile(r.Context(), slug, fileSlug, userID, user.Can(domain.PermModerateFiles)); err != nil {
+		if handleAlbumServiceError(w, err) {
+			return
+		}
+		Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DownloadAlbum streams the album's files the caller can open as a ZIP archive
+func (h *AlbumHandler) DownloadAlbum(w http.ResponseWriter, r *http.Request) {
+	slug := chi.URLParam(r, "slug")
+	userID := auth.GetUserIDFromContext(r.Context())
+	user := auth.GetUserFromContext(r.Context())
+
+	album, err := h.albumSvc.GetAlbum(r.Context(), slug, userID, user.Can(domain.PermModerateFiles))
+	if err != nil {
+		if handleAlbumServiceError(w, err) {
+			return
+		}
+		Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	h.files.streamArchive(w, r, album.Name, archiveZip, album.Files)
+}
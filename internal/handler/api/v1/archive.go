@@ -0,0 +1,305 @@
+package v1
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zqz/web/backend/internal/domain"
+	"github.com/zqz/web/backend/internal/handler"
+	"github.com/zqz/web/backend/internal/handler/auth"
+	"github.com/zqz/web/backend/internal/service"
+)
+
+const (
+	contentTypeZip  = "application/zip"
+	contentTypeGzip = "application/gzip"
+)
+
+// maxArchiveFiles caps how many files one bulk download can hold
+const maxArchiveFiles = 500
+
+// isArchiveDownload reports whether r streams several files as one archive
+// (GET /albums/{slug}/zip, or GET or POST /archive)
+func isArchiveDownload(r *http.Request) bool {
+	switch {
+	case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/zip"):
+	case (r.Method == http.MethodGet || r.Method == http.MethodPost) && strings.HasSuffix(r.URL.Path, "/archive"):
+	default:
+		return false
+	}
+	return true
+}
+
+// archiveFormat is a kind of archive files can be streamed as
+type archiveFormat struct {
+	contentType string
+	ext         string
+	newWriter   func(w io.Writer) archiveWriter
+}
+
+var (
+	archiveZip   = archiveFormat{contentType: contentTypeZip, ext: ".zip", newWriter: newZipArchive}
+	archiveTarGz = archiveFormat{contentType: contentTypeGzip, ext: ".tar.gz", newWriter: newTarGzArchive}
+)
+
+// parseArchiveFormat maps a format parameter to an archive format: "zip" (the default
+// when empty) or "tar.gz" (also "tgz")
+func parseArchiveFormat(format string) (archiveFormat, bool) {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", "zip":
+		return archiveZip, true
+	case "tar.gz", "tgz":
+		return archiveTarGz, true
+	}
+	return archiveFormat{}, false
+}
+
+// archiveWriter writes files into an archive as they are streamed
+type archiveWriter interface {
+	add(name string, file *domain.File, data io.Reader) error
+	Close() error
+}
+
+// zipArchive stores files uncompressed: most uploads are media that doesn't compress,
+// and it keeps the archive cheap to stream.
+type zipArchive struct {
+	zw *zip.Writer
+}
+
+func newZipArchive(w io.Writer) archiveWriter {
+	return &zipArchive{zw: zip.NewWriter(w)}
+}
+
+func (a *zipArchive) add(name string, file *domain.File, data io.Reader) error {
+	entry, err := a.zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Store,
+		Modified: file.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, data)
+	return err
+}
+
+func (a *zipArchive) Close() error {
+	return a.zw.Close()
+}
+
+// tarGzArchive is a gzipped tar. Each entry's size comes from the file record, so the
+// tar writer fails the download if the stored data turns out shorter or longer.
+type tarGzArchive struct {
+	gz *gzip.Writer
+	tw *tar.Writer
+}
+
+func newTarGzArchive(w io.Writer) archiveWriter {
+	gz := gzip.NewWriter(w)
+	return &tarGzArchive{gz: gz, tw: tar.NewWriter(gz)}
+}
+
+func (a *tarGzArchive) add(name string, file *domain.File, data io.Reader) error {
+	err := a.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0o644,
+		Size:     file.Size,
+		ModTime:  file.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(a.tw, data)
+	return err
+}
+
+func (a *tarGzArchive) Close() error {
+	if err := a.tw.Close(); err != nil {
+		return err
+	}
+	return a.gz.Close()
+}
+
+// archiveNamer hands out unique entry names within one archive. Names that differ only
+// in case count as the same, so archives extract cleanly on case-insensitive filesystems.
+type archiveNamer map[string]bool
+
+// name returns filename made safe for an archive entry, with " (2)", " (3)", ... before
+// the extension if an earlier entry already took it
+func (n archiveNamer) name(filename string) string {
+	name := sanitizeContentDispositionFilename(filename)
+	if name == "." || name == ".." {
+		name = "download"
+	}
+	ext := path.Ext(name)
+	if ext == name {
+		ext = "" // dotfiles like ".env" have no extension to keep
+	}
+	base := strings.TrimSuffix(name, ext)
+	for i := 2; n[strings.ToLower(name)]; i++ {
+		name = base + " (" + strconv.Itoa(i) + ")" + ext
+	}
+	n[strings.ToLower(name)] = true
+	return name
+}
+
+// DownloadArchive streams several files as one ZIP or tar.gz archive (GET or POST /archive).
+// The files are given as slug parameters, repeated or comma-separated, or as a search
+// query q over the files the caller can see. format is "zip" (the default) or "tar.gz".
+// Files the caller can't see are left out; if that leaves none the response is 404.
+func (h *FileHandler) DownloadArchive(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		Error(w, http.StatusBadRequest, err)
+		return
+	}
+	format, ok := parseArchiveFormat(r.Form.Get("format"))
+	if !ok {
+		ErrorMessage(w, http.StatusBadRequest, `format must be "zip" or "tar.gz"`)
+		return
+	}
+	slugs := archiveSlugs(r.Form["slug"])
+	search := strings.TrimSpace(r.Form.Get("q"))
+	userID := auth.GetUserIDFromContext(r.Context())
+	user := auth.GetUserFromContext(r.Context())
+	moderator := user.Can(domain.PermModerateFiles)
+
+	var files []*domain.File
+	var err error
+	switch {
+	case len(slugs) > 0 && search != "":
+		ErrorMessage(w, http.StatusBadRequest, "give either slug or q, not both")
+		return
+	case len(slugs) > maxArchiveFiles:
+		ErrorMessage(w, http.StatusBadRequest, "too many files; at most "+strconv.Itoa(maxArchiveFiles)+" per archive")
+		return
+	case len(slugs) > 0:
+		files, err = h.archiveFilesBySlug(r.Context(), slugs, userID, moderator)
+	case search != "":
+		files, err = h.fileSvc.ListFiles(r.Context(), maxArchiveFiles, 0, userID, moderator, search)
+	default:
+		ErrorMessage(w, http.StatusBadRequest, "slug or q parameter is required")
+		return
+	}
+	if err != nil {
+		Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	if len(files) == 0 {
+		ErrorMessage(w, http.StatusNotFound, "no files to download")
+		return
+	}
+	h.streamArchive(w, r, "files", format, files)
+}
+
+// archiveSlugs splits comma-separated slug parameters and drops blanks and repeats
+func archiveSlugs(params []string) []string {
+	var slugs []string
+	seen := make(map[string]bool)
+	for _, param := range params {
+		for slug := range strings.SplitSeq(param, ",") {
+			slug = strings.TrimSpace(slug)
+			if slug == "" || seen[slug] {
+				continue
+			}
+			seen[slug] = true
+			slugs = append(slugs, slug)
+		}
+	}
+	return slugs
+}
+
+// archiveFilesBySlug looks up the files for an archive in the order given, leaving out
+// those the caller can't see
+func (h *FileHandler) archiveFilesBySlug(ctx context.Context, slugs []string, userID *int32, moderator bool) ([]*domain.File, error) {
+	files := make([]*domain.File, 0, len(slugs))
+	for _, slug := range slugs {
+		file, err := h.fileSvc.GetFileBySlug(ctx, slug, userID, moderator)
+		if err != nil {
+			if skippedInArchive(err) {
+				continue
+			}
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// streamArchive streams files as an archive called name plus the format's extension.
+// Each file is opened again as it is reached, so access is checked then and the file
+// counts as downloaded. Files the caller would have to unlock with a password, and
+// files that have gone, expired or reached their download limit since they were listed,
+// are left out. Once the response has started, a failure aborts the connection so the
+// client sees a broken download rather than a short archive.
+func (h *FileHandler) streamArchive(w http.ResponseWriter, r *http.Request, name string, format archiveFormat, files []*domain.File) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	user := auth.GetUserFromContext(r.Context())
+	moderator := user.Can(domain.PermModerateFiles)
+
+	// An archive is built on the fly and can't be resumed, so lift the server's write timeout
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	handler.SetContentType(w, format.contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+sanitizeContentDispositionFilename(name+format.ext)+`"`)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	archive := format.newWriter(w)
+	names := archiveNamer{}
+	for _, f := range files {
+		if !h.unlocked(r, f, userID, moderator) {
+			continue
+		}
+		reader, file, err := h.openArchived(r, f.Slug, userID, moderator)
+		if err != nil {
+			panic(http.ErrAbortHandler)
+		}
+		if reader == nil {
+			continue
+		}
+		err = archive.add(names.name(file.Name), file, reader)
+		reader.Close()
+		if err != nil {
+			panic(http.ErrAbortHandler)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// openArchived opens a file for an archive and records the download. It returns a nil
+// reader, and no error, for files that should be skipped.
+func (h *FileHandler) openArchived(r *http.Request, slug string, userID *int32, moderator bool) (io.ReadSeekCloser, *domain.File, error) {
+	reader, file, err := h.fileSvc.DownloadFile(r.Context(), slug, userID, moderator)
+	if err != nil {
+		if skippedInArchive(err) {
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+	if err := h.fileSvc.RecordDownload(r.Context(), file, file.Size); err != nil {
+		reader.Close()
+		if skippedInArchive(err) {
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+	return reader, file, nil
+}
+
+// skippedInArchive reports whether err means a file can't be included any more, rather than a failure
+func skippedInArchive(err error) bool {
+	return errors.Is(err, service.ErrFileNotFound) || errors.Is(err, service.ErrUnauthorized) ||
+		errors.Is(err, service.ErrFileExpired) || errors.Is(err, service.ErrFileIncomplete)
+}
@@ -0,0 +1,108 @@
+package v1
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zqz/web/backend/internal/domain"
+)
+
+func TestArchiveNamer(t *testing.T) {
+	names := archiveNamer{}
+
+	assert.Equal(t, "photo.jpg", names.name("photo.jpg"))
+	assert.Equal(t, "photo (2).jpg", names.name("photo.jpg"))
+	assert.Equal(t, "Photo (3).JPG", names.name("Photo.JPG"), "names differing only in case collide")
+	assert.Equal(t, "photo (2) (2).jpg", names.name("photo (2).jpg"))
+	assert.Equal(t, ".env", names.name(".env"))
+	assert.Equal(t, ".env (2)", names.name(".env"))
+	assert.Equal(t, "download", names.name(".."))
+	assert.NotContains(t, names.name("../../etc/passwd"), "/")
+}
+
+func TestArchiveSlugs(t *testing.T) {
+	assert.Equal(t, []string{"a", "b", "c"}, archiveSlugs([]string{"a,b", " c ", "a", ""}))
+	assert.Empty(t, archiveSlugs(nil))
+}
+
+func TestParseArchiveFormat(t *testing.T) {
+	for format, want := range map[string]string{"": contentTypeZip, "zip": contentTypeZip, "TAR.GZ": contentTypeGzip, "tgz": contentTypeGzip} {
+		got, ok := parseArchiveFormat(format)
+		require.True(t, ok, format)
+		assert.Equal(t, want, got.contentType, format)
+	}
+	_, ok := parseArchiveFormat("rar")
+	assert.False(t, ok)
+}
+
+func TestFileHandlerDownloadArchive(t *testing.T) {
+	ctx := context.Background()
+	r, fileSvc, cleanup := setupFileHandlerTest(t, ctx)
+	defer cleanup()
+
+	upload := func(name, content string) string {
+		sum := sha256.Sum256([]byte(content))
+		hash := fmt.Sprintf("%x", sum[:])
+		_, err := fileSvc.CreateFile(ctx, domain.CreateFileRequest{
+			Name: name, Hash: hash, Size: int64(len(content)), ContentType: contentTypePlain,
+		}, 0)
+		require.NoError(t, err)
+		file, err := fileSvc.UploadFileData(ctx, hash, strings.NewReader(content), 0, nil)
+		require.NoError(t, err)
+		return file.Slug
+	}
+	first := upload("same.txt", "first")
+	second := upload("same.txt", "second")
+
+	// tar.gz by slug: unknown slugs are left out and repeated names are numbered
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/archive?format=tar.gz&slug="+first+",nope&slug="+second, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, contentTypeGzip, rec.Header().Get(headerContentType))
+	gz, err := gzip.NewReader(rec.Body)
+	require.NoError(t, err)
+	tr := tar.NewReader(gz)
+	got := map[string]string{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		data, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		got[hdr.Name] = string(data)
+	}
+	assert.Equal(t, map[string]string{"same.txt": "first", "same (2).txt": "second"}, got)
+
+	// ZIP of a search, posted as a form
+	form := url.Values{"q": {"same"}}
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/archive", strings.NewReader(form.Encode()))
+	req.Header.Set(headerContentType, "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	require.NoError(t, err)
+	assert.Len(t, zr.File, 2)
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/archive?slug=nope", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/archive?format=rar&slug="+first, nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
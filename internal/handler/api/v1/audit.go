@@ -0,0 +1,90 @@
+package v1
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/zqz/web/backend/internal/domain"
+	"github.com/zqz/web/backend/internal/service"
+)
+
+// AuditHandler serves the audit log (admin only)
+type AuditHandler struct {
+	auditSvc *service.AuditService
+}
+
+// NewAuditHandler creates a new audit handler
+func NewAuditHandler(auditSvc *service.AuditService) *AuditHandler {
+	return &AuditHandler{auditSvc: auditSvc}
+}
+
+// AuditEventResponse represents an audit event in API responses
+type AuditEventResponse struct {
+	ID         int64           `json:"id"`
+	ActorID    *int32          `json:"actor_id"` // null = the server itself or a maintenance command
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type"`
+	TargetID   string          `json:"target_id"`
+	Before     json.RawMessage `json:"before"`
+	After      json.RawMessage `json:"after"`
+	IP         string          `json:"ip,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// AuditListResponse is a page of audit events with the number of matching events
+type AuditListResponse struct {
+	Events []AuditEventResponse `json:"events"`
+	Total  int64                `json:"total"`
+	Limit  int32                `json:"limit"`
+	Offset int32                `json:"offset"`
+}
+
+// ListEvents returns audit events, newest first, filtered by the actor_id, action,
+// target_type and target_id query parameters and paged with limit and offset
+func (h *AuditHandler) ListEvents(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := domain.AuditFilter{
+		Action:     q.Get("action"),
+		TargetType: q.Get("target_type"),
+		TargetID:   q.Get("target_id"),
+	}
+	if s := q.Get("actor_id"); s != "" {
+		id, err := strconv.ParseInt(s, 10, 32)
+		if err != nil {
+			ErrorMessage(w, http.StatusBadRequest, "invalid actor_id")
+			return
+		}
+		actorID := int32(id)
+		filter.ActorID = &actorID
+	}
+	limit, offset := parseListParams(r, 50)
+
+	events, total, err := h.auditSvc.ListEvents(r.Context(), filter, limit, offset)
+	if err != nil {
+		Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	response := AuditListResponse{
+		Events: make([]AuditEventResponse, len(events)),
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+	}
+	for i, e := range events {
+		response.Events[i] = AuditEventResponse{
+			ID:         e.ID,
+			ActorID:    e.ActorID,
+			Action:     e.Action,
+			TargetType: e.TargetType,
+			TargetID:   e.TargetID,
+			Before:     e.Before,
+			After:      e.After,
+			IP:         e.IP,
+			CreatedAt:  e.CreatedAt,
+		}
+	}
+	JSON(w, http.StatusOK, response)
+}
@@ -1,6 +1,7 @@
 package v1
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"io"
@@ -19,6 +20,13 @@ import (
 
 const maxListLimit = 2000
 
+const (
+	// filePasswordHeader carries a file's share password on API downloads
+	filePasswordHeader = "X-File-Password"
+	// unlockCookiePrefix + slug names the cookie set after a successful unlock
+	unlockCookiePrefix = "file_unlock_"
+)
+
 // FileHandler handles file-related HTTP requests
 type FileHandler struct {
 	fileSvc *service.FileService
@@ -35,17 +43,45 @@ type FileResponse struct {
 	Name          string    `json:"name"`
 	Hash          string    `json:"hash"`
 	Slug          string    `json:"slug"`
-	Size          int32     `json:"size"`
+	Size          int64     `json:"size"`
 	ContentType   string    `json:"content_type"`
 	CreatedAt     time.Time `json:"created_at"`
 	UpdatedAt     time.Time `json:"updated_at"`
-	BytesReceived int32     `json:"bytes_received"`
+	BytesReceived int64     `json:"bytes_received"`
 	Private       bool      `json:"private"`
 	Comment       string    `json:"comment,omitempty"`
 	UserID        *int32    `json:"user_id,omitempty"`
 	ViewURL       string    `json:"view_url,omitempty"`
 	DownloadURL   string    `json:"download_url"`
+	ThumbnailURL  string    `json:"thumbnail_url,omitempty"`
 	CanEdit       bool      `json:"can_edit"`
+
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	MaxDownloads  *int32     `json:"max_downloads,omitempty"`
+	DownloadCount int32      `json:"download_count"`
+
+	PasswordProtected bool `json:"password_protected"`
+
+	Processing []ProcessingResponse `json:"processing,omitempty"`
+
+	// ReceivedRanges lists stored byte ranges while a chunked upload is incomplete
+	ReceivedRanges []ByteRangeResponse `json:"received_ranges,omitempty"`
+}
+
+// ByteRangeResponse is a received byte range; end is exclusive
+type ByteRangeResponse struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+}
+
+// ProcessingResponse is the state of one processor (e.g. thumbnail) for a file
+type ProcessingResponse struct {
+	Processor string    `json:"processor"`
+	Status    string    `json:"status"`
+	Attempts  int32     `json:"attempts"`
+	LastError string    `json:"last_error,omitempty"`
+	NextRunAt time.Time `json:"next_run_at,omitzero"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 // toFileResponse converts a domain file to API response
@@ -64,19 +100,45 @@ func toFileResponse(f *domain.File) FileResponse {
 		Comment:       f.Comment,
 		UserID:        f.UserID,
 		DownloadURL:   "/api/v1/files/" + f.Slug,
+		ExpiresAt:     f.ExpiresAt,
+		MaxDownloads:  f.MaxDownloads,
+		DownloadCount: f.DownloadCount,
+
+		PasswordProtected: f.HasPassword(),
 	}
 
 	// Only add view URL for images
 	if strings.HasPrefix(f.ContentType, "image/") {
 		resp.ViewURL = "/api/v1/files/" + f.Slug + "/view"
 	}
+	if f.Thumbnail != nil {
+		resp.ThumbnailURL = "/api/v1/files/" + f.Slug + "/thumbnail"
+	}
+
+	for _, j := range f.Processing {
+		p := ProcessingResponse{
+			Processor: j.Processor,
+			Status:    j.Status,
+			Attempts:  j.Attempts,
+			LastError: j.LastError,
+			UpdatedAt: j.UpdatedAt,
+		}
+		if j.Status == domain.JobStatusPending {
+			p.NextRunAt = j.RunAt
+		}
+		resp.Processing = append(resp.Processing, p)
+	}
+
+	for _, r := range f.ReceivedRanges {
+		resp.ReceivedRanges = append(resp.ReceivedRanges, ByteRangeResponse{Start: r.Start, End: r.End})
+	}
 
 	return resp
 }
 
-func canEditFile(f *domain.File, userID *int32, isAdmin bool) bool {
-	if isAdmin || userID == nil || f.UserID == nil {
-		return isAdmin
+func canEditFile(f *domain.File, userID *int32, moderator bool) bool {
+	if moderator || userID == nil || f.UserID == nil {
+		return moderator
 	}
 	return *userID == *f.UserID
 }
@@ -106,12 +168,29 @@ func sanitizeContentDispositionFilename(name string) string {
 // Returns true if the error was handled (caller should return), false otherwise.
 func handleFileServiceError(w http.ResponseWriter, err error) bool {
 	switch {
-	case errors.Is(err, service.ErrFileNotFound):
+	case errors.Is(err, service.ErrFileNotFound), errors.Is(err, service.ErrNoThumbnail):
 		Error(w, http.StatusNotFound, err)
 	case errors.Is(err, service.ErrUnauthorized):
 		Error(w, http.StatusForbidden, err)
+	case errors.Is(err, service.ErrUserBanned):
+		ErrorWithCode(w, http.StatusForbidden, err, "user_banned")
+	case errors.Is(err, service.ErrPermissionDenied):
+		ErrorWithCode(w, http.StatusForbidden, err, "permission_denied")
 	case errors.Is(err, service.ErrFileIncomplete):
 		Error(w, http.StatusConflict, err)
+	case errors.Is(err, service.ErrFileExpired):
+		Error(w, http.StatusGone, err)
+	case errors.Is(err, service.ErrInvalidSignature):
+		Error(w, http.StatusForbidden, err)
+	case errors.Is(err, service.ErrSignedURLExpired):
+		Error(w, http.StatusGone, err)
+	case errors.Is(err, service.ErrInvalidExpiry), errors.Is(err, service.ErrPasswordTooLong), errors.Is(err, service.ErrInvalidSignedURLTTL):
+		Error(w, http.StatusBadRequest, err)
+	case errors.Is(err, service.ErrPasswordRequired), errors.Is(err, service.ErrWrongPassword):
+		Error(w, http.StatusUnauthorized, err)
+	case errors.Is(err, service.ErrTooManyPasswordAttempts):
+		w.Header().Set("Retry-After", "60")
+		Error(w, http.StatusTooManyRequests, err)
 	default:
 		return false
 	}
@@ -124,12 +203,23 @@ func handleCreateFileError(w http.ResponseWriter, err error) bool {
 	switch {
 	case errors.Is(err, service.ErrPublicUploadsDisabled):
 		ErrorMessage(w, http.StatusForbidden, "public uploads are disabled")
+	case errors.Is(err, service.ErrUserBanned):
+		ErrorWithCode(w, http.StatusForbidden, err, "user_banned")
+	case errors.Is(err, service.ErrPermissionDenied):
+		ErrorWithCode(w, http.StatusForbidden, err, "permission_denied")
 	case errors.Is(err, service.ErrFileTooLarge):
 		ErrorMessage(w, http.StatusRequestEntityTooLarge, "file exceeds maximum allowed size")
+	case errors.Is(err, service.ErrStorageQuotaExceeded):
+		ErrorMessage(w, http.StatusInsufficientStorage, "storage quota exceeded")
 	case errors.Is(err, service.ErrInvalidHash):
 		ErrorMessage(w, http.StatusBadRequest, "hash must be a 64-character SHA-256 hex string")
-	case errors.Is(err, service.ErrNameTooLong), errors.Is(err, service.ErrContentTypeTooLong):
+	case errors.Is(err, service.ErrNameTooLong), errors.Is(err, service.ErrContentTypeTooLong), errors.Is(err, service.ErrInvalidExpiry),
+		errors.Is(err, service.ErrIncompleteChunk):
 		ErrorMessage(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrInvalidChunk):
+		ErrorMessage(w, http.StatusRequestedRangeNotSatisfiable, err.Error())
+	case errors.Is(err, service.ErrChunkOverlap), errors.Is(err, service.ErrUploadInProgress):
+		ErrorMessage(w, http.StatusConflict, err.Error())
 	default:
 		return false
 	}
@@ -137,18 +227,244 @@ func handleCreateFileError(w http.ResponseWriter, err error) bool {
 }
 
 // streamFileWithHeaders sets response headers and streams the file body. disposition is "inline" or "attachment".
-func streamFileWithHeaders(w http.ResponseWriter, r *http.Request, reader io.Reader, file *domain.File, disposition string) {
+// Byte ranges (single and multi-range), If-Range and If-None-Match are handled by http.ServeContent,
+// with the quoted SHA-256 hash as a strong ETag.
+func streamFileWithHeaders(w http.ResponseWriter, r *http.Request, reader io.ReadSeeker, file *domain.File, disposition string) {
 	safeName := sanitizeContentDispositionFilename(file.Name)
 	handler.SetContentType(w, file.ContentType)
-	w.Header().Set("Content-Length", strconv.Itoa(int(file.Size)))
 	w.Header().Set("Content-Disposition", disposition+`; filename="`+safeName+`"`)
-	w.Header().Set("ETag", file.Hash)
+	w.Header().Set("ETag", `"`+file.Hash+`"`)
 	w.Header().Set("Cache-Control", "no-cache")
-	if match := r.Header.Get("If-None-Match"); match == file.Hash {
-		w.WriteHeader(http.StatusNotModified)
+	w.Header().Set("Accept-Ranges", "bytes")
+	http.ServeContent(w, r, "", time.Time{}, reader)
+}
+
+// downloadBytes returns how many bytes of file a request will be sent, which is what it's
+// charged against the file's download limit, and false for requests that get no content:
+// HEAD, revalidations that will get a 304, and ranges that can't be satisfied. Charging
+// by bytes lets a resume or a media player's seeks add up to one download, while ranges
+// that skip the first byte can't fetch the file for free.
+func downloadBytes(r *http.Request, file *domain.File) (int64, bool) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		return 0, false
+	}
+	if strings.Contains(r.Header.Get("If-None-Match"), `"`+file.Hash+`"`) {
+		return 0, false
+	}
+	rng := r.Header.Get("Range")
+	if rng == "" || file.Size == 0 {
+		return file.Size, true // ServeContent ignores ranges on empty files
+	}
+	if ir := r.Header.Get("If-Range"); ir != "" && ir != `"`+file.Hash+`"` {
+		return file.Size, true // Range is ignored and the whole file is sent
+	}
+	n := rangeBytes(rng, file.Size)
+	return n, n > 0
+}
+
+// sendsWholeFile reports whether a request without a Range header will be answered with
+// the file's content, rather than only headers (HEAD, 304 Not Modified, 412 Precondition Failed)
+func sendsWholeFile(r *http.Request, file *domain.File) bool {
+	if im := r.Header.Get("If-Match"); im != "" && im != "*" && !strings.Contains(im, `"`+file.Hash+`"`) {
+		return false
+	}
+	_, ok := downloadBytes(r, file)
+	return ok
+}
+
+// rangeBytes returns how many bytes of a size-byte file http.ServeContent sends for a Range
+// header: the satisfiable ranges added up, or the whole file when they come to more than it.
+// Headers that don't parse are charged as the whole file; serveDownload refunds what isn't sent.
+func rangeBytes(rng string, size int64) int64 {
+	specs, ok := strings.CutPrefix(rng, "bytes=")
+	if !ok {
+		return size
+	}
+	var total int64
+	for _, spec := range strings.Split(specs, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		first, last, ok := strings.Cut(spec, "-")
+		if !ok {
+			return size
+		}
+		first, last = strings.TrimSpace(first), strings.TrimSpace(last)
+		if first == "" {
+			n, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || n < 0 {
+				return size
+			}
+			total += min(n, size)
+			continue
+		}
+		start, err := strconv.ParseInt(first, 10, 64)
+		if err != nil || start < 0 {
+			return size
+		}
+		if start >= size {
+			continue // Not satisfiable; ServeContent skips it
+		}
+		end := size - 1
+		if last != "" {
+			if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+				return size
+			}
+			end = min(end, size-1)
+		}
+		total += end - start + 1
+	}
+	return min(total, size)
+}
+
+// serveDownload charges the request's bytes against the file's download limit, streams the
+// file, and refunds whatever the client didn't stay to receive
+func (h *FileHandler) serveDownload(w http.ResponseWriter, r *http.Request, reader io.ReadSeeker, file *domain.File, disposition string) {
+	n, counts := downloadBytes(r, file)
+	if !counts {
+		streamFileWithHeaders(w, r, reader, file, disposition)
+		return
+	}
+	if err := h.fileSvc.RecordDownload(r.Context(), file, n); err != nil {
+		if handleFileServiceError(w, err) {
+			return
+		}
+		Error(w, http.StatusInternalServerError, err)
 		return
 	}
-	io.Copy(w, reader)
+	cw := &countingWriter{ResponseWriter: w}
+	streamFileWithHeaders(cw, r, reader, file, disposition)
+	if cw.n < n {
+		// Best effort: if this fails the client stays charged for bytes it never got
+		_ = h.fileSvc.RefundDownload(context.WithoutCancel(r.Context()), file, n-cw.n)
+	}
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	http.ResponseWriter
+	n int64
+}
+
+func (cw *countingWriter) Write(b []byte) (int, error) {
+	n, err := cw.ResponseWriter.Write(b)
+	cw.n += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (cw *countingWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// checkFilePassword lets the request through if the caller doesn't need the file's share
+// password or has already unlocked it. Otherwise it tries a password from the X-File-Password
+// header or, on POST, a "password" form field, and sets the unlock cookie when it matches.
+// Returns false after writing an error response.
+func (h *FileHandler) checkFilePassword(w http.ResponseWriter, r *http.Request, file *domain.File, userID *int32, moderator bool) bool {
+	if h.unlocked(r, file, userID, moderator) {
+		return true
+	}
+
+	password := r.Header.Get(filePasswordHeader)
+	if password == "" && r.Method == http.MethodPost {
+		password = r.PostFormValue("password")
+	}
+	if password == "" {
+		Error(w, http.StatusUnauthorized, service.ErrPasswordRequired)
+		return false
+	}
+	if err := h.unlock(w, r, file, password); err != nil {
+		if !handleFileServiceError(w, err) {
+			Error(w, http.StatusInternalServerError, err)
+		}
+		return false
+	}
+	return true
+}
+
+// unlocked reports whether the caller can open file without giving its share password:
+// they don't need it, or they hold a valid unlock cookie for it
+func (h *FileHandler) unlocked(r *http.Request, file *domain.File, userID *int32, moderator bool) bool {
+	if !h.fileSvc.NeedsPassword(file, userID, moderator) {
+		return true
+	}
+	c, err := r.Cookie(unlockCookiePrefix + file.Slug)
+	return err == nil && h.fileSvc.ValidUnlockToken(file, c.Value)
+}
+
+// unlock checks password and sets a short-lived cookie scoped to the file's slug
+func (h *FileHandler) unlock(w http.ResponseWriter, r *http.Request, file *domain.File, password string) error {
+	token, expires, err := h.fileSvc.UnlockFile(r.Context(), file, password)
+	if err != nil {
+		return err
+	}
+	if token == "" {
+		return nil
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     unlockCookiePrefix + file.Slug,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// openDownload opens a file for ViewFile and DownloadFile. A signed URL (sig, expires and
+// optional nonce query parameters) stands in for the session; otherwise the caller needs
+// access to the file and, if it has one, its share password. With inline set, only images
+// are served, and a single-use link isn't spent on anything else. Returns false after writing an error response.
+func (h *FileHandler) openDownload(w http.ResponseWriter, r *http.Request, slug string, inline bool) (io.ReadSeekCloser, *domain.File, bool) {
+	var (
+		reader io.ReadSeekCloser
+		file   *domain.File
+		err    error
+	)
+	sig, signed := service.ParseDownloadSignature(r.URL.Query())
+	if signed {
+		reader, file, err = h.fileSvc.DownloadFileSigned(r.Context(), slug, sig)
+	} else {
+		userID := auth.GetUserIDFromContext(r.Context())
+		user := auth.GetUserFromContext(r.Context())
+		moderator := user.Can(domain.PermModerateFiles)
+		reader, file, err = h.fileSvc.DownloadFile(r.Context(), slug, userID, moderator)
+		if err == nil && !h.checkFilePassword(w, r, file, userID, moderator) {
+			reader.Close()
+			return nil, nil, false
+		}
+	}
+	if err != nil {
+		if !handleFileServiceError(w, err) {
+			Error(w, http.StatusInternalServerError, err)
+		}
+		return nil, nil, false
+	}
+	if inline && !strings.HasPrefix(file.ContentType, "image/") {
+		reader.Close()
+		ErrorMessage(w, http.StatusBadRequest, "only images can be viewed inline")
+		return nil, nil, false
+	}
+	if signed && sig.SingleUse() {
+		// A single-use link is spent by the response that sends the file. It ignores
+		// Range so the file can't be read piece by piece; HEAD requests and
+		// revalidations that get no body leave it unspent.
+		r.Header.Del("Range")
+		if sendsWholeFile(r, file) {
+			if err := h.fileSvc.UseSignedURL(r.Context(), sig); err != nil {
+				reader.Close()
+				if !handleFileServiceError(w, err) {
+					Error(w, http.StatusInternalServerError, err)
+				}
+				return nil, nil, false
+			}
+		}
+	}
+	return reader, file, true
 }
 
 // parseListParams reads limit and offset from request query. defaultLimit is used when limit is missing or invalid.
@@ -172,11 +488,15 @@ func parseListParams(r *http.Request, defaultLimit int32) (limit, offset int32)
 
 // CreateFileRequest represents a file creation request.
 // Private, comment, user_id, and slug are never taken from the body; they come from settings and auth.
+// Expiry is either an absolute expires_at or expires_in seconds from now, not both.
 type CreateFileRequest struct {
-	Name        string `json:"name"`
-	Hash        string `json:"hash"`
-	Size        int32  `json:"size"`
-	ContentType string `json:"content_type"`
+	Name         string     `json:"name"`
+	Hash         string     `json:"hash"`
+	Size         int64      `json:"size"`
+	ContentType  string     `json:"content_type"`
+	ExpiresAt    *time.Time `json:"expires_at"`
+	ExpiresIn    int64      `json:"expires_in"`
+	MaxDownloads *int32     `json:"max_downloads"`
 }
 
 // CreateFile creates file metadata
@@ -187,24 +507,36 @@ func (h *FileHandler) CreateFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	expiresAt := req.ExpiresAt
+	if req.ExpiresIn != 0 {
+		if expiresAt != nil || req.ExpiresIn < 0 {
+			ErrorMessage(w, http.StatusBadRequest, "expires_in must be positive and cannot be combined with expires_at")
+			return
+		}
+		t := time.Now().UTC().Add(time.Duration(req.ExpiresIn) * time.Second)
+		expiresAt = &t
+	}
+
 	userID := auth.GetUserIDFromContext(r.Context())
 	user := auth.GetUserFromContext(r.Context())
-	isAdmin := user != nil && user.IsAdmin()
+	moderator := user.Can(domain.PermModerateFiles)
 
-	maxFileSize, err := h.fileSvc.GetEffectiveMaxFileSize(r.Context(), userID, isAdmin)
+	maxFileSize, err := h.fileSvc.GetEffectiveMaxFileSize(r.Context(), userID, user.Can(domain.PermUnlimitedFiles))
 	if err != nil {
 		Error(w, http.StatusInternalServerError, err)
 		return
 	}
 
 	file, err := h.fileSvc.CreateFile(r.Context(), domain.CreateFileRequest{
-		Name:        req.Name,
-		Hash:        req.Hash,
-		Size:        req.Size,
-		ContentType: req.ContentType,
-		UserID:      userID,
-		Private:     false,
-		Comment:     "",
+		Name:         req.Name,
+		Hash:         req.Hash,
+		Size:         req.Size,
+		ContentType:  req.ContentType,
+		UserID:       userID,
+		Private:      false,
+		Comment:      "",
+		ExpiresAt:    expiresAt,
+		MaxDownloads: req.MaxDownloads,
 	}, maxFileSize)
 	if err != nil {
 		if handleCreateFileError(w, err) {
@@ -214,11 +546,40 @@ func (h *FileHandler) CreateFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	resp := toFileResponse(file)
-	resp.CanEdit = canEditFile(file, userID, isAdmin)
+	resp.CanEdit = canEditFile(file, userID, moderator)
 	JSON(w, http.StatusCreated, resp)
 }
 
+// parseChunkRange reads a chunk's position from Content-Range ("bytes 0-1023/4096") or
+// Upload-Offset (length from Content-Length). ok is false when neither header is sent.
+func parseChunkRange(r *http.Request) (offset, length int64, ok bool, err error) {
+	if cr := r.Header.Get("Content-Range"); cr != "" {
+		spec, found := strings.CutPrefix(cr, "bytes ")
+		rng, _, hasTotal := strings.Cut(spec, "/")
+		first, last, hasDash := strings.Cut(rng, "-")
+		if !found || !hasTotal || !hasDash {
+			return 0, 0, true, errors.New("Content-Range must look like \"bytes first-last/total\"")
+		}
+		offset, err1 := strconv.ParseInt(first, 10, 64)
+		end, err2 := strconv.ParseInt(last, 10, 64)
+		if err1 != nil || err2 != nil || offset < 0 || end < offset {
+			return 0, 0, true, errors.New("invalid Content-Range")
+		}
+		return offset, end - offset + 1, true, nil
+	}
+	if uo := r.Header.Get("Upload-Offset"); uo != "" {
+		offset, err := strconv.ParseInt(uo, 10, 64)
+		if err != nil || offset < 0 {
+			return 0, 0, true, errors.New("Upload-Offset must be a non-negative integer")
+		}
+		return offset, r.ContentLength, true, nil
+	}
+	return 0, 0, false, nil
+}
+
 // UploadFileData uploads file data (supports chunked uploads). Stops when max size exceeded; verifies SHA-256 on completion.
+// With Content-Range or Upload-Offset the body is written at that offset, so chunks can be sent out of order,
+// in parallel, or retried.
 func (h *FileHandler) UploadFileData(w http.ResponseWriter, r *http.Request) {
 	hash := chi.URLParam(r, "hash")
 	if hash == "" {
@@ -228,9 +589,9 @@ func (h *FileHandler) UploadFileData(w http.ResponseWriter, r *http.Request) {
 
 	userID := auth.GetUserIDFromContext(r.Context())
 	user := auth.GetUserFromContext(r.Context())
-	isAdmin := user != nil && user.IsAdmin()
+	moderator := user.Can(domain.PermModerateFiles)
 
-	maxFileSize, err := h.fileSvc.GetEffectiveMaxFileSize(r.Context(), userID, isAdmin)
+	maxFileSize, err := h.fileSvc.GetEffectiveMaxFileSize(r.Context(), userID, user.Can(domain.PermUnlimitedFiles))
 	if err != nil {
 		Error(w, http.StatusInternalServerError, err)
 		return
@@ -239,7 +600,20 @@ func (h *FileHandler) UploadFileData(w http.ResponseWriter, r *http.Request) {
 		r.Body = http.MaxBytesReader(w, r.Body, maxFileSize)
 	}
 
-	file, err := h.fileSvc.UploadFileData(r.Context(), hash, r.Body, maxFileSize)
+	var file *domain.File
+	offset, length, chunked, err := parseChunkRange(r)
+	switch {
+	case err != nil:
+		Error(w, http.StatusBadRequest, err)
+		return
+	case chunked && length <= 0:
+		ErrorMessage(w, http.StatusLengthRequired, "chunk uploads need a Content-Length")
+		return
+	case chunked:
+		file, err = h.fileSvc.UploadFileChunk(r.Context(), hash, offset, length, r.Body, maxFileSize, userID)
+	default:
+		file, err = h.fileSvc.UploadFileData(r.Context(), hash, r.Body, maxFileSize, userID)
+	}
 	if err != nil {
 		if errors.Is(err, service.ErrFileNotFound) {
 			Error(w, http.StatusNotFound, err)
@@ -255,8 +629,14 @@ func (h *FileHandler) UploadFileData(w http.ResponseWriter, r *http.Request) {
 		Error(w, http.StatusInternalServerError, err)
 		return
 	}
+	if file.Finished() {
+		if err := h.fileSvc.LoadProcessing(r.Context(), file); err != nil {
+			Error(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
 	resp := toFileResponse(file)
-	resp.CanEdit = canEditFile(file, userID, isAdmin)
+	resp.CanEdit = canEditFile(file, userID, moderator)
 	JSON(w, http.StatusOK, resp)
 }
 
@@ -269,8 +649,8 @@ func (h *FileHandler) GetFile(w http.ResponseWriter, r *http.Request) {
 	}
 	userID := auth.GetUserIDFromContext(r.Context())
 	user := auth.GetUserFromContext(r.Context())
-	isAdmin := user != nil && user.IsAdmin()
-	file, err := h.fileSvc.GetFileByHash(r.Context(), hash)
+	moderator := user.Can(domain.PermModerateFiles)
+	file, err := h.fileSvc.GetFileByHash(r.Context(), hash, userID)
 	if err != nil {
 		if handleFileServiceError(w, err) {
 			return
@@ -278,8 +658,12 @@ func (h *FileHandler) GetFile(w http.ResponseWriter, r *http.Request) {
 		Error(w, http.StatusInternalServerError, err)
 		return
 	}
+	if err := h.fileSvc.LoadProcessing(r.Context(), file); err != nil {
+		Error(w, http.StatusInternalServerError, err)
+		return
+	}
 	resp := toFileResponse(file)
-	resp.CanEdit = canEditFile(file, userID, isAdmin)
+	resp.CanEdit = canEditFile(file, userID, moderator)
 	JSON(w, http.StatusOK, resp)
 }
 
@@ -290,27 +674,31 @@ func (h *FileHandler) ViewFile(w http.ResponseWriter, r *http.Request) {
 		ErrorMessage(w, http.StatusBadRequest, "slug parameter is required")
 		return
 	}
-	userID := auth.GetUserIDFromContext(r.Context())
-	user := auth.GetUserFromContext(r.Context())
-	isAdmin := user != nil && user.IsAdmin()
-	reader, file, err := h.fileSvc.DownloadFile(r.Context(), slug, userID, isAdmin)
-	if err != nil {
-		if handleFileServiceError(w, err) {
-			return
-		}
-		Error(w, http.StatusInternalServerError, err)
+	reader, file, ok := h.openDownload(w, r, slug, true)
+	if !ok {
 		return
 	}
 	defer reader.Close()
-	if !strings.HasPrefix(file.ContentType, "image/") {
-		ErrorMessage(w, http.StatusBadRequest, "only images can be viewed inline")
-		return
-	}
-	streamFileWithHeaders(w, r, reader, file, "inline")
+	h.serveDownload(w, r, reader, file, "inline")
 }
 
 // DownloadFile downloads file data by slug (with attachment content-disposition)
 func (h *FileHandler) DownloadFile(w http.ResponseWriter, r *http.Request) {
+	slug := chi.URLParam(r, "slug")
+	if slug == "" {
+		ErrorMessage(w, http.StatusBadRequest, "slug parameter is required")
+		return
+	}
+	reader, file, ok := h.openDownload(w, r, slug, false)
+	if !ok {
+		return
+	}
+	defer reader.Close()
+	h.serveDownload(w, r, reader, file, "attachment")
+}
+
+// Thumbnail serves a file's thumbnail image, with the same access and password checks as viewing the file
+func (h *FileHandler) Thumbnail(w http.ResponseWriter, r *http.Request) {
 	slug := chi.URLParam(r, "slug")
 	if slug == "" {
 		ErrorMessage(w, http.StatusBadRequest, "slug parameter is required")
@@ -318,8 +706,19 @@ func (h *FileHandler) DownloadFile(w http.ResponseWriter, r *http.Request) {
 	}
 	userID := auth.GetUserIDFromContext(r.Context())
 	user := auth.GetUserFromContext(r.Context())
-	isAdmin := user != nil && user.IsAdmin()
-	reader, file, err := h.fileSvc.DownloadFile(r.Context(), slug, userID, isAdmin)
+	moderator := user.Can(domain.PermModerateFiles)
+	file, err := h.fileSvc.GetFileBySlug(r.Context(), slug, userID, moderator)
+	if err != nil {
+		if handleFileServiceError(w, err) {
+			return
+		}
+		Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !h.checkFilePassword(w, r, file, userID, moderator) {
+		return
+	}
+	reader, thumb, err := h.fileSvc.OpenThumbnail(r.Context(), file)
 	if err != nil {
 		if handleFileServiceError(w, err) {
 			return
@@ -328,7 +727,11 @@ func (h *FileHandler) DownloadFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	defer reader.Close()
-	streamFileWithHeaders(w, r, reader, file, "attachment")
+
+	// Thumbnails are PNG or JPEG; ServeContent sniffs which
+	w.Header().Set("ETag", `"`+thumb.Hash+`"`)
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeContent(w, r, "", time.Time{}, reader)
 }
 
 // ListFiles lists files with pagination
@@ -337,9 +740,9 @@ func (h *FileHandler) ListFiles(w http.ResponseWriter, r *http.Request) {
 	search := strings.TrimSpace(r.URL.Query().Get("q"))
 	userID := auth.GetUserIDFromContext(r.Context())
 	user := auth.GetUserFromContext(r.Context())
-	isAdmin := user != nil && user.IsAdmin()
+	moderator := user.Can(domain.PermModerateFiles)
 
-	files, err := h.fileSvc.ListFiles(r.Context(), limit, offset, userID, isAdmin, search)
+	files, err := h.fileSvc.ListFiles(r.Context(), limit, offset, userID, moderator, search)
 	if err != nil {
 		Error(w, http.StatusInternalServerError, err)
 		return
@@ -347,7 +750,7 @@ func (h *FileHandler) ListFiles(w http.ResponseWriter, r *http.Request) {
 	response := make([]FileResponse, len(files))
 	for i, f := range files {
 		response[i] = toFileResponse(f)
-		response[i].CanEdit = canEditFile(f, userID, isAdmin)
+		response[i].CanEdit = canEditFile(f, userID, moderator)
 	}
 	JSON(w, http.StatusOK, response)
 }
@@ -361,9 +764,9 @@ func (h *FileHandler) DeleteFile(w http.ResponseWriter, r *http.Request) {
 	}
 	userID := auth.GetUserIDFromContext(r.Context())
 	user := auth.GetUserFromContext(r.Context())
-	isAdmin := user != nil && user.IsAdmin()
+	moderator := user.Can(domain.PermModerateFiles)
 
-	err := h.fileSvc.DeleteFile(r.Context(), slug, userID, isAdmin)
+	err := h.fileSvc.DeleteFile(r.Context(), slug, userID, moderator)
 	if err != nil {
 		if handleFileServiceError(w, err) {
 			return
@@ -383,8 +786,8 @@ func (h *FileHandler) GetFileBySlug(w http.ResponseWriter, r *http.Request) {
 	}
 	userID := auth.GetUserIDFromContext(r.Context())
 	user := auth.GetUserFromContext(r.Context())
-	isAdmin := user != nil && user.IsAdmin()
-	file, err := h.fileSvc.GetFileBySlug(r.Context(), slug, userID, isAdmin)
+	moderator := user.Can(domain.PermModerateFiles)
+	file, err := h.fileSvc.GetFileBySlug(r.Context(), slug, userID, moderator)
 	if err != nil {
 		if handleFileServiceError(w, err) {
 			return
@@ -392,16 +795,133 @@ func (h *FileHandler) GetFileBySlug(w http.ResponseWriter, r *http.Request) {
 		Error(w, http.StatusInternalServerError, err)
 		return
 	}
+	if !h.checkFilePassword(w, r, file, userID, moderator) {
+		return
+	}
+	if err := h.fileSvc.LoadProcessing(r.Context(), file); err != nil {
+		Error(w, http.StatusInternalServerError, err)
+		return
+	}
 	resp := toFileResponse(file)
-	resp.CanEdit = canEditFile(file, userID, isAdmin)
+	resp.CanEdit = canEditFile(file, userID, moderator)
 	JSON(w, http.StatusOK, resp)
 }
 
-// UpdateFileRequest represents a file update request
+// UnlockFileRequest is the JSON body for POST /files/{slug}/unlock (a "password" form field also works)
+type UnlockFileRequest struct {
+	Password string `json:"password"`
+}
+
+// UnlockFile checks a password-protected file's password and sets the unlock cookie
+func (h *FileHandler) UnlockFile(w http.ResponseWriter, r *http.Request) {
+	slug := chi.URLParam(r, "slug")
+	if slug == "" {
+		ErrorMessage(w, http.StatusBadRequest, "slug parameter is required")
+		return
+	}
+	var req UnlockFileRequest
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			Error(w, http.StatusBadRequest, err)
+			return
+		}
+	} else {
+		req.Password = r.PostFormValue("password")
+	}
+	if req.Password == "" {
+		ErrorMessage(w, http.StatusBadRequest, "password is required")
+		return
+	}
+	userID := auth.GetUserIDFromContext(r.Context())
+	user := auth.GetUserFromContext(r.Context())
+	moderator := user.Can(domain.PermModerateFiles)
+	file, err := h.fileSvc.GetFileBySlug(r.Context(), slug, userID, moderator)
+	if err != nil {
+		if handleFileServiceError(w, err) {
+			return
+		}
+		Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err := h.unlock(w, r, file, req.Password); err != nil {
+		if handleFileServiceError(w, err) {
+			return
+		}
+		Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	resp := toFileResponse(file)
+	resp.CanEdit = canEditFile(file, userID, moderator)
+	JSON(w, http.StatusOK, resp)
+}
+
+// SignedURLRequest is the JSON body for POST /files/{slug}/signed-url.
+// expires_in is in seconds (default 1 hour, at most 7 days).
+type SignedURLRequest struct {
+	ExpiresIn int64 `json:"expires_in"`
+	SingleUse bool  `json:"single_use"`
+}
+
+// SignedURLResponse holds download and view URLs that work without a session until expires_at
+type SignedURLResponse struct {
+	URL       string    `json:"url"`
+	ViewURL   string    `json:"view_url,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+	SingleUse bool      `json:"single_use"`
+}
+
+// CreateSignedURL returns an HMAC-signed, expiring download URL for a file. Owners and admins only.
+func (h *FileHandler) CreateSignedURL(w http.ResponseWriter, r *http.Request) {
+	slug := chi.URLParam(r, "slug")
+	if slug == "" {
+		ErrorMessage(w, http.StatusBadRequest, "slug parameter is required")
+		return
+	}
+	var req SignedURLRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			Error(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	ttl := service.DefaultSignedURLTTL
+	if req.ExpiresIn != 0 {
+		ttl = time.Duration(req.ExpiresIn) * time.Second
+	}
+	userID := auth.GetUserIDFromContext(r.Context())
+	user := auth.GetUserFromContext(r.Context())
+	moderator := user.Can(domain.PermModerateFiles)
+
+	file, sig, err := h.fileSvc.SignDownloadURL(r.Context(), slug, userID, moderator, ttl, req.SingleUse)
+	if err != nil {
+		if handleFileServiceError(w, err) {
+			return
+		}
+		Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	query := "?" + sig.Query().Encode()
+	resp := SignedURLResponse{
+		URL:       "/api/v1/files/" + file.Slug + query,
+		ExpiresAt: sig.ExpiresAt,
+		SingleUse: sig.SingleUse(),
+	}
+	if strings.HasPrefix(file.ContentType, "image/") {
+		resp.ViewURL = "/api/v1/files/" + file.Slug + "/view" + query
+	}
+	JSON(w, http.StatusOK, resp)
+}
+
+// UpdateFileRequest represents a file update request.
+// expires_at is an RFC 3339 time or "" to clear; max_downloads 0 clears the limit;
+// password "" removes the share password.
 type UpdateFileRequest struct {
-	Name    *string `json:"name"`
-	Private *bool   `json:"private"`
-	Comment *string `json:"comment"`
+	Name         *string `json:"name"`
+	Private      *bool   `json:"private"`
+	Comment      *string `json:"comment"`
+	ExpiresAt    *string `json:"expires_at"`
+	MaxDownloads *int32  `json:"max_downloads"`
+	Password     *string `json:"password"`
 }
 
 // UpdateFile updates file metadata
@@ -416,15 +936,31 @@ func (h *FileHandler) UpdateFile(w http.ResponseWriter, r *http.Request) {
 		Error(w, http.StatusBadRequest, err)
 		return
 	}
+	var expiresAt *time.Time
+	if req.ExpiresAt != nil {
+		t := time.Time{}
+		if *req.ExpiresAt != "" {
+			var err error
+			if t, err = time.Parse(time.RFC3339, *req.ExpiresAt); err != nil {
+				ErrorMessage(w, http.StatusBadRequest, "expires_at must be an RFC 3339 time")
+				return
+			}
+			t = t.UTC()
+		}
+		expiresAt = &t
+	}
 	userID := auth.GetUserIDFromContext(r.Context())
 	user := auth.GetUserFromContext(r.Context())
-	isAdmin := user != nil && user.IsAdmin()
+	moderator := user.Can(domain.PermModerateFiles)
 
 	file, err := h.fileSvc.UpdateFile(r.Context(), slug, service.UpdateFileRequest{
-		Name:    req.Name,
-		Private: req.Private,
-		Comment: req.Comment,
-	}, userID, isAdmin)
+		Name:         req.Name,
+		Private:      req.Private,
+		Comment:      req.Comment,
+		ExpiresAt:    expiresAt,
+		MaxDownloads: req.MaxDownloads,
+		Password:     req.Password,
+	}, userID, moderator)
 	if err != nil {
 		if handleFileServiceError(w, err) {
 			return
@@ -433,6 +969,6 @@ func (h *FileHandler) UpdateFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	resp := toFileResponse(file)
-	resp.CanEdit = canEditFile(file, userID, isAdmin)
+	resp.CanEdit = canEditFile(file, userID, moderator)
 	JSON(w, http.StatusOK, resp)
 }
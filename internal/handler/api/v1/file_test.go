@@ -3,11 +3,14 @@ package v1
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/rs/zerolog"
@@ -58,7 +61,8 @@ func setupFileHandlerTest(t *testing.T, ctx context.Context) (*chi.Mux, *service
 
 	r := chi.NewRouter()
 	r.Use(authHandler.AuthMiddleware)
-	r.Mount("/api/v1", NewRouter(fileHandler, userHandler, authHandler))
+	albumHandler := NewAlbumHandler(service.NewAlbumService(repo, fileSvc), fileHandler)
+	r.Mount("/api/v1", NewRouter(fileHandler, albumHandler, userHandler, NewAuditHandler(service.NewAuditService(repo)), authHandler))
 
 	return r, fileSvc, cleanup
 }
@@ -92,7 +96,7 @@ func TestFileHandlerCreateFileListFilesGetBySlugDelete(t *testing.T) {
 	assert.Equal(t, "api-test.txt", createResp.Name)
 	assert.Equal(t, testHash64, createResp.Hash)
 	assert.NotEmpty(t, createResp.Slug)
-	assert.Equal(t, int32(100), createResp.Size)
+	assert.Equal(t, int64(100), createResp.Size)
 
 	// List files
 	req = httptest.NewRequest(http.MethodGet, pathAPIV1Files, nil)
@@ -150,7 +154,9 @@ func TestFileHandlerCreateFilePublicUploadsDisabled(t *testing.T) {
 	authHandler := auth.NewAuthHandler(userSvc, &logger, cfg)
 	r := chi.NewRouter()
 	r.Use(authHandler.AuthMiddleware)
-	r.Mount("/api/v1", NewRouter(NewFileHandler(fileSvc), NewUserHandler(userSvc, fileSvc), authHandler))
+	fileHandler := NewFileHandler(fileSvc)
+	albumHandler := NewAlbumHandler(service.NewAlbumService(repo, fileSvc), fileHandler)
+	r.Mount("/api/v1", NewRouter(fileHandler, albumHandler, NewUserHandler(userSvc, fileSvc), NewAuditHandler(service.NewAuditService(repo)), authHandler))
 
 	createBody := map[string]interface{}{
 		"name":         "anon.txt",
@@ -270,3 +276,434 @@ func TestFileHandlerCreateFileValidationLimits(t *testing.T) {
 		assert.Equal(t, http.StatusBadRequest, rec.Code)
 	})
 }
+
+func TestStreamFileWithHeadersRanges(t *testing.T) {
+	content := []byte("0123456789abcdefghij")
+	file := &domain.File{
+		Name:        "range.txt",
+		Hash:        testHash64,
+		Size:        int64(len(content)),
+		ContentType: contentTypePlain,
+	}
+	etag := `"` + testHash64 + `"`
+
+	serve := func(headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, pathAPIV1Files+"slug", nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		streamFileWithHeaders(rec, req, bytes.NewReader(content), file, "attachment")
+		return rec
+	}
+
+	t.Run("full body advertises ranges", func(t *testing.T) {
+		rec := serve(nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "bytes", rec.Header().Get("Accept-Ranges"))
+		assert.Equal(t, etag, rec.Header().Get("ETag"))
+		assert.Equal(t, "20", rec.Header().Get("Content-Length"))
+		assert.Equal(t, string(content), rec.Body.String())
+	})
+
+	t.Run("single range", func(t *testing.T) {
+		rec := serve(map[string]string{"Range": "bytes=5-9"})
+		assert.Equal(t, http.StatusPartialContent, rec.Code)
+		assert.Equal(t, "bytes 5-9/20", rec.Header().Get("Content-Range"))
+		assert.Equal(t, "56789", rec.Body.String())
+	})
+
+	t.Run("suffix range", func(t *testing.T) {
+		rec := serve(map[string]string{"Range": "bytes=-3"})
+		assert.Equal(t, http.StatusPartialContent, rec.Code)
+		assert.Equal(t, "hij", rec.Body.String())
+	})
+
+	t.Run("multi range", func(t *testing.T) {
+		rec := serve(map[string]string{"Range": "bytes=0-1,10-11"})
+		assert.Equal(t, http.StatusPartialContent, rec.Code)
+		assert.True(t, strings.HasPrefix(rec.Header().Get(headerContentType), "multipart/byteranges"))
+		assert.Contains(t, rec.Body.String(), "01")
+		assert.Contains(t, rec.Body.String(), "ab")
+	})
+
+	t.Run("unsatisfiable range", func(t *testing.T) {
+		rec := serve(map[string]string{"Range": "bytes=100-200"})
+		assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, rec.Code)
+		assert.Equal(t, "bytes */20", rec.Header().Get("Content-Range"))
+	})
+
+	t.Run("if-range matching etag returns range", func(t *testing.T) {
+		rec := serve(map[string]string{"Range": "bytes=0-3", "If-Range": etag})
+		assert.Equal(t, http.StatusPartialContent, rec.Code)
+		assert.Equal(t, "0123", rec.Body.String())
+	})
+
+	t.Run("if-range stale etag returns full body", func(t *testing.T) {
+		rec := serve(map[string]string{"Range": "bytes=0-3", "If-Range": `"stale"`})
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, string(content), rec.Body.String())
+	})
+
+	t.Run("if-none-match returns not modified", func(t *testing.T) {
+		rec := serve(map[string]string{"If-None-Match": etag})
+		assert.Equal(t, http.StatusNotModified, rec.Code)
+	})
+}
+
+func TestDownloadBytes(t *testing.T) {
+	file := &domain.File{Hash: testHash64, Size: 4096}
+	cases := []struct {
+		name    string
+		method  string
+		headers map[string]string
+		want    int64
+		counts  bool
+	}{
+		{"plain get", http.MethodGet, nil, 4096, true},
+		{"head", http.MethodHead, nil, 0, false},
+		{"form post", http.MethodPost, nil, 4096, true},
+		{"range from start", http.MethodGet, map[string]string{"Range": "bytes=0-1023"}, 1024, true},
+		{"open range from start", http.MethodGet, map[string]string{"Range": "bytes=0-"}, 4096, true},
+		{"resume", http.MethodGet, map[string]string{"Range": "bytes=1024-"}, 3072, true},
+		{"skipping first byte", http.MethodGet, map[string]string{"Range": "bytes=1-"}, 4095, true},
+		{"suffix range", http.MethodGet, map[string]string{"Range": "bytes=-100"}, 100, true},
+		{"suffix range past start", http.MethodGet, map[string]string{"Range": "bytes=-5000"}, 4096, true},
+		{"range set", http.MethodGet, map[string]string{"Range": "bytes=1-10,20-29"}, 20, true},
+		{"ranges adding up to more than the file", http.MethodGet, map[string]string{"Range": "bytes=1-,1-"}, 4096, true},
+		{"range past end", http.MethodGet, map[string]string{"Range": "bytes=4000-9999"}, 96, true},
+		{"unsatisfiable range", http.MethodGet, map[string]string{"Range": "bytes=5000-"}, 0, false},
+		{"malformed range", http.MethodGet, map[string]string{"Range": "bytes=x-"}, 4096, true},
+		{"other unit", http.MethodGet, map[string]string{"Range": "items=1-"}, 4096, true},
+		{"resume with matching if-range", http.MethodGet, map[string]string{"Range": "bytes=1024-", "If-Range": `"` + testHash64 + `"`}, 3072, true},
+		{"resume with stale if-range", http.MethodGet, map[string]string{"Range": "bytes=1024-", "If-Range": `"stale"`}, 4096, true},
+		{"revalidation", http.MethodGet, map[string]string{"If-None-Match": `"` + testHash64 + `"`}, 0, false},
+		{"stale etag", http.MethodGet, map[string]string{"If-None-Match": `"stale"`}, 4096, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, pathAPIV1Files+"slug", nil)
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+			n, counts := downloadBytes(req, file)
+			assert.Equal(t, tc.want, n)
+			assert.Equal(t, tc.counts, counts)
+		})
+	}
+}
+
+func TestSendsWholeFile(t *testing.T) {
+	file := &domain.File{Hash: testHash64, Size: 4096}
+	cases := []struct {
+		name    string
+		method  string
+		headers map[string]string
+		want    bool
+	}{
+		{"plain get", http.MethodGet, nil, true},
+		{"head", http.MethodHead, nil, false},
+		{"form post", http.MethodPost, nil, true},
+		{"revalidation", http.MethodGet, map[string]string{"If-None-Match": `"` + testHash64 + `"`}, false},
+		{"stale etag", http.MethodGet, map[string]string{"If-None-Match": `"stale"`}, true},
+		{"matching if-match", http.MethodGet, map[string]string{"If-Match": `"` + testHash64 + `"`}, true},
+		{"any if-match", http.MethodGet, map[string]string{"If-Match": "*"}, true},
+		{"failed if-match", http.MethodGet, map[string]string{"If-Match": `"stale"`}, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, pathAPIV1Files+"slug", nil)
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+			assert.Equal(t, tc.want, sendsWholeFile(req, file))
+		})
+	}
+}
+
+// uploadLimitedFile uploads content through the API with a download limit and returns its slug
+func uploadLimitedFile(t *testing.T, r http.Handler, name string, content []byte, maxDownloads int) string {
+	t.Helper()
+	sum := sha256.Sum256(content)
+	hash := fmt.Sprintf("%x", sum[:])
+
+	body, _ := json.Marshal(map[string]any{
+		"name":          name,
+		"hash":          hash,
+		"size":          len(content),
+		"content_type":  contentTypePlain,
+		"expires_in":    3600,
+		"max_downloads": maxDownloads,
+	})
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/files", bytes.NewReader(body))
+	req.Header.Set(headerContentType, contentTypeJSON)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	var created FileResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&created))
+	require.NotNil(t, created.ExpiresAt)
+	require.NotNil(t, created.MaxDownloads)
+
+	req = httptest.NewRequest(http.MethodPost, pathAPIV1Meta+hash, bytes.NewReader(content))
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var uploaded FileResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&uploaded))
+	return uploaded.Slug
+}
+
+func TestFileHandlerDownloadLimitReturnsGone(t *testing.T) {
+	ctx := context.Background()
+	r, _, cleanup := setupFileHandlerTest(t, ctx)
+	defer cleanup()
+
+	content := []byte("read once")
+	slug := uploadLimitedFile(t, r, "once.txt", content, 1)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, pathAPIV1Files+slug, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, string(content), rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, pathAPIV1Files+slug, nil))
+	assert.Equal(t, http.StatusGone, rec.Code)
+}
+
+func TestFileHandlerRangesSkippingStartUseUpLimit(t *testing.T) {
+	ctx := context.Background()
+	r, _, cleanup := setupFileHandlerTest(t, ctx)
+	defer cleanup()
+
+	slug := uploadLimitedFile(t, r, "once.txt", []byte("read once"), 1)
+
+	req := httptest.NewRequest(http.MethodGet, pathAPIV1Files+slug, nil)
+	req.Header.Set("Range", "bytes=1-")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusPartialContent, rec.Code)
+	assert.Equal(t, "ead once", rec.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, pathAPIV1Files+slug, nil)
+	req.Header.Set("Range", "bytes=1-")
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusGone, rec.Code)
+}
+
+func TestFileHandlerPasswordProtectedDownload(t *testing.T) {
+	ctx := context.Background()
+	r, fileSvc, cleanup := setupFileHandlerTest(t, ctx)
+	defer cleanup()
+
+	content := []byte("secret stuff")
+	sum := sha256.Sum256(content)
+	hash := fmt.Sprintf("%x", sum[:])
+
+	_, err := fileSvc.CreateFile(ctx, domain.CreateFileRequest{
+		Name: "secret.txt", Hash: hash, Size: int64(len(content)), ContentType: contentTypePlain,
+	}, 0)
+	require.NoError(t, err)
+	uploaded, err := fileSvc.UploadFileData(ctx, hash, bytes.NewReader(content), 0, nil)
+	require.NoError(t, err)
+
+	admin := int32(1)
+	password := "hunter2"
+	_, err = fileSvc.UpdateFile(ctx, uploaded.Slug, service.UpdateFileRequest{Password: &password}, &admin, true)
+	require.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, pathAPIV1Files+uploaded.Slug, nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, pathAPIV1FileMetadata+uploaded.Slug, nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	req := httptest.NewRequest(http.MethodGet, pathAPIV1Files+uploaded.Slug, nil)
+	req.Header.Set(filePasswordHeader, "wrong")
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	// Header
+	req = httptest.NewRequest(http.MethodGet, pathAPIV1Files+uploaded.Slug, nil)
+	req.Header.Set(filePasswordHeader, password)
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, string(content), rec.Body.String())
+
+	// Form field
+	req = httptest.NewRequest(http.MethodPost, pathAPIV1Files+uploaded.Slug, strings.NewReader("password="+password))
+	req.Header.Set(headerContentType, "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, string(content), rec.Body.String())
+
+	// Unlock endpoint sets a cookie that works for later requests
+	req = httptest.NewRequest(http.MethodPost, pathAPIV1Files+uploaded.Slug+"/unlock", strings.NewReader(`{"password":"hunter2"}`))
+	req.Header.Set(headerContentType, contentTypeJSON)
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	cookies := rec.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, unlockCookiePrefix+uploaded.Slug, cookies[0].Name)
+
+	req = httptest.NewRequest(http.MethodGet, pathAPIV1FileMetadata+uploaded.Slug, nil)
+	req.AddCookie(cookies[0])
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var meta FileResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&meta))
+	assert.True(t, meta.PasswordProtected)
+}
+
+func TestFileHandlerSignedURL(t *testing.T) {
+	ctx := context.Background()
+	r, fileSvc, cleanup := setupFileHandlerTest(t, ctx)
+	defer cleanup()
+
+	content := []byte("private but shareable")
+	sum := sha256.Sum256(content)
+	hash := fmt.Sprintf("%x", sum[:])
+
+	_, err := fileSvc.CreateFile(ctx, domain.CreateFileRequest{
+		Name: "share.txt", Hash: hash, Size: int64(len(content)), ContentType: contentTypePlain,
+	}, 0)
+	require.NoError(t, err)
+	uploaded, err := fileSvc.UploadFileData(ctx, hash, bytes.NewReader(content), 0, nil)
+	require.NoError(t, err)
+
+	admin := int32(1)
+	private := true
+	_, err = fileSvc.UpdateFile(ctx, uploaded.Slug, service.UpdateFileRequest{Private: &private}, &admin, true)
+	require.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, pathAPIV1Files+uploaded.Slug, nil))
+	require.Equal(t, http.StatusForbidden, rec.Code)
+
+	// Guests can't sign
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, pathAPIV1Files+uploaded.Slug+"/signed-url", nil))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	_, sig, err := fileSvc.SignDownloadURL(ctx, uploaded.Slug, &admin, true, time.Hour, true)
+	require.NoError(t, err)
+	url := pathAPIV1Files + uploaded.Slug + "?" + sig.Query().Encode()
+
+	// Requests that don't send the file leave the link unspent
+	req := httptest.NewRequest(http.MethodGet, url, nil)
+	req.Header.Set("If-None-Match", `"`+hash+`"`)
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusNotModified, rec.Code)
+
+	req = httptest.NewRequest(http.MethodGet, url, nil)
+	req.Header.Set("If-Match", `"stale"`)
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusPreconditionFailed, rec.Code)
+
+	// Viewing a file that isn't an image is refused without spending the link
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, pathAPIV1Files+uploaded.Slug+"/view?"+sig.Query().Encode(), nil))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// Range is ignored, so the one use gets the whole file
+	req = httptest.NewRequest(http.MethodGet, url, nil)
+	req.Header.Set("Range", "bytes=8-")
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, string(content), rec.Body.String())
+
+	// Single use
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+	assert.Equal(t, http.StatusGone, rec.Code)
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url+"x", nil))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestParseChunkRange(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, pathAPIV1Meta+testHash64, strings.NewReader("abcd"))
+	_, _, ok, err := parseChunkRange(req)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	req.Header.Set("Content-Range", "bytes 100-199/1000")
+	offset, length, ok, err := parseChunkRange(req)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, int64(100), offset)
+	assert.Equal(t, int64(100), length)
+
+	req.Header.Set("Content-Range", "bytes 200-100/*")
+	_, _, _, err = parseChunkRange(req)
+	assert.Error(t, err)
+
+	req.Header.Del("Content-Range")
+	req.Header.Set("Upload-Offset", "8")
+	offset, length, ok, err = parseChunkRange(req)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, int64(8), offset)
+	assert.Equal(t, int64(4), length)
+}
+
+func TestFileHandlerUploadChunksOutOfOrder(t *testing.T) {
+	ctx := context.Background()
+	router, _, cleanup := setupFileHandlerTest(t, ctx)
+	defer cleanup()
+
+	content := []byte("out of order chunk upload")
+	sum := sha256.Sum256(content)
+	hash := fmt.Sprintf("%x", sum[:])
+
+	bodyBytes, _ := json.Marshal(map[string]interface{}{
+		"name": "chunks.txt", "hash": hash, "size": len(content), "content_type": contentTypePlain,
+	})
+	req := httptest.NewRequest(http.MethodPost, pathAPIV1Files, bytes.NewReader(bodyBytes))
+	req.Header.Set(headerContentType, contentTypeJSON)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	send := func(start, end int) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, pathAPIV1Meta+hash, bytes.NewReader(content[start:end]))
+		req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end-1, len(content)))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec = send(10, len(content))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var resp FileResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	assert.Equal(t, int64(0), resp.BytesReceived)
+	assert.Equal(t, []ByteRangeResponse{{Start: 10, End: int64(len(content))}}, resp.ReceivedRanges)
+
+	assert.Equal(t, http.StatusConflict, send(5, 15).Code)
+
+	rec = send(0, 10)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	resp = FileResponse{}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	assert.Equal(t, int64(len(content)), resp.BytesReceived)
+	assert.Empty(t, resp.ReceivedRanges)
+
+	// A retry after completion is a no-op
+	assert.Equal(t, http.StatusOK, send(0, 10).Code)
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"github.com/zqz/web/backend/internal/handler"
+	"github.com/zqz/web/backend/internal/telemetry"
 )
 
 // ErrorResponse represents an API error response
@@ -12,6 +13,7 @@ type ErrorResponse struct {
 	Error   string `json:"error"`
 	Message string `json:"message,omitempty"`
 	Code    string `json:"code,omitempty"`
+	TraceID string `json:"trace_id,omitempty"` // Same as the X-Trace-Id header; empty when tracing is off
 }
 
 // JSON writes a JSON response
@@ -26,6 +28,7 @@ func Error(w http.ResponseWriter, status int, err error) {
 	JSON(w, status, ErrorResponse{
 		Error:   err.Error(),
 		Message: http.StatusText(status),
+		TraceID: w.Header().Get(telemetry.TraceIDHeader),
 	})
 }
 
@@ -34,5 +37,16 @@ func ErrorMessage(w http.ResponseWriter, status int, message string) {
 	JSON(w, status, ErrorResponse{
 		Error:   message,
 		Message: http.StatusText(status),
+		TraceID: w.Header().Get(telemetry.TraceIDHeader),
+	})
+}
+
+// ErrorWithCode writes an error JSON response with a machine-readable code
+func ErrorWithCode(w http.ResponseWriter, status int, err error, code string) {
+	JSON(w, status, ErrorResponse{
+		Error:   err.Error(),
+		Message: http.StatusText(status),
+		Code:    code,
+		TraceID: w.Header().Get(telemetry.TraceIDHeader),
 	})
 }
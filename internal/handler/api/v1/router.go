@@ -8,16 +8,29 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/cors"
+	"github.com/zqz/web/backend/internal/domain"
 	"github.com/zqz/web/backend/internal/handler/auth"
 )
 
 const nonUploadTimeout = 200 * time.Millisecond
 
+// isDataUpload reports whether r carries file data: POST /meta/{hash}, POST /upload or a tus PATCH
+func isDataUpload(r *http.Request) bool {
+	switch {
+	case r.Method == http.MethodPost && strings.Contains(r.URL.Path, "/meta/"):
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/upload"):
+	case (r.Method == http.MethodPatch || r.Method == http.MethodPost) && strings.Contains(r.URL.Path, "/tus/"):
+	default:
+		return false
+	}
+	return true
+}
+
 // timeoutForNonUpload cancels the request context after 200ms for all endpoints
-// except POST /meta/{hash} (file data upload), which may take longer.
+// except file data uploads and archive downloads, which may take longer.
 func timeoutForNonUpload(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodPost && strings.Contains(r.URL.Path, "/meta/") {
+		if isDataUpload(r) || isArchiveDownload(r) {
 			next.ServeHTTP(w, r)
 			return
 		}
@@ -28,7 +41,7 @@ func timeoutForNonUpload(next http.Handler) http.Handler {
 }
 
 // NewRouter creates a new API v1 router
-func NewRouter(fileHandler *FileHandler, userHandler *UserHandler, authHandler *auth.AuthHandler) http.Handler {
+func NewRouter(fileHandler *FileHandler, albumHandler *AlbumHandler, userHandler *UserHandler, auditHandler *AuditHandler, authHandler *auth.AuthHandler) http.Handler {
 	r := chi.NewRouter()
 
 	r.Use(timeoutForNonUpload)
@@ -36,9 +49,9 @@ func NewRouter(fileHandler *FileHandler, userHandler *UserHandler, authHandler *
 	// CORS middleware
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"*"}, // TODO: Configure allowed origins
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedMethods:   []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   append([]string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "Range", "If-Range", "If-None-Match", "Content-Range", filePasswordHeader}, tusRequestHeaders...),
+		ExposedHeaders:   append([]string{"Link", "Accept-Ranges", "Content-Range", "Content-Length", "ETag"}, tusResponseHeaders...),
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
@@ -49,34 +62,81 @@ func NewRouter(fileHandler *FileHandler, userHandler *UserHandler, authHandler *
 	})
 
 	// File endpoints
+	// Requests authenticated with a personal API token must carry the matching scope.
+	upload := auth.RequireScope(domain.ScopeUpload)
+	read := auth.RequireScope(domain.ScopeRead)
+	del := auth.RequireScope(domain.ScopeDelete)
+
 	r.Route("/files", func(r chi.Router) {
-		r.Post("/", fileHandler.CreateFile)         // Create file metadata
-		r.Get("/", fileHandler.ListFiles)           // List files
-		r.Get("/{slug}/view", fileHandler.ViewFile) // View file (inline, images only)
-		r.Get("/{slug}", fileHandler.DownloadFile)  // Download file (attachment)
-		r.Put("/{slug}", fileHandler.UpdateFile)    // Update file metadata
-		r.Delete("/{slug}", fileHandler.DeleteFile) // Delete file
+		r.With(upload).Post("/", fileHandler.CreateFile)                     // Create file metadata
+		r.With(read).Get("/", fileHandler.ListFiles)                         // List files
+		r.With(read).Get("/{slug}/view", fileHandler.ViewFile)               // View file (inline, images only)
+		r.With(read).Get("/{slug}/thumbnail", fileHandler.Thumbnail)         // Thumbnail image
+		r.With(read).Get("/{slug}", fileHandler.DownloadFile)                // Download file (attachment)
+		r.With(read).Post("/{slug}", fileHandler.DownloadFile)               // Download with a "password" form field
+		r.With(read).Post("/{slug}/unlock", fileHandler.UnlockFile)          // Unlock a password-protected file
+		r.With(read).Post("/{slug}/signed-url", fileHandler.CreateSignedURL) // Signed, expiring download URL
+		r.With(upload).Put("/{slug}", fileHandler.UpdateFile)                // Update file metadata
+		r.With(del).Delete("/{slug}", fileHandler.DeleteFile)                // Delete file
+	})
+
+	// Albums: the owner's files in order, shared by slug
+	requireAuth := func(next http.Handler) http.Handler {
+		return authHandler.RequireAuth(next, nil)
+	}
+	r.Route("/albums", func(r chi.Router) {
+		r.With(upload, requireAuth).Post("/", albumHandler.CreateAlbum)                 // Create album
+		r.With(read, requireAuth).Get("/", albumHandler.ListAlbums)                     // List own albums
+		r.With(read).Get("/{slug}", albumHandler.GetAlbum)                              // Album and its visible files
+		r.With(read).Get("/{slug}/zip", albumHandler.DownloadAlbum)                     // ZIP of its visible files
+		r.With(upload).Put("/{slug}", albumHandler.UpdateAlbum)                         // Rename, describe, change visibility
+		r.With(del).Delete("/{slug}", albumHandler.DeleteAlbum)                         // Delete album (files are kept)
+		r.With(upload).Post("/{slug}/files", albumHandler.AddAlbumFiles)                // Append files
+		r.With(upload).Put("/{slug}/files", albumHandler.ReorderAlbumFiles)             // Reorder files
+		r.With(upload).Delete("/{slug}/files/{fileSlug}", albumHandler.RemoveAlbumFile) // Remove a file
 	})
 
+	// Bulk download: several files, by slug or search, streamed as one ZIP or tar.gz
+	r.With(read).Get("/archive", fileHandler.DownloadArchive)
+	r.With(read).Post("/archive", fileHandler.DownloadArchive) // Form post, for long slug lists
+
+	// One-shot multipart upload (curl -F file=@x.png)
+	r.With(upload).Post("/upload", fileHandler.UploadForm)
+
 	// File metadata endpoints (for web interface)
 	r.Route("/file-metadata", func(r chi.Router) {
-		r.Get("/{slug}", fileHandler.GetFileBySlug) // Get file metadata by slug
+		r.With(read).Get("/{slug}", fileHandler.GetFileBySlug) // Get file metadata by slug
 	})
 
 	// Metadata endpoints
 	r.Route("/meta", func(r chi.Router) {
-		r.Get("/{hash}", fileHandler.GetFile)         // Get file metadata by hash
-		r.Post("/{hash}", fileHandler.UploadFileData) // Upload file data
+		r.With(read).Get("/{hash}", fileHandler.GetFile)           // Get file metadata by hash
+		r.With(upload).Post("/{hash}", fileHandler.UploadFileData) // Upload file data
 	})
 
-	// User endpoints (admin only)
+	// tus 1.0 resumable uploads (creation, termination and checksum extensions)
+	r.Route("/tus", func(r chi.Router) {
+		r.Use(tusResumable)
+		r.Options("/", fileHandler.TusOptions)                // Server capabilities
+		r.With(upload).Post("/", fileHandler.TusCreate)       // Create upload
+		r.With(upload).Head("/{id}", fileHandler.TusHead)     // Current offset
+		r.With(upload).Patch("/{id}", fileHandler.TusPatch)   // Append data
+		r.With(upload).Delete("/{id}", fileHandler.TusDelete) // Terminate upload
+	})
+
+	// User endpoints (admins and moderators)
 	r.Route("/users", func(r chi.Router) {
 		r.Use(func(next http.Handler) http.Handler {
-			return authHandler.RequireAdmin(next, nil) // API: no HTML error page
+			return authHandler.RequirePermission(domain.PermViewUsers, next, nil) // API: no HTML error page
 		})
 		r.Get("/", userHandler.ListUsers)               // List all users
 		r.Get("/{id}/files", userHandler.ListUserFiles) // List files by user
 	})
 
+	// Audit log (admin only)
+	r.With(func(next http.Handler) http.Handler {
+		return authHandler.RequirePermission(domain.PermViewAudit, next, nil)
+	}).Get("/audit", auditHandler.ListEvents)
+
 	return r
 }
@@ -47,4 +47,65 @@ func TestTimeoutForNonUpload(t *testing.T) {
 		assert.False(t, gotOK, "upload request should not have a deadline from the timeout middleware")
 		assert.Equal(t, http.StatusOK, rec.Code)
 	})
+
+	t.Run("tus PATCH has no deadline", func(t *testing.T) {
+		var gotOK bool
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, gotOK = r.Context().Deadline()
+			w.WriteHeader(http.StatusOK)
+		})
+
+		handler := timeoutForNonUpload(next)
+		req := httptest.NewRequest(http.MethodPatch, tusPath+"abc123", nil)
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, req)
+
+		assert.False(t, gotOK, "tus PATCH should not have a deadline from the timeout middleware")
+	})
+	t.Run("one-shot upload has no deadline", func(t *testing.T) {
+		var gotOK bool
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, gotOK = r.Context().Deadline()
+			w.WriteHeader(http.StatusOK)
+		})
+
+		handler := timeoutForNonUpload(next)
+		req := httptest.NewRequest(http.MethodPost, pathAPIV1Upload, nil)
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, req)
+
+		assert.False(t, gotOK, "one-shot upload should not have a deadline from the timeout middleware")
+	})
+	t.Run("album zip has no deadline", func(t *testing.T) {
+		var gotOK bool
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, gotOK = r.Context().Deadline()
+			w.WriteHeader(http.StatusOK)
+		})
+
+		handler := timeoutForNonUpload(next)
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/albums/abc123/zip", nil)
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, req)
+
+		assert.False(t, gotOK, "album zip should not have a deadline from the timeout middleware")
+	})
+	t.Run("bulk archive has no deadline", func(t *testing.T) {
+		var gotOK bool
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, gotOK = r.Context().Deadline()
+			w.WriteHeader(http.StatusOK)
+		})
+
+		handler := timeoutForNonUpload(next)
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/archive", nil)
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, req)
+
+		assert.False(t, gotOK, "bulk archive should not have a deadline from the timeout middleware")
+	})
 }
@@ -0,0 +1,304 @@
+package v1
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/zqz/web/backend/internal/domain"
+	"github.com/zqz/web/backend/internal/handler/auth"
+	"github.com/zqz/web/backend/internal/service"
+)
+
+// tus 1.0 protocol constants (https://tus.io/protocols/resumable-upload)
+const (
+	tusVersion            = "1.0.0"
+	tusExtensions         = "creation,termination,checksum"
+	tusChecksumAlgorithms = "md5,sha1,sha256"
+	tusContentType        = "application/offset+octet-stream"
+	tusPath               = "/api/v1/tus/"
+
+	// statusChecksumMismatch is returned (checksum extension) when a chunk fails its Upload-Checksum
+	statusChecksumMismatch = 460
+
+	// tusFileSlugHeader tells clients where a finished upload can be found
+	tusFileSlugHeader = "X-File-Slug"
+)
+
+var (
+	// tusRequestHeaders and tusResponseHeaders are allowed and exposed for browser clients
+	tusRequestHeaders  = []string{"Tus-Resumable", "Upload-Length", "Upload-Offset", "Upload-Metadata", "Upload-Checksum", "Upload-Defer-Length", "X-HTTP-Method-Override"}
+	tusResponseHeaders = []string{"Location", "Tus-Resumable", "Tus-Version", "Tus-Extension", "Tus-Max-Size", "Tus-Checksum-Algorithm", "Upload-Offset", "Upload-Length", tusFileSlugHeader}
+)
+
+// tusResumable sets Tus-Resumable on every response and rejects requests for other protocol versions.
+// X-HTTP-Method-Override lets clients that can't send PATCH or DELETE tunnel them through POST.
+func tusResumable(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Tus-Resumable", tusVersion)
+		if r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.Header.Get("Tus-Resumable") != tusVersion {
+			w.Header().Set("Tus-Version", tusVersion)
+			ErrorMessage(w, http.StatusPreconditionFailed, "unsupported tus version")
+			return
+		}
+		if m := r.Header.Get("X-HTTP-Method-Override"); m != "" && r.Method == http.MethodPost {
+			r.Method = strings.ToUpper(m)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// parseTusMetadata decodes Upload-Metadata: comma-separated "key base64(value)" pairs
+func parseTusMetadata(header string) (map[string]string, error) {
+	meta := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, encoded, _ := strings.Cut(pair, " ")
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, errors.New("invalid Upload-Metadata value for " + key)
+		}
+		meta[key] = string(value)
+	}
+	return meta, nil
+}
+
+// firstOf returns the first non-empty metadata value among keys (clients disagree on naming)
+func firstOf(meta map[string]string, keys ...string) string {
+	for _, k := range keys {
+		if v := meta[k]; v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// newChecksumHash returns the hash for a tus checksum algorithm name, or nil if unsupported
+func newChecksumHash(algorithm string) hash.Hash {
+	switch algorithm {
+	case "md5":
+		return md5.New()
+	case "sha1":
+		return sha1.New()
+	case "sha256":
+		return sha256.New()
+	}
+	return nil
+}
+
+// handleTusError writes the appropriate HTTP error for tus service errors.
+// Returns true if the error was handled, false otherwise.
+func handleTusError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, service.ErrTusUploadNotFound), errors.Is(err, service.ErrFileNotFound):
+		Error(w, http.StatusNotFound, err)
+	case errors.Is(err, service.ErrTusOffsetMismatch):
+		Error(w, http.StatusConflict, err)
+	case errors.Is(err, service.ErrUploadInProgress):
+		Error(w, http.StatusLocked, err)
+	case errors.Is(err, service.ErrHashMismatch):
+		ErrorMessage(w, http.StatusBadRequest, "file hash verification failed")
+	default:
+		return handleCreateFileError(w, err)
+	}
+	return true
+}
+
+// setTusUploadHeaders describes an upload's progress in HEAD and PATCH responses
+func setTusUploadHeaders(w http.ResponseWriter, upload *service.TusUpload) {
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Size, 10))
+	w.Header().Set("Cache-Control", "no-store")
+	if upload.Finished() && upload.File != nil {
+		w.Header().Set(tusFileSlugHeader, upload.File.Slug)
+	}
+}
+
+// TusOptions advertises the supported tus version, extensions and limits
+func (h *FileHandler) TusOptions(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	user := auth.GetUserFromContext(r.Context())
+	maxFileSize, err := h.fileSvc.GetEffectiveMaxFileSize(r.Context(), userID, user.Can(domain.PermUnlimitedFiles))
+	if err != nil {
+		Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+	w.Header().Set("Tus-Checksum-Algorithm", tusChecksumAlgorithms)
+	if maxFileSize > 0 {
+		w.Header().Set("Tus-Max-Size", strconv.FormatInt(maxFileSize, 10))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// TusCreate creates an upload (creation extension). The file name and type come from the
+// filename/filetype metadata; a sha256 entry lets the data go straight to its file record.
+func (h *FileHandler) TusCreate(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Upload-Defer-Length") != "" {
+		ErrorMessage(w, http.StatusBadRequest, "Upload-Defer-Length is not supported")
+		return
+	}
+	size, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || size <= 0 {
+		ErrorMessage(w, http.StatusBadRequest, "Upload-Length must be a positive integer")
+		return
+	}
+	meta, err := parseTusMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		Error(w, http.StatusBadRequest, err)
+		return
+	}
+
+	name := firstOf(meta, "filename", "name")
+	if name == "" {
+		name = "upload"
+	}
+	contentType := firstOf(meta, "filetype", "type", "contentType")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	userID := auth.GetUserIDFromContext(r.Context())
+	user := auth.GetUserFromContext(r.Context())
+	maxFileSize, err := h.fileSvc.GetEffectiveMaxFileSize(r.Context(), userID, user.Can(domain.PermUnlimitedFiles))
+	if err != nil {
+		Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	upload, err := h.fileSvc.CreateTusUpload(r.Context(), domain.CreateFileRequest{
+		Name:        name,
+		Hash:        strings.ToLower(firstOf(meta, "sha256", "hash")),
+		Size:        size,
+		ContentType: contentType,
+		UserID:      userID,
+	}, maxFileSize)
+	if err != nil {
+		if handleTusError(w, err) {
+			return
+		}
+		Error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Location", tusPath+upload.ID)
+	setTusUploadHeaders(w, upload)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// TusHead reports an upload's current offset so clients can resume
+func (h *FileHandler) TusHead(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	upload, err := h.fileSvc.GetTusUpload(r.Context(), chi.URLParam(r, "id"), userID)
+	if err != nil {
+		if errors.Is(err, service.ErrTusUploadNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	setTusUploadHeaders(w, upload)
+	w.WriteHeader(http.StatusOK)
+}
+
+// TusPatch appends a chunk at Upload-Offset. With the checksum extension the chunk is
+// buffered to a temporary file and only written if it matches Upload-Checksum.
+func (h *FileHandler) TusPatch(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Content-Type") != tusContentType {
+		ErrorMessage(w, http.StatusUnsupportedMediaType, "Content-Type must be "+tusContentType)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		ErrorMessage(w, http.StatusBadRequest, "Upload-Offset must be a non-negative integer")
+		return
+	}
+
+	userID := auth.GetUserIDFromContext(r.Context())
+	user := auth.GetUserFromContext(r.Context())
+	maxFileSize, err := h.fileSvc.GetEffectiveMaxFileSize(r.Context(), userID, user.Can(domain.PermUnlimitedFiles))
+	if err != nil {
+		Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	if maxFileSize > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, maxFileSize)
+	}
+
+	var body io.Reader = r.Body
+	if checksum := r.Header.Get("Upload-Checksum"); checksum != "" {
+		algorithm, encoded, _ := strings.Cut(checksum, " ")
+		expected, err := base64.StdEncoding.DecodeString(encoded)
+		hasher := newChecksumHash(algorithm)
+		if err != nil || hasher == nil {
+			ErrorMessage(w, http.StatusBadRequest, "unsupported or malformed Upload-Checksum")
+			return
+		}
+
+		tmp, err := os.CreateTemp("", "tus-chunk-*")
+		if err != nil {
+			Error(w, http.StatusInternalServerError, err)
+			return
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+
+		if _, err := io.Copy(io.MultiWriter(tmp, hasher), r.Body); err != nil {
+			Error(w, http.StatusBadRequest, err)
+			return
+		}
+		if !bytes.Equal(hasher.Sum(nil), expected) {
+			ErrorMessage(w, statusChecksumMismatch, "checksum mismatch")
+			return
+		}
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			Error(w, http.StatusInternalServerError, err)
+			return
+		}
+		body = tmp
+	}
+
+	upload, err := h.fileSvc.WriteTusUpload(r.Context(), chi.URLParam(r, "id"), userID, offset, body, maxFileSize)
+	if err != nil {
+		if handleTusError(w, err) {
+			return
+		}
+		Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	setTusUploadHeaders(w, upload)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// TusDelete terminates an upload (termination extension)
+func (h *FileHandler) TusDelete(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	if err := h.fileSvc.DeleteTusUpload(r.Context(), chi.URLParam(r, "id"), userID); err != nil {
+		if handleTusError(w, err) {
+			return
+		}
+		Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,184 @@
+package v1
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func tusRequest(method, path string, body []byte) *http.Request {
+	req := httptest.NewRequest(method, path, bytes.NewReader(body))
+	req.Header.Set("Tus-Resumable", tusVersion)
+	return req
+}
+
+func tusPatchRequest(path string, offset int64, chunk []byte) *http.Request {
+	req := tusRequest(http.MethodPatch, path, chunk)
+	req.Header.Set(headerContentType, tusContentType)
+	req.Header.Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	return req
+}
+
+func tusMetadata(pairs ...string) string {
+	var parts []string
+	for i := 0; i+1 < len(pairs); i += 2 {
+		parts = append(parts, pairs[i]+" "+base64.StdEncoding.EncodeToString([]byte(pairs[i+1])))
+	}
+	return strings.Join(parts, ",")
+}
+
+func TestParseTusMetadata(t *testing.T) {
+	meta, err := parseTusMetadata("filename bXkgZmlsZS50eHQ=, filetype dGV4dC9wbGFpbg==,is_confidential")
+	require.NoError(t, err)
+	assert.Equal(t, "my file.txt", meta["filename"])
+	assert.Equal(t, "text/plain", meta["filetype"])
+	assert.Contains(t, meta, "is_confidential")
+
+	_, err = parseTusMetadata("filename not*base64")
+	assert.Error(t, err)
+}
+
+func TestTusResumable(t *testing.T) {
+	var method string
+	r := chi.NewRouter()
+	r.Use(tusResumable)
+	r.HandleFunc("/*", func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	req := httptest.NewRequest(http.MethodHead, "/abc", nil)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+	assert.Equal(t, tusVersion, rec.Header().Get("Tus-Version"))
+
+	req = tusRequest(http.MethodPost, "/abc", nil)
+	req.Header.Set("X-HTTP-Method-Override", "PATCH")
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, http.MethodPatch, method)
+	assert.Equal(t, tusVersion, rec.Header().Get("Tus-Resumable"))
+}
+
+func TestFileHandlerTusStagedUpload(t *testing.T) {
+	ctx := context.Background()
+	router, _, cleanup := setupFileHandlerTest(t, ctx)
+	defer cleanup()
+
+	content := []byte("uploaded through tus without a hash up front")
+
+	req := httptest.NewRequest(http.MethodOptions, tusPath, nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, tusExtensions, rec.Header().Get("Tus-Extension"))
+
+	req = tusRequest(http.MethodPost, tusPath, nil)
+	req.Header.Set("Upload-Length", strconv.Itoa(len(content)))
+	req.Header.Set("Upload-Metadata", tusMetadata("filename", "tus.txt", "filetype", contentTypePlain))
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	location := rec.Header().Get("Location")
+	require.NotEmpty(t, location)
+
+	req = tusRequest(http.MethodHead, location, nil)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "0", rec.Header().Get("Upload-Offset"))
+	assert.Equal(t, strconv.Itoa(len(content)), rec.Header().Get("Upload-Length"))
+
+	// First half, with a checksum
+	half := int64(len(content) / 2)
+	sum := sha1.Sum(content[:half])
+	req = tusPatchRequest(location, 0, content[:half])
+	req.Header.Set("Upload-Checksum", "sha1 "+base64.StdEncoding.EncodeToString(sum[:]))
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+	assert.Equal(t, strconv.FormatInt(half, 10), rec.Header().Get("Upload-Offset"))
+
+	// Wrong offset
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, tusPatchRequest(location, 0, content[half:]))
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	// Bad checksum is rejected without writing anything
+	req = tusPatchRequest(location, half, content[half:])
+	req.Header.Set("Upload-Checksum", "sha1 "+base64.StdEncoding.EncodeToString(sum[:]))
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, statusChecksumMismatch, rec.Code)
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, tusPatchRequest(location, half, content[half:]))
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+	assert.Equal(t, strconv.Itoa(len(content)), rec.Header().Get("Upload-Offset"))
+	slug := rec.Header().Get(tusFileSlugHeader)
+	require.NotEmpty(t, slug)
+
+	req = httptest.NewRequest(http.MethodGet, pathAPIV1Files+slug, nil)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	got, _ := io.ReadAll(rec.Body)
+	assert.Equal(t, content, got)
+	assert.Contains(t, rec.Header().Get("Content-Disposition"), "tus.txt")
+}
+
+func TestFileHandlerTusUploadWithHash(t *testing.T) {
+	ctx := context.Background()
+	router, _, cleanup := setupFileHandlerTest(t, ctx)
+	defer cleanup()
+
+	content := []byte("uploaded through tus with a sha256")
+	sum := sha256.Sum256(content)
+
+	create := func() string {
+		req := tusRequest(http.MethodPost, tusPath, nil)
+		req.Header.Set("Upload-Length", strconv.Itoa(len(content)))
+		req.Header.Set("Upload-Metadata", tusMetadata("filename", "hashed.txt", "sha256", fmt.Sprintf("%x", sum[:])))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+		return rec.Header().Get("Location")
+	}
+
+	// Terminating an unfinished upload removes it
+	location := create()
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, tusRequest(http.MethodDelete, location, nil))
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, tusRequest(http.MethodHead, location, nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	location = create()
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, tusPatchRequest(location, 0, content))
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+	slug := rec.Header().Get(tusFileSlugHeader)
+	require.NotEmpty(t, slug)
+
+	req := httptest.NewRequest(http.MethodGet, pathAPIV1FileMetadata+slug, nil)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"name":"hashed.txt"`)
+}
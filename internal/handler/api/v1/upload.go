@@ -0,0 +1,140 @@
+package v1
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zqz/web/backend/internal/domain"
+	"github.com/zqz/web/backend/internal/handler"
+	"github.com/zqz/web/backend/internal/handler/auth"
+	"github.com/zqz/web/backend/internal/service"
+)
+
+const (
+	// uploadFormField is the multipart field holding the file
+	uploadFormField = "file"
+	// maxFormOverhead allows for multipart boundaries and small fields around the file
+	maxFormOverhead = 1 << 20
+	// maxFormFieldLen caps the optional non-file fields
+	maxFormFieldLen = 64
+)
+
+// UploadResponse is returned by the one-shot upload endpoint
+type UploadResponse struct {
+	FileResponse
+	// URL is the absolute address of the file's page, for sharing
+	URL string `json:"url"`
+}
+
+// wantsPlainText reports whether the client asked for a text/plain response
+func wantsPlainText(r *http.Request) bool {
+	return r.URL.Query().Get("format") == "text" || strings.Contains(r.Header.Get("Accept"), "text/plain")
+}
+
+// absoluteURL turns a site path into a full URL using the request's host and scheme
+func absoluteURL(r *http.Request, path string) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + path
+}
+
+// UploadForm uploads a whole file in one multipart/form-data request (curl -F file=@x.png).
+// The file part is streamed to storage and hashed server-side. Optional expires_in and
+// max_downloads fields apply when they come before the file. Responds with JSON, or with
+// just the file's URL when the client accepts text/plain or passes ?format=text.
+func (h *FileHandler) UploadForm(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	user := auth.GetUserFromContext(r.Context())
+	moderator := user.Can(domain.PermModerateFiles)
+
+	maxFileSize, err := h.fileSvc.GetEffectiveMaxFileSize(r.Context(), userID, user.Can(domain.PermUnlimitedFiles))
+	if err != nil {
+		Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	if maxFileSize > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, maxFileSize+maxFormOverhead)
+	}
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		ErrorMessage(w, http.StatusBadRequest, "expected a multipart/form-data body")
+		return
+	}
+
+	req := domain.CreateFileRequest{UserID: userID}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			ErrorMessage(w, http.StatusBadRequest, "missing \""+uploadFormField+"\" field")
+			return
+		}
+		if err != nil {
+			Error(w, http.StatusBadRequest, err)
+			return
+		}
+
+		if part.FormName() != uploadFormField {
+			value, _ := io.ReadAll(io.LimitReader(part, maxFormFieldLen))
+			n, err := strconv.ParseInt(strings.TrimSpace(string(value)), 10, 64)
+			switch part.FormName() {
+			case "expires_in":
+				if err != nil || n <= 0 {
+					ErrorMessage(w, http.StatusBadRequest, "expires_in must be a positive number of seconds")
+					return
+				}
+				t := time.Now().UTC().Add(time.Duration(n) * time.Second)
+				req.ExpiresAt = &t
+			case "max_downloads":
+				if err != nil || n <= 0 || n > 1<<31-1 {
+					ErrorMessage(w, http.StatusBadRequest, "max_downloads must be a positive integer")
+					return
+				}
+				m := int32(n)
+				req.MaxDownloads = &m
+			}
+			continue
+		}
+
+		req.Name = part.FileName()
+		if req.Name == "" {
+			req.Name = "upload"
+		}
+		req.ContentType = part.Header.Get("Content-Type")
+		if req.ContentType == "" {
+			req.ContentType = "application/octet-stream"
+		}
+
+		file, err := h.fileSvc.UploadFile(r.Context(), req, part, maxFileSize)
+		if err != nil {
+			if errors.Is(err, service.ErrHashMismatch) {
+				ErrorMessage(w, http.StatusBadRequest, "file hash verification failed")
+				return
+			}
+			if handleCreateFileError(w, err) {
+				return
+			}
+			Error(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		url := absoluteURL(r, "/view/"+file.Slug)
+		if wantsPlainText(r) {
+			handler.SetContentType(w, handler.ContentTypeText)
+			w.WriteHeader(http.StatusCreated)
+			io.WriteString(w, url+"\n")
+			return
+		}
+
+		resp := UploadResponse{FileResponse: toFileResponse(file), URL: url}
+		resp.CanEdit = canEditFile(file, userID, moderator)
+		JSON(w, http.StatusCreated, resp)
+		return
+	}
+}
@@ -0,0 +1,101 @@
+package v1
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const pathAPIV1Upload = "/api/v1/upload"
+
+func multipartUpload(t *testing.T, fields map[string]string, filename, contentType string, content []byte) (*bytes.Buffer, string) {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for k, v := range fields {
+		require.NoError(t, mw.WriteField(k, v))
+	}
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="%s"`, filename))
+	h.Set("Content-Type", contentType)
+	part, err := mw.CreatePart(h)
+	require.NoError(t, err)
+	_, err = part.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, mw.Close())
+	return &body, mw.FormDataContentType()
+}
+
+func TestWantsPlainTextAndAbsoluteURL(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "http://example.com"+pathAPIV1Upload, nil)
+	assert.False(t, wantsPlainText(req))
+	assert.Equal(t, "http://example.com/view/abc", absoluteURL(req, "/view/abc"))
+
+	req.Header.Set("Accept", "text/plain")
+	req.Header.Set("X-Forwarded-Proto", "https")
+	assert.True(t, wantsPlainText(req))
+	assert.Equal(t, "https://example.com/view/abc", absoluteURL(req, "/view/abc"))
+
+	req = httptest.NewRequest(http.MethodPost, pathAPIV1Upload+"?format=text", nil)
+	assert.True(t, wantsPlainText(req))
+}
+
+func TestFileHandlerUploadForm(t *testing.T) {
+	ctx := context.Background()
+	router, _, cleanup := setupFileHandlerTest(t, ctx)
+	defer cleanup()
+
+	content := []byte("one-shot multipart upload")
+	sum := sha256.Sum256(content)
+
+	body, ct := multipartUpload(t, map[string]string{"max_downloads": "2"}, "shot.txt", contentTypePlain, content)
+	req := httptest.NewRequest(http.MethodPost, pathAPIV1Upload, body)
+	req.Header.Set(headerContentType, ct)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	var resp UploadResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	assert.Equal(t, "shot.txt", resp.Name)
+	assert.Equal(t, fmt.Sprintf("%x", sum[:]), resp.Hash)
+	assert.Equal(t, int64(len(content)), resp.Size)
+	assert.Equal(t, resp.Size, resp.BytesReceived)
+	require.NotNil(t, resp.MaxDownloads)
+	assert.Equal(t, int32(2), *resp.MaxDownloads)
+	assert.Equal(t, "http://example.com/view/"+resp.Slug, resp.URL)
+
+	// Same content again, plain-text response: a new record sharing the stored data
+	body, ct = multipartUpload(t, nil, "again.txt", contentTypePlain, content)
+	req = httptest.NewRequest(http.MethodPost, pathAPIV1Upload, body)
+	req.Header.Set(headerContentType, ct)
+	req.Header.Set("Accept", "text/plain")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	url := strings.TrimSpace(rec.Body.String())
+	assert.True(t, strings.HasPrefix(url, "http://example.com/view/"))
+	assert.NotEqual(t, resp.URL, url)
+
+	// Missing file field
+	var empty bytes.Buffer
+	mw := multipart.NewWriter(&empty)
+	require.NoError(t, mw.WriteField("expires_in", "60"))
+	require.NoError(t, mw.Close())
+	req = httptest.NewRequest(http.MethodPost, pathAPIV1Upload, &empty)
+	req.Header.Set(headerContentType, mw.FormDataContentType())
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
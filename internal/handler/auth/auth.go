@@ -3,14 +3,15 @@ package auth
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/gorilla/sessions"
 	"github.com/markbates/goth"
 	"github.com/markbates/goth/gothic"
-	"github.com/markbates/goth/providers/google"
 	"github.com/rs/zerolog"
 
 	"github.com/zqz/web/backend/internal/config"
@@ -22,8 +23,9 @@ import (
 type contextKey string
 
 const (
-	userIDKey contextKey = "user_id"
-	userKey   contextKey = "user"
+	userIDKey   contextKey = "user_id"
+	userKey     contextKey = "user"
+	apiTokenKey contextKey = "api_token"
 )
 
 // AuthHandler handles authentication-related HTTP requests
@@ -31,6 +33,7 @@ type AuthHandler struct {
 	userSvc *service.UserService
 	logger  *zerolog.Logger
 	store   *sessions.CookieStore
+	login   LoginOptions
 }
 
 // NewAuthHandler creates a new auth handler
@@ -45,49 +48,80 @@ func NewAuthHandler(userSvc *service.UserService, logger *zerolog.Logger, cfg *c
 
 	gothic.Store = store
 
-	// Setup OAuth providers
-	if cfg.GoogleClientID != "" && cfg.GoogleClientSecret != "" {
-		goth.UseProviders(
-			google.New(
-				cfg.GoogleClientID,
-				cfg.GoogleClientSecret,
-				cfg.GoogleCallbackURL,
-			),
-		)
-		logger.Info().Msg("Google OAuth provider configured")
-	}
-
 	return &AuthHandler{
 		userSvc: userSvc,
 		logger:  logger,
 		store:   store,
+		login: LoginOptions{
+			Providers:   configureProviders(cfg, logger),
+			LocalLogin:  cfg.LocalLogin,
+			LocalSignup: cfg.LocalLogin && cfg.LocalSignup,
+		},
 	}
 }
 
-// BeginAuth starts the OAuth flow
+// LoginOptions returns the ways of signing in that are configured
+func (h *AuthHandler) LoginOptions() LoginOptions {
+	return h.login
+}
+
+// BeginAuth starts the OAuth flow for the provider in the path (or, on /auth/login, the
+// provider query parameter). /auth/login without one goes to the login page, or straight
+// to the provider when it is the only way of signing in.
 func (h *AuthHandler) BeginAuth(w http.ResponseWriter, r *http.Request) {
-	// Set provider in query if not present
-	q := r.URL.Query()
-	if q.Get("provider") == "" {
-		q.Set("provider", "google")
-		r.URL.RawQuery = q.Encode()
+	provider := chi.URLParam(r, "provider")
+	if provider == "" {
+		provider = r.URL.Query().Get("provider")
+	}
+	if provider == "" {
+		if len(h.login.Providers) == 1 && !h.login.LocalLogin {
+			provider = h.login.Providers[0].Name
+		} else {
+			http.Redirect(w, r, "/login", http.StatusTemporaryRedirect)
+			return
+		}
+	}
+	if !h.login.HasProvider(provider) {
+		http.Error(w, "Unknown login provider", http.StatusNotFound)
+		return
 	}
 
-	gothic.BeginAuthHandler(w, r)
+	gothic.BeginAuthHandler(w, withProvider(r, provider))
 }
 
-// CallbackAuth handles the OAuth callback
+// CallbackAuth handles the OAuth callback for the provider in the path. A signed-in user
+// coming back from a provider has the identity linked to their account; anyone else is
+// signed in as the user the identity belongs to, created on first sign-in.
 func (h *AuthHandler) CallbackAuth(w http.ResponseWriter, r *http.Request) {
-	authUser, err := gothic.CompleteUserAuth(w, r)
+	provider := chi.URLParam(r, "provider")
+	if !h.login.HasProvider(provider) {
+		http.Error(w, "Unknown login provider", http.StatusNotFound)
+		return
+	}
+
+	authUser, err := gothic.CompleteUserAuth(w, withProvider(r, provider))
 	if err != nil {
-		h.logger.Error().Err(err).Msg("failed to complete auth")
+		h.logger.Error().Ctx(r.Context()).Err(err).Str("provider", provider).Msg("failed to complete auth")
 		http.Error(w, "Authentication failed", http.StatusInternalServerError)
 		return
 	}
+	if authUser.Email == "" {
+		h.logger.Warn().Ctx(r.Context()).Str("provider", provider).Msg("login provider returned no email address")
+		http.Error(w, "Your account with this provider has no email address", http.StatusBadRequest)
+		return
+	}
+
+	if current := GetUserFromContext(r.Context()); current != nil && GetAPITokenFromContext(r.Context()) == nil {
+		h.linkIdentity(w, r, current, provider, authUser)
+		return
+	}
 
 	// Get or create user
-	// Use email as name fallback if name is empty
+	// Use nickname, then email, as name fallback if name is empty
 	name := authUser.Name
+	if name == "" {
+		name = authUser.NickName
+	}
 	if name == "" {
 		name = authUser.Email
 	}
@@ -95,35 +129,73 @@ func (h *AuthHandler) CallbackAuth(w http.ResponseWriter, r *http.Request) {
 	user, err := h.userSvc.GetOrCreateUser(r.Context(), domain.CreateUserRequest{
 		Email:      authUser.Email,
 		Name:       name,
-		Provider:   "google",
+		Provider:   provider,
 		ProviderID: authUser.UserID,
-		Role:       "member",
+		Role:       domain.RoleMember,
 	})
 	if err != nil {
-		h.logger.Error().Err(err).Msg("failed to get or create user")
+		h.logger.Error().Ctx(r.Context()).Err(err).Msg("failed to get or create user")
 		http.Error(w, "Failed to create user", http.StatusInternalServerError)
 		return
 	}
 
-	// Store user ID in session
+	if !h.startSession(w, r, user, provider) {
+		return
+	}
+
+	// Redirect to home
+	http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+}
+
+// linkIdentity links the provider account a signed-in user just authenticated as
+func (h *AuthHandler) linkIdentity(w http.ResponseWriter, r *http.Request, user *domain.User, provider string, authUser goth.User) {
+	if user.IsBanned(time.Now()) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if _, err := h.userSvc.LinkIdentity(r.Context(), user.ID, provider, authUser.UserID, authUser.Email); err != nil {
+		if errors.Is(err, service.ErrIdentityInUse) {
+			http.Error(w, "This account is already linked to another user", http.StatusConflict)
+			return
+		}
+		h.logger.Error().Ctx(r.Context()).Err(err).Msg("failed to link identity")
+		http.Error(w, "Failed to link account", http.StatusInternalServerError)
+		return
+	}
+
+	h.logger.Info().Ctx(r.Context()).Int32("user_id", user.ID).Str("provider", provider).Msg("identity linked")
+
+	http.Redirect(w, r, "/user", http.StatusTemporaryRedirect)
+}
+
+// startSession stores the signed-in user in the session cookie. Writes an error and
+// returns false if the session can't be saved.
+func (h *AuthHandler) startSession(w http.ResponseWriter, r *http.Request, user *domain.User, provider string) bool {
 	session, err := h.store.Get(r, "auth-session")
 	if err != nil {
-		h.logger.Error().Err(err).Msg("failed to get session")
+		h.logger.Error().Ctx(r.Context()).Err(err).Msg("failed to get session")
 		http.Error(w, "Session error", http.StatusInternalServerError)
-		return
+		return false
 	}
 
 	session.Values["user_id"] = user.ID
 	if err := session.Save(r, w); err != nil {
-		h.logger.Error().Err(err).Msg("failed to save session")
+		h.logger.Error().Ctx(r.Context()).Err(err).Msg("failed to save session")
 		http.Error(w, "Session error", http.StatusInternalServerError)
-		return
+		return false
 	}
 
-	h.logger.Info().Int32("user_id", user.ID).Str("email", user.Email).Msg("user logged in")
+	h.logger.Info().Ctx(r.Context()).Int32("user_id", user.ID).Str("email", user.Email).Str("provider", provider).Msg("user logged in")
+	return true
+}
 
-	// Redirect to home
-	http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+// withProvider pins the provider gothic uses for r, so a provider query parameter
+// can't override the one in the path
+func withProvider(r *http.Request, provider string) *http.Request {
+	q := r.URL.Query()
+	q.Set("provider", provider)
+	r.URL.RawQuery = q.Encode()
+	return r
 }
 
 // Logout logs out the user
@@ -138,20 +210,22 @@ func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
 	// Clear gothic session
 	gothic.Logout(w, r)
 
-	h.logger.Info().Msg("user logged out")
+	h.logger.Info().Ctx(r.Context()).Msg("user logged out")
 
 	http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 }
 
 // meResponse is the JSON shape for GET /auth/me
 type meResponse struct {
-	Authenticated bool   `json:"authenticated"`
-	ID            int32  `json:"id,omitempty"`
-	Email         string `json:"email,omitempty"`
-	Name          string `json:"name,omitempty"`
-	Admin         bool   `json:"admin,omitempty"`
-	DisplayTag    string `json:"display_tag,omitempty"`
-	Colour        string `json:"colour,omitempty"`
+	Authenticated bool                `json:"authenticated"`
+	ID            int32               `json:"id,omitempty"`
+	Email         string              `json:"email,omitempty"`
+	Name          string              `json:"name,omitempty"`
+	Admin         bool                `json:"admin,omitempty"`
+	Role          string              `json:"role,omitempty"`
+	Permissions   []domain.Permission `json:"permissions,omitempty"`
+	DisplayTag    string              `json:"display_tag,omitempty"`
+	Colour        string              `json:"colour,omitempty"`
 }
 
 // CurrentUser returns the current user info as JSON
@@ -165,7 +239,7 @@ func (h *AuthHandler) CurrentUser(w http.ResponseWriter, r *http.Request) {
 
 	user, err := h.userSvc.GetUserByID(r.Context(), *userID)
 	if err != nil {
-		h.logger.Error().Err(err).Msg("failed to get user")
+		h.logger.Error().Ctx(r.Context()).Err(err).Msg("failed to get user")
 		http.Error(w, "Failed to get user", http.StatusInternalServerError)
 		return
 	}
@@ -177,6 +251,8 @@ func (h *AuthHandler) CurrentUser(w http.ResponseWriter, r *http.Request) {
 		Email:         user.Email,
 		Name:          user.Name,
 		Admin:         user.IsAdmin(),
+		Role:          user.Role,
+		Permissions:   domain.RolePermissions(user.Role),
 		DisplayTag:    user.DisplayTag,
 		Colour:        user.Colour,
 	})
@@ -213,7 +289,7 @@ func (h *AuthHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
 
 	user, err := h.userSvc.UpdateProfile(r.Context(), *userID, tag, colour)
 	if err != nil {
-		h.logger.Warn().Err(err).Msg("update profile failed")
+		h.logger.Warn().Ctx(r.Context()).Err(err).Msg("update profile failed")
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
@@ -225,14 +301,27 @@ func (h *AuthHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
 		Email:         user.Email,
 		Name:          user.Name,
 		Admin:         user.IsAdmin(),
+		Role:          user.Role,
+		Permissions:   domain.RolePermissions(user.Role),
 		DisplayTag:    user.DisplayTag,
 		Colour:        user.Colour,
 	})
 }
 
-// AuthMiddleware checks if user is authenticated and loads user into context
+// AuthMiddleware checks if user is authenticated and loads user into context.
+// A request carrying "Authorization: Bearer <token>" is authenticated by personal
+// API token instead of the session cookie; an invalid or expired token is rejected with 401.
+// The user and client IP are also set as the service.Actor audited changes are attributed to.
 func (h *AuthHandler) AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := handler.ClientIP(r)
+		r = r.WithContext(service.WithActor(r.Context(), service.Actor{IP: ip}))
+
+		if bearer, ok := bearerToken(r); ok {
+			h.serveWithAPIToken(w, r, next, bearer)
+			return
+		}
+
 		session, err := h.store.Get(r, "auth-session")
 		if err != nil {
 			next.ServeHTTP(w, r)
@@ -261,7 +350,7 @@ func (h *AuthHandler) AuthMiddleware(next http.Handler) http.Handler {
 		// Load user from database
 		user, err := h.userSvc.GetUserByID(r.Context(), userID)
 		if err != nil {
-			h.logger.Warn().Err(err).Int32("user_id", userID).Msg("failed to load user from session")
+			h.logger.Warn().Ctx(r.Context()).Err(err).Int32("user_id", userID).Msg("failed to load user from session")
 			next.ServeHTTP(w, r)
 			return
 		}
@@ -269,11 +358,75 @@ func (h *AuthHandler) AuthMiddleware(next http.Handler) http.Handler {
 		// Add user to context
 		ctx := context.WithValue(r.Context(), userIDKey, userID)
 		ctx = context.WithValue(ctx, userKey, user)
+		ctx = service.WithActor(ctx, service.Actor{UserID: &userID, IP: ip})
 
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+func (h *AuthHandler) serveWithAPIToken(w http.ResponseWriter, r *http.Request, next http.Handler, bearer string) {
+	user, token, err := h.userSvc.AuthenticateAPIToken(r.Context(), bearer)
+	if err != nil {
+		msg := "Invalid API token"
+		switch {
+		case errors.Is(err, service.ErrAPITokenExpired):
+			msg = "API token expired"
+		case errors.Is(err, service.ErrInvalidAPIToken):
+		default:
+			h.logger.Error().Ctx(r.Context()).Err(err).Msg("failed to authenticate api token")
+		}
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		http.Error(w, msg, http.StatusUnauthorized)
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), userIDKey, user.ID)
+	ctx = context.WithValue(ctx, userKey, user)
+	ctx = context.WithValue(ctx, apiTokenKey, token)
+	ctx = service.WithActor(ctx, service.Actor{UserID: &user.ID, IP: handler.ClientIP(r)})
+
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// bearerToken extracts the token from an "Authorization: Bearer <token>" header
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// RequireScope middleware rejects requests authenticated by an API token that lacks scope.
+// Session-authenticated and anonymous requests pass through unchanged.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token := GetAPITokenFromContext(r.Context()); token != nil && !token.HasScope(scope) {
+				http.Error(w, "API token lacks required scope: "+scope, http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// errSessionRequired is the 403 message for token-authenticated requests to session-only routes
+const errSessionRequired = "This requires signing in with a browser session"
+
+// SessionOnly middleware rejects requests authenticated by an API token with 403. Token scopes
+// only govern /api/v1, so the web pages, admin forms and account routes are for browser sessions only.
+func SessionOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if GetAPITokenFromContext(r.Context()) != nil {
+			http.Error(w, errSessionRequired, http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 // RequireAuth middleware requires authentication. If unauthorizedHandler is non-nil and request accepts HTML, it is used instead of plain 401.
 func (h *AuthHandler) RequireAuth(next http.Handler, unauthorizedHandler http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -289,11 +442,10 @@ func (h *AuthHandler) RequireAuth(next http.Handler, unauthorizedHandler http.Ha
 	})
 }
 
-// RequireAdmin middleware requires admin role. If forbiddenHandler is non-nil and request accepts HTML, it is used instead of plain 403.
-func (h *AuthHandler) RequireAdmin(next http.Handler, forbiddenHandler http.Handler) http.Handler {
+// RequirePermission middleware requires a user whose role grants perm. If forbiddenHandler is non-nil and request accepts HTML, it is used instead of plain 403.
+func (h *AuthHandler) RequirePermission(perm domain.Permission, next http.Handler, forbiddenHandler http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		user := GetUserFromContext(r.Context())
-		if user == nil || !user.IsAdmin() {
+		if !GetUserFromContext(r.Context()).Can(perm) {
 			if forbiddenHandler != nil && acceptsHTML(r) {
 				forbiddenHandler.ServeHTTP(w, r)
 				return
@@ -305,6 +457,44 @@ func (h *AuthHandler) RequireAdmin(next http.Handler, forbiddenHandler http.Hand
 	})
 }
 
+// bannedResponse is the JSON body for requests refused by RejectBanned
+type bannedResponse struct {
+	Error       string     `json:"error"`
+	Code        string     `json:"code"`
+	Reason      string     `json:"reason,omitempty"`
+	BannedUntil *time.Time `json:"banned_until,omitempty"`
+}
+
+// RejectBanned middleware refuses anything but GET, HEAD and OPTIONS from a user whose ban
+// is in force, so a banned user can still browse and sign out. If bannedHandler is non-nil and
+// request accepts HTML, it is used instead of the JSON 403.
+func (h *AuthHandler) RejectBanned(next http.Handler, bannedHandler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		user := GetUserFromContext(r.Context())
+		if user == nil || !user.IsBanned(time.Now()) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if bannedHandler != nil && acceptsHTML(r) {
+			bannedHandler.ServeHTTP(w, r)
+			return
+		}
+		handler.SetContentType(w, handler.ContentTypeJSON)
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(bannedResponse{
+			Error:       service.ErrUserBanned.Error(),
+			Code:        "user_banned",
+			Reason:      user.BanReason,
+			BannedUntil: user.BannedUntil,
+		})
+	})
+}
+
 func acceptsHTML(r *http.Request) bool {
 	return strings.Contains(r.Header.Get("Accept"), "text/html")
 }
@@ -313,11 +503,34 @@ func acceptsHTML(r *http.Request) bool {
 func NewRouter(h *AuthHandler) *chi.Mux {
 	r := chi.NewRouter()
 
-	r.Get("/login", h.BeginAuth)
-	r.Get("/google/callback", h.CallbackAuth)
-	r.Get("/logout", h.Logout)
 	r.Get("/me", h.CurrentUser)
-	r.Patch("/profile", h.UpdateProfile)
+
+	// Everything else is for browser sessions; an API token can only ask who it belongs to
+	r.Group(func(r chi.Router) {
+		r.Use(SessionOnly)
+
+		r.Get("/login", h.BeginAuth)
+		r.Get("/logout", h.Logout)
+		r.Patch("/profile", h.UpdateProfile)
+
+		// Personal API tokens (a token cannot mint or revoke tokens)
+		r.Get("/tokens", h.ListTokens)
+		r.Post("/tokens", h.CreateToken)
+		r.Delete("/tokens/{id}", h.RevokeToken)
+
+		// Email and password accounts
+		r.Post("/local/login", h.LocalLogin)
+		r.Post("/local/register", h.LocalRegister)
+		r.Post("/local/password", h.SetLocalPassword)
+
+		// Linked identities. Linking goes through a provider's login flow while signed in.
+		r.Get("/identities", h.ListIdentities)
+		r.Delete("/identities/{id}", h.UnlinkIdentity)
+
+		// External providers; each has its own callback path
+		r.Get("/{provider}/login", h.BeginAuth)
+		r.Get("/{provider}/callback", h.CallbackAuth)
+	})
 
 	return r
 }
@@ -337,3 +550,11 @@ func GetUserFromContext(ctx context.Context) *domain.User {
 	}
 	return nil
 }
+
+// GetAPITokenFromContext retrieves the API token the request was authenticated with, or nil for session auth
+func GetAPITokenFromContext(ctx context.Context) *domain.APIToken {
+	if token, ok := ctx.Value(apiTokenKey).(*domain.APIToken); ok {
+		return token
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zqz/web/backend/internal/config"
+	"github.com/zqz/web/backend/internal/domain"
+	"github.com/zqz/web/backend/internal/repository"
+	"github.com/zqz/web/backend/internal/service"
+	"github.com/zqz/web/backend/internal/tests"
+)
+
+func okHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+func withToken(r *http.Request, scopes ...string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), apiTokenKey, &domain.APIToken{Scopes: scopes}))
+}
+
+func TestRequireScope(t *testing.T) {
+	h := RequireScope(domain.ScopeUpload)(http.HandlerFunc(okHandler))
+
+	t.Run("session request passes", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("token with scope passes", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, withToken(httptest.NewRequest(http.MethodPost, "/", nil), domain.ScopeRead, domain.ScopeUpload))
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("token without scope is forbidden", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, withToken(httptest.NewRequest(http.MethodPost, "/", nil), domain.ScopeRead))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), "lacks required scope: "+domain.ScopeUpload)
+	})
+}
+
+func TestSessionOnly(t *testing.T) {
+	h := SessionOnly(http.HandlerFunc(okHandler))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Even a token with every scope is refused
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, withToken(httptest.NewRequest(http.MethodGet, "/", nil), domain.ScopeRead, domain.ScopeUpload, domain.ScopeDelete))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), errSessionRequired)
+}
+
+func TestAuthMiddlewareBearerToken(t *testing.T) {
+	ctx := context.Background()
+	pg, cleanup := tests.SetupTestDB(t, ctx)
+	defer cleanup()
+
+	repo := repository.NewRepository(pg.Pool)
+	userSvc := service.NewUserService(repo)
+	logger := zerolog.Nop()
+	h := NewAuthHandler(userSvc, &logger, &config.Config{SessionSecret: "test-secret", Env: "development"})
+
+	admin, err := userSvc.GetOrCreateUser(ctx, domain.CreateUserRequest{
+		Name:       "Admin",
+		Email:      "admin@example.com",
+		Provider:   "google",
+		ProviderID: "google-admin",
+		Role:       domain.RoleAdmin,
+	})
+	require.NoError(t, err)
+
+	readOnly, _, err := userSvc.CreateAPIToken(ctx, admin.ID, domain.CreateAPITokenRequest{Name: "read", Scopes: []string{domain.ScopeRead}})
+	require.NoError(t, err)
+
+	// Stand-ins for an /api/v1 write, an admin form and the account routes
+	r := chi.NewRouter()
+	r.Use(h.AuthMiddleware)
+	r.Mount("/auth", NewRouter(h))
+	r.With(RequireScope(domain.ScopeRead)).Get("/api/v1/files", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, admin.ID, *GetUserIDFromContext(r.Context()))
+		assert.NotNil(t, GetAPITokenFromContext(r.Context()))
+		okHandler(w, r)
+	})
+	r.With(RequireScope(domain.ScopeUpload)).Post("/api/v1/files", okHandler)
+	r.With(SessionOnly).Post("/admin/settings", okHandler)
+
+	do := func(method, path, bearer string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader("{}"))
+		if bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("token with scope authenticates", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/v1/files", readOnly).Code)
+	})
+
+	t.Run("token without scope cannot write", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, do(http.MethodPost, "/api/v1/files", readOnly).Code)
+	})
+
+	t.Run("invalid token is unauthorized", func(t *testing.T) {
+		w := do(http.MethodGet, "/api/v1/files", "zqz_notatoken")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, `Bearer error="invalid_token"`, w.Header().Get("WWW-Authenticate"))
+	})
+
+	t.Run("admin token cannot use admin forms", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, do(http.MethodPost, "/admin/settings", readOnly).Code)
+	})
+
+	t.Run("token cannot change the profile", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, do(http.MethodPatch, "/auth/profile", readOnly).Code)
+	})
+
+	t.Run("token can ask who it belongs to", func(t *testing.T) {
+		w := do(http.MethodGet, "/auth/me", readOnly)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"id":`)
+	})
+}
@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/zqz/web/backend/internal/domain"
+	"github.com/zqz/web/backend/internal/handler"
+	"github.com/zqz/web/backend/internal/service"
+)
+
+// identityResponse is the JSON shape for a linked sign-in identity
+type identityResponse struct {
+	ID          int32     `json:"id"`
+	Provider    string    `json:"provider"`
+	Email       string    `json:"email,omitempty"`
+	HasPassword bool      `json:"has_password,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ListIdentities returns the ways the current user can sign in as JSON
+func (h *AuthHandler) ListIdentities(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	identities, err := h.userSvc.ListIdentities(r.Context(), userID)
+	if err != nil {
+		h.logger.Error().Ctx(r.Context()).Err(err).Msg("failed to list identities")
+		http.Error(w, "Failed to list identities", http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]identityResponse, len(identities))
+	for i, identity := range identities {
+		resp[i] = toIdentityResponse(identity)
+	}
+	handler.SetContentType(w, handler.ContentTypeJSON)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// UnlinkIdentity removes one of the current user's identities. The last one can't be removed.
+func (h *AuthHandler) UnlinkIdentity(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid identity ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.userSvc.UnlinkIdentity(r.Context(), userID, int32(id)); err != nil {
+		switch {
+		case errors.Is(err, service.ErrIdentityNotFound):
+			http.Error(w, "Identity not found", http.StatusNotFound)
+		case errors.Is(err, service.ErrLastIdentity):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			h.logger.Error().Ctx(r.Context()).Err(err).Msg("failed to unlink identity")
+			http.Error(w, "Failed to unlink identity", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	h.logger.Info().Ctx(r.Context()).Int32("user_id", userID).Int64("identity_id", id).Msg("identity unlinked")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func toIdentityResponse(i *domain.Identity) identityResponse {
+	return identityResponse{
+		ID:          i.ID,
+		Provider:    i.Provider,
+		Email:       i.Email,
+		HasPassword: i.HasPassword,
+		CreatedAt:   i.CreatedAt,
+	}
+}
@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/zqz/web/backend/internal/domain"
+	"github.com/zqz/web/backend/internal/handler"
+	"github.com/zqz/web/backend/internal/service"
+)
+
+// loginErrorCodes maps local account errors to the code the login page shows a message for
+var loginErrorCodes = []struct {
+	err  error
+	code string
+}{
+	{service.ErrInvalidCredentials, "invalid"},
+	{service.ErrTooManyLoginAttempts, "throttled"},
+	{service.ErrEmailTaken, "email_taken"},
+	{service.ErrInvalidEmail, "invalid_email"},
+	{service.ErrInvalidAccountPassword, "password"},
+}
+
+// LocalLogin signs in with an email and password. Form: email, password.
+func (h *AuthHandler) LocalLogin(w http.ResponseWriter, r *http.Request) {
+	if !h.login.LocalLogin {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+
+	user, err := h.userSvc.AuthenticateLocal(r.Context(), r.FormValue("email"), r.FormValue("password"))
+	if err != nil {
+		h.localError(w, r, "local login failed", err)
+		return
+	}
+	if !h.startSession(w, r, user, domain.ProviderLocal) {
+		return
+	}
+	h.localDone(w, r)
+}
+
+// LocalRegister creates an email and password account and signs in as it (LOCAL_SIGNUP only).
+// Form: name (optional), email, password.
+func (h *AuthHandler) LocalRegister(w http.ResponseWriter, r *http.Request) {
+	if !h.login.LocalSignup {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+
+	user, err := h.userSvc.RegisterLocal(r.Context(), domain.RegisterLocalRequest{
+		Name:     r.FormValue("name"),
+		Email:    r.FormValue("email"),
+		Password: r.FormValue("password"),
+	})
+	if err != nil {
+		h.localError(w, r, "local registration failed", err)
+		return
+	}
+	if !h.startSession(w, r, user, domain.ProviderLocal) {
+		return
+	}
+	h.localDone(w, r)
+}
+
+// SetLocalPasswordRequest is the JSON body for POST /auth/local/password
+type SetLocalPasswordRequest struct {
+	Password string `json:"password"`
+}
+
+// SetLocalPassword lets the current user sign in with their email and a password
+func (h *AuthHandler) SetLocalPassword(w http.ResponseWriter, r *http.Request) {
+	if !h.login.LocalLogin {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+	userID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var req SetLocalPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	identity, err := h.userSvc.SetLocalPassword(r.Context(), userID, req.Password)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidAccountPassword), errors.Is(err, service.ErrInvalidEmail):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, service.ErrEmailTaken):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			h.logger.Error().Ctx(r.Context()).Err(err).Msg("failed to set local password")
+			http.Error(w, "Failed to set password", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	h.logger.Info().Ctx(r.Context()).Int32("user_id", userID).Msg("local password set")
+
+	handler.SetContentType(w, handler.ContentTypeJSON)
+	json.NewEncoder(w).Encode(toIdentityResponse(identity))
+}
+
+// localError reports a failed local sign-in or registration: back to the login page with
+// an error code for browsers, a plain error for anything else
+func (h *AuthHandler) localError(w http.ResponseWriter, r *http.Request, msg string, err error) {
+	status := http.StatusBadRequest
+	code := ""
+	for _, c := range loginErrorCodes {
+		if errors.Is(err, c.err) {
+			code = c.code
+		}
+	}
+	switch {
+	case code == "":
+		h.logger.Error().Ctx(r.Context()).Err(err).Msg(msg)
+		status = http.StatusInternalServerError
+	case errors.Is(err, service.ErrInvalidCredentials):
+		status = http.StatusUnauthorized
+	case errors.Is(err, service.ErrTooManyLoginAttempts):
+		status = http.StatusTooManyRequests
+	case errors.Is(err, service.ErrEmailTaken):
+		status = http.StatusConflict
+	}
+
+	if acceptsHTML(r) && code != "" {
+		http.Redirect(w, r, "/login?error="+url.QueryEscape(code), http.StatusSeeOther)
+		return
+	}
+	if status == http.StatusInternalServerError {
+		http.Error(w, "Sign-in failed", status)
+		return
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// localDone finishes a successful local sign-in: home for browsers, 204 for anything else
+func (h *AuthHandler) localDone(w http.ResponseWriter, r *http.Request) {
+	if acceptsHTML(r) {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"strings"
+
+	"github.com/markbates/goth"
+	"github.com/markbates/goth/providers/github"
+	"github.com/markbates/goth/providers/google"
+	"github.com/markbates/goth/providers/openidConnect"
+	"github.com/rs/zerolog"
+
+	"github.com/zqz/web/backend/internal/config"
+	"github.com/zqz/web/backend/internal/domain"
+)
+
+// LoginProvider is an external login provider offered on the login page. Its flow
+// starts at /auth/{Name}/login and returns to /auth/{Name}/callback.
+type LoginProvider struct {
+	Name  string
+	Label string
+}
+
+// LoginOptions are the ways of signing in that are configured
+type LoginOptions struct {
+	Providers   []LoginProvider
+	LocalLogin  bool // email and password sign-in
+	LocalSignup bool // anyone can register an email and password account
+}
+
+// HasProvider returns true if name is a configured external provider
+func (o LoginOptions) HasProvider(name string) bool {
+	for _, p := range o.Providers {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// configureProviders registers a goth provider for each external login configured in cfg.
+// A provider that fails to set up (e.g. an unreachable OIDC issuer) is logged and left out.
+func configureProviders(cfg *config.Config, logger *zerolog.Logger) []LoginProvider {
+	var providers []goth.Provider
+	var login []LoginProvider
+
+	if cfg.GoogleClientID != "" && cfg.GoogleClientSecret != "" {
+		providers = append(providers, google.New(cfg.GoogleClientID, cfg.GoogleClientSecret, cfg.GoogleCallbackURL))
+		login = append(login, LoginProvider{Name: domain.ProviderGoogle, Label: "Google"})
+		logger.Info().Msg("Google OAuth provider configured")
+	}
+
+	if cfg.GitHubClientID != "" && cfg.GitHubClientSecret != "" {
+		// user:email lets goth fetch the primary address when the profile email is private
+		providers = append(providers, github.New(cfg.GitHubClientID, cfg.GitHubClientSecret, cfg.GitHubCallbackURL, "read:user", "user:email"))
+		login = append(login, LoginProvider{Name: domain.ProviderGitHub, Label: "GitHub"})
+		logger.Info().Msg("GitHub OAuth provider configured")
+	}
+
+	if cfg.OIDCIssuer != "" {
+		discovery := strings.TrimSuffix(cfg.OIDCIssuer, "/") + "/.well-known/openid-configuration"
+		p, err := openidConnect.New(cfg.OIDCClientID, cfg.OIDCClientSecret, cfg.OIDCCallbackURL, discovery, "email", "profile")
+		if err != nil {
+			logger.Error().Err(err).Str("issuer", cfg.OIDCIssuer).Msg("failed to configure OpenID Connect provider")
+		} else {
+			p.SetName(domain.ProviderOIDC)
+			providers = append(providers, p)
+			login = append(login, LoginProvider{Name: domain.ProviderOIDC, Label: cfg.OIDCName})
+			logger.Info().Str("issuer", cfg.OIDCIssuer).Msg("OpenID Connect provider configured")
+		}
+	}
+
+	goth.UseProviders(providers...)
+	return login
+}
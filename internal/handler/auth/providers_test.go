@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/markbates/goth"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zqz/web/backend/internal/config"
+	"github.com/zqz/web/backend/internal/domain"
+)
+
+// mockIssuer is a minimal OpenID Connect provider: discovery, a token endpoint that
+// accepts the code "good" and a userinfo endpoint
+func mockIssuer(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 srv.URL,
+			"authorization_endpoint": srv.URL + "/authorize",
+			"token_endpoint":         srv.URL + "/token",
+			"userinfo_endpoint":      srv.URL + "/userinfo",
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "good" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		claims, _ := json.Marshal(map[string]any{
+			"iss":   srv.URL,
+			"aud":   "client",
+			"sub":   "user-42",
+			"email": "dana@example.com",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+		})
+		idToken := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." +
+			base64.RawURLEncoding.EncodeToString(claims) + "."
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "at", "token_type": "Bearer", "expires_in": 3600, "id_token": idToken,
+		})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer at" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"sub": "user-42", "name": "Dana"})
+	})
+	return srv
+}
+
+func TestConfigureProvidersOIDC(t *testing.T) {
+	idp := mockIssuer(t)
+	logger := zerolog.Nop()
+	login := configureProviders(&config.Config{
+		GitHubClientID:     "gh",
+		GitHubClientSecret: "gh-secret",
+		OIDCIssuer:         idp.URL + "/",
+		OIDCClientID:       "client",
+		OIDCClientSecret:   "secret",
+		OIDCCallbackURL:    "http://app.test/auth/oidc/callback",
+		OIDCName:           "Mock IdP",
+	}, &logger)
+	t.Cleanup(goth.ClearProviders)
+
+	opts := LoginOptions{Providers: login}
+	assert.True(t, opts.HasProvider(domain.ProviderGitHub))
+	assert.True(t, opts.HasProvider(domain.ProviderOIDC))
+	assert.False(t, opts.HasProvider(domain.ProviderGoogle))
+	assert.Equal(t, LoginProvider{Name: domain.ProviderOIDC, Label: "Mock IdP"}, login[1])
+
+	provider, err := goth.GetProvider(domain.ProviderOIDC)
+	require.NoError(t, err)
+	sess, err := provider.BeginAuth("state")
+	require.NoError(t, err)
+	authURL, err := sess.GetAuthURL()
+	require.NoError(t, err)
+	assert.Contains(t, authURL, idp.URL+"/authorize?")
+	assert.Contains(t, authURL, "redirect_uri="+url.QueryEscape("http://app.test/auth/oidc/callback"))
+
+	_, err = sess.Authorize(provider, url.Values{"code": {"bad"}})
+	require.Error(t, err)
+	_, err = sess.Authorize(provider, url.Values{"code": {"good"}})
+	require.NoError(t, err)
+	user, err := provider.FetchUser(sess)
+	require.NoError(t, err)
+	assert.Equal(t, domain.ProviderOIDC, user.Provider)
+	assert.Equal(t, "user-42", user.UserID)
+	assert.Equal(t, "dana@example.com", user.Email)
+	assert.Equal(t, "Dana", user.Name)
+}
+
+func TestConfigureProvidersSkipsUnreachableIssuer(t *testing.T) {
+	idp := httptest.NewServer(http.NotFoundHandler())
+	idp.Close()
+	logger := zerolog.Nop()
+	login := configureProviders(&config.Config{
+		OIDCIssuer:      idp.URL,
+		OIDCClientID:    "client",
+		OIDCCallbackURL: "http://app.test/auth/oidc/callback",
+	}, &logger)
+	t.Cleanup(goth.ClearProviders)
+
+	assert.Empty(t, login)
+	_, err := goth.GetProvider(domain.ProviderOIDC)
+	assert.Error(t, err)
+}
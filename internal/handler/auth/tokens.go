@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/zqz/web/backend/internal/domain"
+	"github.com/zqz/web/backend/internal/handler"
+	"github.com/zqz/web/backend/internal/service"
+)
+
+// tokenResponse is the JSON shape for a personal API token. Token is only set on creation.
+type tokenResponse struct {
+	ID         int32      `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Token      string     `json:"token,omitempty"`
+}
+
+// CreateTokenRequest is the JSON body for POST /auth/tokens
+type CreateTokenRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays *int     `json:"expires_in_days"` // nil or 0 = never expires
+}
+
+// ListTokens returns the current user's personal API tokens as JSON
+func (h *AuthHandler) ListTokens(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	tokens, err := h.userSvc.ListAPITokens(r.Context(), userID)
+	if err != nil {
+		h.logger.Error().Ctx(r.Context()).Err(err).Msg("failed to list api tokens")
+		http.Error(w, "Failed to list tokens", http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]tokenResponse, len(tokens))
+	for i, token := range tokens {
+		resp[i] = toTokenResponse(token)
+	}
+
+	handler.SetContentType(w, handler.ContentTypeJSON)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// CreateToken mints a personal API token. The plaintext token is only returned in this response.
+func (h *AuthHandler) CreateToken(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var req CreateTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	createReq := domain.CreateAPITokenRequest{
+		Name:   req.Name,
+		Scopes: req.Scopes,
+	}
+	if req.ExpiresInDays != nil && *req.ExpiresInDays != 0 {
+		if *req.ExpiresInDays < 0 {
+			http.Error(w, "expires_in_days must be positive", http.StatusBadRequest)
+			return
+		}
+		expiresAt := time.Now().AddDate(0, 0, *req.ExpiresInDays)
+		createReq.ExpiresAt = &expiresAt
+	}
+
+	plaintext, token, err := h.userSvc.CreateAPIToken(r.Context(), userID, createReq)
+	if err != nil {
+		h.logger.Warn().Ctx(r.Context()).Err(err).Msg("create api token failed")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.logger.Info().Ctx(r.Context()).Int32("user_id", userID).Int32("token_id", token.ID).Msg("api token created")
+
+	resp := toTokenResponse(token)
+	resp.Token = plaintext
+
+	handler.SetContentType(w, handler.ContentTypeJSON)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// RevokeToken deletes one of the current user's personal API tokens
+func (h *AuthHandler) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid token ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.userSvc.RevokeAPIToken(r.Context(), userID, int32(id)); err != nil {
+		if errors.Is(err, service.ErrAPITokenNotFound) {
+			http.Error(w, "Token not found", http.StatusNotFound)
+			return
+		}
+		h.logger.Error().Ctx(r.Context()).Err(err).Msg("failed to revoke api token")
+		http.Error(w, "Failed to revoke token", http.StatusInternalServerError)
+		return
+	}
+
+	h.logger.Info().Ctx(r.Context()).Int32("user_id", userID).Int64("token_id", id).Msg("api token revoked")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sessionUserID returns the logged-in user's ID, writing an error if the request is
+// anonymous or was authenticated with an API token (tokens cannot manage tokens or sign-in methods).
+func (h *AuthHandler) sessionUserID(w http.ResponseWriter, r *http.Request) (int32, bool) {
+	userID := GetUserIDFromContext(r.Context())
+	if userID == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return 0, false
+	}
+	if GetAPITokenFromContext(r.Context()) != nil {
+		http.Error(w, errSessionRequired, http.StatusForbidden)
+		return 0, false
+	}
+	return *userID, true
+}
+
+func toTokenResponse(t *domain.APIToken) tokenResponse {
+	scopes := t.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+	return tokenResponse{
+		ID:         t.ID,
+		Name:       t.Name,
+		Scopes:     scopes,
+		ExpiresAt:  t.ExpiresAt,
+		LastUsedAt: t.LastUsedAt,
+		CreatedAt:  t.CreatedAt,
+	}
+}
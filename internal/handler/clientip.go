@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+type clientIPKey struct{}
+
+// TrustProxies returns middleware that works out the client address ClientIP reports.
+// X-Forwarded-For is only believed from a peer in trusted: reading it from the right, the
+// first address outside trusted is the client. Any other request is attributed to its peer,
+// so clients can't pick the address they are rate-limited and audited under.
+func TrustProxies(trusted []netip.Prefix) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), clientIPKey{}, forwardedFor(r, trusted))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// ClientIP returns the address of the client that made r, as worked out by TrustProxies.
+// Requests that didn't pass through it are attributed to the peer address without its port.
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey{}).(string); ok {
+		return ip
+	}
+	return peerIP(r)
+}
+
+// forwardedFor walks back along the X-Forwarded-For chain while each hop came from a trusted proxy
+func forwardedFor(r *http.Request, trusted []netip.Prefix) string {
+	ip := peerIP(r)
+	if !isTrusted(ip, trusted) {
+		return ip
+	}
+
+	// Several X-Forwarded-For headers make up one list
+	var hops []string
+	for _, h := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(h, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if _, err := netip.ParseAddr(hop); err != nil {
+			return ip // Garbage before a trusted proxy; it is the last address we know
+		}
+		ip = hop
+		if !isTrusted(ip, trusted) {
+			return ip
+		}
+	}
+	return ip
+}
+
+func isTrusted(ip string, trusted []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range trusted {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func peerIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrustProxies(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("::1/128")}
+	cases := []struct {
+		name   string
+		peer   string
+		header []string
+		want   string
+	}{
+		{"direct", "203.0.113.7:1234", nil, "203.0.113.7"},
+		{"spoofed from an untrusted peer", "203.0.113.7:1234", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"one proxy", "10.0.0.2:1234", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"client prepends a fake hop", "10.0.0.2:1234", []string{"192.0.2.66, 198.51.100.1"}, "198.51.100.1"},
+		{"proxy chain", "10.0.0.2:1234", []string{"198.51.100.1, 10.0.0.3"}, "198.51.100.1"},
+		{"split headers", "10.0.0.2:1234", []string{"198.51.100.1", "10.0.0.3"}, "198.51.100.1"},
+		{"ipv6 proxy", "[::1]:1234", []string{"2001:db8::1"}, "2001:db8::1"},
+		{"garbage hop", "10.0.0.2:1234", []string{"nonsense"}, "10.0.0.2"},
+		{"only proxies", "10.0.0.2:1234", []string{"10.0.0.3"}, "10.0.0.3"},
+		{"no header from a proxy", "10.0.0.2:1234", nil, "10.0.0.2"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tc.peer
+			for _, h := range tc.header {
+				req.Header.Add("X-Forwarded-For", h)
+			}
+			var got string
+			TrustProxies(trusted)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = ClientIP(r)
+			})).ServeHTTP(httptest.NewRecorder(), req)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
@@ -5,6 +5,7 @@ import "net/http"
 const (
 	ContentTypeHTML = "text/html; charset=utf-8"
 	ContentTypeJSON = "application/json"
+	ContentTypeText = "text/plain; charset=utf-8"
 )
 
 // SetContentType sets the response Content-Type header.
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/zqz/web/backend/internal/metrics"
+)
+
+// unmatchedRoute labels requests that no route handled, so unknown paths don't each get a series
+const unmatchedRoute = "unmatched"
+
+// otherMethod labels requests with a method outside the standard set, which clients choose freely
+const otherMethod = "other"
+
+// Metrics records request counts, durations and body sizes labelled by the chi route pattern
+func Metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		rw := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		body := &countingReader{ReadCloser: r.Body}
+		r.Body = body
+
+		next.ServeHTTP(rw, r)
+
+		method, route := methodLabel(r.Method), routePattern(r)
+		metrics.HTTPRequests.WithLabelValues(method, route, strconv.Itoa(rw.statusCode)).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+		metrics.HTTPRequestBytes.WithLabelValues(route).Add(float64(body.bytes))
+		metrics.HTTPResponseBytes.WithLabelValues(route).Add(float64(rw.bytes))
+	})
+}
+
+// routePattern returns the chi pattern of the route that handled r, once it has been served
+func routePattern(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		if pattern := rctx.RoutePattern(); pattern != "" {
+			return pattern
+		}
+	}
+	return unmatchedRoute
+}
+
+// methodLabel returns method if it is a standard HTTP method and otherMethod if not
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return otherMethod
+}
+
+// countingReader counts the bytes read from a request body
+type countingReader struct {
+	io.ReadCloser
+	bytes int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.bytes += int64(n)
+	return n, err
+}
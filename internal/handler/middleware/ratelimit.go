@@ -3,13 +3,14 @@ package middleware
 import (
 	"net/http"
 	"strconv"
-	"strings"
 	"sync"
 	"time"
 
 	"github.com/rs/zerolog"
 	"golang.org/x/time/rate"
 
+	"github.com/zqz/web/backend/internal/handler"
+	"github.com/zqz/web/backend/internal/metrics"
 	"github.com/zqz/web/backend/internal/repository"
 )
 
@@ -52,13 +53,7 @@ func RateLimitAPI(repo *repository.Repository, logger *zerolog.Logger) func(next
 				return
 			}
 
-			ip := r.RemoteAddr
-			if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
-				// Take first (client) when behind proxy (e.g. nginx)
-				if first := strings.TrimSpace(strings.Split(fwd, ",")[0]); first != "" {
-					ip = first
-				}
-			}
+			ip := handler.ClientIP(r)
 
 			var limiter *rate.Limiter
 			if v, ok := limiters.Load(ip); ok {
@@ -75,7 +70,8 @@ func RateLimitAPI(repo *repository.Repository, logger *zerolog.Logger) func(next
 			}
 
 			if !limiter.Allow() {
-				logger.Debug().Str("ip", ip).Int("rps", rps).Msg("API rate limit exceeded")
+				logger.Debug().Ctx(r.Context()).Str("ip", ip).Int("rps", rps).Msg("API rate limit exceeded")
+				metrics.RateLimitRejections.Inc()
 				w.Header().Set("Retry-After", "1")
 				http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
 				return
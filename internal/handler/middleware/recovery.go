@@ -13,8 +13,15 @@ func Recovery(logger *zerolog.Logger) func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			defer func() {
 				if err := recover(); err != nil {
+					// A deliberate abort (e.g. a streamed archive failing part way) must reach
+					// net/http so the client sees a broken connection, not a complete response
+					if err == http.ErrAbortHandler {
+						panic(err)
+					}
+
 					// Log the panic
 					logger.Error().
+						Ctx(r.Context()).
 						Interface("panic", err).
 						Bytes("stack", debug.Stack()).
 						Str("method", r.Method).
@@ -2,48 +2,106 @@ package web
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"html/template"
 	"net/http"
+	"net/url"
 	"strconv"
+	"time"
 
+	"github.com/zqz/web/backend/internal/domain"
 	"github.com/zqz/web/backend/internal/handler"
 	"github.com/zqz/web/backend/internal/handler/auth"
 	"github.com/zqz/web/backend/internal/repository"
+	"github.com/zqz/web/backend/internal/service"
+	"github.com/zqz/web/backend/internal/service/storage"
 )
 
 const siteSettingPublicUploads = "public_uploads_enabled"
 const siteSettingDefaultMaxFileSize = "default_max_file_size"
 const siteSettingAPIRateLimitRPS = "api_rate_limit_rps"
+const siteSettingDefaultFileTTLHours = "default_file_ttl_hours"
+const siteSettingDefaultStorageQuota = "default_storage_quota"
+const siteSettingIncompleteUploadTTLHours = "incomplete_upload_ttl_hours"
 
-// AdminHandler serves the admin panel (admin only).
+// scrubListLimit caps how many problems and orphans the admin panel lists from a scrub report
+const scrubListLimit = 100
+
+// auditPageSize is how many events the audit log page shows at a time
+const auditPageSize = 50
+
+// AdminHandler serves the admin panel and audit log (admin only).
 type AdminHandler struct {
-	repo      *repository.Repository
-	templates *template.Template
+	repo        *repository.Repository
+	fileSvc     *service.FileService
+	settingsSvc *service.SettingsService
+	auditSvc    *service.AuditService
+	scrubber    *service.StorageScrubber
+	templates   *template.Template
 }
 
 // NewAdminHandler creates a new AdminHandler.
-func NewAdminHandler(repo *repository.Repository, templates *template.Template) *AdminHandler {
-	return &AdminHandler{repo: repo, templates: templates}
+func NewAdminHandler(repo *repository.Repository, fileSvc *service.FileService, settingsSvc *service.SettingsService, auditSvc *service.AuditService, scrubber *service.StorageScrubber, templates *template.Template) *AdminHandler {
+	return &AdminHandler{repo: repo, fileSvc: fileSvc, settingsSvc: settingsSvc, auditSvc: auditSvc, scrubber: scrubber, templates: templates}
 }
 
 // AdminPageData is the data for the admin panel.
 type AdminPageData struct {
 	LayoutData
-	FileCount            int64
-	TotalSize            int64
-	TotalSizeFmt         string
-	UserCount            int64
-	BannedCount          int64
-	PublicUploadsEnabled bool
-	DefaultMaxFileSizeMB int64 // 0 means use fallback (100 MB)
-	APIRateLimitRPS      int   // API rate limit (requests/sec); 0 = disabled. Default 10.
+	FileCount                int64
+	TotalSize                int64
+	TotalSizeFmt             string
+	UserCount                int64
+	BannedCount              int64
+	PublicUploadsEnabled     bool
+	DefaultMaxFileSizeMB     int64 // 0 means use fallback (100 MB)
+	APIRateLimitRPS          int   // API rate limit (requests/sec); 0 = disabled. Default 10.
+	DefaultFileTTLHours      int64 // Lifetime of new uploads without an explicit expiry; 0 = forever
+	DefaultStorageQuotaMB    int64 // Total storage per non-admin user; 0 = unlimited
+	IncompleteUploadTTLHours int64 // Unfinished uploads with no data for this long are deleted; 0 = never
+	IncompleteUploads        int64
+	IncompleteBytesFmt       string
+	StaleUploads             int64 // Past the TTL; removed on the next reaper pass
+	StaleBytesFmt            string
+	Scrub                    ScrubView
+}
+
+// ScrubView is the storage scrub section of the admin panel.
+type ScrubView struct {
+	Running        bool
+	Error          string
+	Report         *service.ScrubReport // Last finished scrub; nil if none has run since startup
+	StartedAt      string
+	Duration       string
+	OrphanBytesFmt string
+	Problems       []service.StorageProblem // First scrubListLimit problems
+	Orphans        []storage.Object         // First scrubListLimit orphans
+	MoreProblems   int
+	MoreOrphans    int
 }
 
-// Page serves GET /admin (admin panel). Caller should use RequireAdmin middleware or check admin in handler.
+func scrubViewFromStatus(status service.ScrubStatus) ScrubView {
+	v := ScrubView{Running: status.Running, Report: status.Last}
+	if status.Err != nil {
+		v.Error = status.Err.Error()
+	}
+	if r := status.Last; r != nil {
+		v.StartedAt = r.StartedAt.UTC().Format("2006-01-02 15:04 UTC")
+		v.Duration = r.FinishedAt.Sub(r.StartedAt).Round(time.Second).String()
+		v.OrphanBytesFmt = formatBytesForAdmin(r.OrphanBytes)
+		v.Problems = r.Problems[:min(len(r.Problems), scrubListLimit)]
+		v.MoreProblems = len(r.Problems) - len(v.Problems)
+		v.Orphans = r.Orphans[:min(len(r.Orphans), scrubListLimit)]
+		v.MoreOrphans = len(r.Orphans) - len(v.Orphans)
+	}
+	return v
+}
+
+// Page serves GET /admin (admin panel). Needs domain.PermManageSettings; the router also enforces it.
 func (h *AdminHandler) Page(w http.ResponseWriter, r *http.Request) {
 	user := auth.GetUserFromContext(r.Context())
-	if user == nil || !user.IsAdmin() {
+	if !user.Can(domain.PermManageSettings) {
 		http.Error(w, "Forbidden", http.StatusForbidden)
 		return
 	}
@@ -76,16 +134,43 @@ func (h *AdminHandler) Page(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	var defaultFileTTLHours int64
+	if val, err := h.repo.Settings.Get(ctx, siteSettingDefaultFileTTLHours); err == nil && val != "" {
+		if n, err := strconv.ParseInt(val, 10, 64); err == nil && n >= 0 {
+			defaultFileTTLHours = n
+		}
+	}
+
+	var defaultStorageQuotaMB int64
+	if val, err := h.repo.Settings.Get(ctx, siteSettingDefaultStorageQuota); err == nil && val != "" {
+		if n, err := strconv.ParseInt(val, 10, 64); err == nil && n > 0 {
+			defaultStorageQuotaMB = max(n/(1024*1024), 1)
+		}
+	}
+
+	var incomplete service.IncompleteUploads
+	if stats, err := h.fileSvc.IncompleteUploadStats(ctx); err == nil {
+		incomplete = *stats
+	}
+
 	data := AdminPageData{
-		LayoutData:           LayoutDataFromRequest(r),
-		FileCount:            fileCount,
-		TotalSize:            totalSize,
-		TotalSizeFmt:         formatBytesForAdmin(totalSize),
-		UserCount:            userCount,
-		BannedCount:          bannedCount,
-		PublicUploadsEnabled: publicUploads,
-		DefaultMaxFileSizeMB: defaultMaxFileSizeMB,
-		APIRateLimitRPS:      apiRateLimitRPS,
+		LayoutData:               LayoutDataFromRequest(r),
+		FileCount:                fileCount,
+		TotalSize:                totalSize,
+		TotalSizeFmt:             formatBytesForAdmin(totalSize),
+		UserCount:                userCount,
+		BannedCount:              bannedCount,
+		PublicUploadsEnabled:     publicUploads,
+		DefaultMaxFileSizeMB:     defaultMaxFileSizeMB,
+		APIRateLimitRPS:          apiRateLimitRPS,
+		DefaultFileTTLHours:      defaultFileTTLHours,
+		DefaultStorageQuotaMB:    defaultStorageQuotaMB,
+		IncompleteUploadTTLHours: int64(incomplete.TTL / time.Hour),
+		IncompleteUploads:        incomplete.Uploads,
+		IncompleteBytesFmt:       formatBytesForAdmin(incomplete.Bytes),
+		StaleUploads:             incomplete.Stale,
+		StaleBytesFmt:            formatBytesForAdmin(incomplete.StaleBytes),
+		Scrub:                    scrubViewFromStatus(h.scrubber.Status()),
 	}
 	data.PageTitle = "page.admin"
 
@@ -100,10 +185,10 @@ func (h *AdminHandler) Page(w http.ResponseWriter, r *http.Request) {
 	_ = h.templates.ExecuteTemplate(w, "layout.html", data)
 }
 
-// UpdateSettings handles POST /admin/settings (public uploads, default max file size).
+// UpdateSettings handles POST /admin/settings (public uploads, default max file size, rate limit, default file TTL, storage quota, incomplete upload TTL).
 func (h *AdminHandler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
 	user := auth.GetUserFromContext(r.Context())
-	if user == nil || !user.IsAdmin() {
+	if !user.Can(domain.PermManageSettings) {
 		http.Error(w, "Forbidden", http.StatusForbidden)
 		return
 	}
@@ -116,7 +201,7 @@ func (h *AdminHandler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
 	if r.FormValue("public_uploads") == "on" || r.FormValue("public_uploads") == "1" {
 		value = "true"
 	}
-	if err := h.repo.Settings.Set(r.Context(), siteSettingPublicUploads, value); err != nil {
+	if err := h.settingsSvc.Set(r.Context(), siteSettingPublicUploads, value); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -124,7 +209,7 @@ func (h *AdminHandler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
 	if mbStr := r.FormValue("default_max_file_size_mb"); mbStr != "" {
 		if mb, err := strconv.ParseInt(mbStr, 10, 64); err == nil && mb > 0 {
 			bytesVal := strconv.FormatInt(mb*1024*1024, 10)
-			if err := h.repo.Settings.Set(r.Context(), siteSettingDefaultMaxFileSize, bytesVal); err != nil {
+			if err := h.settingsSvc.Set(r.Context(), siteSettingDefaultMaxFileSize, bytesVal); err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
@@ -133,7 +218,35 @@ func (h *AdminHandler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
 
 	if rpsStr := r.FormValue("api_rate_limit_rps"); rpsStr != "" {
 		if rps, err := strconv.Atoi(rpsStr); err == nil && rps >= 0 {
-			if err := h.repo.Settings.Set(r.Context(), siteSettingAPIRateLimitRPS, strconv.Itoa(rps)); err != nil {
+			if err := h.settingsSvc.Set(r.Context(), siteSettingAPIRateLimitRPS, strconv.Itoa(rps)); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	if ttlStr := r.FormValue("default_file_ttl_hours"); ttlStr != "" {
+		if hours, err := strconv.ParseInt(ttlStr, 10, 64); err == nil && hours >= 0 {
+			if err := h.settingsSvc.Set(r.Context(), siteSettingDefaultFileTTLHours, strconv.FormatInt(hours, 10)); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	if mbStr := r.FormValue("default_storage_quota_mb"); mbStr != "" {
+		if mb, err := strconv.ParseInt(mbStr, 10, 64); err == nil && mb >= 0 {
+			bytesVal := strconv.FormatInt(mb*1024*1024, 10)
+			if err := h.settingsSvc.Set(r.Context(), siteSettingDefaultStorageQuota, bytesVal); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	if ttlStr := r.FormValue("incomplete_upload_ttl_hours"); ttlStr != "" {
+		if hours, err := strconv.ParseInt(ttlStr, 10, 64); err == nil && hours >= 0 {
+			if err := h.settingsSvc.Set(r.Context(), siteSettingIncompleteUploadTTLHours, strconv.FormatInt(hours, 10)); err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
@@ -143,6 +256,28 @@ func (h *AdminHandler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/admin", http.StatusSeeOther)
 }
 
+// StartScrub handles POST /admin/storage/scrub: starts a storage scrub in the background
+// (a dry run unless "apply" is checked) and returns to the admin panel, which shows the result.
+func (h *AdminHandler) StartScrub(w http.ResponseWriter, r *http.Request) {
+	user := auth.GetUserFromContext(r.Context())
+	if !user.Can(domain.PermManageSettings) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	err := h.scrubber.Start(service.ScrubOptions{
+		CheckHash: r.FormValue("check_hash") == "on",
+		Apply:     r.FormValue("apply") == "on",
+		MinAge:    service.DefaultScrubMinAge,
+	})
+	if err != nil && !errors.Is(err, service.ErrScrubRunning) {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	http.Redirect(w, r, "/admin#storage", http.StatusSeeOther)
+}
+
 func formatBytesForAdmin(n int64) string {
 	if n == 0 {
 		return "0 B"
@@ -159,3 +294,116 @@ func formatBytesForAdmin(n int64) string {
 	}
 	return fmt.Sprintf("%.2f %s", float64(n), units[i])
 }
+
+// AuditPageData is the data for the audit log page.
+type AuditPageData struct {
+	LayoutData
+	Events     []AuditEventView
+	Actions    []string // Every audited action, for the filter
+	ActorID    string
+	Action     string
+	TargetType string
+	TargetID   string
+	Total      int64
+	First      int32 // 1-based position of the first event shown
+	Last       int32
+	PrevURL    string // Empty on the first page
+	NextURL    string // Empty on the last page
+}
+
+// AuditEventView is an audit event formatted for the audit log page.
+type AuditEventView struct {
+	*domain.AuditEvent
+	Time   string
+	Before string
+	After  string
+}
+
+// Audit serves GET /admin/audit: the audit log, newest first, filtered by the actor_id,
+// action, target_type and target_id query parameters and paged with offset.
+func (h *AdminHandler) Audit(w http.ResponseWriter, r *http.Request) {
+	user := auth.GetUserFromContext(r.Context())
+	if !user.Can(domain.PermViewAudit) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	q := r.URL.Query()
+	data := AuditPageData{
+		LayoutData: LayoutDataFromRequest(r),
+		Actions:    domain.AuditActions,
+		ActorID:    q.Get("actor_id"),
+		Action:     q.Get("action"),
+		TargetType: q.Get("target_type"),
+		TargetID:   q.Get("target_id"),
+	}
+	data.PageTitle = "page.audit"
+
+	filter := domain.AuditFilter{Action: data.Action, TargetType: data.TargetType, TargetID: data.TargetID}
+	if data.ActorID != "" {
+		id, err := strconv.ParseInt(data.ActorID, 10, 32)
+		if err != nil {
+			http.Error(w, "invalid actor_id", http.StatusBadRequest)
+			return
+		}
+		actorID := int32(id)
+		filter.ActorID = &actorID
+	}
+	var offset int32
+	if o, err := strconv.ParseInt(q.Get("offset"), 10, 32); err == nil && o > 0 {
+		offset = int32(o)
+	}
+
+	events, total, err := h.auditSvc.ListEvents(r.Context(), filter, auditPageSize, offset)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data.Total = total
+	data.Events = make([]AuditEventView, len(events))
+	for i, e := range events {
+		data.Events[i] = AuditEventView{
+			AuditEvent: e,
+			Time:       e.CreatedAt.UTC().Format("2006-01-02 15:04:05 UTC"),
+			Before:     string(e.Before),
+			After:      string(e.After),
+		}
+	}
+	if len(events) > 0 {
+		data.First = offset + 1
+		data.Last = offset + int32(len(events))
+	}
+	if offset > 0 {
+		data.PrevURL = auditPageURL(q, max(offset-auditPageSize, 0))
+	}
+	if int64(offset)+int64(len(events)) < total {
+		data.NextURL = auditPageURL(q, offset+auditPageSize)
+	}
+
+	var buf bytes.Buffer
+	if err := h.templates.ExecuteTemplate(&buf, "content_audit", data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data.Content = template.HTML(buf.String())
+
+	handler.SetContentType(w, handler.ContentTypeHTML)
+	_ = h.templates.ExecuteTemplate(w, "layout.html", data)
+}
+
+// auditPageURL links to the audit log page at offset, keeping the filters in q
+func auditPageURL(q url.Values, offset int32) string {
+	page := url.Values{}
+	for _, k := range []string{"actor_id", "action", "target_type", "target_id"} {
+		if v := q.Get(k); v != "" {
+			page.Set(k, v)
+		}
+	}
+	if offset > 0 {
+		page.Set("offset", strconv.FormatInt(int64(offset), 10))
+	}
+	if len(page) == 0 {
+		return "/admin/audit"
+	}
+	return "/admin/audit?" + page.Encode()
+}
@@ -0,0 +1,127 @@
+package web
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/zqz/web/backend/internal/domain"
+	"github.com/zqz/web/backend/internal/handler"
+	"github.com/zqz/web/backend/internal/handler/auth"
+	"github.com/zqz/web/backend/internal/service"
+)
+
+// AlbumsHandler serves the album list and the shared album gallery.
+type AlbumsHandler struct {
+	albumSvc  *service.AlbumService
+	fileSvc   *service.FileService
+	templates *template.Template
+	notFound  http.HandlerFunc
+}
+
+// NewAlbumsHandler creates an AlbumsHandler. notFound serves albums that don't exist or are private.
+func NewAlbumsHandler(albumSvc *service.AlbumService, fileSvc *service.FileService, templates *template.Template, notFound http.HandlerFunc) *AlbumsHandler {
+	return &AlbumsHandler{albumSvc: albumSvc, fileSvc: fileSvc, templates: templates, notFound: notFound}
+}
+
+// albumRow is one album on the album list page.
+type albumRow struct {
+	Name      string
+	Slug      string
+	Private   bool
+	FileCount int64
+}
+
+// galleryItem is one file tile on an album page.
+type galleryItem struct {
+	Name         string
+	Slug         string
+	SizeFmt      string
+	ContentType  string
+	ThumbnailURL string // empty when the file has no thumbnail or is locked
+	Locked       bool   // the viewer must enter the file's password on its own page first
+}
+
+// albumsPageData is the data for the album list page content.
+type albumsPageData struct {
+	LayoutData
+	Albums []albumRow
+}
+
+// albumPageData is the data for the album gallery content.
+type albumPageData struct {
+	LayoutData
+	Album   *domain.Album
+	Items   []galleryItem
+	CanEdit bool
+}
+
+// List serves the signed-in user's albums and a form to create one. Requires auth.
+func (h *AlbumsHandler) List(w http.ResponseWriter, r *http.Request) {
+	data := albumsPageData{LayoutData: LayoutDataFromRequest(r)}
+	data.PageTitle = "page.albums"
+	userID := auth.GetUserIDFromContext(r.Context())
+	albums, err := h.albumSvc.ListAlbums(r.Context(), *userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, a := range albums {
+		data.Albums = append(data.Albums, albumRow{Name: a.Name, Slug: a.Slug, Private: a.Private, FileCount: a.FileCount})
+	}
+	h.render(w, "content_albums", data, &data.LayoutData)
+}
+
+// Gallery serves an album's thumbnail gallery (URL: /albums/{slug}). Only files the viewer
+// could open on their own are shown; password-protected ones appear locked until unlocked.
+func (h *AlbumsHandler) Gallery(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	user := auth.GetUserFromContext(r.Context())
+	moderator := user.Can(domain.PermModerateFiles)
+
+	album, err := h.albumSvc.GetAlbum(r.Context(), chi.URLParam(r, "slug"), userID, moderator)
+	if err != nil {
+		if errors.Is(err, service.ErrAlbumNotFound) {
+			h.notFound(w, r)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := albumPageData{
+		LayoutData: LayoutDataFromRequest(r),
+		Album:      album,
+		CanEdit:    moderator || (userID != nil && album.IsOwnedBy(*userID)),
+	}
+	data.PageTitle = "page.album"
+	for _, f := range album.Files {
+		item := galleryItem{
+			Name:        f.Name,
+			Slug:        f.Slug,
+			SizeFmt:     formatBytesForUserFiles(f.Size),
+			ContentType: f.ContentType,
+			Locked:      h.fileSvc.NeedsPassword(f, userID, moderator),
+		}
+		if f.Thumbnail != nil && !item.Locked {
+			item.ThumbnailURL = "/api/v1/files/" + f.Slug + "/thumbnail"
+		}
+		data.Items = append(data.Items, item)
+	}
+	h.render(w, "content_album", data, &data.LayoutData)
+}
+
+// render executes contentName with data into the layout, like RenderLayoutWithData but
+// for content that needs more than the layout data
+func (h *AlbumsHandler) render(w http.ResponseWriter, contentName string, data any, layout *LayoutData) {
+	var buf bytes.Buffer
+	if err := h.templates.ExecuteTemplate(&buf, contentName, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	layout.Content = template.HTML(buf.String())
+	handler.SetContentType(w, handler.ContentTypeHTML)
+	_ = h.templates.ExecuteTemplate(w, "layout.html", layout)
+}
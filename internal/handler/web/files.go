@@ -9,6 +9,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/zqz/web/backend/internal/domain"
 	"github.com/zqz/web/backend/internal/handler"
 	"github.com/zqz/web/backend/internal/handler/auth"
 	"github.com/zqz/web/backend/internal/service"
@@ -121,9 +122,9 @@ func (h *FilesHandler) List(w http.ResponseWriter, r *http.Request) {
 
 	userID := auth.GetUserIDFromContext(r.Context())
 	user := auth.GetUserFromContext(r.Context())
-	isAdmin := user != nil && user.IsAdmin()
+	moderator := user.Can(domain.PermModerateFiles)
 
-	files, err := h.fileSvc.ListFiles(r.Context(), limit, offset, userID, isAdmin, search)
+	files, err := h.fileSvc.ListFiles(r.Context(), limit, offset, userID, moderator, search)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -135,19 +136,19 @@ func (h *FilesHandler) List(w http.ResponseWriter, r *http.Request) {
 		if strings.HasPrefix(f.ContentType, "image/") {
 			viewURL = "/api/v1/files/" + f.Slug + "/view"
 		}
-		canEdit := userID != nil && (isAdmin || (f.UserID != nil && *f.UserID == *userID))
+		canEdit := userID != nil && (moderator || (f.UserID != nil && *f.UserID == *userID))
 		rows[i] = FileRow{
 			Name:        f.Name,
 			Comment:     f.Comment,
 			Slug:        f.Slug,
-			Size:        int64(f.Size),
-			SizeFmt:     formatBytes(int64(f.Size)),
+			Size:        f.Size,
+			SizeFmt:     formatBytes(f.Size),
 			ContentType: humanReadableContentType(f.ContentType),
 			Private:     f.Private,
 			ViewURL:     viewURL,
 			DownloadURL: "/api/v1/files/" + f.Slug,
 			CanEdit:     canEdit,
-			ShowDelete:  isAdmin,
+			ShowDelete:  moderator,
 			Complete:    f.BytesReceived == f.Size,
 		}
 	}
@@ -191,7 +192,9 @@ type authUser struct {
 	DisplayTag string
 	Colour     string
 	TextColour string // contrasting text colour when Colour is set
-	Banned     bool
+	Banned     bool   // ban is in force; the layout shows only the ban notice
+	BanReason  string
+	BannedUntil string // formatted ban expiry; empty if the ban is permanent
 }
 
 // humanReadableContentType converts MIME types into short labels (pdf, jpg, mp4, etc).
@@ -8,8 +8,10 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/zqz/web/backend/internal/domain"
 	"github.com/zqz/web/backend/internal/handler"
 	"github.com/zqz/web/backend/internal/handler/auth"
 	"github.com/zqz/web/backend/internal/repository"
@@ -22,7 +24,8 @@ type LayoutData struct {
 	Content              template.HTML
 	TitleExtra           template.HTML // optional content to show to the right of the page title (e.g. files search)
 	User                 *authUser
-	ShowUsers            bool
+	ShowUsers            bool // user can open /users
+	ShowAdmin            bool // user can open /admin
 	PublicUploadsEnabled bool
 	MaxFileSizeMB        int64 // effective max upload size in MB for the current user; 0 = no limit (e.g. admin). Used on upload page.
 }
@@ -65,9 +68,14 @@ func LayoutDataFromRequest(r *http.Request) LayoutData {
 			DisplayTag: user.DisplayTag,
 			Colour:     user.Colour,
 			TextColour: textColour,
-			Banned:     user.Banned,
+			Banned:     user.IsBanned(time.Now()),
+			BanReason:  user.BanReason,
 		}
-		data.ShowUsers = user.IsAdmin()
+		if user.BannedUntil != nil {
+			data.User.BannedUntil = formatBanExpiry(*user.BannedUntil)
+		}
+		data.ShowUsers = user.Can(domain.PermViewUsers)
+		data.ShowAdmin = user.Can(domain.PermManageSettings)
 	}
 	return data
 }
@@ -77,11 +85,13 @@ type PagesHandler struct {
 	templates *template.Template
 	userSvc   *service.UserService
 	fileSvc   *service.FileService
+	login     auth.LoginOptions
 }
 
-// NewPagesHandler creates a handler that serves themed pages.
-func NewPagesHandler(templates *template.Template, userSvc *service.UserService, fileSvc *service.FileService) *PagesHandler {
-	return &PagesHandler{templates: templates, userSvc: userSvc, fileSvc: fileSvc}
+// NewPagesHandler creates a handler that serves themed pages. login lists the ways of
+// signing in offered on the login and profile pages.
+func NewPagesHandler(templates *template.Template, userSvc *service.UserService, fileSvc *service.FileService, login auth.LoginOptions) *PagesHandler {
+	return &PagesHandler{templates: templates, userSvc: userSvc, fileSvc: fileSvc, login: login}
 }
 
 // userFilesPageUser is the user display model for the user files page.
@@ -94,7 +104,43 @@ type userFilesPageUser struct {
 	Colour               string
 	TextColour           string // contrasting text colour for the tag
 	Banned               bool
+	BanReason            string
+	BannedUntil          string // formatted; empty if the ban is permanent
+	BanHidesFiles        bool
 	MaxFileSizeOverrideMB int64 // 0 means use site default
+	StorageQuotaOverrideMB int64 // 0 means use site default
+	Storage                *storageUsageView
+}
+
+// storageUsageView is a user's storage usage formatted for templates.
+type storageUsageView struct {
+	UsedFmt   string
+	QuotaFmt  string
+	Percent   int
+	Unlimited bool
+}
+
+func newStorageUsageView(u domain.StorageUsage) *storageUsageView {
+	return &storageUsageView{
+		UsedFmt:   formatBytesForUserFiles(u.Used),
+		QuotaFmt:  formatBytesForUserFiles(u.Quota),
+		Percent:   min(u.Percent(), 100),
+		Unlimited: u.Unlimited(),
+	}
+}
+
+// profilePageData is the data for the profile page content.
+type profilePageData struct {
+	LayoutData
+	Storage *storageUsageView
+	Login   auth.LoginOptions // providers that can be linked, and whether a password can be set
+}
+
+// loginPageData is the data for the login page content.
+type loginPageData struct {
+	LayoutData
+	Login auth.LoginOptions
+	Error string // i18n key for a failed local sign-in or registration
 }
 
 // userFileRow is one file row for the user files page.
@@ -113,13 +159,12 @@ func (h *PagesHandler) Upload(w http.ResponseWriter, r *http.Request) {
 	data := LayoutDataFromRequest(r)
 	data.PageTitle = ""
 	var userID *int32
-	isAdmin := false
-	if user := auth.GetUserFromContext(r.Context()); user != nil {
+	user := auth.GetUserFromContext(r.Context())
+	if user != nil {
 		id := user.ID
 		userID = &id
-		isAdmin = user.IsAdmin()
 	}
-	if maxBytes, err := h.fileSvc.GetEffectiveMaxFileSize(r.Context(), userID, isAdmin); err == nil && maxBytes > 0 {
+	if maxBytes, err := h.fileSvc.GetEffectiveMaxFileSize(r.Context(), userID, user.Can(domain.PermUnlimitedFiles)); err == nil && maxBytes > 0 {
 		data.MaxFileSizeMB = maxBytes / (1024 * 1024)
 	}
 	RenderLayoutWithData(w, h.templates, "content_upload", &data, r)
@@ -143,12 +188,12 @@ func (h *PagesHandler) View(w http.ResponseWriter, r *http.Request) {
 	RenderLayoutWithData(w, h.templates, "content_file_view", &data, r)
 }
 
-// Users serves the users list page (admin only; middleware enforces).
+// Users serves the users list page (admins and moderators; middleware enforces).
 func (h *PagesHandler) Users(w http.ResponseWriter, r *http.Request) {
 	RenderLayout(w, h.templates, "content_users", "page.users", r)
 }
 
-// UserFiles serves the page for one user and their files (admin only). URL: /users/{id}.
+// UserFiles serves the page for one user and their files (admins and moderators). URL: /users/{id}.
 func (h *PagesHandler) UserFiles(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
 	id64, err := strconv.ParseInt(idStr, 10, 32)
@@ -188,7 +233,7 @@ func (h *PagesHandler) UserFiles(w http.ResponseWriter, r *http.Request) {
 		rows = append(rows, userFileRow{
 			Name:        f.Name,
 			Slug:        f.Slug,
-			SizeFmt:     formatBytesForUserFiles(int64(f.Size)),
+			SizeFmt:     formatBytesForUserFiles(f.Size),
 			ContentType: humanReadableContentType(f.ContentType),
 			Complete:    f.BytesReceived == f.Size,
 			DownloadURL: "/api/v1/files/" + f.Slug,
@@ -203,6 +248,10 @@ func (h *PagesHandler) UserFiles(w http.ResponseWriter, r *http.Request) {
 			maxMB = 1
 		}
 	}
+	quotaMB := int64(0)
+	if user.StorageQuotaOverride != nil && *user.StorageQuotaOverride > 0 {
+		quotaMB = max(*user.StorageQuotaOverride/(1024*1024), 1)
+	}
 	pageUser := &userFilesPageUser{
 		ID:                    user.ID,
 		Name:                  user.Name,
@@ -210,8 +259,17 @@ func (h *PagesHandler) UserFiles(w http.ResponseWriter, r *http.Request) {
 		Role:                  user.Role,
 		DisplayTag:            user.DisplayTag,
 		Colour:                user.Colour,
-		Banned:                user.Banned,
+		Banned:                user.IsBanned(time.Now()),
+		BanReason:             user.BanReason,
+		BanHidesFiles:         user.BanHidesFiles,
 		MaxFileSizeOverrideMB: maxMB,
+		StorageQuotaOverrideMB: quotaMB,
+	}
+	if user.BannedUntil != nil {
+		pageUser.BannedUntil = formatBanExpiry(*user.BannedUntil)
+	}
+	if usage, err := h.fileSvc.GetStorageUsage(r.Context(), userID); err == nil {
+		pageUser.Storage = newStorageUsageView(usage)
 	}
 	if pageUser.Colour == "" {
 		pageUser.Colour = "var(--border)"
@@ -220,14 +278,17 @@ func (h *PagesHandler) UserFiles(w http.ResponseWriter, r *http.Request) {
 		pageUser.TextColour = contrastTextColour(pageUser.Colour)
 	}
 
+	viewer := auth.GetUserFromContext(r.Context())
 	data := LayoutDataFromRequest(r)
 	data.PageTitle = strings.ToLower(user.Name)
 	var buf bytes.Buffer
 	if err := h.templates.ExecuteTemplate(&buf, "content_user_files", struct {
-		User           *userFilesPageUser
-		Files          []userFileRow
-		ShowBanOption  bool
-	}{pageUser, rows, true}); err != nil {
+		User          *userFilesPageUser
+		Files         []userFileRow
+		ShowBanOption bool
+		ShowManage    bool     // role, tag and limit forms
+		Roles         []string // choices for the role form
+	}{pageUser, rows, viewer.Can(domain.PermBanUsers), viewer.Can(domain.PermManageUsers), domain.Roles}); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -253,14 +314,15 @@ func formatBytesForUserFiles(n int64) string {
 	return strconv.FormatFloat(float64(n), 'f', 2, 64) + " " + units[i]
 }
 
-// UserSetBan handles POST /users/{id}/ban and POST /users/{id}/unban (admin only). Redirects back to user page.
+// UserSetBan handles POST /users/{id}/ban and POST /users/{id}/unban (admins and moderators). Redirects back to user page.
+// Ban form: reason, until (UTC date or datetime; empty = until unbanned), hide_files.
 func (h *PagesHandler) UserSetBan(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 	user := auth.GetUserFromContext(r.Context())
-	if user == nil || !user.IsAdmin() {
+	if !user.Can(domain.PermBanUsers) {
 		http.Error(w, "Forbidden", http.StatusForbidden)
 		return
 	}
@@ -271,19 +333,51 @@ func (h *PagesHandler) UserSetBan(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	userID := int32(id64)
-	banned := !strings.HasSuffix(r.URL.Path, "/unban")
-	_, err = h.userSvc.SetBanned(r.Context(), userID, banned)
+	if strings.HasSuffix(r.URL.Path, "/unban") {
+		_, err = h.userSvc.UnbanUser(r.Context(), userID)
+	} else {
+		req := domain.BanRequest{
+			Reason:    r.FormValue("reason"),
+			HideFiles: r.FormValue("hide_files") != "",
+		}
+		if v := strings.TrimSpace(r.FormValue("until")); v != "" {
+			until, perr := parseBanExpiry(v)
+			if perr != nil {
+				http.Error(w, "Invalid ban expiry", http.StatusBadRequest)
+				return
+			}
+			req.Until = &until
+		}
+		_, err = h.userSvc.BanUser(r.Context(), userID, req)
+	}
 	if err != nil {
 		if errors.Is(err, service.ErrUserNotFound) {
 			http.Error(w, "Not Found", http.StatusNotFound)
 			return
 		}
+		if errors.Is(err, service.ErrInvalidBan) {
+			http.Error(w, "Ban reason must be at most 500 characters and expiry in the future", http.StatusBadRequest)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	http.Redirect(w, r, "/users/"+idStr, http.StatusSeeOther)
 }
 
+// parseBanExpiry parses the ban form's expiry, a datetime-local or date value in UTC
+func parseBanExpiry(v string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02T15:04", v); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", v)
+}
+
+// formatBanExpiry formats a ban expiry for display
+func formatBanExpiry(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04 UTC")
+}
+
 // UserSetMaxFileSize handles POST /users/{id}/max-file-size (admin only). Form: max_file_size_mb (empty = use default).
 func (h *PagesHandler) UserSetMaxFileSize(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -291,7 +385,7 @@ func (h *PagesHandler) UserSetMaxFileSize(w http.ResponseWriter, r *http.Request
 		return
 	}
 	user := auth.GetUserFromContext(r.Context())
-	if user == nil || !user.IsAdmin() {
+	if !user.Can(domain.PermManageUsers) {
 		http.Error(w, "Forbidden", http.StatusForbidden)
 		return
 	}
@@ -321,6 +415,73 @@ func (h *PagesHandler) UserSetMaxFileSize(w http.ResponseWriter, r *http.Request
 	http.Redirect(w, r, "/users/"+idStr, http.StatusSeeOther)
 }
 
+// UserSetStorageQuota handles POST /users/{id}/storage-quota (admin only). Form: storage_quota_mb (empty = use default).
+func (h *PagesHandler) UserSetStorageQuota(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user := auth.GetUserFromContext(r.Context())
+	if !user.Can(domain.PermManageUsers) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	idStr := chi.URLParam(r, "id")
+	id64, err := strconv.ParseInt(idStr, 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	userID := int32(id64)
+	var quotaBytes *int64
+	if mbStr := r.FormValue("storage_quota_mb"); mbStr != "" {
+		if mb, err := strconv.ParseInt(mbStr, 10, 64); err == nil && mb > 0 {
+			b := mb * 1024 * 1024
+			quotaBytes = &b
+		}
+	}
+	_, err = h.userSvc.SetStorageQuota(r.Context(), userID, quotaBytes)
+	if err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/users/"+idStr, http.StatusSeeOther)
+}
+
+// UserSetRole handles POST /users/{id}/role (admin only). Form: role, one of domain.Roles.
+func (h *PagesHandler) UserSetRole(w http.ResponseWriter, r *http.Request) {
+	user := auth.GetUserFromContext(r.Context())
+	if !user.Can(domain.PermManageUsers) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	idStr := chi.URLParam(r, "id")
+	id64, err := strconv.ParseInt(idStr, 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	_, err = h.userSvc.SetRole(r.Context(), int32(id64), r.FormValue("role"))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrUserNotFound):
+			http.Error(w, "Not Found", http.StatusNotFound)
+		case errors.Is(err, service.ErrInvalidRole):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, service.ErrLastAdmin):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	http.Redirect(w, r, "/users/"+idStr, http.StatusSeeOther)
+}
+
 // UserSetProfile handles POST /users/{id}/profile (admin only). Form: display_tag, colour (hex #RRGGBB). Updates the user's display tag and colour.
 func (h *PagesHandler) UserSetProfile(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -328,7 +489,7 @@ func (h *PagesHandler) UserSetProfile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	user := auth.GetUserFromContext(r.Context())
-	if user == nil || !user.IsAdmin() {
+	if !user.Can(domain.PermManageUsers) {
 		http.Error(w, "Forbidden", http.StatusForbidden)
 		return
 	}
@@ -361,9 +522,54 @@ func (h *PagesHandler) APIDocs(w http.ResponseWriter, r *http.Request) {
 	RenderLayout(w, h.templates, "content_api_docs", "page.api_docs", r)
 }
 
-// Profile serves the user profile page (display tag and colour). Requires auth.
+// loginErrors maps the error codes auth.LocalLogin and auth.LocalRegister redirect with to messages
+var loginErrors = map[string]string{
+	"invalid":       "login.error_invalid",
+	"throttled":     "login.error_throttled",
+	"email_taken":   "login.error_email_taken",
+	"invalid_email": "login.error_invalid_email",
+	"password":      "login.error_password",
+}
+
+// Login serves the login page: a button per external provider and, when enabled, the
+// email and password forms. Signed-in users are sent to their profile.
+func (h *PagesHandler) Login(w http.ResponseWriter, r *http.Request) {
+	if auth.GetUserIDFromContext(r.Context()) != nil {
+		http.Redirect(w, r, "/user", http.StatusSeeOther)
+		return
+	}
+	data := loginPageData{LayoutData: LayoutDataFromRequest(r), Login: h.login}
+	data.PageTitle = "page.login"
+	data.Error = loginErrors[r.URL.Query().Get("error")]
+
+	var buf bytes.Buffer
+	if err := h.templates.ExecuteTemplate(&buf, "content_login", data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data.Content = template.HTML(buf.String())
+	handler.SetContentType(w, handler.ContentTypeHTML)
+	_ = h.templates.ExecuteTemplate(w, "layout.html", data.LayoutData)
+}
+
+// Profile serves the user profile page (display tag, colour, storage usage). Requires auth.
 func (h *PagesHandler) Profile(w http.ResponseWriter, r *http.Request) {
-	RenderLayout(w, h.templates, "content_profile", "page.profile", r)
+	data := profilePageData{LayoutData: LayoutDataFromRequest(r), Login: h.login}
+	data.PageTitle = "page.profile"
+	if user := auth.GetUserFromContext(r.Context()); user != nil {
+		if usage, err := h.fileSvc.GetStorageUsage(r.Context(), user.ID); err == nil {
+			data.Storage = newStorageUsageView(usage)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := h.templates.ExecuteTemplate(&buf, "content_profile", data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data.Content = template.HTML(buf.String())
+	handler.SetContentType(w, handler.ContentTypeHTML)
+	_ = h.templates.ExecuteTemplate(w, "layout.html", data.LayoutData)
 }
 
 // NotFound serves the 404 page. Use for r.NotFound.
@@ -404,6 +610,20 @@ func (h *PagesHandler) Forbidden(w http.ResponseWriter, r *http.Request) {
 	_ = h.templates.ExecuteTemplate(w, "layout.html", data)
 }
 
+// Banned serves the 403 page for changes refused because the user is banned (see auth.RejectBanned).
+// The layout shows only the ban notice for a banned user, so there is no content template.
+func (h *PagesHandler) Banned(w http.ResponseWriter, r *http.Request) {
+	if !acceptsHTML(r) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	data := LayoutDataFromRequest(r)
+	data.PageTitle = "page.banned"
+	handler.SetContentType(w, handler.ContentTypeHTML)
+	w.WriteHeader(http.StatusForbidden)
+	_ = h.templates.ExecuteTemplate(w, "layout.html", data)
+}
+
 // Unauthorized serves the 401 page. Use when the user is not logged in (e.g. RequireAuth).
 func (h *PagesHandler) Unauthorized(w http.ResponseWriter, r *http.Request) {
 	if !acceptsHTML(r) {
@@ -6,12 +6,16 @@ var En = map[string]string{
 	"site.title":            "zqz.ca",
 	"site.title_with_page":  "zqz.ca - %s",
 	"site.banned":            "You are banned.",
+	"site.banned_reason":     "Reason:",
+	"site.banned_until":      "Your ban ends",
+	"site.banned_readonly":   "Uploads and changes are disabled.",
 
 	// Page titles (used as .PageTitle in layout)
 	"page.upload":   "upload",
 	"page.files":    "files",
 	"page.users":    "users",
 	"page.admin":    "admin",
+	"page.audit":    "audit log",
 	"page.api":      "api",
 	"page.profile":    "profile",
 	"page.api_docs":   "api",
@@ -19,15 +23,21 @@ var En = map[string]string{
 	"page.file_view":  "View file",
 	"page.not_found":  "not found",
 	"page.forbidden":  "forbidden",
+	"page.banned":     "banned",
 	"page.unauthorized": "unauthorized",
+	"page.login":       "login",
+	"page.albums":      "albums",
+	"page.album":       "album",
 
 	// Nav
 	"nav.upload":   "upload",
 	"nav.files":    "files",
+	"nav.albums":   "albums",
 	"nav.users":   "users",
 	"nav.admin":   "admin",
 	"nav.api":     "api",
 	"nav.login":   "login",
+	"nav.logout":  "logout",
 	"nav.edit_profile_title": "edit profile",
 
 	// Common
@@ -61,6 +71,10 @@ var En = map[string]string{
 	"files.delete_failed":     "Delete failed",
 	"files.no_files_yet":      "No files yet.",
 	"files.upload_first":      "Upload your first file",
+	"files.select_aria":       "Select for download",
+	"files.download_all":      "download all",
+	"files.download_selected": "download selected",
+	"files.archive_format_aria": "Archive format",
 
 	// File edit page
 	"file_edit.name":        "Name",
@@ -87,6 +101,23 @@ var En = map[string]string{
 	"file_edit.complete":      "✓ Complete",
 	"file_edit.uploading":     "Uploading…",
 	"file_edit.save_login_required": "Save (login required)",
+	"file_edit.expires_at":          "Expires at",
+	"file_edit.expires_help":        "Leave empty to keep the file forever.",
+	"file_edit.max_downloads":       "Max downloads",
+	"file_edit.max_downloads_help":  "The file is deleted after this many downloads. Empty or 0 = unlimited.",
+	"file_edit.expires":             "Expires",
+	"file_edit.downloads":           "Downloads",
+	"file_edit.never":               "Never",
+	"file_edit.password":            "Password",
+	"file_edit.password_help":       "Optional. Anyone else needs this password to view or download the file.",
+	"file_edit.password_set_help":   "This file is password protected. Enter a new password to change it.",
+	"file_edit.remove_password":     "Remove password",
+	"file_view.password_required":   "This file is password protected.",
+	"file_view.unlock":              "Unlock",
+	"file_edit.share_link":          "Share link",
+	"file_edit.share_link_help":     "A signed link that works without logging in, even for private or password-protected files, until it expires.",
+	"file_edit.share_single_use":    "Single use",
+	"file_edit.share_create":        "Create link",
 
 	// Upload page
 	"upload.click_or_drag": "Click or drag files to upload",
@@ -105,6 +136,13 @@ var En = map[string]string{
 	"upload.uploading":    "uploading…",
 	"upload.please_login": "please login",
 	"upload.request_failed": "Request failed",
+	"upload.expires":         "Expires",
+	"upload.expires_default": "Site default",
+	"upload.expires_1h":      "after 1 hour",
+	"upload.expires_1d":      "after 1 day",
+	"upload.expires_7d":      "after 7 days",
+	"upload.expires_30d":     "after 30 days",
+	"upload.max_downloads":   "Max downloads",
 
 	// Admin
 	"admin.statistics":     "Statistics",
@@ -112,6 +150,8 @@ var En = map[string]string{
 	"admin.total_size":    "Total size",
 	"admin.total_users":   "Total users",
 	"admin.banned_users":  "Banned users",
+	"admin.incomplete_uploads": "Incomplete uploads",
+	"admin.stale_uploads":      "Stale incomplete uploads",
 	"admin.settings":      "Settings",
 	"admin.allow_public_uploads": "Allow public uploads",
 	"admin.public_uploads_help":  "When disabled, only logged-in users can upload files.",
@@ -119,6 +159,48 @@ var En = map[string]string{
 	"admin.max_file_size_help":      "Per-user limit for non-admin users. Admins have no limit.",
 	"admin.api_rate_limit_rps":      "API rate limit (requests/sec)",
 	"admin.api_rate_limit_help":     "Per-IP limit for /api/v1. 0 = disabled. Default 10.",
+	"admin.default_file_ttl_hours":  "Default file lifetime (hours)",
+	"admin.default_file_ttl_help":   "New uploads without an explicit expiry are deleted after this long. 0 = keep forever.",
+	"admin.default_storage_quota_mb": "Default storage quota (MB)",
+	"admin.storage_quota_help":       "Total storage per non-admin user, including uploads in progress. 0 = unlimited.",
+	"admin.incomplete_upload_ttl_hours": "Incomplete upload timeout (hours)",
+	"admin.incomplete_upload_ttl_help":  "Unfinished uploads that receive no data for this long are deleted with their partial data. 0 = never.",
+	"admin.storage_integrity":        "Storage integrity",
+	"admin.scrub_help":               "A scrub checks stored data against the database: missing or damaged blobs, thumbnails without data, and stored files nothing refers to (orphans). Files written in the last hour are left alone.",
+	"admin.scrub_running":            "A scrub is running. Reload this page to see the result.",
+	"admin.scrub_failed":             "The last scrub stopped early:",
+	"admin.scrub_last_run":           "Last scrub",
+	"admin.scrub_dry_run":            "dry run",
+	"admin.scrub_applied":            "applied",
+	"admin.scrub_hashes_checked":     "hashes checked",
+	"admin.scrub_blobs_checked":      "Blobs checked",
+	"admin.scrub_problems":           "Problems",
+	"admin.scrub_stored_files":       "Stored files",
+	"admin.scrub_orphans":            "Orphans",
+	"admin.scrub_deleted_orphans":    "Orphans deleted",
+	"admin.scrub_deleted_thumbnails": "Thumbnail rows removed",
+	"admin.scrub_more":               "more",
+	"admin.scrub_check_hash":         "Re-hash every blob (reads all stored data)",
+	"admin.scrub_apply":              "Delete orphans and thumbnail rows without data (otherwise a dry run)",
+	"admin.scrub_run":                "Run scrub",
+	"admin.audit_log":                "Audit log",
+
+	// Audit log
+	"audit.title":       "Audit log",
+	"audit.actor_id":    "Actor (user ID)",
+	"audit.action":      "Action",
+	"audit.any":         "any",
+	"audit.target_type": "Target type",
+	"audit.target_id":   "Target ID",
+	"audit.filter":      "Filter",
+	"audit.clear":       "clear",
+	"audit.of":          "of",
+	"audit.by":          "by",
+	"audit.user":        "user",
+	"audit.system":      "system",
+	"audit.newer":       "← newer",
+	"audit.older":       "older →",
+	"audit.no_events":   "No matching events.",
 
 	// Profile
 	"profile.display_tag_label": "Display tag (1–3 chars)",
@@ -131,21 +213,100 @@ var En = map[string]string{
 	"profile.saved": "Saved",
 	"profile.save_failed": "Save failed",
 	"profile.request_failed": "Request failed",
+	"profile.api_tokens": "API tokens",
+	"profile.api_tokens_help": "Use with Authorization: Bearer <token> for scripts and CI.",
+	"profile.token_name": "Name",
+	"profile.token_name_placeholder": "e.g. ci-uploads",
+	"profile.token_scopes": "Scopes",
+	"profile.token_scopes_help": "None selected = all scopes",
+	"profile.token_expires_days": "Expires in (days)",
+	"profile.token_expires_help": "Empty = never",
+	"profile.create_token": "Create token",
+	"profile.token_created": "Copy this token now; it will not be shown again:",
+	"profile.no_tokens": "No tokens yet.",
+	"profile.token_last_used": "last used",
+	"profile.token_never_used": "never used",
+	"profile.token_expires": "expires",
+	"profile.token_expired": "expired",
+	"profile.token_revoke": "revoke",
+	"profile.token_revoke_confirm": "Revoke this token? Scripts using it will stop working.",
+	"profile.identities": "Sign-in methods",
+	"profile.identities_help": "Any of these signs you in to this account. Linking a provider signs you in with it once.",
+	"profile.identity_link": "Link",
+	"profile.identity_linked": "linked",
+	"profile.identity_unlink": "unlink",
+	"profile.identity_unlink_confirm": "Unlink this sign-in method? You will no longer be able to sign in with it.",
+	"profile.password_label": "Password",
+	"profile.password_help": "Sign in with your email and this password. At least 8 characters.",
+	"profile.password_set": "Set password",
+
+	// Login page
+	"login.with_provider": "Sign in with",
+	"login.with_password": "Sign in with email",
+	"login.register": "Create an account",
+	"login.name": "Name",
+	"login.email": "Email",
+	"login.password": "Password",
+	"login.password_help": "At least 8 characters",
+	"login.sign_in": "Sign in",
+	"login.create_account": "Create account",
+	"login.none_configured": "No sign-in methods are configured.",
+	"login.error_invalid": "Wrong email or password.",
+	"login.error_throttled": "Too many attempts. Try again in a few minutes.",
+	"login.error_email_taken": "An account with this email already exists. Sign in and link it from your profile.",
+	"login.error_invalid_email": "Enter a valid email address.",
+	"login.error_password": "Passwords must be 8 to 1024 characters.",
 
 	// User files (user detail page)
 	"user_files.back_users": "← users",
 	"user_files.banned":     "banned",
 	"user_files.edit_user":  "Edit user",
+	"user_files.role":       "Role",
+	"user_files.role_help":  "moderator: hide, delete any file and ban · member: upload · readonly: browse only",
 	"user_files.tag":        "Tag",
 	"user_files.tag_placeholder": "1–3 chars",
 	"user_files.colour":     "Colour",
 	"user_files.unban":      "Unban user",
 	"user_files.ban":       "Ban user",
+	"user_files.ban_reason": "Reason",
+	"user_files.ban_until":  "Until (UTC, empty = indefinitely)",
+	"user_files.ban_hide_files": "Hide their files",
+	"user_files.banned_until": "until",
+	"user_files.files_hidden": "files hidden",
 	"user_files.max_file_size_mb": "Max file size (MB)",
+	"user_files.storage_quota_mb": "Storage quota (MB)",
+	"storage.heading":   "Storage",
+	"storage.usage":     "Storage",
+	"storage.of":        "of",
+	"storage.unlimited": "unlimited",
 	"user_files.files_heading": "Files",
 	"user_files.no_files":   "No files.",
 	"user_files.user_not_found": "User not found.",
 
+	// Albums
+	"albums.none":          "No albums yet.",
+	"albums.files":         "files",
+	"albums.create":        "New album",
+	"albums.create_btn":    "Create album",
+	"album.name":           "Name",
+	"album.description":    "Description",
+	"album.private":        "Private",
+	"album.private_help":   "Only you can see a private album.",
+	"album.empty":          "This album is empty.",
+	"album.locked":         "password protected",
+	"album.download_zip":   "Download all (ZIP)",
+	"album.move_earlier":   "Move earlier",
+	"album.move_later":     "Move later",
+	"album.remove":         "Remove",
+	"album.add_files":      "Add files",
+	"album.add_files_label": "File slugs or links",
+	"album.add_files_help": "Separate several with spaces or commas. Only your own files can be added.",
+	"album.add":            "Add",
+	"album.settings":       "Album settings",
+	"album.delete":         "Delete album",
+	"album.delete_confirm": "Delete this album? Its files are kept.",
+	"album.save_failed":    "Could not update the album",
+
 	// Users list
 	"users.loading":     "Loading…",
 	"users.no_users":   "No users yet.",
@@ -164,10 +325,15 @@ var En = map[string]string{
 	"api_docs.returns_ok": "returns OK",
 	"api_docs.create_file": "Create file metadata",
 	"api_docs.upload_file": "Upload file data",
+	"api_docs.signed_url":  "Signed download URLs",
+	"api_docs.tus":         "Resumable uploads (tus)",
+	"api_docs.upload_form":  "One-shot upload",
 	"api_docs.get_metadata": "Get file metadata",
 	"api_docs.download":   "Download",
 	"api_docs.list_files": "List files",
 	"api_docs.delete_file": "Delete file",
 	"api_docs.auth":      "Auth",
 	"api_docs.example":   "Example",
+	"api_docs.albums":    "Albums",
+	"api_docs.archive":   "Bulk download",
 }
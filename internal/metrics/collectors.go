@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/zqz/web/backend/internal/repository"
+)
+
+// storedBytesTimeout bounds the query run on each scrape
+const storedBytesTimeout = 5 * time.Second
+
+func desc(name, help string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName(namespace, "", name), help, nil, nil)
+}
+
+// poolCollector reports pgxpool statistics at scrape time
+type poolCollector struct {
+	pool *pgxpool.Pool
+
+	acquiredConns     *prometheus.Desc
+	idleConns         *prometheus.Desc
+	constructingConns *prometheus.Desc
+	totalConns        *prometheus.Desc
+	maxConns          *prometheus.Desc
+	acquires          *prometheus.Desc
+	acquireSeconds    *prometheus.Desc
+	emptyAcquires     *prometheus.Desc
+	canceledAcquires  *prometheus.Desc
+	newConns          *prometheus.Desc
+}
+
+// NewPoolCollector returns a collector for the database connection pool's statistics
+func NewPoolCollector(pool *pgxpool.Pool) prometheus.Collector {
+	return &poolCollector{
+		pool:              pool,
+		acquiredConns:     desc("db_pool_acquired_connections", "Connections currently checked out of the pool."),
+		idleConns:         desc("db_pool_idle_connections", "Idle connections in the pool."),
+		constructingConns: desc("db_pool_constructing_connections", "Connections being opened."),
+		totalConns:        desc("db_pool_connections", "Connections in the pool (acquired, idle and being opened)."),
+		maxConns:          desc("db_pool_max_connections", "Maximum size of the pool."),
+		acquires:          desc("db_pool_acquires_total", "Connections acquired from the pool."),
+		acquireSeconds:    desc("db_pool_acquire_seconds_total", "Time spent acquiring connections."),
+		emptyAcquires:     desc("db_pool_empty_acquires_total", "Acquires that had to wait because the pool had no idle connection."),
+		canceledAcquires:  desc("db_pool_canceled_acquires_total", "Acquires canceled by their context."),
+		newConns:          desc("db_pool_new_connections_total", "Connections opened."),
+	}
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.pool.Stat()
+	ch <- prometheus.MustNewConstMetric(c.acquiredConns, prometheus.GaugeValue, float64(s.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(c.idleConns, prometheus.GaugeValue, float64(s.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(c.constructingConns, prometheus.GaugeValue, float64(s.ConstructingConns()))
+	ch <- prometheus.MustNewConstMetric(c.totalConns, prometheus.GaugeValue, float64(s.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(c.maxConns, prometheus.GaugeValue, float64(s.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(c.acquires, prometheus.CounterValue, float64(s.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.acquireSeconds, prometheus.CounterValue, s.AcquireDuration().Seconds())
+	ch <- prometheus.MustNewConstMetric(c.emptyAcquires, prometheus.CounterValue, float64(s.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.canceledAcquires, prometheus.CounterValue, float64(s.CanceledAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.newConns, prometheus.CounterValue, float64(s.NewConnsCount()))
+}
+
+// storedBytesCollector reports the total size of all file records at scrape time
+type storedBytesCollector struct {
+	files repository.FileRepository
+	bytes *prometheus.Desc
+}
+
+// NewStoredBytesCollector returns a collector for the total size of stored files (Files.TotalSize)
+func NewStoredBytesCollector(files repository.FileRepository) prometheus.Collector {
+	return &storedBytesCollector{
+		files: files,
+		bytes: desc("stored_bytes", "Total size of all file records."),
+	}
+}
+
+func (c *storedBytesCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.bytes
+}
+
+func (c *storedBytesCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), storedBytesTimeout)
+	defer cancel()
+
+	total, err := c.files.TotalSize(ctx)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.bytes, err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.bytes, prometheus.GaugeValue, float64(total))
+}
@@ -0,0 +1,86 @@
+// Package metrics holds the Prometheus collectors the server exposes on /metrics
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// namespace prefixes every metric name
+const namespace = "zqz"
+
+// Registry holds every collector below plus the Go runtime and process collectors.
+// The server adds the database pool and storage collectors when it starts.
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// HTTP requests, labelled by chi route pattern so that slugs and IDs don't multiply series
+var (
+	HTTPRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route pattern and status code.",
+	}, []string{"method", "route", "status"})
+
+	HTTPRequestDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time to serve HTTP requests by method and route pattern.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"method", "route"})
+
+	HTTPRequestBytes = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_request_body_bytes_total",
+		Help:      "Request body bytes read (uploads) by route pattern.",
+	}, []string{"route"})
+
+	HTTPResponseBytes = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_response_body_bytes_total",
+		Help:      "Response body bytes written (downloads) by route pattern.",
+	}, []string{"route"})
+
+	RateLimitRejections = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "api_rate_limit_rejections_total",
+		Help:      "API requests rejected by the per-IP rate limit.",
+	})
+)
+
+// Uploads and processing
+var (
+	UploadsCompleted = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "uploads_completed_total",
+		Help:      "Uploads whose data was fully received and verified.",
+	})
+
+	UploadHashMismatches = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upload_hash_mismatches_total",
+		Help:      "Uploads discarded because their data didn't match the claimed SHA-256.",
+	})
+
+	ProcessorDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "processor_duration_seconds",
+		Help:      "Time processing jobs take by processor, failed runs included.",
+		Buckets:   []float64{.01, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120},
+	}, []string{"processor"})
+
+	ProcessorFailures = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "processor_failures_total",
+		Help:      "Processing job runs that returned an error, by processor.",
+	}, []string{"processor"})
+)
@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+)
+
+type albumRepository struct {
+	queries *Queries
+}
+
+// NewAlbumRepository creates a new album repository
+func NewAlbumRepository(queries *Queries) AlbumRepository {
+	return &albumRepository{queries: queries}
+}
+
+func (r *albumRepository) Create(ctx context.Context, params CreateAlbumParams) (*Album, error) {
+	album, err := r.queries.CreateAlbum(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	return &album, nil
+}
+
+func (r *albumRepository) GetBySlug(ctx context.Context, slug string) (*Album, error) {
+	album, err := r.queries.GetAlbumBySlug(ctx, slug)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &album, nil
+}
+
+func (r *albumRepository) ListByUserID(ctx context.Context, userID int32) ([]*ListAlbumsByUserIDRow, error) {
+	albums, err := r.queries.ListAlbumsByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*ListAlbumsByUserIDRow, len(albums))
+	for i := range albums {
+		result[i] = &albums[i]
+	}
+	return result, nil
+}
+
+func (r *albumRepository) Update(ctx context.Context, params UpdateAlbumParams) (*Album, error) {
+	album, err := r.queries.UpdateAlbum(ctx, params)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &album, nil
+}
+
+func (r *albumRepository) Delete(ctx context.Context, id int32) error {
+	return r.queries.DeleteAlbum(ctx, id)
+}
+
+func (r *albumRepository) ListFiles(ctx context.Context, albumID int32) ([]*File, error) {
+	files, err := r.queries.ListAlbumFiles(ctx, albumID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*File, len(files))
+	for i := range files {
+		result[i] = &files[i]
+	}
+	return result, nil
+}
+
+func (r *albumRepository) AddFile(ctx context.Context, albumID, fileID int32) error {
+	return r.queries.AddAlbumFile(ctx, AddAlbumFileParams{AlbumID: albumID, FileID: fileID})
+}
+
+func (r *albumRepository) RemoveFile(ctx context.Context, albumID, fileID int32) error {
+	rows, err := r.queries.RemoveAlbumFile(ctx, RemoveAlbumFileParams{AlbumID: albumID, FileID: fileID})
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *albumRepository) Reorder(ctx context.Context, albumID int32, fileIDs []int32) error {
+	return r.queries.ReorderAlbumFiles(ctx, ReorderAlbumFilesParams{FileIds: fileIDs, AlbumID: albumID})
+}
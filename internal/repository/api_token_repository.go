@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+)
+
+type apiTokenRepository struct {
+	queries *Queries
+}
+
+// NewAPITokenRepository creates a new API token repository
+func NewAPITokenRepository(queries *Queries) APITokenRepository {
+	return &apiTokenRepository{queries: queries}
+}
+
+func (r *apiTokenRepository) Create(ctx context.Context, params CreateAPITokenParams) (*ApiToken, error) {
+	token, err := r.queries.CreateAPIToken(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *apiTokenRepository) GetByHash(ctx context.Context, tokenHash string) (*ApiToken, error) {
+	token, err := r.queries.GetAPITokenByHash(ctx, tokenHash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *apiTokenRepository) ListByUserID(ctx context.Context, userID int32) ([]*ApiToken, error) {
+	tokens, err := r.queries.ListAPITokensByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*ApiToken, len(tokens))
+	for i := range tokens {
+		result[i] = &tokens[i]
+	}
+	return result, nil
+}
+
+// Delete removes the token only if it belongs to userID
+func (r *apiTokenRepository) Delete(ctx context.Context, id, userID int32) error {
+	rows, err := r.queries.DeleteAPIToken(ctx, DeleteAPITokenParams{ID: id, UserID: userID})
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *apiTokenRepository) Touch(ctx context.Context, id int32) error {
+	return r.queries.TouchAPIToken(ctx, id)
+}
@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"context"
+)
+
+type auditEventRepository struct {
+	queries *Queries
+}
+
+// NewAuditEventRepository creates a new audit event repository
+func NewAuditEventRepository(queries *Queries) AuditEventRepository {
+	return &auditEventRepository{queries: queries}
+}
+
+func (r *auditEventRepository) Create(ctx context.Context, params CreateAuditEventParams) (*AuditEvent, error) {
+	event, err := r.queries.CreateAuditEvent(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+func (r *auditEventRepository) List(ctx context.Context, params ListAuditEventsParams) ([]*AuditEvent, error) {
+	events, err := r.queries.ListAuditEvents(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*AuditEvent, len(events))
+	for i := range events {
+		result[i] = &events[i]
+	}
+	return result, nil
+}
+
+func (r *auditEventRepository) Count(ctx context.Context, params CountAuditEventsParams) (int64, error) {
+	return r.queries.CountAuditEvents(ctx, params)
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+)
+
+type blobRepository struct {
+	queries *Queries
+}
+
+// NewBlobRepository creates a new blob repository
+func NewBlobRepository(queries *Queries) BlobRepository {
+	return &blobRepository{queries: queries}
+}
+
+func (r *blobRepository) Acquire(ctx context.Context, hash string, size int64) (*Blob, error) {
+	blob, err := r.queries.AcquireBlob(ctx, AcquireBlobParams{Hash: hash, Size: size})
+	if err != nil {
+		return nil, err
+	}
+	return &blob, nil
+}
+
+func (r *blobRepository) Get(ctx context.Context, hash string) (*Blob, error) {
+	blob, err := r.queries.GetBlob(ctx, hash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &blob, nil
+}
+
+func (r *blobRepository) Release(ctx context.Context, hash string) (int32, error) {
+	refCount, err := r.queries.ReleaseBlob(ctx, hash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrNotFound
+		}
+		return 0, err
+	}
+	return refCount, nil
+}
+
+func (r *blobRepository) DeleteUnreferenced(ctx context.Context, hash string) (bool, error) {
+	n, err := r.queries.DeleteUnreferencedBlob(ctx, hash)
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (r *blobRepository) GetForUpdate(ctx context.Context, hash string) (*Blob, error) {
+	blob, err := r.queries.GetBlobForUpdate(ctx, hash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &blob, nil
+}
+
+func (r *blobRepository) MarkCompleted(ctx context.Context, hash string, size int64) error {
+	return r.queries.MarkBlobCompleted(ctx, MarkBlobCompletedParams{Hash: hash, Size: size})
+}
+
+func (r *blobRepository) List(ctx context.Context, afterHash string, limit int32) ([]*Blob, error) {
+	blobs, err := r.queries.ListBlobs(ctx, ListBlobsParams{Hash: afterHash, Limit: limit})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*Blob, len(blobs))
+	for i := range blobs {
+		result[i] = &blobs[i]
+	}
+	return result, nil
+}
+
+func (r *blobRepository) ListLegacyUploads(ctx context.Context, limit int32) ([]*LegacyUploadObject, error) {
+	objects, err := r.queries.ListLegacyUploadObjects(ctx, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*LegacyUploadObject, len(objects))
+	for i := range objects {
+		result[i] = &objects[i]
+	}
+	return result, nil
+}
+
+func (r *blobRepository) DeleteLegacyUpload(ctx context.Context, key string) error {
+	return r.queries.DeleteLegacyUploadObject(ctx, key)
+}
@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"time"
 )
 
 type fileRepository struct {
@@ -55,6 +56,30 @@ func (r *fileRepository) GetByHash(ctx context.Context, hash string) (*File, err
 	return &file, nil
 }
 
+func (r *fileRepository) GetByHashAndUserID(ctx context.Context, hash string, userID *int32) (*File, error) {
+	file, err := r.queries.GetFileByHashAndUserID(ctx, GetFileByHashAndUserIDParams{Hash: hash, UserID: userID})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &file, nil
+}
+
+func (r *fileRepository) ListByHash(ctx context.Context, hash string) ([]*File, error) {
+	files, err := r.queries.ListFilesByHash(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*File, len(files))
+	for i := range files {
+		result[i] = &files[i]
+	}
+	return result, nil
+}
+
 func (r *fileRepository) GetWithThumbnail(ctx context.Context, id int32) (*FileWithThumbnail, error) {
 	row, err := r.queries.GetFileWithThumbnail(ctx, id)
 	if err != nil {
@@ -287,6 +312,79 @@ func (r *fileRepository) Update(ctx context.Context, params UpdateFileParams) (*
 	return &file, nil
 }
 
+func (r *fileRepository) SetExpiry(ctx context.Context, params SetFileExpiryParams) (*File, error) {
+	file, err := r.queries.SetFileExpiry(ctx, params)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &file, nil
+}
+
+func (r *fileRepository) SetBytesReceived(ctx context.Context, id int32, bytesReceived int64) error {
+	return r.queries.SetFileBytesReceived(ctx, SetFileBytesReceivedParams{ID: id, BytesReceived: bytesReceived})
+}
+
+func (r *fileRepository) SetPassword(ctx context.Context, id int32, passwordHash *string) (*File, error) {
+	file, err := r.queries.SetFilePassword(ctx, SetFilePasswordParams{ID: id, PasswordHash: passwordHash})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &file, nil
+}
+
+// AddBytesServed meters bytes of a download and returns the file's download count.
+// Returns ErrNotFound when they would take the file past max_downloads.
+func (r *fileRepository) AddBytesServed(ctx context.Context, id int32, bytes int64) (int32, error) {
+	count, err := r.queries.AddFileBytesServed(ctx, AddFileBytesServedParams{ID: id, Bytes: bytes})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrNotFound
+		}
+		return 0, err
+	}
+	return count, nil
+}
+
+func (r *fileRepository) RefundBytesServed(ctx context.Context, id int32, bytes int64) error {
+	return r.queries.RefundFileBytesServed(ctx, RefundFileBytesServedParams{ID: id, Bytes: bytes})
+}
+
+func (r *fileRepository) ListExpired(ctx context.Context, limit int32) ([]*File, error) {
+	files, err := r.queries.ListExpiredFiles(ctx, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*File, len(files))
+	for i := range files {
+		result[i] = &files[i]
+	}
+	return result, nil
+}
+
+func (r *fileRepository) ListCompletedImages(ctx context.Context, afterID int32, missingThumbnail bool, limit int32) ([]*File, error) {
+	files, err := r.queries.ListCompletedImageFiles(ctx, ListCompletedImageFilesParams{
+		AfterID:          afterID,
+		MissingThumbnail: missingThumbnail,
+		Limit:            limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*File, len(files))
+	for i := range files {
+		result[i] = &files[i]
+	}
+	return result, nil
+}
+
 func (r *fileRepository) Delete(ctx context.Context, id int32) error {
 	return r.queries.DeleteFile(ctx, id)
 }
@@ -307,6 +405,31 @@ func (r *fileRepository) TotalSize(ctx context.Context) (int64, error) {
 	return r.queries.TotalFileSize(ctx)
 }
 
+func (r *fileRepository) ListStaleIncomplete(ctx context.Context, inactiveSince time.Time, limit int32) ([]*File, error) {
+	files, err := r.queries.ListStaleIncompleteFiles(ctx, ListStaleIncompleteFilesParams{InactiveSince: inactiveSince, Limit: limit})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*File, len(files))
+	for i := range files {
+		result[i] = &files[i]
+	}
+	return result, nil
+}
+
+func (r *fileRepository) IncompleteUploadStats(ctx context.Context, inactiveSince time.Time) (*GetIncompleteUploadStatsRow, error) {
+	stats, err := r.queries.GetIncompleteUploadStats(ctx, inactiveSince)
+	if err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+func (r *fileRepository) TotalSizeByUserID(ctx context.Context, userID int32) (int64, error) {
+	return r.queries.TotalFileSizeByUserID(ctx, &userID)
+}
+
 // Helper function to convert GetFileWithThumbnailRow to FileWithThumbnail
 func rowToFileWithThumbnail(row GetFileWithThumbnailRow) *FileWithThumbnail {
 	return &FileWithThumbnail{
@@ -33,7 +33,7 @@ func TestFileRepositoryCreate(t *testing.T) {
 
 	require.NoError(t, err)
 	assert.NotZero(t, file.ID)
-	assert.Equal(t, int32(1024), file.Size)
+	assert.Equal(t, int64(1024), file.Size)
 	assert.Equal(t, "test.txt", file.Name)
 	assert.Equal(t, "abc123", file.Hash)
 	assert.Equal(t, "test-slug", file.Slug)
@@ -42,6 +42,36 @@ func TestFileRepositoryCreate(t *testing.T) {
 	assert.Equal(t, "Test file", file.Comment)
 }
 
+func TestFileRepositoryCreateOver2GiB(t *testing.T) {
+	ctx := context.Background()
+	pg, cleanup := tests.SetupTestDB(t, ctx)
+	defer cleanup()
+
+	repo := NewRepository(pg.Pool)
+
+	size := int64(5) << 30
+	file, err := repo.Files.Create(ctx, CreateFileParams{
+		Size:          size,
+		Name:          "huge.bin",
+		Alias:         "huge",
+		Hash:          "big123",
+		Slug:          "big-slug",
+		ContentType:   "application/octet-stream",
+		BytesReceived: 0,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, size, file.Size)
+
+	received := size - 1
+	updated, err := repo.Files.Update(ctx, UpdateFileParams{ID: file.ID, BytesReceived: &received})
+	require.NoError(t, err)
+	assert.Equal(t, received, updated.BytesReceived)
+
+	total, err := repo.Files.TotalSize(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, size, total)
+}
+
 func TestFileRepositoryGetByID(t *testing.T) {
 	ctx := context.Background()
 	pg, cleanup := tests.SetupTestDB(t, ctx)
@@ -149,7 +179,7 @@ func TestFileRepositoryList(t *testing.T) {
 	// Create multiple files
 	for i := 0; i < 5; i++ {
 		_, err := repo.Files.Create(ctx, CreateFileParams{
-			Size:        int32(1024 * (i + 1)),
+			Size:        int64(1024 * (i + 1)),
 			Name:        "file" + string(rune('a'+i)) + ".txt",
 			Alias:       "file" + string(rune('a'+i)),
 			Hash:        "hash" + string(rune('a'+i)),
@@ -258,7 +288,7 @@ func TestFileRepositoryCount(t *testing.T) {
 	// Create files
 	for i := 0; i < 3; i++ {
 		_, err := repo.Files.Create(ctx, CreateFileParams{
-			Size:        int32(1024 * (i + 1)),
+			Size:        int64(1024 * (i + 1)),
 			Name:        "count" + string(rune('a'+i)) + ".txt",
 			Alias:       "count" + string(rune('a'+i)),
 			Hash:        "counthash" + string(rune('a'+i)),
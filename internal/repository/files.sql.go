@@ -7,10 +7,34 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const addFileBytesServed = `-- name: AddFileBytesServed :one
+UPDATE files
+SET bytes_served = bytes_served + $1::bigint,
+    download_count = ((bytes_served + $1::bigint) / GREATEST(size, 1))::integer,
+    updated_at = NOW()
+WHERE id = $2
+  AND (max_downloads IS NULL OR bytes_served + $1::bigint <= max_downloads::bigint * GREATEST(size, 1))
+RETURNING download_count
+`
+
+type AddFileBytesServedParams struct {
+	Bytes int64 `db:"bytes" json:"bytes"`
+	ID    int32 `db:"id" json:"id"`
+}
+
+// Meters a download in bytes; no row is returned when it would go past max_downloads * size
+func (q *Queries) AddFileBytesServed(ctx context.Context, arg AddFileBytesServedParams) (int32, error) {
+	row := q.db.QueryRow(ctx, addFileBytesServed, arg.Bytes, arg.ID)
+	var download_count int32
+	err := row.Scan(&download_count)
+	return download_count, err
+}
+
 const countFiles = `-- name: CountFiles :one
 SELECT COUNT(*) FROM files
 `
@@ -46,24 +70,28 @@ INSERT INTO files (
     private,
     comment,
     bytes_received,
+    expires_at,
+    max_downloads,
     created_at,
     updated_at
 ) VALUES (
-    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NOW(), NOW()
-) RETURNING id, size, name, alias, hash, slug, content_type, created_at, updated_at, user_id, private, comment, bytes_received
+    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, NOW(), NOW()
+) RETURNING id, size, name, alias, hash, slug, content_type, created_at, updated_at, user_id, private, comment, bytes_received, expires_at, max_downloads, download_count, password_hash, bytes_served
 `
 
 type CreateFileParams struct {
-	Size          int32  `db:"size" json:"size"`
-	Name          string `db:"name" json:"name"`
-	Alias         string `db:"alias" json:"alias"`
-	Hash          string `db:"hash" json:"hash"`
-	Slug          string `db:"slug" json:"slug"`
-	ContentType   string `db:"content_type" json:"content_type"`
-	UserID        *int32 `db:"user_id" json:"user_id"`
-	Private       bool   `db:"private" json:"private"`
-	Comment       string `db:"comment" json:"comment"`
-	BytesReceived int32  `db:"bytes_received" json:"bytes_received"`
+	Size          int64            `db:"size" json:"size"`
+	Name          string           `db:"name" json:"name"`
+	Alias         string           `db:"alias" json:"alias"`
+	Hash          string           `db:"hash" json:"hash"`
+	Slug          string           `db:"slug" json:"slug"`
+	ContentType   string           `db:"content_type" json:"content_type"`
+	UserID        *int32           `db:"user_id" json:"user_id"`
+	Private       bool             `db:"private" json:"private"`
+	Comment       string           `db:"comment" json:"comment"`
+	BytesReceived int64            `db:"bytes_received" json:"bytes_received"`
+	ExpiresAt     pgtype.Timestamp `db:"expires_at" json:"expires_at"`
+	MaxDownloads  *int32           `db:"max_downloads" json:"max_downloads"`
 }
 
 func (q *Queries) CreateFile(ctx context.Context, arg CreateFileParams) (File, error) {
@@ -78,6 +106,8 @@ func (q *Queries) CreateFile(ctx context.Context, arg CreateFileParams) (File, e
 		arg.Private,
 		arg.Comment,
 		arg.BytesReceived,
+		arg.ExpiresAt,
+		arg.MaxDownloads,
 	)
 	var i File
 	err := row.Scan(
@@ -94,6 +124,11 @@ func (q *Queries) CreateFile(ctx context.Context, arg CreateFileParams) (File, e
 		&i.Private,
 		&i.Comment,
 		&i.BytesReceived,
+		&i.ExpiresAt,
+		&i.MaxDownloads,
+		&i.DownloadCount,
+		&i.PasswordHash,
+		&i.BytesServed,
 	)
 	return i, err
 }
@@ -119,7 +154,7 @@ func (q *Queries) DeleteFilesByUserID(ctx context.Context, userID *int32) error
 }
 
 const getFileByHash = `-- name: GetFileByHash :one
-SELECT id, size, name, alias, hash, slug, content_type, created_at, updated_at, user_id, private, comment, bytes_received FROM files
+SELECT id, size, name, alias, hash, slug, content_type, created_at, updated_at, user_id, private, comment, bytes_received, expires_at, max_downloads, download_count, password_hash, bytes_served FROM files
 WHERE hash = $1 LIMIT 1
 `
 
@@ -140,12 +175,55 @@ func (q *Queries) GetFileByHash(ctx context.Context, hash string) (File, error)
 		&i.Private,
 		&i.Comment,
 		&i.BytesReceived,
+		&i.ExpiresAt,
+		&i.MaxDownloads,
+		&i.DownloadCount,
+		&i.PasswordHash,
+		&i.BytesServed,
+	)
+	return i, err
+}
+
+const getFileByHashAndUserID = `-- name: GetFileByHashAndUserID :one
+SELECT id, size, name, alias, hash, slug, content_type, created_at, updated_at, user_id, private, comment, bytes_received, expires_at, max_downloads, download_count, password_hash, bytes_served FROM files
+WHERE hash = $1 AND user_id IS NOT DISTINCT FROM $2
+ORDER BY id DESC
+LIMIT 1
+`
+
+type GetFileByHashAndUserIDParams struct {
+	Hash   string `db:"hash" json:"hash"`
+	UserID *int32 `db:"user_id" json:"user_id"`
+}
+
+func (q *Queries) GetFileByHashAndUserID(ctx context.Context, arg GetFileByHashAndUserIDParams) (File, error) {
+	row := q.db.QueryRow(ctx, getFileByHashAndUserID, arg.Hash, arg.UserID)
+	var i File
+	err := row.Scan(
+		&i.ID,
+		&i.Size,
+		&i.Name,
+		&i.Alias,
+		&i.Hash,
+		&i.Slug,
+		&i.ContentType,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Private,
+		&i.Comment,
+		&i.BytesReceived,
+		&i.ExpiresAt,
+		&i.MaxDownloads,
+		&i.DownloadCount,
+		&i.PasswordHash,
+		&i.BytesServed,
 	)
 	return i, err
 }
 
 const getFileByID = `-- name: GetFileByID :one
-SELECT id, size, name, alias, hash, slug, content_type, created_at, updated_at, user_id, private, comment, bytes_received FROM files
+SELECT id, size, name, alias, hash, slug, content_type, created_at, updated_at, user_id, private, comment, bytes_received, expires_at, max_downloads, download_count, password_hash, bytes_served FROM files
 WHERE id = $1 LIMIT 1
 `
 
@@ -166,12 +244,17 @@ func (q *Queries) GetFileByID(ctx context.Context, id int32) (File, error) {
 		&i.Private,
 		&i.Comment,
 		&i.BytesReceived,
+		&i.ExpiresAt,
+		&i.MaxDownloads,
+		&i.DownloadCount,
+		&i.PasswordHash,
+		&i.BytesServed,
 	)
 	return i, err
 }
 
 const getFileBySlug = `-- name: GetFileBySlug :one
-SELECT id, size, name, alias, hash, slug, content_type, created_at, updated_at, user_id, private, comment, bytes_received FROM files
+SELECT id, size, name, alias, hash, slug, content_type, created_at, updated_at, user_id, private, comment, bytes_received, expires_at, max_downloads, download_count, password_hash, bytes_served FROM files
 WHERE slug = $1 LIMIT 1
 `
 
@@ -192,6 +275,11 @@ func (q *Queries) GetFileBySlug(ctx context.Context, slug string) (File, error)
 		&i.Private,
 		&i.Comment,
 		&i.BytesReceived,
+		&i.ExpiresAt,
+		&i.MaxDownloads,
+		&i.DownloadCount,
+		&i.PasswordHash,
+		&i.BytesServed,
 	)
 	return i, err
 }
@@ -221,7 +309,7 @@ LIMIT 1
 
 type GetFileWithThumbnailRow struct {
 	ID              int32            `db:"id" json:"id"`
-	Size            int32            `db:"size" json:"size"`
+	Size            int64            `db:"size" json:"size"`
 	Name            string           `db:"name" json:"name"`
 	Alias           string           `db:"alias" json:"alias"`
 	Hash            string           `db:"hash" json:"hash"`
@@ -285,7 +373,7 @@ LIMIT 1
 
 type GetFileWithThumbnailByHashRow struct {
 	ID              int32            `db:"id" json:"id"`
-	Size            int32            `db:"size" json:"size"`
+	Size            int64            `db:"size" json:"size"`
 	Name            string           `db:"name" json:"name"`
 	Alias           string           `db:"alias" json:"alias"`
 	Hash            string           `db:"hash" json:"hash"`
@@ -349,7 +437,7 @@ LIMIT 1
 
 type GetFileWithThumbnailBySlugRow struct {
 	ID              int32            `db:"id" json:"id"`
-	Size            int32            `db:"size" json:"size"`
+	Size            int64            `db:"size" json:"size"`
 	Name            string           `db:"name" json:"name"`
 	Alias           string           `db:"alias" json:"alias"`
 	Hash            string           `db:"hash" json:"hash"`
@@ -388,8 +476,152 @@ func (q *Queries) GetFileWithThumbnailBySlug(ctx context.Context, slug string) (
 	return i, err
 }
 
+const getIncompleteUploadStats = `-- name: GetIncompleteUploadStats :one
+WITH parked AS (
+    SELECT file_id, SUM(size) AS bytes, MAX(created_at) AS active_at
+    FROM upload_chunks
+    GROUP BY file_id
+), uploads AS (
+    SELECT
+        f.bytes_received + COALESCE(c.bytes, 0) AS bytes,
+        GREATEST(COALESCE(f.updated_at, f.created_at), c.active_at) < $1::timestamp AS stale
+    FROM files f
+    LEFT JOIN parked c ON c.file_id = f.id
+    WHERE f.bytes_received < f.size
+)
+SELECT
+    COUNT(*)::bigint AS uploads,
+    COALESCE(SUM(bytes), 0)::bigint AS bytes,
+    COUNT(*) FILTER (WHERE stale)::bigint AS stale_uploads,
+    COALESCE(SUM(bytes) FILTER (WHERE stale), 0)::bigint AS stale_bytes
+FROM uploads
+`
+
+type GetIncompleteUploadStatsRow struct {
+	Uploads      int64 `db:"uploads" json:"uploads"`
+	Bytes        int64 `db:"bytes" json:"bytes"`
+	StaleUploads int64 `db:"stale_uploads" json:"stale_uploads"`
+	StaleBytes   int64 `db:"stale_bytes" json:"stale_bytes"`
+}
+
+func (q *Queries) GetIncompleteUploadStats(ctx context.Context, inactiveSince time.Time) (GetIncompleteUploadStatsRow, error) {
+	row := q.db.QueryRow(ctx, getIncompleteUploadStats, inactiveSince)
+	var i GetIncompleteUploadStatsRow
+	err := row.Scan(
+		&i.Uploads,
+		&i.Bytes,
+		&i.StaleUploads,
+		&i.StaleBytes,
+	)
+	return i, err
+}
+
+const listCompletedImageFiles = `-- name: ListCompletedImageFiles :many
+SELECT id, size, name, alias, hash, slug, content_type, created_at, updated_at, user_id, private, comment, bytes_received, expires_at, max_downloads, download_count, password_hash, bytes_served FROM files
+WHERE id > $1
+    AND bytes_received >= size
+    AND content_type ILIKE 'image/%'
+    AND (NOT $2::boolean OR NOT EXISTS (
+        SELECT 1 FROM thumbnails t WHERE t.file_id = files.id
+    ))
+ORDER BY id
+LIMIT $3
+`
+
+type ListCompletedImageFilesParams struct {
+	AfterID          int32 `db:"after_id" json:"after_id"`
+	MissingThumbnail bool  `db:"missing_thumbnail" json:"missing_thumbnail"`
+	Limit            int32 `db:"limit" json:"limit"`
+}
+
+func (q *Queries) ListCompletedImageFiles(ctx context.Context, arg ListCompletedImageFilesParams) ([]File, error) {
+	rows, err := q.db.Query(ctx, listCompletedImageFiles, arg.AfterID, arg.MissingThumbnail, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []File{}
+	for rows.Next() {
+		var i File
+		if err := rows.Scan(
+			&i.ID,
+			&i.Size,
+			&i.Name,
+			&i.Alias,
+			&i.Hash,
+			&i.Slug,
+			&i.ContentType,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.Private,
+			&i.Comment,
+			&i.BytesReceived,
+			&i.ExpiresAt,
+			&i.MaxDownloads,
+			&i.DownloadCount,
+			&i.PasswordHash,
+			&i.BytesServed,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listExpiredFiles = `-- name: ListExpiredFiles :many
+SELECT id, size, name, alias, hash, slug, content_type, created_at, updated_at, user_id, private, comment, bytes_received, expires_at, max_downloads, download_count, password_hash, bytes_served FROM files
+WHERE (expires_at IS NOT NULL AND expires_at <= NOW())
+   OR (max_downloads IS NOT NULL AND download_count >= max_downloads AND updated_at <= NOW() - INTERVAL '1 hour')
+ORDER BY id
+LIMIT $1
+`
+
+func (q *Queries) ListExpiredFiles(ctx context.Context, limit int32) ([]File, error) {
+	rows, err := q.db.Query(ctx, listExpiredFiles, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []File{}
+	for rows.Next() {
+		var i File
+		if err := rows.Scan(
+			&i.ID,
+			&i.Size,
+			&i.Name,
+			&i.Alias,
+			&i.Hash,
+			&i.Slug,
+			&i.ContentType,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.Private,
+			&i.Comment,
+			&i.BytesReceived,
+			&i.ExpiresAt,
+			&i.MaxDownloads,
+			&i.DownloadCount,
+			&i.PasswordHash,
+			&i.BytesServed,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listFiles = `-- name: ListFiles :many
-SELECT id, size, name, alias, hash, slug, content_type, created_at, updated_at, user_id, private, comment, bytes_received FROM files
+SELECT id, size, name, alias, hash, slug, content_type, created_at, updated_at, user_id, private, comment, bytes_received, expires_at, max_downloads, download_count, password_hash, bytes_served FROM files
 ORDER BY created_at DESC
 LIMIT $1 OFFSET $2
 `
@@ -422,6 +654,56 @@ func (q *Queries) ListFiles(ctx context.Context, arg ListFilesParams) ([]File, e
 			&i.Private,
 			&i.Comment,
 			&i.BytesReceived,
+			&i.ExpiresAt,
+			&i.MaxDownloads,
+			&i.DownloadCount,
+			&i.PasswordHash,
+			&i.BytesServed,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listFilesByHash = `-- name: ListFilesByHash :many
+SELECT id, size, name, alias, hash, slug, content_type, created_at, updated_at, user_id, private, comment, bytes_received, expires_at, max_downloads, download_count, password_hash, bytes_served FROM files
+WHERE hash = $1
+ORDER BY id
+`
+
+func (q *Queries) ListFilesByHash(ctx context.Context, hash string) ([]File, error) {
+	rows, err := q.db.Query(ctx, listFilesByHash, hash)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []File{}
+	for rows.Next() {
+		var i File
+		if err := rows.Scan(
+			&i.ID,
+			&i.Size,
+			&i.Name,
+			&i.Alias,
+			&i.Hash,
+			&i.Slug,
+			&i.ContentType,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.Private,
+			&i.Comment,
+			&i.BytesReceived,
+			&i.ExpiresAt,
+			&i.MaxDownloads,
+			&i.DownloadCount,
+			&i.PasswordHash,
+			&i.BytesServed,
 		); err != nil {
 			return nil, err
 		}
@@ -434,7 +716,7 @@ func (q *Queries) ListFiles(ctx context.Context, arg ListFilesParams) ([]File, e
 }
 
 const listFilesByUserID = `-- name: ListFilesByUserID :many
-SELECT id, size, name, alias, hash, slug, content_type, created_at, updated_at, user_id, private, comment, bytes_received FROM files
+SELECT id, size, name, alias, hash, slug, content_type, created_at, updated_at, user_id, private, comment, bytes_received, expires_at, max_downloads, download_count, password_hash, bytes_served FROM files
 WHERE user_id = $1
 ORDER BY created_at DESC
 LIMIT $2 OFFSET $3
@@ -469,6 +751,11 @@ func (q *Queries) ListFilesByUserID(ctx context.Context, arg ListFilesByUserIDPa
 			&i.Private,
 			&i.Comment,
 			&i.BytesReceived,
+			&i.ExpiresAt,
+			&i.MaxDownloads,
+			&i.DownloadCount,
+			&i.PasswordHash,
+			&i.BytesServed,
 		); err != nil {
 			return nil, err
 		}
@@ -481,8 +768,13 @@ func (q *Queries) ListFilesByUserID(ctx context.Context, arg ListFilesByUserIDPa
 }
 
 const listFilesVisibleToUser = `-- name: ListFilesVisibleToUser :many
-SELECT id, size, name, alias, hash, slug, content_type, created_at, updated_at, user_id, private, comment, bytes_received FROM files
-WHERE private = false OR user_id = $1
+SELECT id, size, name, alias, hash, slug, content_type, created_at, updated_at, user_id, private, comment, bytes_received, expires_at, max_downloads, download_count, password_hash, bytes_served FROM files
+WHERE (private = false OR user_id = $1)
+  AND (user_id = $1 OR NOT EXISTS (
+    SELECT 1 FROM users u
+    WHERE u.id = files.user_id AND u.ban_hides_files
+      AND u.banned AND (u.banned_until IS NULL OR u.banned_until > NOW())
+  ))
 ORDER BY created_at DESC
 LIMIT $2 OFFSET $3
 `
@@ -516,6 +808,11 @@ func (q *Queries) ListFilesVisibleToUser(ctx context.Context, arg ListFilesVisib
 			&i.Private,
 			&i.Comment,
 			&i.BytesReceived,
+			&i.ExpiresAt,
+			&i.MaxDownloads,
+			&i.DownloadCount,
+			&i.PasswordHash,
+			&i.BytesServed,
 		); err != nil {
 			return nil, err
 		}
@@ -557,7 +854,7 @@ type ListFilesWithThumbnailsParams struct {
 
 type ListFilesWithThumbnailsRow struct {
 	ID              int32            `db:"id" json:"id"`
-	Size            int32            `db:"size" json:"size"`
+	Size            int64            `db:"size" json:"size"`
 	Name            string           `db:"name" json:"name"`
 	Alias           string           `db:"alias" json:"alias"`
 	Hash            string           `db:"hash" json:"hash"`
@@ -610,8 +907,13 @@ func (q *Queries) ListFilesWithThumbnails(ctx context.Context, arg ListFilesWith
 }
 
 const listPublicFiles = `-- name: ListPublicFiles :many
-SELECT id, size, name, alias, hash, slug, content_type, created_at, updated_at, user_id, private, comment, bytes_received FROM files
+SELECT id, size, name, alias, hash, slug, content_type, created_at, updated_at, user_id, private, comment, bytes_received, expires_at, max_downloads, download_count, password_hash, bytes_served FROM files
 WHERE private = false
+  AND NOT EXISTS (
+    SELECT 1 FROM users u
+    WHERE u.id = files.user_id AND u.ban_hides_files
+      AND u.banned AND (u.banned_until IS NULL OR u.banned_until > NOW())
+  )
 ORDER BY created_at DESC
 LIMIT $1 OFFSET $2
 `
@@ -644,6 +946,67 @@ func (q *Queries) ListPublicFiles(ctx context.Context, arg ListPublicFilesParams
 			&i.Private,
 			&i.Comment,
 			&i.BytesReceived,
+			&i.ExpiresAt,
+			&i.MaxDownloads,
+			&i.DownloadCount,
+			&i.PasswordHash,
+			&i.BytesServed,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listStaleIncompleteFiles = `-- name: ListStaleIncompleteFiles :many
+SELECT f.id, f.size, f.name, f.alias, f.hash, f.slug, f.content_type, f.created_at, f.updated_at, f.user_id, f.private, f.comment, f.bytes_received, f.expires_at, f.max_downloads, f.download_count, f.password_hash, f.bytes_served FROM files f
+WHERE f.bytes_received < f.size
+    AND COALESCE(f.updated_at, f.created_at) < $1::timestamp
+    AND NOT EXISTS (
+        SELECT 1 FROM upload_chunks c
+        WHERE c.file_id = f.id AND c.created_at >= $1::timestamp
+    )
+ORDER BY f.id
+LIMIT $2
+`
+
+type ListStaleIncompleteFilesParams struct {
+	InactiveSince time.Time `db:"inactive_since" json:"inactive_since"`
+	Limit         int32     `db:"limit" json:"limit"`
+}
+
+func (q *Queries) ListStaleIncompleteFiles(ctx context.Context, arg ListStaleIncompleteFilesParams) ([]File, error) {
+	rows, err := q.db.Query(ctx, listStaleIncompleteFiles, arg.InactiveSince, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []File{}
+	for rows.Next() {
+		var i File
+		if err := rows.Scan(
+			&i.ID,
+			&i.Size,
+			&i.Name,
+			&i.Alias,
+			&i.Hash,
+			&i.Slug,
+			&i.ContentType,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.Private,
+			&i.Comment,
+			&i.BytesReceived,
+			&i.ExpiresAt,
+			&i.MaxDownloads,
+			&i.DownloadCount,
+			&i.PasswordHash,
+			&i.BytesServed,
 		); err != nil {
 			return nil, err
 		}
@@ -655,8 +1018,26 @@ func (q *Queries) ListPublicFiles(ctx context.Context, arg ListPublicFilesParams
 	return items, nil
 }
 
+const refundFileBytesServed = `-- name: RefundFileBytesServed :exec
+UPDATE files
+SET bytes_served = GREATEST(bytes_served - $1::bigint, 0),
+    download_count = (GREATEST(bytes_served - $1::bigint, 0) / GREATEST(size, 1))::integer
+WHERE id = $2
+`
+
+type RefundFileBytesServedParams struct {
+	Bytes int64 `db:"bytes" json:"bytes"`
+	ID    int32 `db:"id" json:"id"`
+}
+
+// Gives back bytes metered for a download that was cut short
+func (q *Queries) RefundFileBytesServed(ctx context.Context, arg RefundFileBytesServedParams) error {
+	_, err := q.db.Exec(ctx, refundFileBytesServed, arg.Bytes, arg.ID)
+	return err
+}
+
 const searchFiles = `-- name: SearchFiles :many
-SELECT id, size, name, alias, hash, slug, content_type, created_at, updated_at, user_id, private, comment, bytes_received FROM files
+SELECT id, size, name, alias, hash, slug, content_type, created_at, updated_at, user_id, private, comment, bytes_received, expires_at, max_downloads, download_count, password_hash, bytes_served FROM files
 WHERE (name % $1 OR alias % $1 OR COALESCE(comment, '') % $1)
    OR (POSITION(LOWER($1) IN LOWER(name)) > 0 OR POSITION(LOWER($1) IN LOWER(COALESCE(alias, ''))) > 0 OR POSITION(LOWER($1) IN LOWER(COALESCE(comment, ''))) > 0)
 ORDER BY created_at DESC
@@ -692,6 +1073,11 @@ func (q *Queries) SearchFiles(ctx context.Context, arg SearchFilesParams) ([]Fil
 			&i.Private,
 			&i.Comment,
 			&i.BytesReceived,
+			&i.ExpiresAt,
+			&i.MaxDownloads,
+			&i.DownloadCount,
+			&i.PasswordHash,
+			&i.BytesServed,
 		); err != nil {
 			return nil, err
 		}
@@ -704,10 +1090,15 @@ func (q *Queries) SearchFiles(ctx context.Context, arg SearchFilesParams) ([]Fil
 }
 
 const searchFilesVisibleToUser = `-- name: SearchFilesVisibleToUser :many
-SELECT id, size, name, alias, hash, slug, content_type, created_at, updated_at, user_id, private, comment, bytes_received FROM files
+SELECT id, size, name, alias, hash, slug, content_type, created_at, updated_at, user_id, private, comment, bytes_received, expires_at, max_downloads, download_count, password_hash, bytes_served FROM files
 WHERE (private = false OR user_id = $1)
   AND ((name % $2 OR alias % $2 OR COALESCE(comment, '') % $2)
    OR (POSITION(LOWER($2) IN LOWER(name)) > 0 OR POSITION(LOWER($2) IN LOWER(COALESCE(alias, ''))) > 0 OR POSITION(LOWER($2) IN LOWER(COALESCE(comment, ''))) > 0))
+  AND (user_id = $1 OR NOT EXISTS (
+    SELECT 1 FROM users u
+    WHERE u.id = files.user_id AND u.ban_hides_files
+      AND u.banned AND (u.banned_until IS NULL OR u.banned_until > NOW())
+  ))
 ORDER BY created_at DESC
 LIMIT $3 OFFSET $4
 `
@@ -747,6 +1138,11 @@ func (q *Queries) SearchFilesVisibleToUser(ctx context.Context, arg SearchFilesV
 			&i.Private,
 			&i.Comment,
 			&i.BytesReceived,
+			&i.ExpiresAt,
+			&i.MaxDownloads,
+			&i.DownloadCount,
+			&i.PasswordHash,
+			&i.BytesServed,
 		); err != nil {
 			return nil, err
 		}
@@ -759,10 +1155,15 @@ func (q *Queries) SearchFilesVisibleToUser(ctx context.Context, arg SearchFilesV
 }
 
 const searchPublicFiles = `-- name: SearchPublicFiles :many
-SELECT id, size, name, alias, hash, slug, content_type, created_at, updated_at, user_id, private, comment, bytes_received FROM files
+SELECT id, size, name, alias, hash, slug, content_type, created_at, updated_at, user_id, private, comment, bytes_received, expires_at, max_downloads, download_count, password_hash, bytes_served FROM files
 WHERE private = false
   AND ((name % $1 OR alias % $1 OR COALESCE(comment, '') % $1)
    OR (POSITION(LOWER($1) IN LOWER(name)) > 0 OR POSITION(LOWER($1) IN LOWER(COALESCE(alias, ''))) > 0 OR POSITION(LOWER($1) IN LOWER(COALESCE(comment, ''))) > 0))
+  AND NOT EXISTS (
+    SELECT 1 FROM users u
+    WHERE u.id = files.user_id AND u.ban_hides_files
+      AND u.banned AND (u.banned_until IS NULL OR u.banned_until > NOW())
+  )
 ORDER BY created_at DESC
 LIMIT $2 OFFSET $3
 `
@@ -796,6 +1197,11 @@ func (q *Queries) SearchPublicFiles(ctx context.Context, arg SearchPublicFilesPa
 			&i.Private,
 			&i.Comment,
 			&i.BytesReceived,
+			&i.ExpiresAt,
+			&i.MaxDownloads,
+			&i.DownloadCount,
+			&i.PasswordHash,
+			&i.BytesServed,
 		); err != nil {
 			return nil, err
 		}
@@ -807,6 +1213,102 @@ func (q *Queries) SearchPublicFiles(ctx context.Context, arg SearchPublicFilesPa
 	return items, nil
 }
 
+const setFileBytesReceived = `-- name: SetFileBytesReceived :exec
+UPDATE files
+SET bytes_received = $2, updated_at = NOW()
+WHERE id = $1
+`
+
+type SetFileBytesReceivedParams struct {
+	ID            int32 `db:"id" json:"id"`
+	BytesReceived int64 `db:"bytes_received" json:"bytes_received"`
+}
+
+func (q *Queries) SetFileBytesReceived(ctx context.Context, arg SetFileBytesReceivedParams) error {
+	_, err := q.db.Exec(ctx, setFileBytesReceived, arg.ID, arg.BytesReceived)
+	return err
+}
+
+const setFileExpiry = `-- name: SetFileExpiry :one
+UPDATE files
+SET
+    expires_at = $2,
+    max_downloads = $3,
+    updated_at = NOW()
+WHERE id = $1
+RETURNING id, size, name, alias, hash, slug, content_type, created_at, updated_at, user_id, private, comment, bytes_received, expires_at, max_downloads, download_count, password_hash, bytes_served
+`
+
+type SetFileExpiryParams struct {
+	ID           int32            `db:"id" json:"id"`
+	ExpiresAt    pgtype.Timestamp `db:"expires_at" json:"expires_at"`
+	MaxDownloads *int32           `db:"max_downloads" json:"max_downloads"`
+}
+
+func (q *Queries) SetFileExpiry(ctx context.Context, arg SetFileExpiryParams) (File, error) {
+	row := q.db.QueryRow(ctx, setFileExpiry, arg.ID, arg.ExpiresAt, arg.MaxDownloads)
+	var i File
+	err := row.Scan(
+		&i.ID,
+		&i.Size,
+		&i.Name,
+		&i.Alias,
+		&i.Hash,
+		&i.Slug,
+		&i.ContentType,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Private,
+		&i.Comment,
+		&i.BytesReceived,
+		&i.ExpiresAt,
+		&i.MaxDownloads,
+		&i.DownloadCount,
+		&i.PasswordHash,
+		&i.BytesServed,
+	)
+	return i, err
+}
+
+const setFilePassword = `-- name: SetFilePassword :one
+UPDATE files
+SET password_hash = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING id, size, name, alias, hash, slug, content_type, created_at, updated_at, user_id, private, comment, bytes_received, expires_at, max_downloads, download_count, password_hash, bytes_served
+`
+
+type SetFilePasswordParams struct {
+	ID           int32   `db:"id" json:"id"`
+	PasswordHash *string `db:"password_hash" json:"password_hash"`
+}
+
+func (q *Queries) SetFilePassword(ctx context.Context, arg SetFilePasswordParams) (File, error) {
+	row := q.db.QueryRow(ctx, setFilePassword, arg.ID, arg.PasswordHash)
+	var i File
+	err := row.Scan(
+		&i.ID,
+		&i.Size,
+		&i.Name,
+		&i.Alias,
+		&i.Hash,
+		&i.Slug,
+		&i.ContentType,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Private,
+		&i.Comment,
+		&i.BytesReceived,
+		&i.ExpiresAt,
+		&i.MaxDownloads,
+		&i.DownloadCount,
+		&i.PasswordHash,
+		&i.BytesServed,
+	)
+	return i, err
+}
+
 const totalFileSize = `-- name: TotalFileSize :one
 SELECT COALESCE(SUM(size), 0)::bigint FROM files
 `
@@ -818,6 +1320,18 @@ func (q *Queries) TotalFileSize(ctx context.Context) (int64, error) {
 	return column_1, err
 }
 
+const totalFileSizeByUserID = `-- name: TotalFileSizeByUserID :one
+SELECT COALESCE(SUM(size), 0)::bigint FROM files
+WHERE user_id = $1
+`
+
+func (q *Queries) TotalFileSizeByUserID(ctx context.Context, userID *int32) (int64, error) {
+	row := q.db.QueryRow(ctx, totalFileSizeByUserID, userID)
+	var column_1 int64
+	err := row.Scan(&column_1)
+	return column_1, err
+}
+
 const updateFile = `-- name: UpdateFile :one
 UPDATE files
 SET
@@ -829,7 +1343,7 @@ SET
     bytes_received = COALESCE($6, bytes_received),
     updated_at = NOW()
 WHERE id = $7
-RETURNING id, size, name, alias, hash, slug, content_type, created_at, updated_at, user_id, private, comment, bytes_received
+RETURNING id, size, name, alias, hash, slug, content_type, created_at, updated_at, user_id, private, comment, bytes_received, expires_at, max_downloads, download_count, password_hash, bytes_served
 `
 
 type UpdateFileParams struct {
@@ -838,7 +1352,7 @@ type UpdateFileParams struct {
 	Slug          *string `db:"slug" json:"slug"`
 	Private       *bool   `db:"private" json:"private"`
 	Comment       *string `db:"comment" json:"comment"`
-	BytesReceived *int32  `db:"bytes_received" json:"bytes_received"`
+	BytesReceived *int64  `db:"bytes_received" json:"bytes_received"`
 	ID            int32   `db:"id" json:"id"`
 }
 
@@ -867,6 +1381,11 @@ func (q *Queries) UpdateFile(ctx context.Context, arg UpdateFileParams) (File, e
 		&i.Private,
 		&i.Comment,
 		&i.BytesReceived,
+		&i.ExpiresAt,
+		&i.MaxDownloads,
+		&i.DownloadCount,
+		&i.PasswordHash,
+		&i.BytesServed,
 	)
 	return i, err
 }
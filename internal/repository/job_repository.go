@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type jobRepository struct {
+	queries *Queries
+}
+
+// NewJobRepository creates a new processing job repository
+func NewJobRepository(queries *Queries) JobRepository {
+	return &jobRepository{queries: queries}
+}
+
+func (r *jobRepository) Enqueue(ctx context.Context, params EnqueueProcessingJobParams) (*ProcessingJob, error) {
+	job, err := r.queries.EnqueueProcessingJob(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (r *jobRepository) Claim(ctx context.Context) (*ProcessingJob, error) {
+	job, err := r.queries.ClaimProcessingJob(ctx)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (r *jobRepository) Complete(ctx context.Context, id int32) error {
+	return r.queries.CompleteProcessingJob(ctx, id)
+}
+
+func (r *jobRepository) Retry(ctx context.Context, id int32, lastError string, runAt time.Time) error {
+	return r.queries.RetryProcessingJob(ctx, RetryProcessingJobParams{
+		ID:        id,
+		LastError: lastError,
+		RunAt:     runAt,
+	})
+}
+
+func (r *jobRepository) Fail(ctx context.Context, id int32, lastError string) error {
+	return r.queries.FailProcessingJob(ctx, FailProcessingJobParams{ID: id, LastError: lastError})
+}
+
+func (r *jobRepository) ListByFileID(ctx context.Context, fileID int32) ([]*ProcessingJob, error) {
+	jobs, err := r.queries.ListProcessingJobsByFileID(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*ProcessingJob, len(jobs))
+	for i := range jobs {
+		result[i] = &jobs[i]
+	}
+	return result, nil
+}
+
+func (r *jobRepository) ReleaseStale(ctx context.Context, lockedBefore time.Time) (int64, error) {
+	return r.queries.ReleaseStaleProcessingJobs(ctx, lockedBefore)
+}
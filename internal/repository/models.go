@@ -10,9 +10,58 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+type Album struct {
+	ID          int32     `db:"id" json:"id"`
+	UserID      int32     `db:"user_id" json:"user_id"`
+	Slug        string    `db:"slug" json:"slug"`
+	Name        string    `db:"name" json:"name"`
+	Description string    `db:"description" json:"description"`
+	Private     bool      `db:"private" json:"private"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at" json:"updated_at"`
+}
+
+type AlbumFile struct {
+	AlbumID  int32     `db:"album_id" json:"album_id"`
+	FileID   int32     `db:"file_id" json:"file_id"`
+	Position int32     `db:"position" json:"position"`
+	AddedAt  time.Time `db:"added_at" json:"added_at"`
+}
+
+type ApiToken struct {
+	ID         int32            `db:"id" json:"id"`
+	UserID     int32            `db:"user_id" json:"user_id"`
+	Name       string           `db:"name" json:"name"`
+	TokenHash  string           `db:"token_hash" json:"token_hash"`
+	Scopes     []string         `db:"scopes" json:"scopes"`
+	ExpiresAt  pgtype.Timestamp `db:"expires_at" json:"expires_at"`
+	LastUsedAt pgtype.Timestamp `db:"last_used_at" json:"last_used_at"`
+	CreatedAt  time.Time        `db:"created_at" json:"created_at"`
+}
+
+type AuditEvent struct {
+	ID         int64     `db:"id" json:"id"`
+	ActorID    *int32    `db:"actor_id" json:"actor_id"`
+	Action     string    `db:"action" json:"action"`
+	TargetType string    `db:"target_type" json:"target_type"`
+	TargetID   string    `db:"target_id" json:"target_id"`
+	Before     []byte    `db:"before" json:"before"`
+	After      []byte    `db:"after" json:"after"`
+	Ip         *string   `db:"ip" json:"ip"`
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+}
+
+type Blob struct {
+	Hash        string           `db:"hash" json:"hash"`
+	Size        int64            `db:"size" json:"size"`
+	RefCount    int32            `db:"ref_count" json:"ref_count"`
+	CreatedAt   time.Time        `db:"created_at" json:"created_at"`
+	CompletedAt pgtype.Timestamp `db:"completed_at" json:"completed_at"`
+}
+
 type File struct {
 	ID            int32            `db:"id" json:"id"`
-	Size          int32            `db:"size" json:"size"`
+	Size          int64            `db:"size" json:"size"`
 	Name          string           `db:"name" json:"name"`
 	Alias         string           `db:"alias" json:"alias"`
 	Hash          string           `db:"hash" json:"hash"`
@@ -23,7 +72,37 @@ type File struct {
 	UserID        *int32           `db:"user_id" json:"user_id"`
 	Private       bool             `db:"private" json:"private"`
 	Comment       string           `db:"comment" json:"comment"`
-	BytesReceived int32            `db:"bytes_received" json:"bytes_received"`
+	BytesReceived int64            `db:"bytes_received" json:"bytes_received"`
+	ExpiresAt     pgtype.Timestamp `db:"expires_at" json:"expires_at"`
+	MaxDownloads  *int32           `db:"max_downloads" json:"max_downloads"`
+	DownloadCount int32            `db:"download_count" json:"download_count"`
+	PasswordHash  *string          `db:"password_hash" json:"password_hash"`
+	BytesServed   int64            `db:"bytes_served" json:"bytes_served"`
+}
+
+type LegacyUploadObject struct {
+	Key  string `db:"key" json:"key"`
+	Hash string `db:"hash" json:"hash"`
+}
+
+type ProcessingJob struct {
+	ID          int32            `db:"id" json:"id"`
+	FileID      int32            `db:"file_id" json:"file_id"`
+	Processor   string           `db:"processor" json:"processor"`
+	Status      string           `db:"status" json:"status"`
+	Attempts    int32            `db:"attempts" json:"attempts"`
+	MaxAttempts int32            `db:"max_attempts" json:"max_attempts"`
+	LastError   string           `db:"last_error" json:"last_error"`
+	RunAt       time.Time        `db:"run_at" json:"run_at"`
+	LockedAt    pgtype.Timestamp `db:"locked_at" json:"locked_at"`
+	CreatedAt   time.Time        `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time        `db:"updated_at" json:"updated_at"`
+}
+
+type SignedUrlUse struct {
+	Nonce     string    `db:"nonce" json:"nonce"`
+	ExpiresAt time.Time `db:"expires_at" json:"expires_at"`
+	UsedAt    time.Time `db:"used_at" json:"used_at"`
 }
 
 type SiteSetting struct {
@@ -40,17 +119,56 @@ type Thumbnail struct {
 	CreatedAt pgtype.Timestamp `db:"created_at" json:"created_at"`
 }
 
+type TusUpload struct {
+	ID          string    `db:"id" json:"id"`
+	UserID      *int32    `db:"user_id" json:"user_id"`
+	Hash        *string   `db:"hash" json:"hash"`
+	Size        int64     `db:"size" json:"size"`
+	Name        string    `db:"name" json:"name"`
+	ContentType string    `db:"content_type" json:"content_type"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at" json:"updated_at"`
+}
+
+type UploadChunk struct {
+	FileID      int32     `db:"file_id" json:"file_id"`
+	StartOffset int64     `db:"start_offset" json:"start_offset"`
+	Size        int64     `db:"size" json:"size"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+	Key         string    `db:"key" json:"key"`
+}
+
+type UploadClaim struct {
+	Key       string    `db:"key" json:"key"`
+	Token     string    `db:"token" json:"token"`
+	ExpiresAt time.Time `db:"expires_at" json:"expires_at"`
+}
+
+type UserIdentity struct {
+	ID           int32     `db:"id" json:"id"`
+	UserID       int32     `db:"user_id" json:"user_id"`
+	Provider     string    `db:"provider" json:"provider"`
+	ProviderID   string    `db:"provider_id" json:"provider_id"`
+	Email        string    `db:"email" json:"email"`
+	PasswordHash *string   `db:"password_hash" json:"password_hash"`
+	CreatedAt    time.Time `db:"created_at" json:"created_at"`
+}
+
 type User struct {
-	ID                  int32     `db:"id" json:"id"`
-	Name                string    `db:"name" json:"name"`
-	Email               string    `db:"email" json:"email"`
-	Provider            string    `db:"provider" json:"provider"`
-	ProviderID          string    `db:"provider_id" json:"provider_id"`
-	Role                string    `db:"role" json:"role"`
-	CreatedAt           time.Time `db:"created_at" json:"created_at"`
-	UpdatedAt           time.Time `db:"updated_at" json:"updated_at"`
-	DisplayTag          *string   `db:"display_tag" json:"display_tag"`
-	Colour              *string   `db:"colour" json:"colour"`
-	Banned              bool      `db:"banned" json:"banned"`
-	MaxFileSizeOverride *int64    `db:"max_file_size_override" json:"max_file_size_override"`
+	ID                   int32            `db:"id" json:"id"`
+	Name                 string           `db:"name" json:"name"`
+	Email                string           `db:"email" json:"email"`
+	Provider             string           `db:"provider" json:"provider"`
+	ProviderID           string           `db:"provider_id" json:"provider_id"`
+	Role                 string           `db:"role" json:"role"`
+	CreatedAt            time.Time        `db:"created_at" json:"created_at"`
+	UpdatedAt            time.Time        `db:"updated_at" json:"updated_at"`
+	DisplayTag           *string          `db:"display_tag" json:"display_tag"`
+	Colour               *string          `db:"colour" json:"colour"`
+	Banned               bool             `db:"banned" json:"banned"`
+	MaxFileSizeOverride  *int64           `db:"max_file_size_override" json:"max_file_size_override"`
+	StorageQuotaOverride *int64           `db:"storage_quota_override" json:"storage_quota_override"`
+	BanReason            *string          `db:"ban_reason" json:"ban_reason"`
+	BannedUntil          pgtype.Timestamp `db:"banned_until" json:"banned_until"`
+	BanHidesFiles        bool             `db:"ban_hides_files" json:"ban_hides_files"`
 }
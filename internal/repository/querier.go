@@ -6,50 +6,129 @@ package repository
 
 import (
 	"context"
+	"time"
 )
 
 type Querier interface {
+	AcquireBlob(ctx context.Context, arg AcquireBlobParams) (Blob, error)
+	// Appends the file after the album's current last position; adding it again is a no-op
+	AddAlbumFile(ctx context.Context, arg AddAlbumFileParams) error
+	// Meters a download in bytes; no row is returned when it would go past max_downloads * size
+	AddFileBytesServed(ctx context.Context, arg AddFileBytesServedParams) (int32, error)
+	// Takes an advisory lock on key within namespace until the end of the transaction
+	AdvisoryXactLock(ctx context.Context, arg AdvisoryXactLockParams) error
+	ClaimProcessingJob(ctx context.Context) (ProcessingJob, error)
+	// Claims key for token until ttl_seconds from now, unless another token holds an unexpired claim
+	ClaimUpload(ctx context.Context, arg ClaimUploadParams) (int64, error)
+	CompleteProcessingJob(ctx context.Context, id int32) error
+	CountAuditEvents(ctx context.Context, arg CountAuditEventsParams) (int64, error)
 	CountBannedUsers(ctx context.Context) (int64, error)
 	CountFiles(ctx context.Context) (int64, error)
 	CountFilesByUserID(ctx context.Context, userID *int32) (int64, error)
+	CountThumbnailsByHash(ctx context.Context, hash string) (int64, error)
 	CountUsers(ctx context.Context) (int64, error)
+	CountUsersByRole(ctx context.Context, role string) (int64, error)
+	CreateAPIToken(ctx context.Context, arg CreateAPITokenParams) (ApiToken, error)
+	CreateAlbum(ctx context.Context, arg CreateAlbumParams) (Album, error)
+	CreateAuditEvent(ctx context.Context, arg CreateAuditEventParams) (AuditEvent, error)
 	CreateFile(ctx context.Context, arg CreateFileParams) (File, error)
 	CreateThumbnail(ctx context.Context, arg CreateThumbnailParams) (Thumbnail, error)
+	CreateTusUpload(ctx context.Context, arg CreateTusUploadParams) (TusUpload, error)
+	CreateUploadChunk(ctx context.Context, arg CreateUploadChunkParams) error
 	CreateUser(ctx context.Context, arg CreateUserParams) (User, error)
+	CreateUserIdentity(ctx context.Context, arg CreateUserIdentityParams) (UserIdentity, error)
+	DeleteAPIToken(ctx context.Context, arg DeleteAPITokenParams) (int64, error)
+	DeleteAlbum(ctx context.Context, id int32) error
+	DeleteExpiredSignedURLUses(ctx context.Context) (int64, error)
+	DeleteExpiredUploadClaims(ctx context.Context) (int64, error)
 	DeleteFile(ctx context.Context, id int32) error
 	DeleteFilesByUserID(ctx context.Context, userID *int32) error
+	DeleteLegacyUploadObject(ctx context.Context, key string) error
 	DeleteThumbnail(ctx context.Context, id int32) error
 	DeleteThumbnailsByFileID(ctx context.Context, fileID int32) error
+	DeleteTusUpload(ctx context.Context, id string) error
+	DeleteUnreferencedBlob(ctx context.Context, hash string) (int64, error)
+	DeleteUploadChunk(ctx context.Context, arg DeleteUploadChunkParams) error
+	DeleteUploadChunksByFileID(ctx context.Context, fileID int32) error
 	DeleteUser(ctx context.Context, id int32) error
+	DeleteUserIdentity(ctx context.Context, arg DeleteUserIdentityParams) (int64, error)
+	EnqueueProcessingJob(ctx context.Context, arg EnqueueProcessingJobParams) (ProcessingJob, error)
+	FailProcessingJob(ctx context.Context, arg FailProcessingJobParams) error
+	GetAPITokenByHash(ctx context.Context, tokenHash string) (ApiToken, error)
+	GetAlbumBySlug(ctx context.Context, slug string) (Album, error)
+	GetBlob(ctx context.Context, hash string) (Blob, error)
+	GetBlobForUpdate(ctx context.Context, hash string) (Blob, error)
 	GetFileByHash(ctx context.Context, hash string) (File, error)
+	GetFileByHashAndUserID(ctx context.Context, arg GetFileByHashAndUserIDParams) (File, error)
 	GetFileByID(ctx context.Context, id int32) (File, error)
 	GetFileBySlug(ctx context.Context, slug string) (File, error)
 	GetFileWithThumbnail(ctx context.Context, id int32) (GetFileWithThumbnailRow, error)
 	GetFileWithThumbnailByHash(ctx context.Context, hash string) (GetFileWithThumbnailByHashRow, error)
 	GetFileWithThumbnailBySlug(ctx context.Context, slug string) (GetFileWithThumbnailBySlugRow, error)
+	GetIncompleteUploadStats(ctx context.Context, inactiveSince time.Time) (GetIncompleteUploadStatsRow, error)
 	GetSiteSetting(ctx context.Context, key string) (string, error)
 	GetThumbnailByFileID(ctx context.Context, fileID int32) (Thumbnail, error)
 	GetThumbnailsByFileID(ctx context.Context, fileID int32) ([]Thumbnail, error)
+	GetTusUpload(ctx context.Context, id string) (TusUpload, error)
 	GetUserByEmail(ctx context.Context, email string) (User, error)
 	GetUserByID(ctx context.Context, id int32) (User, error)
 	GetUserByProviderID(ctx context.Context, providerID string) (User, error)
+	GetUserIdentity(ctx context.Context, arg GetUserIdentityParams) (UserIdentity, error)
+	ListAPITokensByUserID(ctx context.Context, userID int32) ([]ApiToken, error)
+	ListAlbumFiles(ctx context.Context, albumID int32) ([]File, error)
+	ListAlbumsByUserID(ctx context.Context, userID int32) ([]ListAlbumsByUserIDRow, error)
+	ListAuditEvents(ctx context.Context, arg ListAuditEventsParams) ([]AuditEvent, error)
+	ListBlobs(ctx context.Context, arg ListBlobsParams) ([]Blob, error)
+	ListCompletedImageFiles(ctx context.Context, arg ListCompletedImageFilesParams) ([]File, error)
+	ListExpiredFiles(ctx context.Context, limit int32) ([]File, error)
 	ListFiles(ctx context.Context, arg ListFilesParams) ([]File, error)
+	ListFilesByHash(ctx context.Context, hash string) ([]File, error)
 	ListFilesByUserID(ctx context.Context, arg ListFilesByUserIDParams) ([]File, error)
 	ListFilesVisibleToUser(ctx context.Context, arg ListFilesVisibleToUserParams) ([]File, error)
 	ListFilesWithThumbnails(ctx context.Context, arg ListFilesWithThumbnailsParams) ([]ListFilesWithThumbnailsRow, error)
+	ListLegacyUploadObjects(ctx context.Context, limit int32) ([]LegacyUploadObject, error)
+	ListProcessingJobsByFileID(ctx context.Context, fileID int32) ([]ProcessingJob, error)
 	ListPublicFiles(ctx context.Context, arg ListPublicFilesParams) ([]File, error)
+	ListSiteSettings(ctx context.Context) ([]SiteSetting, error)
+	ListStaleIncompleteFiles(ctx context.Context, arg ListStaleIncompleteFilesParams) ([]File, error)
+	ListStaleTusUploads(ctx context.Context, arg ListStaleTusUploadsParams) ([]TusUpload, error)
+	ListThumbnails(ctx context.Context, arg ListThumbnailsParams) ([]Thumbnail, error)
+	ListUploadChunksByFileID(ctx context.Context, fileID int32) ([]UploadChunk, error)
+	ListUserIdentitiesByUserID(ctx context.Context, userID int32) ([]UserIdentity, error)
 	ListUsers(ctx context.Context, arg ListUsersParams) ([]User, error)
+	LockUserByID(ctx context.Context, id int32) (int64, error)
+	MarkBlobCompleted(ctx context.Context, arg MarkBlobCompletedParams) error
+	ReleaseBlob(ctx context.Context, hash string) (int32, error)
+	ReleaseStaleProcessingJobs(ctx context.Context, lockedBefore time.Time) (int64, error)
+	ReleaseUploadClaim(ctx context.Context, arg ReleaseUploadClaimParams) error
+	// Gives back bytes metered for a download that was cut short
+	RefundFileBytesServed(ctx context.Context, arg RefundFileBytesServedParams) error
+	RemoveAlbumFile(ctx context.Context, arg RemoveAlbumFileParams) (int64, error)
+	// Sets each listed file's position to its index in file_ids
+	ReorderAlbumFiles(ctx context.Context, arg ReorderAlbumFilesParams) error
+	RetryProcessingJob(ctx context.Context, arg RetryProcessingJobParams) error
 	SearchFiles(ctx context.Context, arg SearchFilesParams) ([]File, error)
 	SearchFilesVisibleToUser(ctx context.Context, arg SearchFilesVisibleToUserParams) ([]File, error)
 	SearchPublicFiles(ctx context.Context, arg SearchPublicFilesParams) ([]File, error)
+	SetFileBytesReceived(ctx context.Context, arg SetFileBytesReceivedParams) error
+	SetFileExpiry(ctx context.Context, arg SetFileExpiryParams) (File, error)
+	SetFilePassword(ctx context.Context, arg SetFilePasswordParams) (File, error)
 	SetSiteSetting(ctx context.Context, arg SetSiteSettingParams) error
+	SetTusUploadHash(ctx context.Context, arg SetTusUploadHashParams) error
 	SetUserBanned(ctx context.Context, arg SetUserBannedParams) (User, error)
+	SetUserIdentityPasswordHash(ctx context.Context, arg SetUserIdentityPasswordHashParams) (int64, error)
 	SetUserMaxFileSize(ctx context.Context, arg SetUserMaxFileSizeParams) (User, error)
+	SetUserStorageQuota(ctx context.Context, arg SetUserStorageQuotaParams) (User, error)
 	TotalFileSize(ctx context.Context) (int64, error)
+	TotalFileSizeByUserID(ctx context.Context, userID *int32) (int64, error)
+	TouchAPIToken(ctx context.Context, id int32) error
+	TouchTusUpload(ctx context.Context, id string) error
+	UpdateAlbum(ctx context.Context, arg UpdateAlbumParams) (Album, error)
 	UpdateFile(ctx context.Context, arg UpdateFileParams) (File, error)
 	UpdateThumbnail(ctx context.Context, arg UpdateThumbnailParams) (Thumbnail, error)
 	UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error)
 	UpdateUserProfile(ctx context.Context, arg UpdateUserProfileParams) (User, error)
+	UseSignedURLNonce(ctx context.Context, arg UseSignedURLNonceParams) (int64, error)
 }
 
 var _ Querier = (*Queries)(nil)
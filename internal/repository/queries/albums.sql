@@ -0,0 +1,64 @@
+-- name: CreateAlbum :one
+INSERT INTO albums (
+    user_id,
+    slug,
+    name,
+    description,
+    private,
+    created_at,
+    updated_at
+) VALUES (
+    $1, $2, $3, $4, $5, NOW(), NOW()
+) RETURNING *;
+
+-- name: GetAlbumBySlug :one
+SELECT * FROM albums
+WHERE slug = $1 LIMIT 1;
+
+-- name: ListAlbumsByUserID :many
+SELECT albums.*, (SELECT COUNT(*) FROM album_files WHERE album_files.album_id = albums.id) AS file_count
+FROM albums
+WHERE user_id = $1
+ORDER BY created_at DESC, id DESC;
+
+-- name: UpdateAlbum :one
+UPDATE albums
+SET
+    name = COALESCE(sqlc.narg('name'), name),
+    description = COALESCE(sqlc.narg('description'), description),
+    private = COALESCE(sqlc.narg('private'), private),
+    updated_at = NOW()
+WHERE id = sqlc.arg('id')
+RETURNING *;
+
+-- name: DeleteAlbum :exec
+DELETE FROM albums
+WHERE id = $1;
+
+-- name: ListAlbumFiles :many
+SELECT files.* FROM files
+JOIN album_files ON album_files.file_id = files.id
+WHERE album_files.album_id = $1
+ORDER BY album_files.position, album_files.added_at, files.id;
+
+-- name: AddAlbumFile :exec
+-- Appends the file after the album's current last position; adding it again is a no-op
+INSERT INTO album_files (
+    album_id,
+    file_id,
+    position,
+    added_at
+) VALUES (
+    $1, $2, (SELECT COALESCE(MAX(position) + 1, 0) FROM album_files WHERE album_id = $1), NOW()
+) ON CONFLICT (album_id, file_id) DO NOTHING;
+
+-- name: RemoveAlbumFile :execrows
+DELETE FROM album_files
+WHERE album_id = $1 AND file_id = $2;
+
+-- name: ReorderAlbumFiles :exec
+-- Sets each listed file's position to its index in file_ids
+UPDATE album_files
+SET position = ordered.ord - 1
+FROM unnest(sqlc.arg('file_ids')::int[]) WITH ORDINALITY AS ordered(file_id, ord)
+WHERE album_files.album_id = sqlc.arg('album_id') AND album_files.file_id = ordered.file_id;
@@ -0,0 +1,50 @@
+-- name: AcquireBlob :one
+INSERT INTO blobs (
+    hash,
+    size,
+    ref_count,
+    created_at
+) VALUES (
+    $1, $2, 1, NOW()
+)
+ON CONFLICT (hash) DO UPDATE SET ref_count = blobs.ref_count + 1
+RETURNING *;
+
+-- name: GetBlob :one
+SELECT * FROM blobs
+WHERE hash = $1 LIMIT 1;
+
+-- name: GetBlobForUpdate :one
+SELECT * FROM blobs
+WHERE hash = $1
+FOR UPDATE;
+
+-- name: ReleaseBlob :one
+UPDATE blobs
+SET ref_count = ref_count - 1
+WHERE hash = $1
+RETURNING ref_count;
+
+-- name: DeleteUnreferencedBlob :execrows
+DELETE FROM blobs
+WHERE hash = $1 AND ref_count <= 0;
+
+-- name: MarkBlobCompleted :exec
+UPDATE blobs
+SET completed_at = NOW(), size = $2
+WHERE hash = $1;
+
+-- name: ListBlobs :many
+SELECT * FROM blobs
+WHERE hash > $1
+ORDER BY hash
+LIMIT $2;
+
+-- name: ListLegacyUploadObjects :many
+SELECT * FROM legacy_upload_objects
+ORDER BY key
+LIMIT $1;
+
+-- name: DeleteLegacyUploadObject :exec
+DELETE FROM legacy_upload_objects
+WHERE key = $1;
@@ -10,16 +10,29 @@ INSERT INTO files (
     private,
     comment,
     bytes_received,
+    expires_at,
+    max_downloads,
     created_at,
     updated_at
 ) VALUES (
-    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NOW(), NOW()
+    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, NOW(), NOW()
 ) RETURNING *;
 
 -- name: GetFileByID :one
 SELECT * FROM files
 WHERE id = $1 LIMIT 1;
 
+-- name: GetFileByHashAndUserID :one
+SELECT * FROM files
+WHERE hash = $1 AND user_id IS NOT DISTINCT FROM $2
+ORDER BY id DESC
+LIMIT 1;
+
+-- name: ListFilesByHash :many
+SELECT * FROM files
+WHERE hash = $1
+ORDER BY id;
+
 -- name: GetFileBySlug :one
 SELECT * FROM files
 WHERE slug = $1 LIMIT 1;
@@ -42,15 +55,36 @@ LIMIT $2 OFFSET $3;
 -- name: ListPublicFiles :many
 SELECT * FROM files
 WHERE private = false
+  AND NOT EXISTS (
+    SELECT 1 FROM users u
+    WHERE u.id = files.user_id AND u.ban_hides_files
+      AND u.banned AND (u.banned_until IS NULL OR u.banned_until > NOW())
+  )
 ORDER BY created_at DESC
 LIMIT $1 OFFSET $2;
 
 -- name: ListFilesVisibleToUser :many
 SELECT * FROM files
-WHERE private = false OR user_id = $1
+WHERE (private = false OR user_id = $1)
+  AND (user_id = $1 OR NOT EXISTS (
+    SELECT 1 FROM users u
+    WHERE u.id = files.user_id AND u.ban_hides_files
+      AND u.banned AND (u.banned_until IS NULL OR u.banned_until > NOW())
+  ))
 ORDER BY created_at DESC
 LIMIT $2 OFFSET $3;
 
+-- name: ListCompletedImageFiles :many
+SELECT * FROM files
+WHERE id > sqlc.arg('after_id')
+    AND bytes_received >= size
+    AND content_type ILIKE 'image/%'
+    AND (NOT sqlc.arg('missing_thumbnail')::boolean OR NOT EXISTS (
+        SELECT 1 FROM thumbnails t WHERE t.file_id = files.id
+    ))
+ORDER BY id
+LIMIT sqlc.arg('limit');
+
 -- name: UpdateFile :one
 UPDATE files
 SET
@@ -64,6 +98,50 @@ SET
 WHERE id = sqlc.arg('id')
 RETURNING *;
 
+-- name: SetFileBytesReceived :exec
+UPDATE files
+SET bytes_received = $2, updated_at = NOW()
+WHERE id = $1;
+
+-- name: SetFileExpiry :one
+UPDATE files
+SET
+    expires_at = $2,
+    max_downloads = $3,
+    updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: SetFilePassword :one
+UPDATE files
+SET password_hash = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: AddFileBytesServed :one
+-- Meters a download in bytes; no row is returned when it would go past max_downloads * size
+UPDATE files
+SET bytes_served = bytes_served + sqlc.arg('bytes')::bigint,
+    download_count = ((bytes_served + sqlc.arg('bytes')::bigint) / GREATEST(size, 1))::integer,
+    updated_at = NOW()
+WHERE id = sqlc.arg('id')
+  AND (max_downloads IS NULL OR bytes_served + sqlc.arg('bytes')::bigint <= max_downloads::bigint * GREATEST(size, 1))
+RETURNING download_count;
+
+-- name: RefundFileBytesServed :exec
+-- Gives back bytes metered for a download that was cut short
+UPDATE files
+SET bytes_served = GREATEST(bytes_served - sqlc.arg('bytes')::bigint, 0),
+    download_count = (GREATEST(bytes_served - sqlc.arg('bytes')::bigint, 0) / GREATEST(size, 1))::integer
+WHERE id = sqlc.arg('id');
+
+-- name: ListExpiredFiles :many
+SELECT * FROM files
+WHERE (expires_at IS NOT NULL AND expires_at <= NOW())
+   OR (max_downloads IS NOT NULL AND download_count >= max_downloads AND updated_at <= NOW() - INTERVAL '1 hour')
+ORDER BY id
+LIMIT $1;
+
 -- name: DeleteFile :exec
 DELETE FROM files
 WHERE id = $1;
@@ -82,6 +160,10 @@ WHERE user_id = $1;
 -- name: TotalFileSize :one
 SELECT COALESCE(SUM(size), 0)::bigint FROM files;
 
+-- name: TotalFileSizeByUserID :one
+SELECT COALESCE(SUM(size), 0)::bigint FROM files
+WHERE user_id = $1;
+
 -- name: GetFileWithThumbnail :one
 SELECT 
     f.id,
@@ -182,6 +264,11 @@ SELECT * FROM files
 WHERE private = false
   AND ((name % $1 OR alias % $1 OR COALESCE(comment, '') % $1)
    OR (POSITION(LOWER($1) IN LOWER(name)) > 0 OR POSITION(LOWER($1) IN LOWER(COALESCE(alias, ''))) > 0 OR POSITION(LOWER($1) IN LOWER(COALESCE(comment, ''))) > 0))
+  AND NOT EXISTS (
+    SELECT 1 FROM users u
+    WHERE u.id = files.user_id AND u.ban_hides_files
+      AND u.banned AND (u.banned_until IS NULL OR u.banned_until > NOW())
+  )
 ORDER BY created_at DESC
 LIMIT $2 OFFSET $3;
 
@@ -190,5 +277,41 @@ SELECT * FROM files
 WHERE (private = false OR user_id = $1)
   AND ((name % $2 OR alias % $2 OR COALESCE(comment, '') % $2)
    OR (POSITION(LOWER($2) IN LOWER(name)) > 0 OR POSITION(LOWER($2) IN LOWER(COALESCE(alias, ''))) > 0 OR POSITION(LOWER($2) IN LOWER(COALESCE(comment, ''))) > 0))
+  AND (user_id = $1 OR NOT EXISTS (
+    SELECT 1 FROM users u
+    WHERE u.id = files.user_id AND u.ban_hides_files
+      AND u.banned AND (u.banned_until IS NULL OR u.banned_until > NOW())
+  ))
 ORDER BY created_at DESC
 LIMIT $3 OFFSET $4;
+
+-- name: ListStaleIncompleteFiles :many
+SELECT * FROM files f
+WHERE f.bytes_received < f.size
+    AND COALESCE(f.updated_at, f.created_at) < sqlc.arg('inactive_since')::timestamp
+    AND NOT EXISTS (
+        SELECT 1 FROM upload_chunks c
+        WHERE c.file_id = f.id AND c.created_at >= sqlc.arg('inactive_since')::timestamp
+    )
+ORDER BY f.id
+LIMIT sqlc.arg('limit');
+
+-- name: GetIncompleteUploadStats :one
+WITH parked AS (
+    SELECT file_id, SUM(size) AS bytes, MAX(created_at) AS active_at
+    FROM upload_chunks
+    GROUP BY file_id
+), uploads AS (
+    SELECT
+        f.bytes_received + COALESCE(c.bytes, 0) AS bytes,
+        GREATEST(COALESCE(f.updated_at, f.created_at), c.active_at) < sqlc.arg('inactive_since')::timestamp AS stale
+    FROM files f
+    LEFT JOIN parked c ON c.file_id = f.id
+    WHERE f.bytes_received < f.size
+)
+SELECT
+    COUNT(*)::bigint AS uploads,
+    COALESCE(SUM(bytes), 0)::bigint AS bytes,
+    COUNT(*) FILTER (WHERE stale)::bigint AS stale_uploads,
+    COALESCE(SUM(bytes) FILTER (WHERE stale), 0)::bigint AS stale_bytes
+FROM uploads;
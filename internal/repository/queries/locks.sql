@@ -0,0 +1,3 @@
+-- name: AdvisoryXactLock :exec
+-- Takes an advisory lock on key within namespace until the end of the transaction
+SELECT pg_advisory_xact_lock(sqlc.arg(namespace)::int, hashtext(sqlc.arg(key)::text));
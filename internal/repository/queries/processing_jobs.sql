@@ -0,0 +1,75 @@
+-- name: EnqueueProcessingJob :one
+INSERT INTO processing_jobs (
+    file_id,
+    processor,
+    max_attempts
+) VALUES (
+    $1, $2, $3
+)
+ON CONFLICT (file_id, processor) DO UPDATE
+SET
+    status = 'pending',
+    attempts = 0,
+    max_attempts = EXCLUDED.max_attempts,
+    last_error = '',
+    run_at = NOW(),
+    locked_at = NULL,
+    updated_at = NOW()
+RETURNING *;
+
+-- name: ClaimProcessingJob :one
+UPDATE processing_jobs
+SET
+    status = 'running',
+    attempts = attempts + 1,
+    locked_at = NOW(),
+    updated_at = NOW()
+WHERE id = (
+    SELECT j.id FROM processing_jobs j
+    WHERE j.status = 'pending' AND j.run_at <= NOW()
+    ORDER BY j.run_at, j.id
+    FOR UPDATE SKIP LOCKED
+    LIMIT 1
+)
+RETURNING *;
+
+-- name: CompleteProcessingJob :exec
+UPDATE processing_jobs
+SET
+    status = 'succeeded',
+    last_error = '',
+    locked_at = NULL,
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: RetryProcessingJob :exec
+UPDATE processing_jobs
+SET
+    status = 'pending',
+    last_error = $2,
+    run_at = $3,
+    locked_at = NULL,
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: FailProcessingJob :exec
+UPDATE processing_jobs
+SET
+    status = 'failed',
+    last_error = $2,
+    locked_at = NULL,
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: ListProcessingJobsByFileID :many
+SELECT * FROM processing_jobs
+WHERE file_id = $1
+ORDER BY processor;
+
+-- name: ReleaseStaleProcessingJobs :execrows
+UPDATE processing_jobs
+SET
+    status = 'pending',
+    locked_at = NULL,
+    updated_at = NOW()
+WHERE status = 'running' AND locked_at < sqlc.arg('locked_before')::timestamp;
@@ -4,3 +4,7 @@ SELECT value FROM site_settings WHERE key = $1;
 -- name: SetSiteSetting :exec
 INSERT INTO site_settings (key, value) VALUES ($1, $2)
 ON CONFLICT (key) DO UPDATE SET value = $2;
+
+-- name: ListSiteSettings :many
+SELECT * FROM site_settings
+ORDER BY key;
@@ -0,0 +1,8 @@
+-- name: UseSignedURLNonce :execrows
+INSERT INTO signed_url_uses (nonce, expires_at)
+VALUES ($1, $2)
+ON CONFLICT (nonce) DO NOTHING;
+
+-- name: DeleteExpiredSignedURLUses :execrows
+DELETE FROM signed_url_uses
+WHERE expires_at <= NOW();
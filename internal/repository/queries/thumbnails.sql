@@ -32,3 +32,13 @@ SET
     height = COALESCE(sqlc.narg('height'), height)
 WHERE id = sqlc.arg('id')
 RETURNING *;
+
+-- name: CountThumbnailsByHash :one
+SELECT COUNT(*) FROM thumbnails
+WHERE hash = $1;
+
+-- name: ListThumbnails :many
+SELECT * FROM thumbnails
+WHERE id > sqlc.arg('after_id')
+ORDER BY id
+LIMIT sqlc.arg('limit');
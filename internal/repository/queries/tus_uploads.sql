@@ -0,0 +1,40 @@
+-- name: CreateTusUpload :one
+INSERT INTO tus_uploads (
+    id,
+    user_id,
+    hash,
+    size,
+    name,
+    content_type
+) VALUES (
+    $1, $2, $3, $4, $5, $6
+)
+RETURNING id, user_id, hash, size, name, content_type, created_at, updated_at;
+
+-- name: GetTusUpload :one
+SELECT id, user_id, hash, size, name, content_type, created_at, updated_at FROM tus_uploads
+WHERE id = $1 LIMIT 1;
+
+-- name: SetTusUploadHash :exec
+UPDATE tus_uploads
+SET hash = $2
+WHERE id = $1;
+
+-- name: TouchTusUpload :exec
+UPDATE tus_uploads
+SET updated_at = NOW()
+WHERE id = $1;
+
+-- name: DeleteTusUpload :exec
+DELETE FROM tus_uploads
+WHERE id = $1;
+
+-- name: ListStaleTusUploads :many
+SELECT id, user_id, hash, size, name, content_type, created_at, updated_at FROM tus_uploads t
+WHERE t.updated_at < sqlc.arg('inactive_since')::timestamp
+    AND (t.hash IS NULL OR NOT EXISTS (
+        SELECT 1 FROM files f
+        WHERE f.hash = t.hash AND f.user_id IS NOT DISTINCT FROM t.user_id
+    ))
+ORDER BY t.id
+LIMIT sqlc.arg('limit');
@@ -0,0 +1,17 @@
+-- name: CreateUploadChunk :exec
+INSERT INTO upload_chunks (file_id, start_offset, size, key)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (file_id, start_offset) DO UPDATE SET size = EXCLUDED.size, key = EXCLUDED.key, created_at = NOW();
+
+-- name: ListUploadChunksByFileID :many
+SELECT file_id, start_offset, size, created_at, key FROM upload_chunks
+WHERE file_id = $1
+ORDER BY start_offset;
+
+-- name: DeleteUploadChunk :exec
+DELETE FROM upload_chunks
+WHERE file_id = $1 AND start_offset = $2 AND key = $3;
+
+-- name: DeleteUploadChunksByFileID :exec
+DELETE FROM upload_chunks
+WHERE file_id = $1;
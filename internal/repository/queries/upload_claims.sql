@@ -0,0 +1,14 @@
+-- name: ClaimUpload :execrows
+-- Claims key for token until ttl_seconds from now, unless another token holds an unexpired claim
+INSERT INTO upload_claims (key, token, expires_at)
+VALUES (sqlc.arg(key), sqlc.arg(token), NOW() + sqlc.arg(ttl_seconds)::int * INTERVAL '1 second')
+ON CONFLICT (key) DO UPDATE SET token = EXCLUDED.token, expires_at = EXCLUDED.expires_at
+WHERE upload_claims.token = EXCLUDED.token OR upload_claims.expires_at < NOW();
+
+-- name: ReleaseUploadClaim :exec
+DELETE FROM upload_claims
+WHERE key = $1 AND token = $2;
+
+-- name: DeleteExpiredUploadClaims :execrows
+DELETE FROM upload_claims
+WHERE expires_at < NOW();
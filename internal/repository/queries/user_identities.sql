@@ -0,0 +1,29 @@
+-- name: CreateUserIdentity :one
+INSERT INTO user_identities (
+    user_id,
+    provider,
+    provider_id,
+    email,
+    password_hash,
+    created_at
+) VALUES (
+    $1, $2, $3, $4, $5, NOW()
+) RETURNING *;
+
+-- name: GetUserIdentity :one
+SELECT * FROM user_identities
+WHERE provider = $1 AND provider_id = $2 LIMIT 1;
+
+-- name: ListUserIdentitiesByUserID :many
+SELECT * FROM user_identities
+WHERE user_id = $1
+ORDER BY created_at, id;
+
+-- name: SetUserIdentityPasswordHash :execrows
+UPDATE user_identities
+SET password_hash = $2
+WHERE id = $1;
+
+-- name: DeleteUserIdentity :execrows
+DELETE FROM user_identities
+WHERE id = $1 AND user_id = $2;
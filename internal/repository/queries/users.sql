@@ -55,12 +55,22 @@ RETURNING *;
 SELECT COUNT(*) FROM users;
 
 -- name: CountBannedUsers :one
-SELECT COUNT(*) FROM users WHERE banned = true;
+SELECT COUNT(*) FROM users
+WHERE banned = true AND (banned_until IS NULL OR banned_until > NOW());
+
+-- name: CountUsersByRole :one
+SELECT COUNT(*) FROM users
+WHERE role = $1;
 
 -- name: SetUserBanned :one
 UPDATE users
-SET banned = $2, updated_at = NOW()
-WHERE id = $1
+SET
+    banned = sqlc.arg('banned'),
+    ban_reason = sqlc.narg('ban_reason'),
+    banned_until = sqlc.narg('banned_until'),
+    ban_hides_files = sqlc.arg('ban_hides_files'),
+    updated_at = NOW()
+WHERE id = sqlc.arg('id')
 RETURNING *;
 
 -- name: SetUserMaxFileSize :one
@@ -68,3 +78,14 @@ UPDATE users
 SET max_file_size_override = $2, updated_at = NOW()
 WHERE id = $1
 RETURNING *;
+
+-- name: SetUserStorageQuota :one
+UPDATE users
+SET storage_quota_override = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: LockUserByID :execrows
+SELECT id FROM users
+WHERE id = $1
+FOR UPDATE;
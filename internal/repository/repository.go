@@ -3,7 +3,9 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -11,28 +13,103 @@ import (
 type Repository struct {
 	Files      FileRepository
 	Users      UserRepository
+	Identities UserIdentityRepository
 	Thumbnails ThumbnailRepository
 	Settings   SettingsRepository
+	APITokens  APITokenRepository
+	Jobs       JobRepository
+	Blobs      BlobRepository
+	SignedURLs SignedURLRepository
+	TusUploads TusUploadRepository
+	Chunks     UploadChunkRepository
+	Claims     UploadClaimRepository
+	Audit      AuditEventRepository
+	Albums     AlbumRepository
+
+	db beginner
+}
+
+// beginner is a connection pool or transaction that queries run on and transactions start from
+type beginner interface {
+	DBTX
+	Begin(ctx context.Context) (pgx.Tx, error)
 }
 
 // NewRepository creates a new Repository with all sub-repositories
 func NewRepository(pool *pgxpool.Pool) *Repository {
-	queries := New(pool)
+	return newRepository(pool)
+}
+
+func newRepository(db beginner) *Repository {
+	queries := New(db)
 
 	return &Repository{
 		Files:      NewFileRepository(queries),
 		Users:      NewUserRepository(queries),
+		Identities: NewUserIdentityRepository(queries),
 		Thumbnails: NewThumbnailRepository(queries),
 		Settings:   NewSettingsRepository(queries),
+		APITokens:  NewAPITokenRepository(queries),
+		Jobs:       NewJobRepository(queries),
+		Blobs:      NewBlobRepository(queries),
+		SignedURLs: NewSignedURLRepository(queries),
+		TusUploads: NewTusUploadRepository(queries),
+		Chunks:     NewUploadChunkRepository(queries),
+		Claims:     NewUploadClaimRepository(queries),
+		Audit:      NewAuditEventRepository(queries),
+		Albums:     NewAlbumRepository(queries),
+		db:         db,
 	}
 }
 
+// WithTransaction runs fn with a Repository whose queries all run in one transaction. The
+// transaction commits if fn returns nil and rolls back otherwise. Calling WithTransaction
+// on the Repository fn receives nests a savepoint inside the outer transaction.
+func (r *Repository) WithTransaction(ctx context.Context, fn func(ctx context.Context, repo *Repository) error) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback(ctx)
+			panic(p)
+		}
+	}()
+
+	if err := fn(ctx, newRepository(tx)); err != nil {
+		_ = tx.Rollback(ctx)
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// LockNamespace keeps the keys of different kinds of advisory lock apart
+type LockNamespace int32
+
+const (
+	// LockFileUpload is keyed by file ID and guards a file record's parked chunk rows
+	LockFileUpload LockNamespace = iota + 1
+	// LockUserSignup is held while creating a user, so only the first user becomes admin
+	LockUserSignup
+)
+
+// XactLock takes a Postgres advisory lock on key within ns, waiting while any instance holds
+// it, until the end of the transaction. Call it on the Repository WithTransaction passes to
+// fn and keep the transaction short, since the lock holds its connection.
+func (r *Repository) XactLock(ctx context.Context, ns LockNamespace, key string) error {
+	return New(r.db).AdvisoryXactLock(ctx, AdvisoryXactLockParams{Namespace: int32(ns), Key: key})
+}
+
 // FileRepository defines the interface for file data access
 type FileRepository interface {
 	Create(ctx context.Context, params CreateFileParams) (*File, error)
 	GetByID(ctx context.Context, id int32) (*File, error)
 	GetBySlug(ctx context.Context, slug string) (*File, error)
 	GetByHash(ctx context.Context, hash string) (*File, error)
+	GetByHashAndUserID(ctx context.Context, hash string, userID *int32) (*File, error)
+	ListByHash(ctx context.Context, hash string) ([]*File, error)
 	GetWithThumbnail(ctx context.Context, id int32) (*FileWithThumbnail, error)
 	GetWithThumbnailBySlug(ctx context.Context, slug string) (*FileWithThumbnail, error)
 	GetWithThumbnailByHash(ctx context.Context, hash string) (*FileWithThumbnail, error)
@@ -45,11 +122,25 @@ type FileRepository interface {
 	SearchFilesVisibleToUser(ctx context.Context, userID int32, search string, limit, offset int32) ([]*File, error)
 	ListWithThumbnails(ctx context.Context, limit, offset int32) ([]*FileWithThumbnail, error)
 	Update(ctx context.Context, params UpdateFileParams) (*File, error)
+	SetExpiry(ctx context.Context, params SetFileExpiryParams) (*File, error)
+	SetBytesReceived(ctx context.Context, id int32, bytesReceived int64) error
+	SetPassword(ctx context.Context, id int32, passwordHash *string) (*File, error)
+	AddBytesServed(ctx context.Context, id int32, bytes int64) (int32, error)
+	RefundBytesServed(ctx context.Context, id int32, bytes int64) error
+	ListExpired(ctx context.Context, limit int32) ([]*File, error)
+	// ListCompletedImages pages by ID through fully uploaded images, optionally only those without a thumbnail
+	ListCompletedImages(ctx context.Context, afterID int32, missingThumbnail bool, limit int32) ([]*File, error)
+	// ListStaleIncomplete returns unfinished files that have received no data since inactiveSince
+	ListStaleIncomplete(ctx context.Context, inactiveSince time.Time, limit int32) ([]*File, error)
+	// IncompleteUploadStats counts unfinished uploads and the bytes stored for them,
+	// in total and for those that have received no data since inactiveSince
+	IncompleteUploadStats(ctx context.Context, inactiveSince time.Time) (*GetIncompleteUploadStatsRow, error)
 	Delete(ctx context.Context, id int32) error
 	DeleteByUserID(ctx context.Context, userID int32) error
 	Count(ctx context.Context) (int64, error)
 	CountByUserID(ctx context.Context, userID int32) (int64, error)
 	TotalSize(ctx context.Context) (int64, error)
+	TotalSizeByUserID(ctx context.Context, userID int32) (int64, error)
 }
 
 // UserRepository defines the interface for user data access
@@ -61,17 +152,54 @@ type UserRepository interface {
 	List(ctx context.Context, limit, offset int32) ([]*User, error)
 	Update(ctx context.Context, params UpdateUserParams) (*User, error)
 	UpdateProfile(ctx context.Context, params UpdateUserProfileParams) (*User, error)
-	SetBanned(ctx context.Context, userID int32, banned bool) (*User, error)
+	// SetBanned bans or unbans a user, replacing the ban reason, expiry and file hiding
+	SetBanned(ctx context.Context, params SetUserBannedParams) (*User, error)
 	SetMaxFileSize(ctx context.Context, userID int32, maxBytes *int64) (*User, error)
+	SetStorageQuota(ctx context.Context, userID int32, quotaBytes *int64) (*User, error)
+	// Lock locks the user's row until the end of the transaction (SELECT ... FOR UPDATE)
+	Lock(ctx context.Context, id int32) error
 	Delete(ctx context.Context, id int32) error
 	Count(ctx context.Context) (int64, error)
 	CountBanned(ctx context.Context) (int64, error)
+	CountByRole(ctx context.Context, role string) (int64, error)
+}
+
+// UserIdentityRepository defines the interface for the login identities linked to users
+type UserIdentityRepository interface {
+	Create(ctx context.Context, params CreateUserIdentityParams) (*UserIdentity, error)
+	Get(ctx context.Context, provider, providerID string) (*UserIdentity, error)
+	ListByUserID(ctx context.Context, userID int32) ([]*UserIdentity, error)
+	SetPasswordHash(ctx context.Context, id int32, passwordHash *string) error
+	// Delete removes the identity only if it belongs to userID
+	Delete(ctx context.Context, id, userID int32) error
 }
 
 // SettingsRepository defines the interface for site settings
 type SettingsRepository interface {
 	Get(ctx context.Context, key string) (string, error)
 	Set(ctx context.Context, key, value string) error
+	List(ctx context.Context) ([]*SiteSetting, error)
+}
+
+// APITokenRepository defines the interface for personal API token data access
+type APITokenRepository interface {
+	Create(ctx context.Context, params CreateAPITokenParams) (*ApiToken, error)
+	GetByHash(ctx context.Context, tokenHash string) (*ApiToken, error)
+	ListByUserID(ctx context.Context, userID int32) ([]*ApiToken, error)
+	Delete(ctx context.Context, id, userID int32) error
+	Touch(ctx context.Context, id int32) error
+}
+
+// JobRepository defines the interface for the file processing job queue
+type JobRepository interface {
+	Enqueue(ctx context.Context, params EnqueueProcessingJobParams) (*ProcessingJob, error)
+	// Claim locks the next runnable job (FOR UPDATE SKIP LOCKED). Returns ErrNotFound when the queue is empty.
+	Claim(ctx context.Context) (*ProcessingJob, error)
+	Complete(ctx context.Context, id int32) error
+	Retry(ctx context.Context, id int32, lastError string, runAt time.Time) error
+	Fail(ctx context.Context, id int32, lastError string) error
+	ListByFileID(ctx context.Context, fileID int32) ([]*ProcessingJob, error)
+	ReleaseStale(ctx context.Context, lockedBefore time.Time) (int64, error)
 }
 
 // ThumbnailRepository defines the interface for thumbnail data access
@@ -79,9 +207,97 @@ type ThumbnailRepository interface {
 	Create(ctx context.Context, params CreateThumbnailParams) (*Thumbnail, error)
 	GetByFileID(ctx context.Context, fileID int32) (*Thumbnail, error)
 	ListByFileID(ctx context.Context, fileID int32) ([]*Thumbnail, error)
+	// List pages through every thumbnail in ID order, starting after afterID
+	List(ctx context.Context, afterID int32, limit int32) ([]*Thumbnail, error)
 	Update(ctx context.Context, params UpdateThumbnailParams) (*Thumbnail, error)
 	Delete(ctx context.Context, id int32) error
 	DeleteByFileID(ctx context.Context, fileID int32) error
+	CountByHash(ctx context.Context, hash string) (int64, error)
+}
+
+// BlobRepository defines the interface for content-addressed blob reference counting
+type BlobRepository interface {
+	// Acquire creates the blob or adds a reference to an existing one
+	Acquire(ctx context.Context, hash string, size int64) (*Blob, error)
+	Get(ctx context.Context, hash string) (*Blob, error)
+	// GetForUpdate returns the blob with its row locked until the transaction ends
+	GetForUpdate(ctx context.Context, hash string) (*Blob, error)
+	// Release drops a reference and returns the remaining count. Returns ErrNotFound for untracked hashes.
+	Release(ctx context.Context, hash string) (int32, error)
+	// DeleteUnreferenced removes the blob row if nothing references it and reports whether it did
+	DeleteUnreferenced(ctx context.Context, hash string) (bool, error)
+	// MarkCompleted records that the data for hash, of the given size, is in storage
+	MarkCompleted(ctx context.Context, hash string, size int64) error
+	// List pages through blobs in hash order, starting after the given hash ("" for the first page)
+	List(ctx context.Context, afterHash string, limit int32) ([]*Blob, error)
+	// ListLegacyUploads returns storage keys of uploads that were in progress when upload
+	// progress moved from hashes to file records, which are left to delete
+	ListLegacyUploads(ctx context.Context, limit int32) ([]*LegacyUploadObject, error)
+	DeleteLegacyUpload(ctx context.Context, key string) error
+}
+
+// SignedURLRepository records uses of single-use signed download URLs
+type SignedURLRepository interface {
+	// Use marks nonce as used and reports whether this was its first use
+	Use(ctx context.Context, nonce string, expiresAt time.Time) (bool, error)
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+// TusUploadRepository defines the interface for uploads created through the tus protocol
+type TusUploadRepository interface {
+	Create(ctx context.Context, params CreateTusUploadParams) (*TusUpload, error)
+	Get(ctx context.Context, id string) (*TusUpload, error)
+	// SetHash attaches the upload to the file records for hash
+	SetHash(ctx context.Context, id, hash string) error
+	// Touch records that data arrived for a staged upload
+	Touch(ctx context.Context, id string) error
+	Delete(ctx context.Context, id string) error
+	// ListStale returns staged uploads with no data since inactiveSince, and uploads whose file record is gone
+	ListStale(ctx context.Context, inactiveSince time.Time, limit int32) ([]*TusUpload, error)
+}
+
+// UploadChunkRepository tracks chunks received ahead of a file's contiguous data
+type UploadChunkRepository interface {
+	// Create records a chunk parked under the storage key, replacing any earlier chunk at the same start
+	Create(ctx context.Context, fileID int32, start, size int64, key string) error
+	ListByFileID(ctx context.Context, fileID int32) ([]*UploadChunk, error)
+	// Delete removes the chunk at start only if it is still the one parked under key
+	Delete(ctx context.Context, fileID int32, start int64, key string) error
+	DeleteByFileID(ctx context.Context, fileID int32) error
+}
+
+// UploadClaimRepository hands out expiring claims that make one request the writer of a storage key
+type UploadClaimRepository interface {
+	// Claim takes the claim on key for token, or extends it if token already holds it, so
+	// that it lasts ttl. Reports false while another token holds a claim that hasn't expired.
+	Claim(ctx context.Context, key, token string, ttl time.Duration) (bool, error)
+	Release(ctx context.Context, key, token string) error
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+// AuditEventRepository defines the interface for the append-only audit log
+type AuditEventRepository interface {
+	Create(ctx context.Context, params CreateAuditEventParams) (*AuditEvent, error)
+	// List returns matching events newest first; nil filter fields match everything
+	List(ctx context.Context, params ListAuditEventsParams) ([]*AuditEvent, error)
+	Count(ctx context.Context, params CountAuditEventsParams) (int64, error)
+}
+
+// AlbumRepository defines the interface for albums and the files in them
+type AlbumRepository interface {
+	Create(ctx context.Context, params CreateAlbumParams) (*Album, error)
+	GetBySlug(ctx context.Context, slug string) (*Album, error)
+	// ListByUserID returns the user's albums newest first, with their file counts
+	ListByUserID(ctx context.Context, userID int32) ([]*ListAlbumsByUserIDRow, error)
+	Update(ctx context.Context, params UpdateAlbumParams) (*Album, error)
+	Delete(ctx context.Context, id int32) error
+	// ListFiles returns the album's files in position order
+	ListFiles(ctx context.Context, albumID int32) ([]*File, error)
+	// AddFile appends a file to the end of the album; adding it again is a no-op
+	AddFile(ctx context.Context, albumID, fileID int32) error
+	RemoveFile(ctx context.Context, albumID, fileID int32) error
+	// Reorder sets each listed file's position to its index in fileIDs
+	Reorder(ctx context.Context, albumID int32, fileIDs []int32) error
 }
 
 // FileWithThumbnail represents a file with its thumbnail information
@@ -110,32 +326,7 @@ func NewTransactor(pool *pgxpool.Pool) Transactor {
 
 // WithTransaction executes the given function within a transaction
 func (t *transactor) WithTransaction(ctx context.Context, fn func(ctx context.Context, repo *Repository) error) error {
-	tx, err := t.pool.Begin(ctx)
-	if err != nil {
-		return err
-	}
-
-	defer func() {
-		if p := recover(); p != nil {
-			_ = tx.Rollback(ctx)
-			panic(p)
-		} else if err != nil {
-			_ = tx.Rollback(ctx)
-		} else {
-			err = tx.Commit(ctx)
-		}
-	}()
-
-	// Create a repository using the transaction
-	queries := New(tx)
-	repo := &Repository{
-		Files:      NewFileRepository(queries),
-		Users:      NewUserRepository(queries),
-		Thumbnails: NewThumbnailRepository(queries),
-		Settings:   NewSettingsRepository(queries),
-	}
-
-	return fn(ctx, repo)
+	return NewRepository(t.pool).WithTransaction(ctx, fn)
 }
 
 // Helper functions to convert between domain models and database models
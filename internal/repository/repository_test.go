@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zqz/web/backend/internal/tests"
+)
+
+func TestRepositoryWithTransaction(t *testing.T) {
+	ctx := context.Background()
+	pg, cleanup := tests.SetupTestDB(t, ctx)
+	defer cleanup()
+
+	repo := NewRepository(pg.Pool)
+	errRollback := errors.New("rollback")
+
+	t.Run("commits when fn succeeds", func(t *testing.T) {
+		err := repo.WithTransaction(ctx, func(ctx context.Context, tx *Repository) error {
+			return tx.Settings.Set(ctx, "committed", "yes")
+		})
+		require.NoError(t, err)
+
+		v, err := repo.Settings.Get(ctx, "committed")
+		require.NoError(t, err)
+		assert.Equal(t, "yes", v)
+	})
+
+	t.Run("rolls back when fn fails", func(t *testing.T) {
+		err := repo.WithTransaction(ctx, func(ctx context.Context, tx *Repository) error {
+			require.NoError(t, tx.Settings.Set(ctx, "rolled_back", "yes"))
+			return errRollback
+		})
+		assert.ErrorIs(t, err, errRollback)
+
+		_, err = repo.Settings.Get(ctx, "rolled_back")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("nested transaction rolls back to its savepoint", func(t *testing.T) {
+		err := repo.WithTransaction(ctx, func(ctx context.Context, tx *Repository) error {
+			require.NoError(t, tx.Settings.Set(ctx, "outer", "yes"))
+			err := tx.WithTransaction(ctx, func(ctx context.Context, tx *Repository) error {
+				require.NoError(t, tx.Settings.Set(ctx, "inner", "yes"))
+				return errRollback
+			})
+			assert.ErrorIs(t, err, errRollback)
+			return nil
+		})
+		require.NoError(t, err)
+
+		_, err = repo.Settings.Get(ctx, "outer")
+		assert.NoError(t, err)
+		_, err = repo.Settings.Get(ctx, "inner")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
+func TestRepositoryXactLock(t *testing.T) {
+	ctx := context.Background()
+	pg, cleanup := tests.SetupTestDB(t, ctx)
+	defer cleanup()
+
+	repo := NewRepository(pg.Pool)
+	other := NewRepository(pg.Pool) // Stands in for another instance
+
+	locked := make(chan struct{})
+	unlock := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- repo.WithTransaction(ctx, func(ctx context.Context, tx *Repository) error {
+			if err := tx.XactLock(ctx, LockFileUpload, "1"); err != nil {
+				return err
+			}
+			close(locked)
+			<-unlock
+			return nil
+		})
+	}()
+	<-locked
+
+	lock := func(ctx context.Context, key string) error {
+		return other.WithTransaction(ctx, func(ctx context.Context, tx *Repository) error {
+			return tx.XactLock(ctx, LockFileUpload, key)
+		})
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	assert.Error(t, lock(waitCtx, "1"), "the key is held")
+	require.NoError(t, lock(ctx, "2"), "other keys are free")
+
+	// Ending the transaction releases the lock
+	close(unlock)
+	require.NoError(t, <-done)
+	require.NoError(t, lock(ctx, "1"))
+}
+
+func TestUploadClaims(t *testing.T) {
+	ctx := context.Background()
+	pg, cleanup := tests.SetupTestDB(t, ctx)
+	defer cleanup()
+
+	claims := NewRepository(pg.Pool).Claims
+
+	ok, err := claims.Claim(ctx, "partial-1", "a", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = claims.Claim(ctx, "partial-1", "b", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, ok, "another token holds the claim")
+	ok, err = claims.Claim(ctx, "partial-1", "a", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok, "the holder can renew it")
+
+	// Releasing with the wrong token does nothing
+	require.NoError(t, claims.Release(ctx, "partial-1", "b"))
+	ok, err = claims.Claim(ctx, "partial-1", "b", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	require.NoError(t, claims.Release(ctx, "partial-1", "a"))
+	ok, err = claims.Claim(ctx, "partial-1", "b", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// An expired claim can be taken over, and is cleaned up otherwise
+	ok, err = claims.Claim(ctx, "partial-2", "a", 0)
+	require.NoError(t, err)
+	require.True(t, ok)
+	time.Sleep(10 * time.Millisecond)
+	ok, err = claims.Claim(ctx, "partial-2", "b", 0)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	time.Sleep(10 * time.Millisecond)
+	n, err := claims.DeleteExpired(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+}
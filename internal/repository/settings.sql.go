@@ -20,6 +20,34 @@ func (q *Queries) GetSiteSetting(ctx context.Context, key string) (string, error
 	return value, err
 }
 
+const listSiteSettings = `-- name: ListSiteSettings :many
+SELECT key, value FROM site_settings
+ORDER BY key
+`
+
+func (q *Queries) ListSiteSettings(ctx context.Context) ([]SiteSetting, error) {
+	rows, err := q.db.Query(ctx, listSiteSettings)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []SiteSetting{}
+	for rows.Next() {
+		var i SiteSetting
+		if err := rows.Scan(
+			&i.Key,
+			&i.Value,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const setSiteSetting = `-- name: SetSiteSetting :exec
 INSERT INTO site_settings (key, value) VALUES ($1, $2)
 ON CONFLICT (key) DO UPDATE SET value = $2
@@ -18,3 +18,16 @@ func (r *settingsRepository) Get(ctx context.Context, key string) (string, error
 func (r *settingsRepository) Set(ctx context.Context, key, value string) error {
 	return r.queries.SetSiteSetting(ctx, SetSiteSettingParams{Key: key, Value: value})
 }
+
+func (r *settingsRepository) List(ctx context.Context) ([]*SiteSetting, error) {
+	settings, err := r.queries.ListSiteSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*SiteSetting, len(settings))
+	for i := range settings {
+		result[i] = &settings[i]
+	}
+	return result, nil
+}
@@ -0,0 +1,27 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+type signedURLRepository struct {
+	queries *Queries
+}
+
+// NewSignedURLRepository creates a new signed URL use repository
+func NewSignedURLRepository(queries *Queries) SignedURLRepository {
+	return &signedURLRepository{queries: queries}
+}
+
+func (r *signedURLRepository) Use(ctx context.Context, nonce string, expiresAt time.Time) (bool, error) {
+	n, err := r.queries.UseSignedURLNonce(ctx, UseSignedURLNonceParams{Nonce: nonce, ExpiresAt: expiresAt})
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (r *signedURLRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	return r.queries.DeleteExpiredSignedURLUses(ctx)
+}
@@ -46,6 +46,19 @@ func (r *thumbnailRepository) ListByFileID(ctx context.Context, fileID int32) ([
 	return result, nil
 }
 
+func (r *thumbnailRepository) List(ctx context.Context, afterID int32, limit int32) ([]*Thumbnail, error) {
+	thumbnails, err := r.queries.ListThumbnails(ctx, ListThumbnailsParams{AfterID: afterID, Limit: limit})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*Thumbnail, len(thumbnails))
+	for i := range thumbnails {
+		result[i] = &thumbnails[i]
+	}
+	return result, nil
+}
+
 func (r *thumbnailRepository) Update(ctx context.Context, params UpdateThumbnailParams) (*Thumbnail, error) {
 	thumbnail, err := r.queries.UpdateThumbnail(ctx, params)
 	if err != nil {
@@ -64,3 +77,7 @@ func (r *thumbnailRepository) Delete(ctx context.Context, id int32) error {
 func (r *thumbnailRepository) DeleteByFileID(ctx context.Context, fileID int32) error {
 	return r.queries.DeleteThumbnailsByFileID(ctx, fileID)
 }
+
+func (r *thumbnailRepository) CountByHash(ctx context.Context, hash string) (int64, error) {
+	return r.queries.CountThumbnailsByHash(ctx, hash)
+}
@@ -9,6 +9,18 @@ import (
 	"context"
 )
 
+const countThumbnailsByHash = `-- name: CountThumbnailsByHash :one
+SELECT COUNT(*) FROM thumbnails
+WHERE hash = $1
+`
+
+func (q *Queries) CountThumbnailsByHash(ctx context.Context, hash string) (int64, error) {
+	row := q.db.QueryRow(ctx, countThumbnailsByHash, hash)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createThumbnail = `-- name: CreateThumbnail :one
 INSERT INTO thumbnails (
     file_id,
@@ -117,6 +129,45 @@ func (q *Queries) GetThumbnailsByFileID(ctx context.Context, fileID int32) ([]Th
 	return items, nil
 }
 
+const listThumbnails = `-- name: ListThumbnails :many
+SELECT id, file_id, width, height, hash, created_at FROM thumbnails
+WHERE id > $1
+ORDER BY id
+LIMIT $2
+`
+
+type ListThumbnailsParams struct {
+	AfterID int32 `db:"after_id" json:"after_id"`
+	Limit   int32 `db:"limit" json:"limit"`
+}
+
+func (q *Queries) ListThumbnails(ctx context.Context, arg ListThumbnailsParams) ([]Thumbnail, error) {
+	rows, err := q.db.Query(ctx, listThumbnails, arg.AfterID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Thumbnail{}
+	for rows.Next() {
+		var i Thumbnail
+		if err := rows.Scan(
+			&i.ID,
+			&i.FileID,
+			&i.Width,
+			&i.Height,
+			&i.Hash,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const updateThumbnail = `-- name: UpdateThumbnail :one
 UPDATE thumbnails
 SET
@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type tusUploadRepository struct {
+	queries *Queries
+}
+
+// NewTusUploadRepository creates a new tus upload repository
+func NewTusUploadRepository(queries *Queries) TusUploadRepository {
+	return &tusUploadRepository{queries: queries}
+}
+
+func (r *tusUploadRepository) Create(ctx context.Context, params CreateTusUploadParams) (*TusUpload, error) {
+	upload, err := r.queries.CreateTusUpload(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	return &upload, nil
+}
+
+func (r *tusUploadRepository) Get(ctx context.Context, id string) (*TusUpload, error) {
+	upload, err := r.queries.GetTusUpload(ctx, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &upload, nil
+}
+
+func (r *tusUploadRepository) SetHash(ctx context.Context, id, hash string) error {
+	return r.queries.SetTusUploadHash(ctx, SetTusUploadHashParams{ID: id, Hash: &hash})
+}
+
+func (r *tusUploadRepository) Touch(ctx context.Context, id string) error {
+	return r.queries.TouchTusUpload(ctx, id)
+}
+
+func (r *tusUploadRepository) Delete(ctx context.Context, id string) error {
+	return r.queries.DeleteTusUpload(ctx, id)
+}
+
+func (r *tusUploadRepository) ListStale(ctx context.Context, inactiveSince time.Time, limit int32) ([]*TusUpload, error) {
+	uploads, err := r.queries.ListStaleTusUploads(ctx, ListStaleTusUploadsParams{InactiveSince: inactiveSince, Limit: limit})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*TusUpload, len(uploads))
+	for i := range uploads {
+		result[i] = &uploads[i]
+	}
+	return result, nil
+}
@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"context"
+)
+
+type uploadChunkRepository struct {
+	queries *Queries
+}
+
+// NewUploadChunkRepository creates a new upload chunk repository
+func NewUploadChunkRepository(queries *Queries) UploadChunkRepository {
+	return &uploadChunkRepository{queries: queries}
+}
+
+func (r *uploadChunkRepository) Create(ctx context.Context, fileID int32, start, size int64, key string) error {
+	return r.queries.CreateUploadChunk(ctx, CreateUploadChunkParams{FileID: fileID, StartOffset: start, Size: size, Key: key})
+}
+
+func (r *uploadChunkRepository) ListByFileID(ctx context.Context, fileID int32) ([]*UploadChunk, error) {
+	chunks, err := r.queries.ListUploadChunksByFileID(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*UploadChunk, len(chunks))
+	for i := range chunks {
+		result[i] = &chunks[i]
+	}
+	return result, nil
+}
+
+func (r *uploadChunkRepository) Delete(ctx context.Context, fileID int32, start int64, key string) error {
+	return r.queries.DeleteUploadChunk(ctx, DeleteUploadChunkParams{FileID: fileID, StartOffset: start, Key: key})
+}
+
+func (r *uploadChunkRepository) DeleteByFileID(ctx context.Context, fileID int32) error {
+	return r.queries.DeleteUploadChunksByFileID(ctx, fileID)
+}
@@ -0,0 +1,31 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+type uploadClaimRepository struct {
+	queries *Queries
+}
+
+// NewUploadClaimRepository creates a new upload claim repository
+func NewUploadClaimRepository(queries *Queries) UploadClaimRepository {
+	return &uploadClaimRepository{queries: queries}
+}
+
+func (r *uploadClaimRepository) Claim(ctx context.Context, key, token string, ttl time.Duration) (bool, error) {
+	n, err := r.queries.ClaimUpload(ctx, ClaimUploadParams{Key: key, Token: token, TtlSeconds: int32(ttl / time.Second)})
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (r *uploadClaimRepository) Release(ctx context.Context, key, token string) error {
+	return r.queries.ReleaseUploadClaim(ctx, ReleaseUploadClaimParams{Key: key, Token: token})
+}
+
+func (r *uploadClaimRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	return r.queries.DeleteExpiredUploadClaims(ctx)
+}
@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+)
+
+type userIdentityRepository struct {
+	queries *Queries
+}
+
+// NewUserIdentityRepository creates a new user identity repository
+func NewUserIdentityRepository(queries *Queries) UserIdentityRepository {
+	return &userIdentityRepository{queries: queries}
+}
+
+func (r *userIdentityRepository) Create(ctx context.Context, params CreateUserIdentityParams) (*UserIdentity, error) {
+	identity, err := r.queries.CreateUserIdentity(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+func (r *userIdentityRepository) Get(ctx context.Context, provider, providerID string) (*UserIdentity, error) {
+	identity, err := r.queries.GetUserIdentity(ctx, GetUserIdentityParams{Provider: provider, ProviderID: providerID})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &identity, nil
+}
+
+func (r *userIdentityRepository) ListByUserID(ctx context.Context, userID int32) ([]*UserIdentity, error) {
+	identities, err := r.queries.ListUserIdentitiesByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*UserIdentity, len(identities))
+	for i := range identities {
+		result[i] = &identities[i]
+	}
+	return result, nil
+}
+
+func (r *userIdentityRepository) SetPasswordHash(ctx context.Context, id int32, passwordHash *string) error {
+	rows, err := r.queries.SetUserIdentityPasswordHash(ctx, SetUserIdentityPasswordHashParams{ID: id, PasswordHash: passwordHash})
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Delete removes the identity only if it belongs to userID
+func (r *userIdentityRepository) Delete(ctx context.Context, id, userID int32) error {
+	rows, err := r.queries.DeleteUserIdentity(ctx, DeleteUserIdentityParams{ID: id, UserID: userID})
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
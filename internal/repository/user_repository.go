@@ -93,8 +93,8 @@ func (r *userRepository) UpdateProfile(ctx context.Context, params UpdateUserPro
 	return &user, nil
 }
 
-func (r *userRepository) SetBanned(ctx context.Context, userID int32, banned bool) (*User, error) {
-	user, err := r.queries.SetUserBanned(ctx, SetUserBannedParams{ID: userID, Banned: banned})
+func (r *userRepository) SetBanned(ctx context.Context, params SetUserBannedParams) (*User, error) {
+	user, err := r.queries.SetUserBanned(ctx, params)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrNotFound
@@ -115,6 +115,28 @@ func (r *userRepository) SetMaxFileSize(ctx context.Context, userID int32, maxBy
 	return &user, nil
 }
 
+func (r *userRepository) SetStorageQuota(ctx context.Context, userID int32, quotaBytes *int64) (*User, error) {
+	user, err := r.queries.SetUserStorageQuota(ctx, SetUserStorageQuotaParams{ID: userID, StorageQuotaOverride: quotaBytes})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *userRepository) Lock(ctx context.Context, id int32) error {
+	n, err := r.queries.LockUserByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
 func (r *userRepository) Delete(ctx context.Context, id int32) error {
 	return r.queries.DeleteUser(ctx, id)
 }
@@ -126,3 +148,7 @@ func (r *userRepository) Count(ctx context.Context) (int64, error) {
 func (r *userRepository) CountBanned(ctx context.Context) (int64, error) {
 	return r.queries.CountBannedUsers(ctx)
 }
+
+func (r *userRepository) CountByRole(ctx context.Context, role string) (int64, error) {
+	return r.queries.CountUsersByRole(ctx, role)
+}
@@ -7,10 +7,13 @@ package repository
 
 import (
 	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 const countBannedUsers = `-- name: CountBannedUsers :one
-SELECT COUNT(*) FROM users WHERE banned = true
+SELECT COUNT(*) FROM users
+WHERE banned = true AND (banned_until IS NULL OR banned_until > NOW())
 `
 
 func (q *Queries) CountBannedUsers(ctx context.Context) (int64, error) {
@@ -31,6 +34,18 @@ func (q *Queries) CountUsers(ctx context.Context) (int64, error) {
 	return count, err
 }
 
+const countUsersByRole = `-- name: CountUsersByRole :one
+SELECT COUNT(*) FROM users
+WHERE role = $1
+`
+
+func (q *Queries) CountUsersByRole(ctx context.Context, role string) (int64, error) {
+	row := q.db.QueryRow(ctx, countUsersByRole, role)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (
     name,
@@ -42,7 +57,7 @@ INSERT INTO users (
     updated_at
 ) VALUES (
     $1, $2, $3, $4, $5, NOW(), NOW()
-) RETURNING id, name, email, provider, provider_id, role, created_at, updated_at, display_tag, colour, banned, max_file_size_override
+) RETURNING id, name, email, provider, provider_id, role, created_at, updated_at, display_tag, colour, banned, max_file_size_override, storage_quota_override, ban_reason, banned_until, ban_hides_files
 `
 
 type CreateUserParams struct {
@@ -75,6 +90,10 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Colour,
 		&i.Banned,
 		&i.MaxFileSizeOverride,
+		&i.StorageQuotaOverride,
+		&i.BanReason,
+		&i.BannedUntil,
+		&i.BanHidesFiles,
 	)
 	return i, err
 }
@@ -90,7 +109,7 @@ func (q *Queries) DeleteUser(ctx context.Context, id int32) error {
 }
 
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, name, email, provider, provider_id, role, created_at, updated_at, display_tag, colour, banned, max_file_size_override FROM users
+SELECT id, name, email, provider, provider_id, role, created_at, updated_at, display_tag, colour, banned, max_file_size_override, storage_quota_override, ban_reason, banned_until, ban_hides_files FROM users
 WHERE email = $1 LIMIT 1
 `
 
@@ -110,12 +129,16 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.Colour,
 		&i.Banned,
 		&i.MaxFileSizeOverride,
+		&i.StorageQuotaOverride,
+		&i.BanReason,
+		&i.BannedUntil,
+		&i.BanHidesFiles,
 	)
 	return i, err
 }
 
 const getUserByID = `-- name: GetUserByID :one
-SELECT id, name, email, provider, provider_id, role, created_at, updated_at, display_tag, colour, banned, max_file_size_override FROM users
+SELECT id, name, email, provider, provider_id, role, created_at, updated_at, display_tag, colour, banned, max_file_size_override, storage_quota_override, ban_reason, banned_until, ban_hides_files FROM users
 WHERE id = $1 LIMIT 1
 `
 
@@ -135,12 +158,16 @@ func (q *Queries) GetUserByID(ctx context.Context, id int32) (User, error) {
 		&i.Colour,
 		&i.Banned,
 		&i.MaxFileSizeOverride,
+		&i.StorageQuotaOverride,
+		&i.BanReason,
+		&i.BannedUntil,
+		&i.BanHidesFiles,
 	)
 	return i, err
 }
 
 const getUserByProviderID = `-- name: GetUserByProviderID :one
-SELECT id, name, email, provider, provider_id, role, created_at, updated_at, display_tag, colour, banned, max_file_size_override FROM users
+SELECT id, name, email, provider, provider_id, role, created_at, updated_at, display_tag, colour, banned, max_file_size_override, storage_quota_override, ban_reason, banned_until, ban_hides_files FROM users
 WHERE provider_id = $1 LIMIT 1
 `
 
@@ -160,12 +187,16 @@ func (q *Queries) GetUserByProviderID(ctx context.Context, providerID string) (U
 		&i.Colour,
 		&i.Banned,
 		&i.MaxFileSizeOverride,
+		&i.StorageQuotaOverride,
+		&i.BanReason,
+		&i.BannedUntil,
+		&i.BanHidesFiles,
 	)
 	return i, err
 }
 
 const listUsers = `-- name: ListUsers :many
-SELECT id, name, email, provider, provider_id, role, created_at, updated_at, display_tag, colour, banned, max_file_size_override FROM users
+SELECT id, name, email, provider, provider_id, role, created_at, updated_at, display_tag, colour, banned, max_file_size_override, storage_quota_override, ban_reason, banned_until, ban_hides_files FROM users
 ORDER BY created_at DESC
 LIMIT $1 OFFSET $2
 `
@@ -197,6 +228,10 @@ func (q *Queries) ListUsers(ctx context.Context, arg ListUsersParams) ([]User, e
 			&i.Colour,
 			&i.Banned,
 			&i.MaxFileSizeOverride,
+			&i.StorageQuotaOverride,
+			&i.BanReason,
+			&i.BannedUntil,
+			&i.BanHidesFiles,
 		); err != nil {
 			return nil, err
 		}
@@ -208,20 +243,48 @@ func (q *Queries) ListUsers(ctx context.Context, arg ListUsersParams) ([]User, e
 	return items, nil
 }
 
+const lockUserByID = `-- name: LockUserByID :execrows
+SELECT id FROM users
+WHERE id = $1
+FOR UPDATE
+`
+
+func (q *Queries) LockUserByID(ctx context.Context, id int32) (int64, error) {
+	result, err := q.db.Exec(ctx, lockUserByID, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const setUserBanned = `-- name: SetUserBanned :one
 UPDATE users
-SET banned = $2, updated_at = NOW()
-WHERE id = $1
-RETURNING id, name, email, provider, provider_id, role, created_at, updated_at, display_tag, colour, banned, max_file_size_override
+SET
+    banned = $1,
+    ban_reason = $2,
+    banned_until = $3,
+    ban_hides_files = $4,
+    updated_at = NOW()
+WHERE id = $5
+RETURNING id, name, email, provider, provider_id, role, created_at, updated_at, display_tag, colour, banned, max_file_size_override, storage_quota_override, ban_reason, banned_until, ban_hides_files
 `
 
 type SetUserBannedParams struct {
-	ID     int32 `db:"id" json:"id"`
-	Banned bool  `db:"banned" json:"banned"`
+	Banned        bool             `db:"banned" json:"banned"`
+	BanReason     *string          `db:"ban_reason" json:"ban_reason"`
+	BannedUntil   pgtype.Timestamp `db:"banned_until" json:"banned_until"`
+	BanHidesFiles bool             `db:"ban_hides_files" json:"ban_hides_files"`
+	ID            int32            `db:"id" json:"id"`
 }
 
 func (q *Queries) SetUserBanned(ctx context.Context, arg SetUserBannedParams) (User, error) {
-	row := q.db.QueryRow(ctx, setUserBanned, arg.ID, arg.Banned)
+	row := q.db.QueryRow(ctx, setUserBanned,
+		arg.Banned,
+		arg.BanReason,
+		arg.BannedUntil,
+		arg.BanHidesFiles,
+		arg.ID,
+	)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -236,6 +299,10 @@ func (q *Queries) SetUserBanned(ctx context.Context, arg SetUserBannedParams) (U
 		&i.Colour,
 		&i.Banned,
 		&i.MaxFileSizeOverride,
+		&i.StorageQuotaOverride,
+		&i.BanReason,
+		&i.BannedUntil,
+		&i.BanHidesFiles,
 	)
 	return i, err
 }
@@ -244,7 +311,7 @@ const setUserMaxFileSize = `-- name: SetUserMaxFileSize :one
 UPDATE users
 SET max_file_size_override = $2, updated_at = NOW()
 WHERE id = $1
-RETURNING id, name, email, provider, provider_id, role, created_at, updated_at, display_tag, colour, banned, max_file_size_override
+RETURNING id, name, email, provider, provider_id, role, created_at, updated_at, display_tag, colour, banned, max_file_size_override, storage_quota_override, ban_reason, banned_until, ban_hides_files
 `
 
 type SetUserMaxFileSizeParams struct {
@@ -268,6 +335,46 @@ func (q *Queries) SetUserMaxFileSize(ctx context.Context, arg SetUserMaxFileSize
 		&i.Colour,
 		&i.Banned,
 		&i.MaxFileSizeOverride,
+		&i.StorageQuotaOverride,
+		&i.BanReason,
+		&i.BannedUntil,
+		&i.BanHidesFiles,
+	)
+	return i, err
+}
+
+const setUserStorageQuota = `-- name: SetUserStorageQuota :one
+UPDATE users
+SET storage_quota_override = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING id, name, email, provider, provider_id, role, created_at, updated_at, display_tag, colour, banned, max_file_size_override, storage_quota_override, ban_reason, banned_until, ban_hides_files
+`
+
+type SetUserStorageQuotaParams struct {
+	ID                   int32  `db:"id" json:"id"`
+	StorageQuotaOverride *int64 `db:"storage_quota_override" json:"storage_quota_override"`
+}
+
+func (q *Queries) SetUserStorageQuota(ctx context.Context, arg SetUserStorageQuotaParams) (User, error) {
+	row := q.db.QueryRow(ctx, setUserStorageQuota, arg.ID, arg.StorageQuotaOverride)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Email,
+		&i.Provider,
+		&i.ProviderID,
+		&i.Role,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.DisplayTag,
+		&i.Colour,
+		&i.Banned,
+		&i.MaxFileSizeOverride,
+		&i.StorageQuotaOverride,
+		&i.BanReason,
+		&i.BannedUntil,
+		&i.BanHidesFiles,
 	)
 	return i, err
 }
@@ -280,7 +387,7 @@ SET
     role = COALESCE($3, role),
     updated_at = NOW()
 WHERE id = $4
-RETURNING id, name, email, provider, provider_id, role, created_at, updated_at, display_tag, colour, banned, max_file_size_override
+RETURNING id, name, email, provider, provider_id, role, created_at, updated_at, display_tag, colour, banned, max_file_size_override, storage_quota_override, ban_reason, banned_until, ban_hides_files
 `
 
 type UpdateUserParams struct {
@@ -311,6 +418,10 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, e
 		&i.Colour,
 		&i.Banned,
 		&i.MaxFileSizeOverride,
+		&i.StorageQuotaOverride,
+		&i.BanReason,
+		&i.BannedUntil,
+		&i.BanHidesFiles,
 	)
 	return i, err
 }
@@ -322,7 +433,7 @@ SET
     colour = $2,
     updated_at = NOW()
 WHERE id = $3
-RETURNING id, name, email, provider, provider_id, role, created_at, updated_at, display_tag, colour, banned, max_file_size_override
+RETURNING id, name, email, provider, provider_id, role, created_at, updated_at, display_tag, colour, banned, max_file_size_override, storage_quota_override, ban_reason, banned_until, ban_hides_files
 `
 
 type UpdateUserProfileParams struct {
@@ -347,6 +458,10 @@ func (q *Queries) UpdateUserProfile(ctx context.Context, arg UpdateUserProfilePa
 		&i.Colour,
 		&i.Banned,
 		&i.MaxFileSizeOverride,
+		&i.StorageQuotaOverride,
+		&i.BanReason,
+		&i.BannedUntil,
+		&i.BanHidesFiles,
 	)
 	return i, err
 }
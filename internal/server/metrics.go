@@ -0,0 +1,54 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/zqz/web/backend/internal/config"
+	"github.com/zqz/web/backend/internal/domain"
+	"github.com/zqz/web/backend/internal/handler/auth"
+	"github.com/zqz/web/backend/internal/metrics"
+)
+
+// metricsPath is where Prometheus scrapes
+const metricsPath = "/metrics"
+
+// withMetrics serves /metrics in front of router according to cfg.MetricsAccess. It sits
+// outside the router because AuthMiddleware would reject METRICS_TOKEN as an unknown API token.
+func withMetrics(cfg *config.Config, authHandler *auth.AuthHandler, router http.Handler) http.Handler {
+	if cfg.MetricsAccess == "off" {
+		return router
+	}
+
+	metricsHandler := promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{})
+	if cfg.MetricsAccess == "admin" {
+		admin := authHandler.AuthMiddleware(authHandler.RequirePermission(domain.PermManageSettings, metricsHandler, nil))
+		metricsHandler = requireMetricsToken(cfg.MetricsToken, metricsHandler, admin)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == metricsPath {
+			metricsHandler.ServeHTTP(w, r)
+			return
+		}
+		router.ServeHTTP(w, r)
+	})
+}
+
+// requireMetricsToken serves next to requests carrying the bearer token and hands every
+// other request to fallback. With no token configured everything goes to fallback.
+func requireMetricsToken(token string, next, fallback http.Handler) http.Handler {
+	if token == "" {
+		return fallback
+	}
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) == 1 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		fallback.ServeHTTP(w, r)
+	})
+}
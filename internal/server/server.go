@@ -12,7 +12,10 @@ import (
 	"github.com/rs/zerolog"
 
 	"github.com/zqz/web/backend/internal/config"
+	"github.com/zqz/web/backend/internal/domain"
 	"github.com/zqz/web/backend/internal/i18n"
+	"github.com/zqz/web/backend/internal/metrics"
+	"github.com/zqz/web/backend/internal/handler"
 	v1 "github.com/zqz/web/backend/internal/handler/api/v1"
 	"github.com/zqz/web/backend/internal/handler/auth"
 	"github.com/zqz/web/backend/internal/handler/middleware"
@@ -21,35 +24,50 @@ import (
 	"github.com/zqz/web/backend/internal/service"
 	"github.com/zqz/web/backend/internal/service/processor"
 	"github.com/zqz/web/backend/internal/service/storage"
+	"github.com/zqz/web/backend/internal/telemetry"
 )
 
 // Server holds the HTTP server and dependencies for explicit shutdown.
 type Server struct {
-	HTTP *http.Server
-	pool *pgxpool.Pool
+	HTTP     *http.Server
+	pool     *pgxpool.Pool
+	workers  *service.ProcessingWorkers
+	reaper   *service.FileReaper
+	scrubber *service.StorageScrubber
+
+	shutdownTracing func(context.Context) error
 }
 
 // New builds the HTTP handler and server from config and logger.
 // Caller must call Shutdown when done to close the database pool.
 func New(ctx context.Context, cfg *config.Config, logger *zerolog.Logger) (*Server, error) {
-	pool, err := setupDatabase(ctx, cfg)
+	shutdownTracing, err := telemetry.Setup(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("tracing: %w", err)
+	}
+	if cfg.TracingExporter != telemetry.ExporterNone {
+		logger.Info().Str("exporter", cfg.TracingExporter).Float64("sample_ratio", cfg.TracingSampleRatio).Msg("tracing enabled")
+	}
+
+	pool, err := OpenDatabase(ctx, cfg)
 	if err != nil {
+		shutdownTracing(ctx)
 		return nil, fmt.Errorf("database: %w", err)
 	}
 
 	repo := repository.NewRepository(pool)
 
-	stor, err := storage.NewDiskStorage(cfg.FilesPath)
+	stor, err := OpenStorage(ctx, cfg)
 	if err != nil {
 		pool.Close()
+		shutdownTracing(ctx)
 		return nil, fmt.Errorf("storage: %w", err)
 	}
 
-	fileSvc := service.NewFileService(repo, stor)
+	fileSvc := NewFileService(cfg, repo, stor)
 	userSvc := service.NewUserService(repo)
 
 	if cfg.EnableThumbnails {
-		fileSvc.AddProcessor(processor.NewThumbnailProcessor(cfg.ThumbnailSize))
 		logger.Info().Int("size", cfg.ThumbnailSize).Msg("thumbnail processor enabled")
 	}
 
@@ -60,10 +78,20 @@ func New(ctx context.Context, cfg *config.Config, logger *zerolog.Logger) (*Serv
 	}).ParseGlob("./templates/*.html")
 	if err != nil {
 		pool.Close()
+		shutdownTracing(ctx)
 		return nil, fmt.Errorf("templates: %w", err)
 	}
 
-	router := setupRouter(cfg, logger, repo, fileSvc, userSvc, templates)
+	metrics.Registry.MustRegister(metrics.NewPoolCollector(pool), metrics.NewStoredBytesCollector(repo.Files))
+
+	scrubber := service.NewStorageScrubber(fileSvc, logger)
+	router := setupRouter(cfg, logger, repo, fileSvc, userSvc, scrubber, templates)
+
+	workers := service.NewProcessingWorkers(fileSvc, logger, cfg.ProcessingWorkers, cfg.ProcessingPollInterval)
+	workers.Start()
+
+	reaper := service.NewFileReaper(fileSvc, logger, cfg.ReaperInterval)
+	reaper.Start()
 
 	srv := &http.Server{
 		Addr:         cfg.Address(),
@@ -74,29 +102,61 @@ func New(ctx context.Context, cfg *config.Config, logger *zerolog.Logger) (*Serv
 	}
 
 	return &Server{
-		HTTP: srv,
-		pool: pool,
+		HTTP:     srv,
+		pool:     pool,
+		workers:  workers,
+		reaper:   reaper,
+		scrubber: scrubber,
+
+		shutdownTracing: shutdownTracing,
 	}, nil
 }
 
-// Shutdown gracefully shuts down the HTTP server and closes the database pool.
+// Shutdown gracefully shuts down the HTTP server, waits for in-flight processing
+// jobs, the file reaper and any storage scrub, closes the database pool and flushes
+// buffered trace spans.
 func (s *Server) Shutdown(ctx context.Context) error {
 	if s.HTTP != nil {
 		if err := s.HTTP.Shutdown(ctx); err != nil {
 			return err
 		}
 	}
+	if s.workers != nil {
+		s.workers.Stop()
+	}
+	if s.reaper != nil {
+		s.reaper.Stop()
+	}
+	if s.scrubber != nil {
+		s.scrubber.Stop()
+	}
 	if s.pool != nil {
 		s.pool.Close()
 	}
+	if s.shutdownTracing != nil {
+		return s.shutdownTracing(ctx)
+	}
 	return nil
 }
 
-func setupDatabase(ctx context.Context, cfg *config.Config) (*pgxpool.Pool, error) {
+// NewFileService creates the file service configured as the server runs it: URL signing
+// and, when enabled, the thumbnail processor.
+func NewFileService(cfg *config.Config, repo *repository.Repository, stor storage.Storage) *service.FileService {
+	fileSvc := service.NewFileService(repo, stor)
+	fileSvc.SetSigningSecret(cfg.SessionSecret)
+	if cfg.EnableThumbnails {
+		fileSvc.AddProcessor(processor.NewThumbnailProcessor(cfg.ThumbnailSize))
+	}
+	return fileSvc
+}
+
+// OpenDatabase connects to cfg.DatabaseURL and checks the connection. The caller closes the pool.
+func OpenDatabase(ctx context.Context, cfg *config.Config) (*pgxpool.Pool, error) {
 	poolConfig, err := pgxpool.ParseConfig(cfg.DatabaseURL)
 	if err != nil {
 		return nil, fmt.Errorf("parse database URL: %w", err)
 	}
+	poolConfig.ConnConfig.Tracer = telemetry.QueryTracer{}
 
 	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
 	if err != nil {
@@ -111,18 +171,46 @@ func setupDatabase(ctx context.Context, cfg *config.Config) (*pgxpool.Pool, erro
 	return pool, nil
 }
 
-func setupRouter(cfg *config.Config, logger *zerolog.Logger, repo *repository.Repository, fileSvc *service.FileService, userSvc *service.UserService, templates *template.Template) http.Handler {
+// OpenStorage returns the file storage backend selected by cfg.StorageBackend
+func OpenStorage(ctx context.Context, cfg *config.Config) (storage.Storage, error) {
+	switch cfg.StorageBackend {
+	case "s3":
+		return storage.NewS3Storage(ctx, storage.S3Config{
+			Endpoint:  cfg.S3Endpoint,
+			Bucket:    cfg.S3Bucket,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+			Region:    cfg.S3Region,
+			UseSSL:    cfg.S3UseSSL,
+			Prefix:    cfg.S3Prefix,
+			PartSize:  cfg.S3PartSize,
+		})
+	default:
+		return storage.NewDiskStorage(cfg.FilesPath)
+	}
+}
+
+func setupRouter(cfg *config.Config, logger *zerolog.Logger, repo *repository.Repository, fileSvc *service.FileService, userSvc *service.UserService, scrubber *service.StorageScrubber, templates *template.Template) http.Handler {
 	r := chi.NewRouter()
 
 	authHandler := auth.NewAuthHandler(userSvc, logger, cfg)
 
 	filesHandler := web.NewFilesHandler(fileSvc, templates)
-	pagesHandler := web.NewPagesHandler(templates, userSvc, fileSvc)
-	adminHandler := web.NewAdminHandler(repo, templates)
+	albumSvc := service.NewAlbumService(repo, fileSvc)
+	pagesHandler := web.NewPagesHandler(templates, userSvc, fileSvc, authHandler.LoginOptions())
+	albumsHandler := web.NewAlbumsHandler(albumSvc, fileSvc, templates, pagesHandler.NotFound)
+	auditSvc := service.NewAuditService(repo)
+	adminHandler := web.NewAdminHandler(repo, fileSvc, service.NewSettingsService(repo), auditSvc, scrubber, templates)
 
+	r.Use(handler.TrustProxies(cfg.TrustedProxies))
+	r.Use(middleware.Tracing)
+	r.Use(middleware.Metrics)
 	r.Use(middleware.Recovery(logger))
 	r.Use(middleware.Logger(logger))
 	r.Use(authHandler.AuthMiddleware)
+	r.Use(func(next http.Handler) http.Handler {
+		return authHandler.RejectBanned(next, http.HandlerFunc(pagesHandler.Banned))
+	})
 	r.Use(web.PublicUploadsMiddleware(repo))
 
 	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
@@ -133,40 +221,62 @@ func setupRouter(cfg *config.Config, logger *zerolog.Logger, repo *repository.Re
 	r.Mount("/auth", auth.NewRouter(authHandler))
 
 	fileHandler := v1.NewFileHandler(fileSvc)
+	albumHandler := v1.NewAlbumHandler(albumSvc, fileHandler)
 	userHandler := v1.NewUserHandler(userSvc, fileSvc)
-	apiHandler := v1.NewRouter(fileHandler, userHandler, authHandler)
+	auditHandler := v1.NewAuditHandler(auditSvc)
+	apiHandler := v1.NewRouter(fileHandler, albumHandler, userHandler, auditHandler, authHandler)
 	r.Mount("/api/v1", middleware.RateLimitAPI(repo, logger)(apiHandler))
 
 	fileServer := http.FileServer(http.Dir("./static"))
 	r.Handle("/static/*", http.StripPrefix("/static/", fileServer))
 
-	r.Get("/", pagesHandler.Upload)
-	r.Get("/files", filesHandler.Page)
-	r.Get("/files/list", filesHandler.List)
-	r.Get("/view/{slug}", pagesHandler.View)
-	r.Get("/files/{slug}", pagesHandler.Edit)
+	requirePermission := func(perm domain.Permission) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return authHandler.RequirePermission(perm, next, http.HandlerFunc(pagesHandler.Forbidden))
+		}
+	}
+
+	// Web pages and forms are for browser sessions; API tokens are scoped to /api/v1 only
 	r.Group(func(r chi.Router) {
-		r.Use(func(next http.Handler) http.Handler {
-			return authHandler.RequireAdmin(next, http.HandlerFunc(pagesHandler.Forbidden))
+		r.Use(auth.SessionOnly)
+
+		r.Get("/", pagesHandler.Upload)
+		r.Get("/files", filesHandler.Page)
+		r.Get("/files/list", filesHandler.List)
+		r.Get("/view/{slug}", pagesHandler.View)
+		r.Get("/files/{slug}", pagesHandler.Edit)
+		r.Get("/albums/{slug}", albumsHandler.Gallery)
+		r.Group(func(r chi.Router) {
+			r.Use(requirePermission(domain.PermManageSettings))
+			r.Get("/admin", adminHandler.Page)
+			r.Post("/admin/settings", adminHandler.UpdateSettings)
+			r.Post("/admin/storage/scrub", adminHandler.StartScrub)
 		})
-		r.Get("/admin", adminHandler.Page)
-		r.Post("/admin/settings", adminHandler.UpdateSettings)
-		r.Get("/users", pagesHandler.Users)
-		r.Get("/users/{id}", pagesHandler.UserFiles)
-		r.Post("/users/{id}/ban", pagesHandler.UserSetBan)
-		r.Post("/users/{id}/unban", pagesHandler.UserSetBan)
-		r.Post("/users/{id}/max-file-size", pagesHandler.UserSetMaxFileSize)
-		r.Post("/users/{id}/profile", pagesHandler.UserSetProfile)
-	})
-	r.Get("/api-docs", pagesHandler.APIDocs)
-	r.Group(func(r chi.Router) {
-		r.Use(func(next http.Handler) http.Handler {
-			return authHandler.RequireAuth(next, http.HandlerFunc(pagesHandler.Unauthorized))
+		r.With(requirePermission(domain.PermViewAudit)).Get("/admin/audit", adminHandler.Audit)
+		r.Group(func(r chi.Router) {
+			// Each action checks its own permission: moderators can ban but not change roles or limits
+			r.Use(requirePermission(domain.PermViewUsers))
+			r.Get("/users", pagesHandler.Users)
+			r.Get("/users/{id}", pagesHandler.UserFiles)
+			r.Post("/users/{id}/ban", pagesHandler.UserSetBan)
+			r.Post("/users/{id}/unban", pagesHandler.UserSetBan)
+			r.Post("/users/{id}/max-file-size", pagesHandler.UserSetMaxFileSize)
+			r.Post("/users/{id}/storage-quota", pagesHandler.UserSetStorageQuota)
+			r.Post("/users/{id}/profile", pagesHandler.UserSetProfile)
+			r.Post("/users/{id}/role", pagesHandler.UserSetRole)
+		})
+		r.Get("/api-docs", pagesHandler.APIDocs)
+		r.Get("/login", pagesHandler.Login)
+		r.Group(func(r chi.Router) {
+			r.Use(func(next http.Handler) http.Handler {
+				return authHandler.RequireAuth(next, http.HandlerFunc(pagesHandler.Unauthorized))
+			})
+			r.Get("/user", pagesHandler.Profile)
+			r.Get("/albums", albumsHandler.List)
 		})
-		r.Get("/user", pagesHandler.Profile)
 	})
 
 	r.NotFound(pagesHandler.NotFound)
 
-	return r
+	return withMetrics(cfg, authHandler, r)
 }
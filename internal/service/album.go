@@ -0,0 +1,357 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/zqz/web/backend/internal/domain"
+	"github.com/zqz/web/backend/internal/repository"
+	"github.com/zqz/web/backend/internal/telemetry"
+)
+
+const (
+	maxAlbumNameLen        = 100
+	maxAlbumDescriptionLen = 1000
+)
+
+var (
+	// ErrAlbumNotFound is returned when an album does not exist or the caller can't see it
+	ErrAlbumNotFound = errors.New("album not found")
+
+	// ErrInvalidAlbumName is returned when an album name is empty or too long
+	ErrInvalidAlbumName = errors.New("album name must be 1 to 100 characters")
+
+	// ErrAlbumDescriptionTooLong is returned when an album description is too long
+	ErrAlbumDescriptionTooLong = errors.New("album description must be at most 1000 characters")
+
+	// ErrInvalidAlbumOrder is returned when a new order names a file that isn't in the album, or names one twice
+	ErrInvalidAlbumOrder = errors.New("order must only list files in the album, each once")
+)
+
+// AlbumService manages albums. Which files of an album a viewer sees is decided by
+// the FileService's own visibility rules.
+type AlbumService struct {
+	repo  *repository.Repository
+	files *FileService
+}
+
+// NewAlbumService creates a new album service
+func NewAlbumService(repo *repository.Repository, files *FileService) *AlbumService {
+	return &AlbumService{repo: repo, files: files}
+}
+
+// CreateAlbum creates an empty album owned by userID
+func (s *AlbumService) CreateAlbum(ctx context.Context, userID int32, req domain.CreateAlbumRequest) (*domain.Album, error) {
+	ctx, span := telemetry.Start(ctx, "AlbumService.CreateAlbum")
+	defer span.End()
+
+	if err := s.files.checkCanManageFiles(ctx, &userID, false); err != nil {
+		return nil, err
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	req.Description = strings.TrimSpace(req.Description)
+	if err := validateAlbum(req.Name, req.Description); err != nil {
+		return nil, err
+	}
+
+	dbAlbum, err := s.repo.Albums.Create(ctx, repository.CreateAlbumParams{
+		UserID:      userID,
+		Slug:        generateSlug(6),
+		Name:        req.Name,
+		Description: req.Description,
+		Private:     req.Private,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create album: %w", err)
+	}
+	return dbAlbumToDomain(dbAlbum), nil
+}
+
+// GetAlbum returns an album with the files the caller can open, in album order.
+// Files that are private to someone else, hidden by a ban, expired or still uploading
+// are left out. Private albums are only found by their owner and moderators.
+func (s *AlbumService) GetAlbum(ctx context.Context, slug string, userID *int32, moderator bool) (*domain.Album, error) {
+	ctx, span := telemetry.Start(ctx, "AlbumService.GetAlbum")
+	defer span.End()
+
+	album, err := s.getAlbum(ctx, slug, userID, moderator)
+	if err != nil {
+		return nil, err
+	}
+
+	dbFiles, err := s.repo.Albums.ListFiles(ctx, album.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list album files: %w", err)
+	}
+	album.Files = make([]*domain.File, 0, len(dbFiles))
+	for _, dbFile := range dbFiles {
+		file := dbFileToDoamin(dbFile)
+		if err := s.files.checkAccess(ctx, file, userID, moderator); err != nil {
+			if errors.Is(err, ErrUnauthorized) || errors.Is(err, ErrFileNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		if checkDownloadable(file) != nil {
+			continue
+		}
+		if err := s.files.LoadThumbnail(ctx, file); err != nil {
+			return nil, err
+		}
+		album.Files = append(album.Files, file)
+	}
+	album.FileCount = int64(len(album.Files))
+
+	return album, nil
+}
+
+// ListAlbums returns the user's albums, newest first
+func (s *AlbumService) ListAlbums(ctx context.Context, userID int32) ([]*domain.Album, error) {
+	ctx, span := telemetry.Start(ctx, "AlbumService.ListAlbums")
+	defer span.End()
+
+	rows, err := s.repo.Albums.ListByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list albums: %w", err)
+	}
+
+	albums := make([]*domain.Album, len(rows))
+	for i, row := range rows {
+		albums[i] = dbAlbumToDomain(&repository.Album{
+			ID:          row.ID,
+			UserID:      row.UserID,
+			Slug:        row.Slug,
+			Name:        row.Name,
+			Description: row.Description,
+			Private:     row.Private,
+			CreatedAt:   row.CreatedAt,
+			UpdatedAt:   row.UpdatedAt,
+		})
+		albums[i].FileCount = row.FileCount
+	}
+	return albums, nil
+}
+
+// UpdateAlbum changes an album's name, description or visibility (owner or moderator)
+func (s *AlbumService) UpdateAlbum(ctx context.Context, slug string, req domain.UpdateAlbumRequest, userID *int32, moderator bool) (*domain.Album, error) {
+	ctx, span := telemetry.Start(ctx, "AlbumService.UpdateAlbum")
+	defer span.End()
+
+	album, err := s.editableAlbum(ctx, slug, userID, moderator)
+	if err != nil {
+		return nil, err
+	}
+
+	name, description := album.Name, album.Description
+	if req.Name != nil {
+		name = strings.TrimSpace(*req.Name)
+		req.Name = &name
+	}
+	if req.Description != nil {
+		description = strings.TrimSpace(*req.Description)
+		req.Description = &description
+	}
+	if err := validateAlbum(name, description); err != nil {
+		return nil, err
+	}
+
+	dbAlbum, err := s.repo.Albums.Update(ctx, repository.UpdateAlbumParams{
+		ID:          album.ID,
+		Name:        req.Name,
+		Description: req.Description,
+		Private:     req.Private,
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrAlbumNotFound
+		}
+		return nil, fmt.Errorf("failed to update album: %w", err)
+	}
+	return dbAlbumToDomain(dbAlbum), nil
+}
+
+// DeleteAlbum deletes an album (owner or moderator). Its files are not touched.
+func (s *AlbumService) DeleteAlbum(ctx context.Context, slug string, userID *int32, moderator bool) error {
+	ctx, span := telemetry.Start(ctx, "AlbumService.DeleteAlbum")
+	defer span.End()
+
+	album, err := s.editableAlbum(ctx, slug, userID, moderator)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.Albums.Delete(ctx, album.ID); err != nil {
+		return fmt.Errorf("failed to delete album: %w", err)
+	}
+	return nil
+}
+
+// AddFiles appends files to the end of the album in the given order. Only files
+// belonging to the album's owner can be added; files already in the album stay where they are.
+func (s *AlbumService) AddFiles(ctx context.Context, slug string, fileSlugs []string, userID *int32, moderator bool) (*domain.Album, error) {
+	ctx, span := telemetry.Start(ctx, "AlbumService.AddFiles")
+	defer span.End()
+
+	album, err := s.editableAlbum(ctx, slug, userID, moderator)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check every file before adding any
+	fileIDs := make([]int32, len(fileSlugs))
+	for i, fileSlug := range fileSlugs {
+		file, err := s.files.GetFileBySlug(ctx, fileSlug, userID, moderator)
+		if err != nil {
+			return nil, err
+		}
+		if file.UserID == nil || !album.IsOwnedBy(*file.UserID) {
+			return nil, ErrPermissionDenied
+		}
+		fileIDs[i] = file.ID
+	}
+	for _, id := range fileIDs {
+		if err := s.repo.Albums.AddFile(ctx, album.ID, id); err != nil {
+			return nil, fmt.Errorf("failed to add file to album: %w", err)
+		}
+	}
+
+	return s.GetAlbum(ctx, slug, userID, moderator)
+}
+
+// RemoveFile takes a file out of the album (owner or moderator). The file itself is kept.
+func (s *AlbumService) RemoveFile(ctx context.Context, slug, fileSlug string, userID *int32, moderator bool) error {
+	ctx, span := telemetry.Start(ctx, "AlbumService.RemoveFile")
+	defer span.End()
+
+	album, err := s.editableAlbum(ctx, slug, userID, moderator)
+	if err != nil {
+		return err
+	}
+
+	dbFile, err := s.repo.Files.GetBySlug(ctx, fileSlug)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrFileNotFound
+		}
+		return fmt.Errorf("failed to get file: %w", err)
+	}
+	if err := s.repo.Albums.RemoveFile(ctx, album.ID, dbFile.ID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrFileNotFound
+		}
+		return fmt.Errorf("failed to remove file from album: %w", err)
+	}
+	return nil
+}
+
+// ReorderFiles moves the listed files to the front of the album in the given order.
+// Files that aren't listed follow them, keeping their current order, so listing every
+// file sets the whole order.
+func (s *AlbumService) ReorderFiles(ctx context.Context, slug string, fileSlugs []string, userID *int32, moderator bool) (*domain.Album, error) {
+	ctx, span := telemetry.Start(ctx, "AlbumService.ReorderFiles")
+	defer span.End()
+
+	album, err := s.editableAlbum(ctx, slug, userID, moderator)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := s.repo.Albums.ListFiles(ctx, album.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list album files: %w", err)
+	}
+	idsBySlug := make(map[string]int32, len(current))
+	for _, f := range current {
+		idsBySlug[f.Slug] = f.ID
+	}
+
+	order := make([]int32, 0, len(current))
+	placed := make(map[int32]bool, len(current))
+	for _, fileSlug := range fileSlugs {
+		id, ok := idsBySlug[fileSlug]
+		if !ok || placed[id] {
+			return nil, ErrInvalidAlbumOrder
+		}
+		order = append(order, id)
+		placed[id] = true
+	}
+	for _, f := range current {
+		if !placed[f.ID] {
+			order = append(order, f.ID)
+		}
+	}
+
+	if err := s.repo.Albums.Reorder(ctx, album.ID, order); err != nil {
+		return nil, fmt.Errorf("failed to reorder album: %w", err)
+	}
+	return s.GetAlbum(ctx, slug, userID, moderator)
+}
+
+// getAlbum looks up an album the caller may see. Private albums, and albums of a user
+// whose ban hides their files, are reported as not found to everyone but the owner and moderators.
+func (s *AlbumService) getAlbum(ctx context.Context, slug string, userID *int32, moderator bool) (*domain.Album, error) {
+	dbAlbum, err := s.repo.Albums.GetBySlug(ctx, slug)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrAlbumNotFound
+		}
+		return nil, fmt.Errorf("failed to get album: %w", err)
+	}
+	album := dbAlbumToDomain(dbAlbum)
+	if moderator || (userID != nil && album.IsOwnedBy(*userID)) {
+		return album, nil
+	}
+	if !album.CanBeAccessedBy(userID) {
+		return nil, ErrAlbumNotFound
+	}
+
+	owner, err := s.files.activeBan(ctx, &album.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if owner != nil && owner.BanHidesFiles {
+		return nil, ErrAlbumNotFound
+	}
+	return album, nil
+}
+
+// editableAlbum looks up an album the caller may change: their own, or any album for moderators
+func (s *AlbumService) editableAlbum(ctx context.Context, slug string, userID *int32, moderator bool) (*domain.Album, error) {
+	if err := s.files.checkCanManageFiles(ctx, userID, moderator); err != nil {
+		return nil, err
+	}
+	album, err := s.getAlbum(ctx, slug, userID, moderator)
+	if err != nil {
+		return nil, err
+	}
+	if !moderator && (userID == nil || !album.IsOwnedBy(*userID)) {
+		return nil, ErrPermissionDenied
+	}
+	return album, nil
+}
+
+func validateAlbum(name, description string) error {
+	if name == "" || utf8.RuneCountInString(name) > maxAlbumNameLen {
+		return ErrInvalidAlbumName
+	}
+	if utf8.RuneCountInString(description) > maxAlbumDescriptionLen {
+		return ErrAlbumDescriptionTooLong
+	}
+	return nil
+}
+
+func dbAlbumToDomain(a *repository.Album) *domain.Album {
+	return &domain.Album{
+		ID:          a.ID,
+		UserID:      a.UserID,
+		Slug:        a.Slug,
+		Name:        a.Name,
+		Description: a.Description,
+		Private:     a.Private,
+		CreatedAt:   a.CreatedAt,
+		UpdatedAt:   a.UpdatedAt,
+	}
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zqz/web/backend/internal/domain"
+	"github.com/zqz/web/backend/internal/repository"
+	"github.com/zqz/web/backend/internal/service/storage"
+	"github.com/zqz/web/backend/internal/tests"
+)
+
+func albumFileNames(album *domain.Album) []string {
+	names := make([]string, len(album.Files))
+	for i, f := range album.Files {
+		names[i] = f.Name
+	}
+	return names
+}
+
+func TestAlbumFilesAndOrder(t *testing.T) {
+	ctx := context.Background()
+	pg, cleanup := tests.SetupTestDB(t, ctx)
+	defer cleanup()
+
+	repo := repository.NewRepository(pg.Pool)
+	stor, err := storage.NewDiskStorage(t.TempDir())
+	require.NoError(t, err)
+	files := NewFileService(repo, stor)
+	svc := NewAlbumService(repo, files)
+
+	alice := createTestUser(t, ctx, repo, "alice")
+	bob := createTestUser(t, ctx, repo, "bob")
+
+	_, err = svc.CreateAlbum(ctx, alice, domain.CreateAlbumRequest{Name: "   "})
+	assert.ErrorIs(t, err, ErrInvalidAlbumName)
+	_, err = svc.CreateAlbum(ctx, alice, domain.CreateAlbumRequest{Name: "Trip", Description: strings.Repeat("x", 1001)})
+	assert.ErrorIs(t, err, ErrAlbumDescriptionTooLong)
+
+	album, err := svc.CreateAlbum(ctx, alice, domain.CreateAlbumRequest{Name: "  Trip  "})
+	require.NoError(t, err)
+	assert.Equal(t, "Trip", album.Name)
+
+	a := uploadTestFile(t, ctx, files, []byte("a.txt"), domain.CreateFileRequest{Name: "a.txt", UserID: &alice})
+	b := uploadTestFile(t, ctx, files, []byte("b.txt"), domain.CreateFileRequest{Name: "b.txt", UserID: &alice})
+	c := uploadTestFile(t, ctx, files, []byte("c.txt"), domain.CreateFileRequest{Name: "c.txt", UserID: &alice})
+	bobs := uploadTestFile(t, ctx, files, []byte("bob.txt"), domain.CreateFileRequest{Name: "bob.txt", UserID: &bob})
+
+	// Only the owner's files can be added, and a refused batch adds nothing
+	_, err = svc.AddFiles(ctx, album.Slug, []string{a.Slug, bobs.Slug}, &alice, false)
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+	_, err = svc.AddFiles(ctx, album.Slug, []string{a.Slug}, &bob, false)
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+
+	album, err = svc.AddFiles(ctx, album.Slug, []string{a.Slug, b.Slug, c.Slug, a.Slug}, &alice, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a.txt", "b.txt", "c.txt"}, albumFileNames(album))
+
+	album, err = svc.ReorderFiles(ctx, album.Slug, []string{c.Slug}, &alice, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c.txt", "a.txt", "b.txt"}, albumFileNames(album))
+	_, err = svc.ReorderFiles(ctx, album.Slug, []string{c.Slug, c.Slug}, &alice, false)
+	assert.ErrorIs(t, err, ErrInvalidAlbumOrder)
+	_, err = svc.ReorderFiles(ctx, album.Slug, []string{bobs.Slug}, &alice, false)
+	assert.ErrorIs(t, err, ErrInvalidAlbumOrder)
+
+	require.NoError(t, svc.RemoveFile(ctx, album.Slug, a.Slug, &alice, false))
+	assert.ErrorIs(t, svc.RemoveFile(ctx, album.Slug, a.Slug, &alice, false), ErrFileNotFound)
+	_, err = files.GetFileBySlug(ctx, a.Slug, &alice, false)
+	assert.NoError(t, err, "removing a file from an album keeps the file")
+
+	// A new file goes to the end
+	album, err = svc.AddFiles(ctx, album.Slug, []string{a.Slug}, &alice, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c.txt", "b.txt", "a.txt"}, albumFileNames(album))
+
+	albums, err := svc.ListAlbums(ctx, alice)
+	require.NoError(t, err)
+	require.Len(t, albums, 1)
+	assert.EqualValues(t, 3, albums[0].FileCount)
+}
+
+func TestAlbumVisibility(t *testing.T) {
+	ctx := context.Background()
+	pg, cleanup := tests.SetupTestDB(t, ctx)
+	defer cleanup()
+
+	repo := repository.NewRepository(pg.Pool)
+	stor, err := storage.NewDiskStorage(t.TempDir())
+	require.NoError(t, err)
+	files := NewFileService(repo, stor)
+	svc := NewAlbumService(repo, files)
+
+	alice := createTestUser(t, ctx, repo, "alice")
+	bob := createTestUser(t, ctx, repo, "bob")
+
+	album, err := svc.CreateAlbum(ctx, alice, domain.CreateAlbumRequest{Name: "Mixed"})
+	require.NoError(t, err)
+	public := uploadTestFile(t, ctx, files, []byte("public.txt"), domain.CreateFileRequest{Name: "public.txt", UserID: &alice})
+	private := uploadTestFile(t, ctx, files, []byte("private.txt"), domain.CreateFileRequest{Name: "private.txt", UserID: &alice, Private: true})
+	_, err = svc.AddFiles(ctx, album.Slug, []string{public.Slug, private.Slug}, &alice, false)
+	require.NoError(t, err)
+
+	// The album never shows a file the viewer couldn't open on its own
+	shared, err := svc.GetAlbum(ctx, album.Slug, nil, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"public.txt"}, albumFileNames(shared))
+	assert.EqualValues(t, 1, shared.FileCount)
+	own, err := svc.GetAlbum(ctx, album.Slug, &alice, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"public.txt", "private.txt"}, albumFileNames(own))
+
+	// Others can't change it; moderators can
+	_, err = svc.UpdateAlbum(ctx, album.Slug, domain.UpdateAlbumRequest{}, &bob, false)
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+	hidden := true
+	updated, err := svc.UpdateAlbum(ctx, album.Slug, domain.UpdateAlbumRequest{Private: &hidden}, &bob, true)
+	require.NoError(t, err)
+	assert.True(t, updated.Private)
+	assert.Equal(t, "Mixed", updated.Name)
+
+	// A private album doesn't exist for anyone but its owner and moderators
+	_, err = svc.GetAlbum(ctx, album.Slug, nil, false)
+	assert.ErrorIs(t, err, ErrAlbumNotFound)
+	_, err = svc.GetAlbum(ctx, album.Slug, &bob, false)
+	assert.ErrorIs(t, err, ErrAlbumNotFound)
+	_, err = svc.GetAlbum(ctx, album.Slug, &alice, false)
+	assert.NoError(t, err)
+
+	assert.ErrorIs(t, svc.DeleteAlbum(ctx, album.Slug, &bob, false), ErrAlbumNotFound)
+	require.NoError(t, svc.DeleteAlbum(ctx, album.Slug, &alice, false))
+	_, err = svc.GetAlbum(ctx, album.Slug, &alice, false)
+	assert.ErrorIs(t, err, ErrAlbumNotFound)
+	_, err = files.GetFileBySlug(ctx, public.Slug, nil, false)
+	assert.NoError(t, err, "deleting an album keeps its files")
+}
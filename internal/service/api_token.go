@@ -0,0 +1,208 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"github.com/zqz/web/backend/internal/domain"
+	"github.com/zqz/web/backend/internal/repository"
+	"github.com/zqz/web/backend/internal/telemetry"
+)
+
+// apiTokenPrefix makes personal API tokens easy to recognise (and to grep for in leaked logs)
+const apiTokenPrefix = "upl_"
+
+var (
+	// ErrAPITokenNotFound is returned when a token does not exist or belongs to another user
+	ErrAPITokenNotFound = errors.New("api token not found")
+
+	// ErrInvalidAPIToken is returned when a presented bearer token is unknown
+	ErrInvalidAPIToken = errors.New("invalid api token")
+
+	// ErrAPITokenExpired is returned when a presented bearer token has expired
+	ErrAPITokenExpired = errors.New("api token expired")
+)
+
+// CreateAPIToken mints a new personal API token for the user. The plaintext token
+// is returned once; only its SHA-256 hash is persisted.
+func (s *UserService) CreateAPIToken(ctx context.Context, userID int32, req domain.CreateAPITokenRequest) (string, *domain.APIToken, error) {
+	ctx, span := telemetry.Start(ctx, "UserService.CreateAPIToken")
+	defer span.End()
+
+	req.Name = strings.TrimSpace(req.Name)
+	if err := validateCreateAPITokenRequest(req); err != nil {
+		return "", nil, fmt.Errorf("invalid request: %w", err)
+	}
+
+	plaintext, err := generateAPIToken()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to generate api token: %w", err)
+	}
+
+	scopes := req.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+	var expiresAt pgtype.Timestamp
+	if req.ExpiresAt != nil {
+		expiresAt = pgtype.Timestamp{Time: req.ExpiresAt.UTC(), Valid: true}
+	}
+
+	// The token and its audit event are committed together
+	var token *domain.APIToken
+	err = s.repo.WithTransaction(ctx, func(ctx context.Context, repo *repository.Repository) error {
+		dbToken, err := repo.APITokens.Create(ctx, repository.CreateAPITokenParams{
+			UserID:    userID,
+			Name:      req.Name,
+			TokenHash: hashAPIToken(plaintext),
+			Scopes:    scopes,
+			ExpiresAt: expiresAt,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create api token: %w", err)
+		}
+
+		token = dbAPITokenToDomain(dbToken)
+		return recordAudit(ctx, repo, domain.AuditAPITokenCreate, domain.AuditTargetAPIToken, strconv.Itoa(int(token.ID)), nil, map[string]any{
+			"user_id":    token.UserID,
+			"name":       token.Name,
+			"scopes":     token.Scopes,
+			"expires_at": token.ExpiresAt,
+		})
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	return plaintext, token, nil
+}
+
+// ListAPITokens returns all API tokens belonging to the user, newest first
+func (s *UserService) ListAPITokens(ctx context.Context, userID int32) ([]*domain.APIToken, error) {
+	ctx, span := telemetry.Start(ctx, "UserService.ListAPITokens")
+	defer span.End()
+
+	dbTokens, err := s.repo.APITokens.ListByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list api tokens: %w", err)
+	}
+
+	tokens := make([]*domain.APIToken, len(dbTokens))
+	for i, dbToken := range dbTokens {
+		tokens[i] = dbAPITokenToDomain(dbToken)
+	}
+
+	return tokens, nil
+}
+
+// RevokeAPIToken deletes one of the user's API tokens
+func (s *UserService) RevokeAPIToken(ctx context.Context, userID, tokenID int32) error {
+	ctx, span := telemetry.Start(ctx, "UserService.RevokeAPIToken")
+	defer span.End()
+
+	return s.repo.WithTransaction(ctx, func(ctx context.Context, repo *repository.Repository) error {
+		if err := repo.APITokens.Delete(ctx, tokenID, userID); err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return ErrAPITokenNotFound
+			}
+			return fmt.Errorf("failed to revoke api token: %w", err)
+		}
+		return recordAudit(ctx, repo, domain.AuditAPITokenRevoke, domain.AuditTargetAPIToken, strconv.Itoa(int(tokenID)), map[string]any{"user_id": userID}, nil)
+	})
+}
+
+// AuthenticateAPIToken resolves a plaintext bearer token to its owner and records its use
+func (s *UserService) AuthenticateAPIToken(ctx context.Context, plaintext string) (*domain.User, *domain.APIToken, error) {
+	ctx, span := telemetry.Start(ctx, "UserService.AuthenticateAPIToken")
+	defer span.End()
+
+	if !strings.HasPrefix(plaintext, apiTokenPrefix) {
+		return nil, nil, ErrInvalidAPIToken
+	}
+
+	dbToken, err := s.repo.APITokens.GetByHash(ctx, hashAPIToken(plaintext))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, nil, ErrInvalidAPIToken
+		}
+		return nil, nil, fmt.Errorf("failed to get api token: %w", err)
+	}
+
+	token := dbAPITokenToDomain(dbToken)
+	if token.IsExpired(time.Now()) {
+		return nil, nil, ErrAPITokenExpired
+	}
+
+	user, err := s.GetUserByID(ctx, token.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := s.repo.APITokens.Touch(ctx, token.ID); err != nil {
+		return nil, nil, fmt.Errorf("failed to update api token: %w", err)
+	}
+
+	return user, token, nil
+}
+
+// Helper functions
+
+func validateCreateAPITokenRequest(req domain.CreateAPITokenRequest) error {
+	if req.Name == "" {
+		return errors.New("name is required")
+	}
+	if len([]rune(req.Name)) > 100 {
+		return errors.New("name must be at most 100 characters")
+	}
+	for _, scope := range req.Scopes {
+		if !slices.Contains(domain.APITokenScopes, scope) {
+			return fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return errors.New("expiry must be in the future")
+	}
+	return nil
+}
+
+func generateAPIToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return apiTokenPrefix + hex.EncodeToString(b), nil
+}
+
+func hashAPIToken(plaintext string) string {
+	sum := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(sum[:])
+}
+
+func dbAPITokenToDomain(t *repository.ApiToken) *domain.APIToken {
+	out := &domain.APIToken{
+		ID:        t.ID,
+		UserID:    t.UserID,
+		Name:      t.Name,
+		Scopes:    t.Scopes,
+		CreatedAt: t.CreatedAt,
+	}
+	if t.ExpiresAt.Valid {
+		expiresAt := t.ExpiresAt.Time
+		out.ExpiresAt = &expiresAt
+	}
+	if t.LastUsedAt.Valid {
+		lastUsedAt := t.LastUsedAt.Time
+		out.LastUsedAt = &lastUsedAt
+	}
+	return out
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// attemptLimiter rate-limits failed attempts (password guesses) per key with a token bucket:
+// a burst of attempts, then one more per refill. An attempt takes a token before the check it
+// guards and gives it back if the check passes, so concurrent guesses can't all get through
+// while the bucket still looks full.
+type attemptLimiter struct {
+	burst  int
+	refill time.Duration
+
+	mu      sync.Mutex
+	buckets map[string]*attemptBucket
+	swept   time.Time
+}
+
+type attemptBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+func newAttemptLimiter(burst int, refill time.Duration) *attemptLimiter {
+	return &attemptLimiter{
+		burst:   burst,
+		refill:  refill,
+		buckets: make(map[string]*attemptBucket),
+		swept:   time.Now(),
+	}
+}
+
+// reserve takes a token for key and returns a func that gives it back, or false (taking
+// nothing) if the key has run out of attempts
+func (l *attemptLimiter) reserve(key string) (func(), bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.swept) >= l.refill {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &attemptBucket{tokens: float64(l.burst), updated: now}
+		l.buckets[key] = b
+	}
+	if l.tokens(b, now) < 1 {
+		return nil, false
+	}
+	b.tokens--
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			b.tokens = min(l.tokens(b, time.Now())+1, float64(l.burst))
+		})
+	}, true
+}
+
+// tokens brings b up to date and returns how many attempts it has left. Callers hold l.mu.
+func (l *attemptLimiter) tokens(b *attemptBucket, now time.Time) float64 {
+	if elapsed := now.Sub(b.updated); elapsed > 0 {
+		b.tokens = min(b.tokens+float64(elapsed)/float64(l.refill), float64(l.burst))
+		b.updated = now
+	}
+	return b.tokens
+}
+
+// sweep forgets keys whose bucket has refilled, since a new bucket would behave the same.
+// Callers hold l.mu.
+func (l *attemptLimiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if l.tokens(b, now) >= float64(l.burst) {
+			delete(l.buckets, key)
+		}
+	}
+	l.swept = now
+}
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAttemptLimiter(t *testing.T) {
+	l := newAttemptLimiter(2, time.Hour)
+
+	_, ok := l.reserve("a")
+	require.True(t, ok)
+	refund, ok := l.reserve("a")
+	require.True(t, ok)
+	_, ok = l.reserve("a")
+	assert.False(t, ok, "burst used up")
+
+	// A refunded attempt can be made again
+	refund()
+	_, ok = l.reserve("a")
+	assert.True(t, ok)
+
+	_, ok = l.reserve("b")
+	assert.True(t, ok, "keys are limited separately")
+}
+
+func TestAttemptLimiterSweep(t *testing.T) {
+	l := newAttemptLimiter(2, time.Hour)
+
+	refund, ok := l.reserve("refilled")
+	require.True(t, ok)
+	refund()
+	_, ok = l.reserve("limited")
+	require.True(t, ok)
+
+	// Keys with a full bucket are dropped; ones still counting attempts are kept
+	l.mu.Lock()
+	l.swept = time.Now().Add(-2 * time.Hour)
+	l.mu.Unlock()
+	_, ok = l.reserve("new")
+	require.True(t, ok)
+
+	assert.NotContains(t, l.buckets, "refilled")
+	assert.Contains(t, l.buckets, "limited")
+	assert.Contains(t, l.buckets, "new")
+}
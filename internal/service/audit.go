@@ -0,0 +1,147 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/zqz/web/backend/internal/domain"
+	"github.com/zqz/web/backend/internal/repository"
+	"github.com/zqz/web/backend/internal/telemetry"
+)
+
+// Actor is who an audited change is attributed to
+type Actor struct {
+	UserID *int32 // nil for the server itself and maintenance commands
+	IP     string
+}
+
+type actorKey struct{}
+
+// WithActor returns ctx carrying the actor that changes made under it are attributed to
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor set by WithActor, or the zero (system) actor
+func ActorFromContext(ctx context.Context) Actor {
+	actor, _ := ctx.Value(actorKey{}).(Actor)
+	return actor
+}
+
+// recordAudit appends an event for a change made through repo. Pass the change's
+// transaction so the two commit together or not at all. before and after are stored as
+// JSON; a nil value is stored as NULL. Nothing is recorded when both encode the same, so
+// resubmitting a form doesn't fill the log.
+func recordAudit(ctx context.Context, repo *repository.Repository, action, targetType, targetID string, before, after any) error {
+	beforeJSON, err := auditJSON(before)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := auditJSON(after)
+	if err != nil {
+		return err
+	}
+	if beforeJSON != nil && bytes.Equal(beforeJSON, afterJSON) {
+		return nil
+	}
+
+	actor := ActorFromContext(ctx)
+	var ip *string
+	if actor.IP != "" {
+		ip = &actor.IP
+	}
+	if _, err := repo.Audit.Create(ctx, repository.CreateAuditEventParams{
+		ActorID:    actor.UserID,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Before:     beforeJSON,
+		After:      afterJSON,
+		Ip:         ip,
+	}); err != nil {
+		return fmt.Errorf("failed to record audit event: %w", err)
+	}
+	return nil
+}
+
+func auditJSON(v any) ([]byte, error) {
+	if v == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode audit state: %w", err)
+	}
+	return b, nil
+}
+
+// AuditService lets admins browse the audit log
+type AuditService struct {
+	repo *repository.Repository
+}
+
+// NewAuditService creates a new audit service
+func NewAuditService(repo *repository.Repository) *AuditService {
+	return &AuditService{repo: repo}
+}
+
+// ListEvents returns a page of events matching filter, newest first, and how many match in total
+func (s *AuditService) ListEvents(ctx context.Context, filter domain.AuditFilter, limit, offset int32) ([]*domain.AuditEvent, int64, error) {
+	ctx, span := telemetry.Start(ctx, "AuditService.ListEvents")
+	defer span.End()
+
+	params := repository.ListAuditEventsParams{
+		ActorID:    filter.ActorID,
+		Action:     nonEmpty(filter.Action),
+		TargetType: nonEmpty(filter.TargetType),
+		TargetID:   nonEmpty(filter.TargetID),
+		Limit:      limit,
+		Offset:     offset,
+	}
+	dbEvents, err := s.repo.Audit.List(ctx, params)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list audit events: %w", err)
+	}
+	total, err := s.repo.Audit.Count(ctx, repository.CountAuditEventsParams{
+		ActorID:    params.ActorID,
+		Action:     params.Action,
+		TargetType: params.TargetType,
+		TargetID:   params.TargetID,
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count audit events: %w", err)
+	}
+
+	events := make([]*domain.AuditEvent, len(dbEvents))
+	for i, e := range dbEvents {
+		events[i] = dbAuditEventToDomain(e)
+	}
+	return events, total, nil
+}
+
+func dbAuditEventToDomain(e *repository.AuditEvent) *domain.AuditEvent {
+	out := &domain.AuditEvent{
+		ID:         e.ID,
+		ActorID:    e.ActorID,
+		Action:     e.Action,
+		TargetType: e.TargetType,
+		TargetID:   e.TargetID,
+		Before:     e.Before,
+		After:      e.After,
+		CreatedAt:  e.CreatedAt,
+	}
+	if e.Ip != nil {
+		out.IP = *e.Ip
+	}
+	return out
+}
+
+// nonEmpty returns nil for "" so an unset filter matches everything
+func nonEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zqz/web/backend/internal/domain"
+	"github.com/zqz/web/backend/internal/repository"
+	"github.com/zqz/web/backend/internal/tests"
+)
+
+func TestAuditRecordsUserChangesWithActor(t *testing.T) {
+	ctx := context.Background()
+	pg, cleanup := tests.SetupTestDB(t, ctx)
+	defer cleanup()
+
+	repo := repository.NewRepository(pg.Pool)
+	users := NewUserService(repo)
+	audit := NewAuditService(repo)
+
+	admin, err := users.GetOrCreateUser(ctx, domain.CreateUserRequest{
+		Name: "Admin", Email: "admin@example.com", Provider: testProviderGoogle, ProviderID: "g-admin", Role: testRoleMember,
+	})
+	require.NoError(t, err)
+	member, err := users.GetOrCreateUser(ctx, domain.CreateUserRequest{
+		Name: "Member", Email: "member@example.com", Provider: testProviderGoogle, ProviderID: "g-member", Role: testRoleMember,
+	})
+	require.NoError(t, err)
+
+	actorCtx := WithActor(ctx, Actor{UserID: &admin.ID, IP: "203.0.113.7"})
+	_, err = users.SetBanned(actorCtx, member.ID, true)
+	require.NoError(t, err)
+	_, err = users.SetBanned(ctx, member.ID, false)
+	require.NoError(t, err)
+
+	events, total, err := audit.ListEvents(ctx, domain.AuditFilter{TargetType: domain.AuditTargetUser, TargetID: strconv.Itoa(int(member.ID))}, 10, 0)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, total)
+	require.Len(t, events, 2)
+
+	// Newest first; the unban had no actor in its context
+	assert.Equal(t, domain.AuditUserUnban, events[0].Action)
+	assert.Nil(t, events[0].ActorID)
+	assert.Empty(t, events[0].IP)
+
+	ban := events[1]
+	assert.Equal(t, domain.AuditUserBan, ban.Action)
+	require.NotNil(t, ban.ActorID)
+	assert.Equal(t, admin.ID, *ban.ActorID)
+	assert.Equal(t, "203.0.113.7", ban.IP)
+	assert.JSONEq(t, `{"banned": false, "reason": null, "until": null, "hide_files": false}`, string(ban.Before))
+	assert.JSONEq(t, `{"banned": true, "reason": null, "until": null, "hide_files": false}`, string(ban.After))
+
+	byActor, total, err := audit.ListEvents(ctx, domain.AuditFilter{ActorID: &admin.ID}, 10, 0)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, total)
+	require.Len(t, byActor, 1)
+	assert.Equal(t, ban.ID, byActor[0].ID)
+
+	page, total, err := audit.ListEvents(ctx, domain.AuditFilter{}, 1, 1)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, total)
+	require.Len(t, page, 1)
+	assert.Equal(t, ban.ID, page[0].ID)
+}
+
+func TestAuditSettingsSkipsUnchangedValues(t *testing.T) {
+	ctx := context.Background()
+	pg, cleanup := tests.SetupTestDB(t, ctx)
+	defer cleanup()
+
+	repo := repository.NewRepository(pg.Pool)
+	settings := NewSettingsService(repo)
+	audit := NewAuditService(repo)
+	filter := domain.AuditFilter{Action: domain.AuditSettingUpdate, TargetID: "api_rate_limit_rps"}
+
+	require.NoError(t, settings.Set(ctx, "api_rate_limit_rps", "5"))
+	require.NoError(t, settings.Set(ctx, "api_rate_limit_rps", "5"))
+
+	events, total, err := audit.ListEvents(ctx, filter, 10, 0)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, total)
+	require.Len(t, events, 1)
+	assert.JSONEq(t, `{"value": "5"}`, string(events[0].After))
+}
+
+func TestAuditEventsAreAppendOnly(t *testing.T) {
+	ctx := context.Background()
+	pg, cleanup := tests.SetupTestDB(t, ctx)
+	defer cleanup()
+
+	repo := repository.NewRepository(pg.Pool)
+	require.NoError(t, NewSettingsService(repo).Set(ctx, "default_private_upload", "true"))
+
+	_, err := pg.Pool.Exec(ctx, "UPDATE audit_events SET action = 'forged'")
+	assert.ErrorContains(t, err, "append-only")
+	_, err = pg.Pool.Exec(ctx, "DELETE FROM audit_events")
+	assert.ErrorContains(t, err, "append-only")
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/zqz/web/backend/internal/domain"
+	"github.com/zqz/web/backend/internal/repository"
+)
+
+// activeBan returns the user if they are currently banned, or nil. Anonymous callers
+// and users that no longer exist are never banned.
+func (s *FileService) activeBan(ctx context.Context, userID *int32) (*domain.User, error) {
+	if userID == nil {
+		return nil, nil
+	}
+	dbUser, err := s.repo.Users.GetByID(ctx, *userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	user := dbUserToDomain(dbUser)
+	if !user.IsBanned(time.Now()) {
+		return nil, nil
+	}
+	return user, nil
+}
+
+// checkNotBanned returns ErrUserBanned if the caller is under an active ban
+func (s *FileService) checkNotBanned(ctx context.Context, userID *int32) error {
+	banned, err := s.activeBan(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if banned != nil {
+		return ErrUserBanned
+	}
+	return nil
+}
+
+// hiddenByBan reports whether file belongs to someone other than viewerID whose
+// active ban hides their files
+func (s *FileService) hiddenByBan(ctx context.Context, file *domain.File, viewerID *int32) (bool, error) {
+	if file.UserID == nil || (viewerID != nil && *viewerID == *file.UserID) {
+		return false, nil
+	}
+	owner, err := s.activeBan(ctx, file.UserID)
+	if err != nil {
+		return false, err
+	}
+	return owner != nil && owner.BanHidesFiles, nil
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zqz/web/backend/internal/domain"
+	"github.com/zqz/web/backend/internal/repository"
+	"github.com/zqz/web/backend/internal/service/storage"
+	"github.com/zqz/web/backend/internal/tests"
+)
+
+func TestBanBlocksChangesAndHidesFiles(t *testing.T) {
+	ctx := context.Background()
+	pg, cleanup := tests.SetupTestDB(t, ctx)
+	defer cleanup()
+
+	repo := repository.NewRepository(pg.Pool)
+	stor, err := storage.NewDiskStorage(t.TempDir())
+	require.NoError(t, err)
+	svc := NewFileService(repo, stor)
+	users := NewUserService(repo)
+
+	owner, err := repo.Users.Create(ctx, repository.CreateUserParams{
+		Name: testOwnerName, Email: testOwnerEmail, Provider: testProviderGoogle, ProviderID: testOwnerProviderID, Role: testRoleMember,
+	})
+	require.NoError(t, err)
+	file, err := svc.CreateFile(ctx, domain.CreateFileRequest{
+		Name: "mine.txt", Hash: testHash1, Size: 100, ContentType: contentTypePlain, UserID: &owner.ID,
+	}, 0)
+	require.NoError(t, err)
+
+	until := time.Now().Add(time.Hour)
+	banned, err := users.BanUser(ctx, owner.ID, domain.BanRequest{Reason: "  spam  ", Until: &until, HideFiles: true})
+	require.NoError(t, err)
+	assert.True(t, banned.IsBanned(time.Now()))
+	assert.Equal(t, "spam", banned.BanReason)
+	require.NotNil(t, banned.BannedUntil)
+	assert.WithinDuration(t, until, *banned.BannedUntil, time.Second)
+
+	_, err = svc.CreateFile(ctx, domain.CreateFileRequest{
+		Name: "more.txt", Hash: testHash2, Size: 100, ContentType: contentTypePlain, UserID: &owner.ID,
+	}, 0)
+	assert.ErrorIs(t, err, ErrUserBanned)
+	_, err = svc.UpdateFile(ctx, file.Slug, UpdateFileRequest{}, &owner.ID, false)
+	assert.ErrorIs(t, err, ErrUserBanned)
+	assert.ErrorIs(t, svc.DeleteFile(ctx, file.Slug, &owner.ID, false), ErrUserBanned)
+
+	// Hidden from everyone else, still visible to the owner and admins
+	_, err = svc.GetFileBySlug(ctx, file.Slug, nil, false)
+	assert.ErrorIs(t, err, ErrFileNotFound)
+	_, err = svc.GetFileBySlug(ctx, file.Slug, &owner.ID, false)
+	assert.NoError(t, err)
+	_, err = svc.GetFileBySlug(ctx, file.Slug, nil, true)
+	assert.NoError(t, err)
+	files, err := svc.ListFiles(ctx, 10, 0, nil, false, "")
+	require.NoError(t, err)
+	assert.Empty(t, files)
+
+	_, err = users.UnbanUser(ctx, owner.ID)
+	require.NoError(t, err)
+	files, err = svc.ListFiles(ctx, 10, 0, nil, false, "")
+	require.NoError(t, err)
+	assert.Len(t, files, 1)
+	_, err = svc.CreateFile(ctx, domain.CreateFileRequest{
+		Name: "more.txt", Hash: testHash2, Size: 100, ContentType: contentTypePlain, UserID: &owner.ID,
+	}, 0)
+	assert.NoError(t, err)
+}
+
+func TestExpiredBanNoLongerApplies(t *testing.T) {
+	ctx := context.Background()
+	pg, cleanup := tests.SetupTestDB(t, ctx)
+	defer cleanup()
+
+	repo := repository.NewRepository(pg.Pool)
+	stor, err := storage.NewDiskStorage(t.TempDir())
+	require.NoError(t, err)
+	svc := NewFileService(repo, stor)
+
+	owner, err := repo.Users.Create(ctx, repository.CreateUserParams{
+		Name: testOwnerName, Email: testOwnerEmail, Provider: testProviderGoogle, ProviderID: testOwnerProviderID, Role: testRoleMember,
+	})
+	require.NoError(t, err)
+	_, err = svc.CreateFile(ctx, domain.CreateFileRequest{
+		Name: "mine.txt", Hash: testHash1, Size: 100, ContentType: contentTypePlain, UserID: &owner.ID,
+	}, 0)
+	require.NoError(t, err)
+
+	// BanUser refuses an expiry in the past, so write the expired ban directly
+	_, err = repo.Users.SetBanned(ctx, repository.SetUserBannedParams{
+		ID:            owner.ID,
+		Banned:        true,
+		BannedUntil:   pgtype.Timestamp{Time: time.Now().UTC().Add(-time.Minute), Valid: true},
+		BanHidesFiles: true,
+	})
+	require.NoError(t, err)
+
+	files, err := svc.ListFiles(ctx, 10, 0, nil, false, "")
+	require.NoError(t, err)
+	assert.Len(t, files, 1)
+	_, err = svc.CreateFile(ctx, domain.CreateFileRequest{
+		Name: "more.txt", Hash: testHash2, Size: 100, ContentType: contentTypePlain, UserID: &owner.ID,
+	}, 0)
+	assert.NoError(t, err)
+
+	count, err := repo.Users.CountBanned(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, count)
+}
+
+func TestBanUserValidation(t *testing.T) {
+	ctx := context.Background()
+	pg, cleanup := tests.SetupTestDB(t, ctx)
+	defer cleanup()
+
+	repo := repository.NewRepository(pg.Pool)
+	users := NewUserService(repo)
+	user, err := repo.Users.Create(ctx, repository.CreateUserParams{
+		Name: testOwnerName, Email: testOwnerEmail, Provider: testProviderGoogle, ProviderID: testOwnerProviderID, Role: testRoleMember,
+	})
+	require.NoError(t, err)
+
+	past := time.Now().Add(-time.Hour)
+	_, err = users.BanUser(ctx, user.ID, domain.BanRequest{Until: &past})
+	assert.ErrorIs(t, err, ErrInvalidBan)
+	_, err = users.BanUser(ctx, user.ID, domain.BanRequest{Reason: strings.Repeat("x", maxBanReasonLen+1)})
+	assert.ErrorIs(t, err, ErrInvalidBan)
+	_, err = users.BanUser(ctx, 99999, domain.BanRequest{})
+	assert.ErrorIs(t, err, ErrUserNotFound)
+}
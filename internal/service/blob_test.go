@@ -0,0 +1,167 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zqz/web/backend/internal/domain"
+	"github.com/zqz/web/backend/internal/repository"
+	"github.com/zqz/web/backend/internal/service/storage"
+	"github.com/zqz/web/backend/internal/tests"
+)
+
+func TestFileServiceSameContentDifferentUsers(t *testing.T) {
+	ctx := context.Background()
+	pg, cleanup := tests.SetupTestDB(t, ctx)
+	defer cleanup()
+
+	repo := repository.NewRepository(pg.Pool)
+	stor, err := storage.NewDiskStorage(t.TempDir())
+	require.NoError(t, err)
+	svc := NewFileService(repo, stor)
+
+	alice := createTestUser(t, ctx, repo, "alice")
+	bob := createTestUser(t, ctx, repo, "bob")
+
+	content := []byte("shared content")
+	aliceFile := uploadTestFile(t, ctx, svc, content, domain.CreateFileRequest{Name: "alice.txt", UserID: &alice})
+	hash := aliceFile.Hash
+
+	// Bob gets his own record, but only once he has sent the bytes himself
+	bobFile, err := svc.CreateFile(ctx, domain.CreateFileRequest{
+		Name: "bob.txt", Hash: hash, Size: int64(len(content)), ContentType: contentTypePlain, UserID: &bob,
+	}, 0)
+	require.NoError(t, err)
+	assert.NotEqual(t, aliceFile.ID, bobFile.ID)
+	assert.Equal(t, "bob.txt", bobFile.Name)
+	assert.True(t, bobFile.IsOwnedBy(bob))
+	assert.False(t, bobFile.Finished())
+	assert.Zero(t, bobFile.BytesReceived)
+
+	bobFile, err = svc.UploadFileData(ctx, hash, bytes.NewReader(content), 0, &bob)
+	require.NoError(t, err)
+	assert.True(t, bobFile.Finished())
+	assert.NotEqual(t, aliceFile.Slug, bobFile.Slug)
+	exists, err := stor.Exists(ctx, partialKey(bobFile.ID))
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	// A second copy for Bob needs no upload
+	again, err := svc.CreateFile(ctx, domain.CreateFileRequest{
+		Name: "again.txt", Hash: hash, Size: int64(len(content)), ContentType: contentTypePlain, UserID: &bob,
+	}, 0)
+	require.NoError(t, err)
+	assert.True(t, again.Finished())
+	require.NoError(t, svc.DeleteFile(ctx, again.Slug, &bob, false))
+
+	private := true
+	_, err = svc.UpdateFile(ctx, bobFile.Slug, UpdateFileRequest{Private: &private}, &bob, false)
+	require.NoError(t, err)
+	got, err := svc.GetFileBySlug(ctx, aliceFile.Slug, nil, false)
+	require.NoError(t, err)
+	assert.False(t, got.Private)
+
+	blob, err := repo.Blobs.Get(ctx, hash)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), blob.RefCount)
+
+	// Deleting one record keeps the data for the other
+	require.NoError(t, svc.DeleteFile(ctx, aliceFile.Slug, &alice, false))
+	reader, _, err := svc.DownloadFile(ctx, bobFile.Slug, &bob, false)
+	require.NoError(t, err)
+	reader.Close()
+
+	// Deleting the last reference removes the blob and its data
+	require.NoError(t, svc.DeleteFile(ctx, bobFile.Slug, &bob, false))
+	_, err = repo.Blobs.Get(ctx, hash)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	exists, err = stor.Exists(ctx, hash)
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestFileServiceCreateFileWrongSize(t *testing.T) {
+	ctx := context.Background()
+	pg, cleanup := tests.SetupTestDB(t, ctx)
+	defer cleanup()
+
+	repo := repository.NewRepository(pg.Pool)
+	stor, err := storage.NewDiskStorage(t.TempDir())
+	require.NoError(t, err)
+	svc := NewFileService(repo, stor)
+
+	alice := createTestUser(t, ctx, repo, "alice")
+	bob := createTestUser(t, ctx, repo, "bob")
+
+	content := []byte("alice's content")
+	aliceFile := uploadTestFile(t, ctx, svc, content, domain.CreateFileRequest{Name: "a.txt", UserID: &alice})
+	hash := aliceFile.Hash
+
+	// Creating a record with the wrong size gives nothing away and can never complete
+	bobFile, err := svc.CreateFile(ctx, domain.CreateFileRequest{
+		Name: "b.txt", Hash: hash, Size: int64(len(content)) + 1, ContentType: contentTypePlain, UserID: &bob,
+	}, 0)
+	require.NoError(t, err)
+	assert.False(t, bobFile.Finished())
+
+	_, err = svc.UploadFileData(ctx, hash, bytes.NewReader(append(content, '!')), 0, &bob)
+	assert.ErrorIs(t, err, ErrHashMismatch)
+
+	got, err := svc.GetFileBySlug(ctx, aliceFile.Slug, &alice, false)
+	require.NoError(t, err)
+	assert.True(t, got.Finished())
+	blob, err := repo.Blobs.Get(ctx, hash)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(content)), blob.Size)
+}
+
+func TestFileServiceFailedUploadKeepsOtherUploads(t *testing.T) {
+	ctx := context.Background()
+	pg, cleanup := tests.SetupTestDB(t, ctx)
+	defer cleanup()
+
+	repo := repository.NewRepository(pg.Pool)
+	stor, err := storage.NewDiskStorage(t.TempDir())
+	require.NoError(t, err)
+	svc := NewFileService(repo, stor)
+
+	alice := createTestUser(t, ctx, repo, "alice")
+	bob := createTestUser(t, ctx, repo, "bob")
+
+	content := []byte("content both of them claim")
+	hash := sha256Hex(content)
+	req := domain.CreateFileRequest{Name: "f.txt", Hash: hash, Size: int64(len(content)), ContentType: contentTypePlain}
+
+	req.UserID = &alice
+	_, err = svc.CreateFile(ctx, req, 0)
+	require.NoError(t, err)
+	req.UserID = &bob
+	_, err = svc.CreateFile(ctx, req, 0)
+	require.NoError(t, err)
+
+	aliceFile, err := svc.UploadFileData(ctx, hash, bytes.NewReader(content[:10]), 0, &alice)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), aliceFile.BytesReceived)
+
+	// Bob's bad data, and his data past the size limit, only ever touch his own record
+	_, err = svc.UploadFileData(ctx, hash, bytes.NewReader(bytes.Repeat([]byte("x"), len(content))), 0, &bob)
+	assert.ErrorIs(t, err, ErrHashMismatch)
+	_, err = svc.UploadFileData(ctx, hash, bytes.NewReader(content), 5, &bob)
+	assert.ErrorIs(t, err, ErrFileTooLarge)
+
+	aliceFile, err = svc.GetFileByHash(ctx, hash, &alice)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), aliceFile.BytesReceived)
+
+	aliceFile, err = svc.UploadFileData(ctx, hash, bytes.NewReader(content[10:]), 0, &alice)
+	require.NoError(t, err)
+	assert.True(t, aliceFile.Finished())
+
+	bobFile, err := svc.GetFileByHash(ctx, hash, &bob)
+	require.NoError(t, err)
+	assert.False(t, bobFile.Finished())
+	assert.Equal(t, int64(5), bobFile.BytesReceived)
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/zqz/web/backend/internal/domain"
+	"github.com/zqz/web/backend/internal/telemetry"
+)
+
+const (
+	// unlockTTL is how long a successful password unlock stays valid
+	unlockTTL = time.Hour
+
+	// Failed unlock attempts per slug: a burst of 5, then one more per minute
+	unlockAttemptBurst  = 5
+	unlockAttemptRefill = time.Minute
+
+	maxFilePasswordLen = 72 // bcrypt ignores anything longer
+)
+
+// SetSigningSecret derives the keys used to sign unlock tokens and download URLs
+// from the server's session secret. Without it they are signed with random
+// per-process keys and stop working on restart.
+func (s *FileService) SetSigningSecret(secret string) {
+	s.unlockKey = deriveKey(secret, "file-unlock")
+	s.urlKey = deriveKey(secret, "signed-url")
+}
+
+// NeedsPassword reports whether the caller must unlock the file before accessing it.
+// Owners and moderators never need the password.
+func (s *FileService) NeedsPassword(file *domain.File, userID *int32, moderator bool) bool {
+	if !file.HasPassword() || moderator {
+		return false
+	}
+	return userID == nil || !file.IsOwnedBy(*userID)
+}
+
+// UnlockFile checks password against the file's share password and returns a signed
+// token proving the unlock, valid until the returned time. Failed attempts are
+// rate-limited per slug (ErrTooManyPasswordAttempts).
+func (s *FileService) UnlockFile(ctx context.Context, file *domain.File, password string) (string, time.Time, error) {
+	ctx, span := telemetry.Start(ctx, "FileService.UnlockFile")
+	defer span.End()
+
+	if !file.HasPassword() {
+		return "", time.Time{}, nil
+	}
+
+	// The attempt counts against the slug until the password turns out to be right
+	refund, ok := s.unlockLimiter.reserve(file.Slug)
+	if !ok {
+		return "", time.Time{}, ErrTooManyPasswordAttempts
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(*file.PasswordHash), []byte(password)); err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return "", time.Time{}, ErrWrongPassword
+		}
+		return "", time.Time{}, fmt.Errorf("failed to check password: %w", err)
+	}
+	refund()
+
+	expires := time.Now().UTC().Add(unlockTTL).Truncate(time.Second)
+	return s.signUnlock(file, expires), expires, nil
+}
+
+// ValidUnlockToken reports whether token was issued by UnlockFile for this file and
+// hasn't expired. Changing or removing the password invalidates existing tokens.
+func (s *FileService) ValidUnlockToken(file *domain.File, token string) bool {
+	if !file.HasPassword() {
+		return true
+	}
+	exp, _, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+	unix, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil {
+		return false
+	}
+	expires := time.Unix(unix, 0).UTC()
+	if !time.Now().Before(expires) {
+		return false
+	}
+	return hmac.Equal([]byte(token), []byte(s.signUnlock(file, expires)))
+}
+
+// signUnlock returns "<expiry unix>.<mac>", where the MAC covers the slug, the expiry
+// and the current password hash
+func (s *FileService) signUnlock(file *domain.File, expires time.Time) string {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	mac := hmac.New(sha256.New, s.unlockKey)
+	mac.Write([]byte(file.Slug + "\n" + exp + "\n" + *file.PasswordHash))
+	return exp + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// hashFilePassword returns the bcrypt hash to store for password, or nil when password is empty
+func hashFilePassword(password string) (*string, error) {
+	if password == "" {
+		return nil, nil
+	}
+	if len(password) > maxFilePasswordLen {
+		return nil, ErrPasswordTooLong
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+	h := string(hash)
+	return &h, nil
+}
+
+// deriveKey derives a purpose-specific signing key from a shared secret
+func deriveKey(secret, purpose string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+func randomKey() []byte {
+	key := make([]byte, sha256.Size)
+	rand.Read(key)
+	return key
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zqz/web/backend/internal/domain"
+)
+
+func TestFileServiceUnlockFile(t *testing.T) {
+	ctx := context.Background()
+	svc := NewFileService(nil, nil)
+	svc.SetSigningSecret("test-secret")
+
+	hash, err := hashFilePassword("hunter2")
+	require.NoError(t, err)
+	owner := int32(1)
+	file := &domain.File{Slug: "abc123", UserID: &owner, PasswordHash: hash}
+
+	other := int32(2)
+	assert.True(t, svc.NeedsPassword(file, nil, false))
+	assert.True(t, svc.NeedsPassword(file, &other, false))
+	assert.False(t, svc.NeedsPassword(file, &owner, false))
+	assert.False(t, svc.NeedsPassword(file, &other, true))
+
+	_, _, err = svc.UnlockFile(ctx, file, "wrong")
+	assert.ErrorIs(t, err, ErrWrongPassword)
+
+	token, _, err := svc.UnlockFile(ctx, file, "hunter2")
+	require.NoError(t, err)
+	assert.True(t, svc.ValidUnlockToken(file, token))
+	assert.False(t, svc.ValidUnlockToken(&domain.File{Slug: "other", PasswordHash: hash}, token))
+	assert.False(t, svc.ValidUnlockToken(file, "1.bogus"))
+
+	// Tokens from another server secret, or for an old password, don't verify
+	otherSvc := NewFileService(nil, nil)
+	assert.False(t, otherSvc.ValidUnlockToken(file, token))
+	newHash, err := hashFilePassword("correct horse")
+	require.NoError(t, err)
+	assert.False(t, svc.ValidUnlockToken(&domain.File{Slug: file.Slug, PasswordHash: newHash}, token))
+}
+
+func TestFileServiceUnlockFileRateLimit(t *testing.T) {
+	ctx := context.Background()
+	svc := NewFileService(nil, nil)
+
+	hash, err := hashFilePassword("hunter2")
+	require.NoError(t, err)
+	file := &domain.File{Slug: "limited", PasswordHash: hash}
+
+	for i := 0; i < unlockAttemptBurst; i++ {
+		_, _, err := svc.UnlockFile(ctx, file, "wrong")
+		require.ErrorIs(t, err, ErrWrongPassword)
+	}
+	_, _, err = svc.UnlockFile(ctx, file, "hunter2")
+	assert.ErrorIs(t, err, ErrTooManyPasswordAttempts)
+
+	// Other slugs are unaffected
+	_, _, err = svc.UnlockFile(ctx, &domain.File{Slug: "fresh", PasswordHash: hash}, "hunter2")
+	assert.NoError(t, err)
+}
+
+func TestFileServiceUnlockFileConcurrentGuesses(t *testing.T) {
+	ctx := context.Background()
+	svc := NewFileService(nil, nil)
+
+	hash, err := hashFilePassword("hunter2")
+	require.NoError(t, err)
+	file := &domain.File{Slug: "raced", PasswordHash: hash}
+
+	// Guesses sent at once still only get the burst between them
+	const guesses = 4 * unlockAttemptBurst
+	var wg sync.WaitGroup
+	errs := make(chan error, guesses)
+	for i := 0; i < guesses; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, err := svc.UnlockFile(ctx, file, "wrong")
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	wrong := 0
+	for err := range errs {
+		if errors.Is(err, ErrWrongPassword) {
+			wrong++
+		} else {
+			assert.ErrorIs(t, err, ErrTooManyPasswordAttempts)
+		}
+	}
+	assert.Equal(t, unlockAttemptBurst, wrong)
+}
+
+func TestFileServiceUnlockFileRightPasswordIsFree(t *testing.T) {
+	ctx := context.Background()
+	svc := NewFileService(nil, nil)
+
+	hash, err := hashFilePassword("hunter2")
+	require.NoError(t, err)
+	file := &domain.File{Slug: "free", PasswordHash: hash}
+
+	for i := 0; i < 2*unlockAttemptBurst; i++ {
+		_, _, err := svc.UnlockFile(ctx, file, "hunter2")
+		require.NoError(t, err)
+	}
+	for i := 0; i < unlockAttemptBurst; i++ {
+		_, _, err := svc.UnlockFile(ctx, file, "wrong")
+		require.ErrorIs(t, err, ErrWrongPassword)
+	}
+}
+
+func TestHashFilePassword(t *testing.T) {
+	hash, err := hashFilePassword("")
+	require.NoError(t, err)
+	assert.Nil(t, hash)
+
+	_, err = hashFilePassword(string(make([]byte, maxFilePasswordLen+1)))
+	assert.ErrorIs(t, err, ErrPasswordTooLong)
+}
@@ -9,10 +9,13 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/zqz/web/backend/internal/domain"
+	"github.com/zqz/web/backend/internal/metrics"
 	"github.com/zqz/web/backend/internal/repository"
 	"github.com/zqz/web/backend/internal/service/storage"
+	"github.com/zqz/web/backend/internal/telemetry"
 )
 
 var sha256HexRegex = regexp.MustCompile(`^[a-fA-F0-9]{64}$`)
@@ -28,6 +31,9 @@ var (
 	// ErrFileNotFound is returned when a file is not found
 	ErrFileNotFound = errors.New("file not found")
 
+	// ErrUserBanned is returned when a banned user tries to upload or change files
+	ErrUserBanned = errors.New("user is banned")
+
 	// ErrUnauthorized is returned when a user doesn't have access to a file
 	ErrUnauthorized = errors.New("unauthorized access to file")
 
@@ -37,6 +43,9 @@ var (
 	// ErrFileIncomplete is returned when trying to access an incomplete file
 	ErrFileIncomplete = errors.New("file upload incomplete")
 
+	// ErrPermissionDenied is returned when the caller's role lacks the permission an action needs
+	ErrPermissionDenied = errors.New("permission denied")
+
 	// ErrPublicUploadsDisabled is returned when anonymous uploads are disabled
 	ErrPublicUploadsDisabled = errors.New("public uploads are disabled")
 
@@ -51,6 +60,63 @@ var (
 
 	// ErrContentTypeTooLong is returned when content type exceeds max length
 	ErrContentTypeTooLong = errors.New("content type must be at most 80 characters")
+
+	// ErrFileExpired is returned when a file is past its expiry time or download limit
+	ErrFileExpired = errors.New("file has expired")
+
+	// ErrStorageQuotaExceeded is returned when a new file would take the user over their total storage quota
+	ErrStorageQuotaExceeded = errors.New("storage quota exceeded")
+
+	// ErrPasswordRequired is returned when a password-protected file is accessed without unlocking it
+	ErrPasswordRequired = errors.New("password required")
+
+	// ErrWrongPassword is returned when a file password doesn't match
+	ErrWrongPassword = errors.New("incorrect password")
+
+	// ErrTooManyPasswordAttempts is returned when a file has had too many recent failed unlock attempts
+	ErrTooManyPasswordAttempts = errors.New("too many password attempts, try again later")
+
+	// ErrPasswordTooLong is returned when a file password is longer than bcrypt can hash
+	ErrPasswordTooLong = errors.New("password must be at most 72 bytes")
+
+	// ErrInvalidSignature is returned when a signed download URL's signature doesn't verify
+	ErrInvalidSignature = errors.New("invalid download signature")
+
+	// ErrSignedURLExpired is returned when a signed download URL has expired or its single use is spent
+	ErrSignedURLExpired = errors.New("download link has expired")
+
+	// ErrInvalidSignedURLTTL is returned when a signed URL lifetime is out of range
+	ErrInvalidSignedURLTTL = errors.New("expires_in must be between 1 second and 7 days")
+
+	// ErrTusUploadNotFound is returned when a tus upload doesn't exist or belongs to someone else
+	ErrTusUploadNotFound = errors.New("upload not found")
+
+	// ErrTusOffsetMismatch is returned when a tus PATCH doesn't start at the upload's current offset
+	ErrTusOffsetMismatch = errors.New("upload offset does not match")
+
+	// ErrInvalidChunk is returned when a chunk's range falls outside the file
+	ErrInvalidChunk = errors.New("chunk range is outside the file")
+
+	// ErrChunkOverlap is returned when a chunk partly overlaps a different chunk that is already stored
+	ErrChunkOverlap = errors.New("chunk overlaps another chunk already received")
+
+	// ErrUploadInProgress is returned when another request is writing the same upload's data
+	ErrUploadInProgress = errors.New("another request is writing this upload")
+
+	// ErrIncompleteChunk is returned when a chunk's body is shorter than its declared length
+	ErrIncompleteChunk = errors.New("chunk is shorter than its declared length")
+
+	// ErrInvalidExpiry is returned when an expiry time is in the past or a download limit is not positive
+	ErrInvalidExpiry = errors.New("expiry must be in the future and max downloads must be positive")
+
+	// ErrUnknownProcessor is returned when naming a processor that isn't registered
+	ErrUnknownProcessor = errors.New("unknown processor")
+
+	// ErrNoThumbnail is returned when a file has no thumbnail (yet)
+	ErrNoThumbnail = errors.New("file has no thumbnail")
+
+	// ErrScrubRunning is returned when starting a storage scrub while another one is still running
+	ErrScrubRunning = errors.New("a storage scrub is already running")
 )
 
 // Processor defines the interface for file processing operations
@@ -64,27 +130,39 @@ type FileService struct {
 	repo       *repository.Repository
 	storage    storage.Storage
 	processors []Processor
+
+	unlockKey     []byte
+	urlKey        []byte
+	unlockLimiter *attemptLimiter // failed unlock attempts, keyed by slug
 }
 
 // NewFileService creates a new file service
 func NewFileService(repo *repository.Repository, storage storage.Storage) *FileService {
 	return &FileService{
-		repo:       repo,
-		storage:    storage,
-		processors: make([]Processor, 0),
+		repo:          repo,
+		storage:       telemetry.Storage(storage),
+		processors:    make([]Processor, 0),
+		unlockKey:     randomKey(),
+		urlKey:        randomKey(),
+		unlockLimiter: newAttemptLimiter(unlockAttemptBurst, unlockAttemptRefill),
 	}
 }
 
-// AddProcessor adds a processor to run on file uploads
+// AddProcessor adds a processor to run on file uploads. Processors run on the
+// job queue (see ProcessNextJob), not inside the upload request.
 func (s *FileService) AddProcessor(p Processor) {
 	s.processors = append(s.processors, p)
 }
 
-const settingDefaultMaxFileSize = "default_max_file_size"
+const (
+	settingDefaultMaxFileSize  = "default_max_file_size"
+	settingDefaultFileTTLHours = "default_file_ttl_hours"
+)
 
-// GetEffectiveMaxFileSize returns the max file size in bytes for the user. Returns 0 for no limit (admins).
-func (s *FileService) GetEffectiveMaxFileSize(ctx context.Context, userID *int32, isAdmin bool) (int64, error) {
-	if isAdmin {
+// GetEffectiveMaxFileSize returns the max file size in bytes for the user. Returns 0 for no limit
+// (unlimited: the user has domain.PermUnlimitedFiles).
+func (s *FileService) GetEffectiveMaxFileSize(ctx context.Context, userID *int32, unlimited bool) (int64, error) {
+	if unlimited {
 		return 0, nil
 	}
 	var max int64
@@ -113,16 +191,20 @@ func (s *FileService) GetEffectiveMaxFileSize(ctx context.Context, userID *int32
 }
 
 // CreateFile creates a new file metadata entry. maxFileSize is the effective limit (0 = no limit).
+// The record starts empty unless the caller already has a finished file with the same content;
+// content stored by other users is only shared once the caller has uploaded bytes that match it.
 func (s *FileService) CreateFile(ctx context.Context, req domain.CreateFileRequest, maxFileSize int64) (*domain.File, error) {
-	// If anonymous upload, check if public uploads are enabled
-	if req.UserID == nil {
-		val, err := s.repo.Settings.Get(ctx, "public_uploads_enabled")
-		if err != nil && !errors.Is(err, repository.ErrNotFound) {
-			return nil, fmt.Errorf("failed to check setting: %w", err)
-		}
-		if err != nil || val != "true" {
-			return nil, ErrPublicUploadsDisabled
-		}
+	ctx, span := telemetry.Start(ctx, "FileService.CreateFile")
+	defer span.End()
+
+	return s.createFile(ctx, req, maxFileSize, false)
+}
+
+// createFile is CreateFile. verified is set when the caller is known to hold the content
+// (this server hashed the data they sent), so stored content can be used without an upload.
+func (s *FileService) createFile(ctx context.Context, req domain.CreateFileRequest, maxFileSize int64, verified bool) (*domain.File, error) {
+	if err := s.checkCanUpload(ctx, req.UserID); err != nil {
+		return nil, err
 	}
 
 	// Validate request (includes SHA-256 hash format)
@@ -130,20 +212,27 @@ func (s *FileService) CreateFile(ctx context.Context, req domain.CreateFileReque
 		return nil, fmt.Errorf("invalid request: %w", err)
 	}
 
-	if maxFileSize > 0 && int64(req.Size) > maxFileSize {
+	if maxFileSize > 0 && req.Size > maxFileSize {
 		return nil, ErrFileTooLarge
 	}
 
-	// Check if file with this hash already exists
-	existing, err := s.repo.Files.GetByHash(ctx, req.Hash)
+	now := time.Now().UTC()
+	if (req.ExpiresAt != nil && !req.ExpiresAt.After(now)) || (req.MaxDownloads != nil && *req.MaxDownloads <= 0) {
+		return nil, ErrInvalidExpiry
+	}
+
+	// The same uploader retrying an unfinished upload resumes their existing record
+	existing, err := s.repo.Files.GetByHashAndUserID(ctx, req.Hash, req.UserID)
 	if err != nil && !errors.Is(err, repository.ErrNotFound) {
 		return nil, fmt.Errorf("failed to check existing file: %w", err)
 	}
-
-	if existing != nil {
-		// File already exists, return it
+	if existing != nil && existing.BytesReceived < existing.Size {
 		return dbFileToDoamin(existing), nil
 	}
+	// A signed-in user with a finished copy is known to hold the content
+	if existing != nil && req.UserID != nil {
+		verified = true
+	}
 
 	// Private, comment, slug: from settings/server, not from user request
 	private := false
@@ -160,31 +249,140 @@ func (s *FileService) CreateFile(ctx context.Context, req domain.CreateFileReque
 	}
 	slug := generateSlug(6)
 
-	// Create file in repository
-	dbFile, err := s.repo.Files.Create(ctx, repository.CreateFileParams{
-		Size:          req.Size,
-		Name:          req.Name,
-		Alias:         alias,
-		Hash:          req.Hash,
-		Slug:          slug,
-		ContentType:   req.ContentType,
-		UserID:        req.UserID,
-		Private:       private,
-		Comment:       comment,
-		BytesReceived: 0,
+	expiresAt := req.ExpiresAt
+	if expiresAt == nil {
+		ttl, err := s.defaultFileTTL(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if ttl > 0 {
+			t := now.Add(ttl)
+			expiresAt = &t
+		}
+	}
+
+	// The quota check, the blob reference and the file record are committed together,
+	// with processing queued in the same transaction if the content is already stored
+	var file *domain.File
+	err = s.repo.WithTransaction(ctx, func(ctx context.Context, repo *repository.Repository) error {
+		if req.UserID != nil {
+			if err := s.lockStorageQuota(ctx, repo, *req.UserID, req.Size); err != nil {
+				return err
+			}
+		}
+
+		// Every file record holds a reference on the content-addressed blob
+		blob, err := repo.Blobs.Acquire(ctx, req.Hash, req.Size)
+		if err != nil {
+			return fmt.Errorf("failed to acquire blob: %w", err)
+		}
+
+		// Anyone else uploads the data, which must hash to req.Hash before the record completes.
+		// Sizes that don't match the stored content can never verify.
+		var bytesReceived int64
+		if verified && blob.CompletedAt.Valid && blob.Size == req.Size {
+			bytesReceived = req.Size
+		}
+
+		dbFile, err := repo.Files.Create(ctx, repository.CreateFileParams{
+			Size:          req.Size,
+			Name:          req.Name,
+			Alias:         alias,
+			Hash:          req.Hash,
+			Slug:          slug,
+			ContentType:   req.ContentType,
+			UserID:        req.UserID,
+			Private:       private,
+			Comment:       comment,
+			BytesReceived: bytesReceived,
+			ExpiresAt:     pgTimestampFromPtr(expiresAt),
+			MaxDownloads:  req.MaxDownloads,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create file: %w", err)
+		}
+		file = dbFileToDoamin(dbFile)
+		if file.Finished() {
+			return s.enqueueProcessors(ctx, repo, file)
+		}
+		return nil
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to create file: %w", err)
+		return nil, err
 	}
 
-	return dbFileToDoamin(dbFile), nil
+	return file, nil
 }
 
-// UploadFileData uploads the actual file data. maxFileSize is the effective limit (0 = no limit).
-// Stops reading as soon as max size would be exceeded and deletes partial data on overflow or hash mismatch.
-func (s *FileService) UploadFileData(ctx context.Context, hash string, data io.Reader, maxFileSize int64) (*domain.File, error) {
+// checkCanUpload returns ErrUserBanned for banned users, ErrPermissionDenied for users whose
+// role can't upload and ErrPublicUploadsDisabled for anonymous uploads unless they are enabled
+func (s *FileService) checkCanUpload(ctx context.Context, userID *int32) error {
+	if userID != nil {
+		dbUser, err := s.repo.Users.GetByID(ctx, *userID)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return ErrUserNotFound
+			}
+			return fmt.Errorf("failed to get user: %w", err)
+		}
+		user := dbUserToDomain(dbUser)
+		if user.IsBanned(time.Now()) {
+			return ErrUserBanned
+		}
+		if !user.Can(domain.PermUploadFiles) {
+			return ErrPermissionDenied
+		}
+		return nil
+	}
+	val, err := s.repo.Settings.Get(ctx, "public_uploads_enabled")
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return fmt.Errorf("failed to check setting: %w", err)
+	}
+	if err != nil || val != "true" {
+		return ErrPublicUploadsDisabled
+	}
+	return nil
+}
+
+// checkCanManageFiles returns ErrUserBanned for banned users and ErrPermissionDenied for users
+// whose role can't manage their own files (domain.PermUploadFiles), such as read-only users.
+// Moderators act on files through domain.PermModerateFiles instead, so they skip the role check.
+func (s *FileService) checkCanManageFiles(ctx context.Context, userID *int32, moderator bool) error {
+	if userID == nil {
+		return nil
+	}
+	dbUser, err := s.repo.Users.GetByID(ctx, *userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrPermissionDenied
+		}
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	user := dbUserToDomain(dbUser)
+	if user.IsBanned(time.Now()) {
+		return ErrUserBanned
+	}
+	if !moderator && !user.Can(domain.PermUploadFiles) {
+		return ErrPermissionDenied
+	}
+	return nil
+}
+
+// UploadFileData appends file data to the caller's file record for hash.
+// maxFileSize is the effective limit (0 = no limit). Stops reading as soon as max size
+// would be exceeded, keeping the bytes that fit. Each record receives its own data, so
+// nothing another upload of the same hash sends can affect it. Returns ErrUploadInProgress
+// while another request is writing the record's data.
+func (s *FileService) UploadFileData(ctx context.Context, hash string, data io.Reader, maxFileSize int64, userID *int32) (*domain.File, error) {
+	ctx, span := telemetry.Start(ctx, "FileService.UploadFileData")
+	defer span.End()
+
+	if err := s.checkNotBanned(ctx, userID); err != nil {
+		return nil, err
+	}
+
 	// Get file metadata
-	dbFile, err := s.repo.Files.GetByHash(ctx, hash)
+	dbFile, err := s.repo.Files.GetByHashAndUserID(ctx, hash, userID)
 	if err != nil {
 		if errors.Is(err, repository.ErrNotFound) {
 			return nil, ErrFileNotFound
@@ -192,90 +390,140 @@ func (s *FileService) UploadFileData(ctx context.Context, hash string, data io.R
 		return nil, fmt.Errorf("failed to get file: %w", err)
 	}
 
-	file := dbFileToDoamin(dbFile)
-
-	// Check if already complete
-	if file.Finished() {
-		return file, nil
+	err = s.writeUpload(ctx, dbFile.ID, func(ctx context.Context, received int64) (int64, error) {
+		return s.appendFileData(ctx, dbFile.ID, dbFile.Size, data, maxFileSize, received)
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	remainingToDeclared := int64(file.Size) - int64(file.BytesReceived)
-	if remainingToDeclared <= 0 {
-		return file, nil
+	updatedFile, err := s.repo.Files.GetByID(ctx, dbFile.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file: %w", err)
 	}
 
+	return dbFileToDoamin(updatedFile), nil
+}
+
+// appendFileData appends data to a file record's received bytes, up to the file's size and
+// maxFileSize (0 = no limit), and returns how many bytes are stored afterwards
+func (s *FileService) appendFileData(ctx context.Context, fileID int32, size int64, data io.Reader, maxFileSize int64, received int64) (int64, error) {
+	remaining := size - received
+	if remaining <= 0 {
+		return received, nil
+	}
 	var reader io.Reader = data
 	if maxFileSize > 0 {
-		allowed := maxFileSize - int64(file.BytesReceived)
+		allowed := maxFileSize - received
 		if allowed <= 0 {
-			s.storage.Delete(hash)
-			_, _ = s.repo.Files.Update(ctx, repository.UpdateFileParams{ID: dbFile.ID, BytesReceived: ptrInt32(0)})
-			return nil, ErrFileTooLarge
+			return received, ErrFileTooLarge
 		}
-		limit := remainingToDeclared
-		if allowed < limit {
-			limit = allowed
-		}
-		reader = newMaxBytesReader(data, limit)
+		reader = newMaxBytesReader(data, min(remaining, allowed))
 	}
 
 	// Append data to storage
-	bytesWritten, err := s.storage.Append(hash, reader)
+	n, err := s.storage.Append(ctx, partialKey(fileID), reader)
+	received += n
 	if err != nil {
 		if errors.Is(err, ErrFileTooLarge) {
-			s.storage.Delete(hash)
-			_, _ = s.repo.Files.Update(ctx, repository.UpdateFileParams{ID: dbFile.ID, BytesReceived: ptrInt32(0)})
-			return nil, ErrFileTooLarge
+			return received, ErrFileTooLarge
 		}
-		return nil, fmt.Errorf("failed to write file data: %w", err)
+		return received, fmt.Errorf("failed to write file data: %w", err)
 	}
+	return received, nil
+}
 
-	file.BytesReceived += int32(bytesWritten)
-
-	// Update bytes_received in database
-	bytesReceived := file.BytesReceived
-	updatedFile, err := s.repo.Files.Update(ctx, repository.UpdateFileParams{
-		ID:            dbFile.ID,
-		BytesReceived: &bytesReceived,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to update bytes_received: %w", err)
+// completeUpload runs once every byte of file has been stored. It verifies the SHA-256,
+// starting the record over on a mismatch, then stores the data as the blob unless another
+// record got there first, gives the record its final slug and queues processing.
+// Callers hold the record's upload claim.
+func (s *FileService) completeUpload(ctx context.Context, file *repository.File) error {
+	key := partialKey(file.ID)
+	if err := s.storage.Finalize(ctx, key); err != nil {
+		return fmt.Errorf("failed to finalize file data: %w", err)
 	}
 
-	file = dbFileToDoamin(updatedFile)
+	if err := s.verifyFileHash(ctx, key, file.Hash); err != nil {
+		if errors.Is(err, ErrHashMismatch) {
+			metrics.UploadHashMismatches.Inc()
+			s.resetUpload(ctx, file.ID)
+		}
+		return err
+	}
 
-	// If upload is complete, verify SHA-256 and delete on mismatch
-	if file.Finished() {
-		if err := s.verifyFileHash(hash); err != nil {
-			s.storage.Delete(hash)
-			return nil, err
+	// The blob, the final slug and the processing jobs are committed together. The blob
+	// row stays locked until then, so only one upload of the content stores it.
+	err := s.repo.WithTransaction(ctx, func(ctx context.Context, repo *repository.Repository) error {
+		blob, err := repo.Blobs.GetForUpdate(ctx, file.Hash)
+		if err != nil {
+			return fmt.Errorf("failed to lock blob: %w", err)
+		}
+		if !blob.CompletedAt.Valid {
+			if err := s.storeBlob(ctx, key, file.Hash); err != nil {
+				return err
+			}
+			if err := repo.Blobs.MarkCompleted(ctx, file.Hash, file.Size); err != nil {
+				return fmt.Errorf("failed to mark blob completed: %w", err)
+			}
 		}
 
+		if err := repo.Files.SetBytesReceived(ctx, file.ID, file.Size); err != nil {
+			return fmt.Errorf("failed to update bytes_received: %w", err)
+		}
 		// Update slug now that file is complete
 		newSlug := generateSlug(6)
-		updatedFile, err = s.repo.Files.Update(ctx, repository.UpdateFileParams{
-			ID:   dbFile.ID,
+		updatedFile, err := repo.Files.Update(ctx, repository.UpdateFileParams{
+			ID:   file.ID,
 			Slug: &newSlug,
 		})
 		if err != nil {
-			return nil, fmt.Errorf("failed to update file slug: %w", err)
+			return fmt.Errorf("failed to update file slug: %w", err)
 		}
-		file = dbFileToDoamin(updatedFile)
 
-		// Run processors
-		if err := s.runProcessors(ctx, file); err != nil {
-			// Log error but don't fail the upload
-			// TODO: Add proper logging
-			fmt.Printf("processor error: %v\n", err)
-		}
+		// Processors run asynchronously on the job queue
+		return s.enqueueProcessors(ctx, repo, dbFileToDoamin(updatedFile))
+	})
+	if err != nil {
+		return err
 	}
 
-	return file, nil
+	s.storage.Delete(ctx, key) // Ignore errors
+	metrics.UploadsCompleted.Inc()
+	return nil
+}
+
+// storeBlob copies the verified data under key to the content-addressed key for hash,
+// replacing anything left there by an upload that never completed
+func (s *FileService) storeBlob(ctx context.Context, key, hash string) error {
+	reader, err := s.storage.Get(ctx, key)
+	if err != nil {
+		return fmt.Errorf("failed to open file data: %w", err)
+	}
+	defer reader.Close()
+
+	if err := s.storage.Delete(ctx, hash); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("failed to delete stale file data: %w", err)
+	}
+	if err := s.storage.Put(ctx, hash, reader); err != nil {
+		s.storage.Delete(ctx, hash)
+		return fmt.Errorf("failed to store file data: %w", err)
+	}
+	return nil
+}
+
+// resetUpload throws away everything received for a file record so its upload starts over
+func (s *FileService) resetUpload(ctx context.Context, fileID int32) {
+	s.storage.Delete(ctx, partialKey(fileID))
+	s.discardChunks(ctx, fileID)
+	_ = s.repo.Files.SetBytesReceived(ctx, fileID, 0)
 }
 
 // GetFileBySlug retrieves a file by its slug.
-// Access: guests see public only; users see public + their private; admins see all.
-func (s *FileService) GetFileBySlug(ctx context.Context, slug string, userID *int32, isAdmin bool) (*domain.File, error) {
+// Access: guests see public only; users see public + their private; moderators (domain.PermModerateFiles) see all.
+func (s *FileService) GetFileBySlug(ctx context.Context, slug string, userID *int32, moderator bool) (*domain.File, error) {
+	ctx, span := telemetry.Start(ctx, "FileService.GetFileBySlug")
+	defer span.End()
+
 	dbFile, err := s.repo.Files.GetBySlug(ctx, slug)
 	if err != nil {
 		if errors.Is(err, repository.ErrNotFound) {
@@ -285,27 +533,45 @@ func (s *FileService) GetFileBySlug(ctx context.Context, slug string, userID *in
 	}
 
 	file := dbFileToDoamin(dbFile)
-
-	// Get current size from storage
-	size, err := s.storage.Size(dbFile.Hash)
-	if err != nil && !errors.Is(err, storage.ErrNotFound) {
-		return nil, fmt.Errorf("failed to get file size: %w", err)
-	}
-	if err == nil {
-		file.BytesReceived = int32(size)
+	if err := s.loadProgress(ctx, file); err != nil {
+		return nil, err
 	}
 
-	// Admins can access everything; otherwise enforce guest/user visibility
-	if !isAdmin && !file.CanBeAccessedBy(userID) {
-		return nil, ErrUnauthorized
+	if err := s.checkAccess(ctx, file, userID, moderator); err != nil {
+		return nil, err
 	}
 
 	return file, nil
 }
 
-// GetFileByHash retrieves a file by its hash
-func (s *FileService) GetFileByHash(ctx context.Context, hash string) (*domain.File, error) {
-	dbFile, err := s.repo.Files.GetByHash(ctx, hash)
+// checkAccess returns ErrUnauthorized if the caller can't see file, or ErrFileNotFound
+// if it is hidden by its owner's ban
+func (s *FileService) checkAccess(ctx context.Context, file *domain.File, userID *int32, moderator bool) error {
+	// Moderators can access everything; otherwise enforce guest/user visibility
+	if moderator {
+		return nil
+	}
+	if !file.CanBeAccessedBy(userID) {
+		return ErrUnauthorized
+	}
+
+	// Files of a banned user may be hidden from everyone but them and moderators
+	hidden, err := s.hiddenByBan(ctx, file, userID)
+	if err != nil {
+		return err
+	}
+	if hidden {
+		return ErrFileNotFound
+	}
+	return nil
+}
+
+// GetFileByHash retrieves the caller's file record for a hash (anonymous callers see anonymous uploads)
+func (s *FileService) GetFileByHash(ctx context.Context, hash string, userID *int32) (*domain.File, error) {
+	ctx, span := telemetry.Start(ctx, "FileService.GetFileByHash")
+	defer span.End()
+
+	dbFile, err := s.repo.Files.GetByHashAndUserID(ctx, hash, userID)
 	if err != nil {
 		if errors.Is(err, repository.ErrNotFound) {
 			return nil, ErrFileNotFound
@@ -313,56 +579,127 @@ func (s *FileService) GetFileByHash(ctx context.Context, hash string) (*domain.F
 		return nil, fmt.Errorf("failed to get file: %w", err)
 	}
 
-	// Get current size from storage
-	size, err := s.storage.Size(hash)
-	if err != nil && !errors.Is(err, storage.ErrNotFound) {
-		return nil, fmt.Errorf("failed to get file size: %w", err)
-	}
-
 	file := dbFileToDoamin(dbFile)
-	if err == nil {
-		file.BytesReceived = int32(size)
+	if err := s.loadProgress(ctx, file); err != nil {
+		return nil, err
+	}
+	if !file.Finished() {
+		if file.ReceivedRanges, err = s.receivedRanges(ctx, file); err != nil {
+			return nil, err
+		}
 	}
 
 	return file, nil
 }
 
-// DownloadFile returns a reader for downloading the file data
-func (s *FileService) DownloadFile(ctx context.Context, slug string, userID *int32, isAdmin bool) (io.ReadCloser, *domain.File, error) {
+// loadProgress sets BytesReceived of an unfinished file to the size of its stored data
+func (s *FileService) loadProgress(ctx context.Context, file *domain.File) error {
+	if file.Finished() {
+		return nil
+	}
+	size, err := s.storedSize(ctx, partialKey(file.ID))
+	if err != nil {
+		return err
+	}
+	file.BytesReceived = size
+	return nil
+}
+
+// DownloadFile returns a seekable reader for downloading the file data
+func (s *FileService) DownloadFile(ctx context.Context, slug string, userID *int32, moderator bool) (io.ReadSeekCloser, *domain.File, error) {
+	ctx, span := telemetry.Start(ctx, "FileService.DownloadFile")
+	defer span.End()
+
 	// Get file metadata and check permissions
-	file, err := s.GetFileBySlug(ctx, slug, userID, isAdmin)
+	file, err := s.GetFileBySlug(ctx, slug, userID, moderator)
 	if err != nil {
 		return nil, nil, err
 	}
 
+	if err := checkDownloadable(file); err != nil {
+		return nil, nil, err
+	}
+
+	reader, err := s.openFile(ctx, file)
+	if err != nil {
+		return nil, nil, err
+	}
+	return reader, file, nil
+}
+
+// checkDownloadable returns an error if the file can't be downloaded yet or any more
+func checkDownloadable(file *domain.File) error {
 	// Check if file is complete
 	if !file.Finished() {
-		return nil, nil, ErrFileIncomplete
+		return ErrFileIncomplete
 	}
 
-	// Get file data from storage
-	reader, err := s.storage.Get(file.Hash)
+	if file.IsExpired(time.Now().UTC()) {
+		return ErrFileExpired
+	}
+	return nil
+}
+
+// openFile returns a reader for the file's data from storage. The reader is used until the
+// response has been sent, which can outlast the API's short deadline for looking the file up,
+// so it keeps ctx's values but not its cancellation; closing it ends the read.
+func (s *FileService) openFile(ctx context.Context, file *domain.File) (io.ReadSeekCloser, error) {
+	reader, err := s.storage.Get(context.WithoutCancel(ctx), file.Hash)
 	if err != nil {
 		if errors.Is(err, storage.ErrNotFound) {
-			return nil, nil, ErrFileNotFound
+			return nil, ErrFileNotFound
 		}
-		return nil, nil, fmt.Errorf("failed to get file data: %w", err)
+		return nil, fmt.Errorf("failed to get file data: %w", err)
 	}
+	return reader, nil
+}
 
-	return reader, file, nil
+// RecordDownload meters a download of bytes of file against its download limit, which allows
+// max_downloads times the file's size in total. Resumes and ranged requests are charged for
+// what they fetch, so they add up to one download rather than each counting as one or none.
+// A response without content still costs a byte, so empty files can't be fetched forever.
+// Returns ErrFileExpired if the bytes don't fit in what's left of the limit.
+func (s *FileService) RecordDownload(ctx context.Context, file *domain.File, bytes int64) error {
+	ctx, span := telemetry.Start(ctx, "FileService.RecordDownload")
+	defer span.End()
+
+	count, err := s.repo.Files.AddBytesServed(ctx, file.ID, max(bytes, 1))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrFileExpired
+		}
+		return fmt.Errorf("failed to record download: %w", err)
+	}
+	file.DownloadCount = count
+	return nil
+}
+
+// RefundDownload gives back bytes recorded by RecordDownload that were never sent,
+// e.g. because the client went away mid-transfer and will resume later.
+func (s *FileService) RefundDownload(ctx context.Context, file *domain.File, bytes int64) error {
+	ctx, span := telemetry.Start(ctx, "FileService.RefundDownload")
+	defer span.End()
+
+	if err := s.repo.Files.RefundBytesServed(ctx, file.ID, bytes); err != nil {
+		return fmt.Errorf("failed to refund download: %w", err)
+	}
+	return nil
 }
 
 // ListFiles returns a paginated list of files visible to the caller.
 // If search is non-empty, filters by fuzzy match on name, alias, and comment (case-insensitive, via pg_trgm).
-// Admins see all files; logged-in users see public files + their own; guests see only public.
-func (s *FileService) ListFiles(ctx context.Context, limit, offset int32, userID *int32, isAdmin bool, search string) ([]*domain.File, error) {
+// Moderators see all files; logged-in users see public files + their own; guests see only public.
+func (s *FileService) ListFiles(ctx context.Context, limit, offset int32, userID *int32, moderator bool, search string) ([]*domain.File, error) {
+	ctx, span := telemetry.Start(ctx, "FileService.ListFiles")
+	defer span.End()
+
 	search = strings.TrimSpace(search)
 
 	var dbFiles []*repository.File
 	var err error
 
 	if search != "" {
-		if isAdmin {
+		if moderator {
 			dbFiles, err = s.repo.Files.SearchFiles(ctx, search, limit, offset)
 		} else if userID != nil {
 			dbFiles, err = s.repo.Files.SearchFilesVisibleToUser(ctx, *userID, search, limit, offset)
@@ -370,7 +707,7 @@ func (s *FileService) ListFiles(ctx context.Context, limit, offset int32, userID
 			dbFiles, err = s.repo.Files.SearchPublicFiles(ctx, search, limit, offset)
 		}
 	} else {
-		if isAdmin {
+		if moderator {
 			dbFiles, err = s.repo.Files.List(ctx, limit, offset)
 		} else if userID != nil {
 			dbFiles, err = s.repo.Files.ListVisibleToUser(ctx, *userID, limit, offset)
@@ -393,6 +730,9 @@ func (s *FileService) ListFiles(ctx context.Context, limit, offset int32, userID
 
 // ListFilesByUserID returns a paginated list of files belonging to a specific user (for user profile / admin list).
 func (s *FileService) ListFilesByUserID(ctx context.Context, userID int32, limit, offset int32) ([]*domain.File, error) {
+	ctx, span := telemetry.Start(ctx, "FileService.ListFilesByUserID")
+	defer span.End()
+
 	dbFiles, err := s.repo.Files.ListByUserID(ctx, userID, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list files by user: %w", err)
@@ -409,21 +749,65 @@ type UpdateFileRequest struct {
 	Name    *string
 	Private *bool
 	Comment *string
+
+	// Password sets the share password; "" removes it
+	Password *string
+
+	// ExpiresAt sets the expiry time; a zero time clears it
+	ExpiresAt *time.Time
+	// MaxDownloads sets the download limit; 0 clears it
+	MaxDownloads *int32
 }
 
-// UpdateFile updates file metadata. Owners and admins can update.
-func (s *FileService) UpdateFile(ctx context.Context, slug string, req UpdateFileRequest, userID *int32, isAdmin bool) (*domain.File, error) {
+// UpdateFile updates file metadata. Owners and moderators can update.
+func (s *FileService) UpdateFile(ctx context.Context, slug string, req UpdateFileRequest, userID *int32, moderator bool) (*domain.File, error) {
+	ctx, span := telemetry.Start(ctx, "FileService.UpdateFile")
+	defer span.End()
+
+	if err := s.checkCanManageFiles(ctx, userID, moderator); err != nil {
+		return nil, err
+	}
+
 	// Get file to check ownership
-	file, err := s.GetFileBySlug(ctx, slug, userID, isAdmin)
+	file, err := s.GetFileBySlug(ctx, slug, userID, moderator)
 	if err != nil {
 		return nil, err
 	}
 
-	// Check if user owns the file or is admin
-	if userID == nil || (!file.IsOwnedBy(*userID) && !isAdmin) {
+	// Check if user owns the file or is a moderator
+	if userID == nil || (!file.IsOwnedBy(*userID) && !moderator) {
 		return nil, ErrUnauthorized
 	}
 
+	// Validate everything before writing anything
+	setExpiry := req.ExpiresAt != nil || req.MaxDownloads != nil
+	expiresAt, maxDownloads := file.ExpiresAt, file.MaxDownloads
+	if req.ExpiresAt != nil {
+		expiresAt = nil
+		if !req.ExpiresAt.IsZero() {
+			if !req.ExpiresAt.After(time.Now().UTC()) {
+				return nil, ErrInvalidExpiry
+			}
+			expiresAt = req.ExpiresAt
+		}
+	}
+	if req.MaxDownloads != nil {
+		maxDownloads = nil
+		if *req.MaxDownloads < 0 {
+			return nil, ErrInvalidExpiry
+		}
+		if *req.MaxDownloads > 0 {
+			maxDownloads = req.MaxDownloads
+		}
+	}
+
+	var passwordHash *string
+	if req.Password != nil {
+		if passwordHash, err = hashFilePassword(*req.Password); err != nil {
+			return nil, err
+		}
+	}
+
 	// Update file metadata
 	updateParams := repository.UpdateFileParams{
 		ID: file.ID,
@@ -439,64 +823,161 @@ func (s *FileService) UpdateFile(ctx context.Context, slug string, req UpdateFil
 		updateParams.Comment = req.Comment
 	}
 
-	dbFile, err := s.repo.Files.Update(ctx, updateParams)
+	// The changes and their audit event are committed together
+	var updated *domain.File
+	err = s.repo.WithTransaction(ctx, func(ctx context.Context, repo *repository.Repository) error {
+		dbFile, err := repo.Files.Update(ctx, updateParams)
+		if err != nil {
+			return fmt.Errorf("failed to update file: %w", err)
+		}
+
+		if setExpiry {
+			dbFile, err = repo.Files.SetExpiry(ctx, repository.SetFileExpiryParams{
+				ID:           file.ID,
+				ExpiresAt:    pgTimestampFromPtr(expiresAt),
+				MaxDownloads: maxDownloads,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to update file expiry: %w", err)
+			}
+		}
+
+		if req.Password != nil {
+			dbFile, err = repo.Files.SetPassword(ctx, file.ID, passwordHash)
+			if err != nil {
+				return fmt.Errorf("failed to update file password: %w", err)
+			}
+		}
+
+		updated = dbFileToDoamin(dbFile)
+		return recordAudit(ctx, repo, domain.AuditFileUpdate, domain.AuditTargetFile, strconv.Itoa(int(file.ID)),
+			fileAccessState(file), fileAccessState(updated))
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to update file: %w", err)
+		return nil, err
 	}
+	return updated, nil
+}
 
-	return dbFileToDoamin(dbFile), nil
+// fileAccessState is the part of a file the audit log tracks on update: who can
+// download it and for how long. Renames and comments aren't audited.
+func fileAccessState(f *domain.File) map[string]any {
+	return map[string]any{
+		"private":       f.Private,
+		"password":      f.PasswordHash != nil,
+		"expires_at":    f.ExpiresAt,
+		"max_downloads": f.MaxDownloads,
+	}
 }
 
 // DeleteFile deletes a file and its data
-func (s *FileService) DeleteFile(ctx context.Context, slug string, userID *int32, isAdmin bool) error {
+func (s *FileService) DeleteFile(ctx context.Context, slug string, userID *int32, moderator bool) error {
+	ctx, span := telemetry.Start(ctx, "FileService.DeleteFile")
+	defer span.End()
+
+	if err := s.checkCanManageFiles(ctx, userID, moderator); err != nil {
+		return err
+	}
+
 	// Get file to check ownership
-	file, err := s.GetFileBySlug(ctx, slug, userID, isAdmin)
+	file, err := s.GetFileBySlug(ctx, slug, userID, moderator)
 	if err != nil {
 		return err
 	}
 
-	// Check if user owns the file or is admin
-	if userID == nil || (!file.IsOwnedBy(*userID) && !isAdmin) {
+	// Check if user owns the file or is a moderator
+	if userID == nil || (!file.IsOwnedBy(*userID) && !moderator) {
 		return ErrUnauthorized
 	}
 
-	// Delete thumbnail from database first (to avoid FK constraint violation)
-	if err := s.repo.Thumbnails.DeleteByFileID(ctx, file.ID); err != nil {
-		return fmt.Errorf("failed to delete thumbnail metadata: %w", err)
+	return s.purgeFile(ctx, file, func(ctx context.Context, repo *repository.Repository) error {
+		return recordAudit(ctx, repo, domain.AuditFileDelete, domain.AuditTargetFile, strconv.Itoa(int(file.ID)), map[string]any{
+			"slug":    file.Slug,
+			"name":    file.Name,
+			"hash":    file.Hash,
+			"user_id": file.UserID,
+			"private": file.Private,
+		}, nil)
+	})
+}
+
+// purgeFile removes a file's thumbnails and database row, and the stored data once no
+// other file record references the same blob. The rows are deleted in one transaction,
+// along with anything record writes (such as an audit event), and stored data is only
+// deleted once it commits. record may be nil.
+func (s *FileService) purgeFile(ctx context.Context, file *domain.File, record func(ctx context.Context, repo *repository.Repository) error) error {
+	// Discard data received for the record itself
+	s.storage.Delete(ctx, partialKey(file.ID)) // Ignore errors
+	s.discardChunks(ctx, file.ID)
+
+	var unusedThumbnails []string
+	deleteData := false
+	err := s.repo.WithTransaction(ctx, func(ctx context.Context, repo *repository.Repository) error {
+		thumbnails, err := repo.Thumbnails.ListByFileID(ctx, file.ID)
+		if err != nil {
+			return fmt.Errorf("failed to list thumbnails: %w", err)
+		}
+
+		// Delete thumbnail from database first (to avoid FK constraint violation)
+		if err := repo.Thumbnails.DeleteByFileID(ctx, file.ID); err != nil {
+			return fmt.Errorf("failed to delete thumbnail metadata: %w", err)
+		}
+
+		// Thumbnail data is kept while another file has an identical thumbnail
+		for _, t := range thumbnails {
+			if n, err := repo.Thumbnails.CountByHash(ctx, t.Hash); err == nil && n == 0 {
+				unusedThumbnails = append(unusedThumbnails, t.Hash)
+			}
+		}
+
+		// Delete file from database
+		if err := repo.Files.Delete(ctx, file.ID); err != nil {
+			return fmt.Errorf("failed to delete file metadata: %w", err)
+		}
+
+		refs, err := repo.Blobs.Release(ctx, file.Hash)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return fmt.Errorf("failed to release blob: %w", err)
+		}
+		// Untracked hashes have no blob row to keep their data alive
+		deleteData = err != nil
+		if err == nil && refs == 0 {
+			// Not deleted when re-acquired by a concurrent upload
+			if deleteData, err = repo.Blobs.DeleteUnreferenced(ctx, file.Hash); err != nil {
+				return fmt.Errorf("failed to delete blob: %w", err)
+			}
+		}
+
+		if record != nil {
+			return record(ctx, repo)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
-	// Delete thumbnail from storage if exists
-	if file.Thumbnail != nil {
-		s.storage.Delete(file.Thumbnail.Hash) // Ignore errors
+	for _, hash := range unusedThumbnails {
+		s.storage.Delete(ctx, hash) // Ignore errors
+	}
+	if !deleteData {
+		return nil
 	}
 
 	// Delete file from storage (ignore not found errors)
-	if err := s.storage.Delete(file.Hash); err != nil && !errors.Is(err, storage.ErrNotFound) {
+	if err := s.storage.Delete(ctx, file.Hash); err != nil && !errors.Is(err, storage.ErrNotFound) {
 		return fmt.Errorf("failed to delete file data: %w", err)
 	}
 
-	// Delete file from database
-	if err := s.repo.Files.Delete(ctx, file.ID); err != nil {
-		return fmt.Errorf("failed to delete file metadata: %w", err)
-	}
-
 	return nil
 }
 
-// verifyFileHash verifies that the stored file contents match the claimed SHA-256 hash
-func (s *FileService) verifyFileHash(hash string) error {
-	reader, err := s.storage.Get(hash)
+// verifyFileHash verifies that the data stored under key matches the claimed SHA-256 hash
+func (s *FileService) verifyFileHash(ctx context.Context, key, hash string) error {
+	calculatedHash, err := s.storedSHA256(ctx, key)
 	if err != nil {
-		return fmt.Errorf("failed to open file for verification: %w", err)
-	}
-	defer reader.Close()
-
-	h := sha256.New()
-	if _, err := io.Copy(h, reader); err != nil {
-		return fmt.Errorf("failed to read file for verification: %w", err)
+		return err
 	}
-
-	calculatedHash := fmt.Sprintf("%x", h.Sum(nil))
 	if calculatedHash != hash {
 		return ErrHashMismatch
 	}
@@ -504,31 +985,42 @@ func (s *FileService) verifyFileHash(hash string) error {
 	return nil
 }
 
-// runProcessors runs all registered processors on the file
-func (s *FileService) runProcessors(ctx context.Context, file *domain.File) error {
-	for _, p := range s.processors {
-		if err := p.Process(ctx, file, s.storage, s.repo); err != nil {
-			return fmt.Errorf("processor %s failed: %w", p.Name(), err)
-		}
+// storedSHA256 returns the hex SHA-256 of the data stored under key
+func (s *FileService) storedSHA256(ctx context.Context, key string) (string, error) {
+	reader, err := s.storage.Get(ctx, key)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file for verification: %w", err)
 	}
-	return nil
+	defer reader.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, reader); err != nil {
+		return "", fmt.Errorf("failed to read file for verification: %w", err)
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
 }
 
 // Helper functions
 
 func validateCreateFileRequest(req domain.CreateFileRequest) error {
-	if req.Name == "" {
-		return errors.New("name is required")
-	}
-	if len(req.Name) > maxNameLen {
-		return ErrNameTooLong
-	}
 	if req.Hash == "" {
 		return errors.New("hash is required")
 	}
 	if len(req.Hash) != sha256HexLen || !sha256HexRegex.MatchString(req.Hash) {
 		return ErrInvalidHash
 	}
+	return validateFileFields(req)
+}
+
+// validateFileFields checks everything in a create request except the hash
+func validateFileFields(req domain.CreateFileRequest) error {
+	if req.Name == "" {
+		return errors.New("name is required")
+	}
+	if len(req.Name) > maxNameLen {
+		return ErrNameTooLong
+	}
 	if req.Size <= 0 {
 		return errors.New("size must be greater than 0")
 	}
@@ -554,7 +1046,17 @@ func newMaxBytesReader(r io.Reader, max int64) *maxBytesReader {
 
 func (m *maxBytesReader) Read(p []byte) (n int, err error) {
 	if m.n >= m.max {
-		return 0, ErrFileTooLarge
+		// Data that exactly fills the limit is fine; only fail if there is more
+		var probe [1]byte
+		for {
+			n, err := m.r.Read(probe[:])
+			if n > 0 {
+				return 0, ErrFileTooLarge
+			}
+			if err != nil {
+				return 0, err
+			}
+		}
 	}
 	limit := int(m.max - m.n)
 	if len(p) > limit {
@@ -565,7 +1067,21 @@ func (m *maxBytesReader) Read(p []byte) (n int, err error) {
 	return n, err
 }
 
-func ptrInt32(x int32) *int32 { return &x }
+// defaultFileTTL returns the site-wide default lifetime for new uploads (0 = keep forever)
+func (s *FileService) defaultFileTTL(ctx context.Context) (time.Duration, error) {
+	val, err := s.repo.Settings.Get(ctx, settingDefaultFileTTLHours)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to get setting: %w", err)
+	}
+	hours, err := strconv.ParseInt(val, 10, 64)
+	if err != nil || hours <= 0 {
+		return 0, nil
+	}
+	return time.Duration(hours) * time.Hour, nil
+}
 
 // dbFileToDoamin converts a repository file to a domain file
 func dbFileToDoamin(f *repository.File) *domain.File {
@@ -583,5 +1099,9 @@ func dbFileToDoamin(f *repository.File) *domain.File {
 		Private:       f.Private,
 		Comment:       f.Comment,
 		BytesReceived: f.BytesReceived,
+		ExpiresAt:     timePtrFromPgType(f.ExpiresAt),
+		MaxDownloads:  f.MaxDownloads,
+		DownloadCount: f.DownloadCount,
+		PasswordHash:  f.PasswordHash,
 	}
 }
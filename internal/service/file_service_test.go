@@ -3,7 +3,6 @@ package service
 import (
 	"bytes"
 	"context"
-	"crypto/sha256"
 	"fmt"
 	"io"
 	"testing"
@@ -61,7 +60,7 @@ func TestFileServiceCreateFile(t *testing.T) {
 	assert.Equal(t, "test.txt", file.Name)
 	assert.Equal(t, testHash1, file.Hash)
 	assert.NotEmpty(t, file.Slug)
-	assert.Equal(t, int32(100), file.Size)
+	assert.Equal(t, int64(100), file.Size)
 	assert.Equal(t, contentTypePlain, file.ContentType)
 }
 
@@ -118,13 +117,12 @@ func TestFileServiceUploadFileData(t *testing.T) {
 
 	// Create file metadata
 	content := []byte("hello world")
-	sum := sha256.Sum256(content)
-	hash := fmt.Sprintf("%x", sum[:])
+	hash := sha256Hex(content)
 
 	file, err := svc.CreateFile(ctx, domain.CreateFileRequest{
 		Name:        "upload.txt",
 		Hash:        hash,
-		Size:        int32(len(content)),
+		Size:        int64(len(content)),
 		ContentType: contentTypePlain,
 		UserID:      nil,
 		Private:     false,
@@ -134,11 +132,11 @@ func TestFileServiceUploadFileData(t *testing.T) {
 
 	// Upload data
 	reader := bytes.NewReader(content)
-	uploadedFile, err := svc.UploadFileData(ctx, hash, reader, 0)
+	uploadedFile, err := svc.UploadFileData(ctx, hash, reader, 0, nil)
 	require.NoError(t, err)
 
 	assert.True(t, uploadedFile.Finished())
-	assert.Equal(t, int32(len(content)), uploadedFile.BytesReceived)
+	assert.Equal(t, int64(len(content)), uploadedFile.BytesReceived)
 	assert.NotEqual(t, file.Slug, uploadedFile.Slug) // Slug should be updated
 }
 
@@ -155,13 +153,12 @@ func TestFileServiceUploadFileDataChunked(t *testing.T) {
 
 	// Create file metadata
 	content := []byte("hello world")
-	sum := sha256.Sum256(content)
-	hash := fmt.Sprintf("%x", sum[:])
+	hash := sha256Hex(content)
 
 	_, err = svc.CreateFile(ctx, domain.CreateFileRequest{
 		Name:        "chunked.txt",
 		Hash:        hash,
-		Size:        int32(len(content)),
+		Size:        int64(len(content)),
 		ContentType: contentTypePlain,
 		UserID:      nil,
 		Private:     false,
@@ -171,16 +168,62 @@ func TestFileServiceUploadFileDataChunked(t *testing.T) {
 
 	// Upload in chunks
 	chunk1 := bytes.NewReader(content[:5])
-	file1, err := svc.UploadFileData(ctx, hash, chunk1, 0)
+	file1, err := svc.UploadFileData(ctx, hash, chunk1, 0, nil)
 	require.NoError(t, err)
 	assert.False(t, file1.Finished())
-	assert.Equal(t, int32(5), file1.BytesReceived)
+	assert.Equal(t, int64(5), file1.BytesReceived)
 
 	chunk2 := bytes.NewReader(content[5:])
-	file2, err := svc.UploadFileData(ctx, hash, chunk2, 0)
+	file2, err := svc.UploadFileData(ctx, hash, chunk2, 0, nil)
 	require.NoError(t, err)
 	assert.True(t, file2.Finished())
-	assert.Equal(t, int32(len(content)), file2.BytesReceived)
+	assert.Equal(t, int64(len(content)), file2.BytesReceived)
+}
+
+func TestFileServiceUploadFileDataChunkedOver2GiB(t *testing.T) {
+	if testing.Short() {
+		t.Skip("hashes several GiB")
+	}
+
+	ctx := context.Background()
+	pg, cleanup := tests.SetupTestDB(t, ctx)
+	defer cleanup()
+
+	repo := repository.NewRepository(pg.Pool)
+	svc := NewFileService(repo, tests.NewSparseStorage())
+
+	// Just past what an int32 could hold
+	const chunk = int64(1 << 30)
+	size := 2*chunk + 5*1024*1024
+	hash := tests.ZeroSHA256(size)
+
+	file, err := svc.CreateFile(ctx, domain.CreateFileRequest{
+		Name:        "huge.bin",
+		Hash:        hash,
+		Size:        size,
+		ContentType: "application/octet-stream",
+	}, 0) // admins have no limit
+	require.NoError(t, err)
+	assert.Equal(t, size, file.Size)
+
+	uploaded, err := svc.UploadFileData(ctx, hash, tests.ZeroReader(chunk), 0, nil)
+	require.NoError(t, err)
+	assert.Equal(t, chunk, uploaded.BytesReceived)
+
+	uploaded, err = svc.UploadFileData(ctx, hash, tests.ZeroReader(chunk), 0, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2*chunk, uploaded.BytesReceived)
+	assert.False(t, uploaded.Finished())
+
+	uploaded, err = svc.UploadFileData(ctx, hash, tests.ZeroReader(size-2*chunk), 0, nil)
+	require.NoError(t, err)
+	assert.True(t, uploaded.Finished())
+	assert.Equal(t, size, uploaded.BytesReceived)
+
+	got, err := svc.GetFileBySlug(ctx, uploaded.Slug, nil, false)
+	require.NoError(t, err)
+	assert.Equal(t, size, got.Size)
+	assert.Equal(t, size, got.BytesReceived)
 }
 
 func TestFileServiceGetFileBySlugPublic(t *testing.T) {
@@ -312,23 +355,7 @@ func TestFileServiceDownloadFile(t *testing.T) {
 
 	// Create and upload file
 	content := []byte("download me")
-	sum := sha256.Sum256(content)
-	hash := fmt.Sprintf("%x", sum[:])
-
-	created, err := svc.CreateFile(ctx, domain.CreateFileRequest{
-		Name:        "download.txt",
-		Hash:        hash,
-		Size:        int32(len(content)),
-		ContentType: contentTypePlain,
-		UserID:      nil,
-		Private:     false,
-		Comment:     "",
-	}, 0)
-	require.NoError(t, err)
-
-	// Upload data
-	uploaded, err := svc.UploadFileData(ctx, hash, bytes.NewReader(content), 0)
-	require.NoError(t, err)
+	uploaded := uploadTestFile(t, ctx, svc, content, domain.CreateFileRequest{Name: "download.txt"})
 
 	// Download file (use updated slug from upload)
 	reader, file, err := svc.DownloadFile(ctx, uploaded.Slug, nil, false)
@@ -339,7 +366,7 @@ func TestFileServiceDownloadFile(t *testing.T) {
 	downloaded, err := io.ReadAll(reader)
 	require.NoError(t, err)
 	assert.Equal(t, content, downloaded)
-	assert.Equal(t, created.Hash, file.Hash)
+	assert.Equal(t, uploaded.Hash, file.Hash)
 }
 
 func TestFileServiceListFilesPublic(t *testing.T) {
@@ -398,3 +425,13 @@ func TestFileServiceListFilesPublic(t *testing.T) {
 	require.NoError(t, err)
 	assert.Len(t, files, 3) // Only public files
 }
+
+func TestMaxBytesReader(t *testing.T) {
+	// Exactly max bytes is fine even when EOF only comes on the next read
+	data, err := io.ReadAll(newMaxBytesReader(io.LimitReader(bytes.NewReader([]byte("hello")), 5), 5))
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+
+	_, err = io.ReadAll(newMaxBytesReader(bytes.NewReader([]byte("hello!")), 5))
+	assert.ErrorIs(t, err, ErrFileTooLarge)
+}
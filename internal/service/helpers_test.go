@@ -0,0 +1,53 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zqz/web/backend/internal/domain"
+	"github.com/zqz/web/backend/internal/repository"
+)
+
+func createTestUser(t *testing.T, ctx context.Context, repo *repository.Repository, name string) int32 {
+	t.Helper()
+	user, err := repo.Users.Create(ctx, repository.CreateUserParams{
+		Name:       name,
+		Email:      name + "@example.com",
+		Provider:   testProviderGoogle,
+		ProviderID: name + "-id",
+		Role:       testRoleMember,
+	})
+	require.NoError(t, err)
+	return user.ID
+}
+
+// sha256Hex returns the hex SHA-256 files with content are stored under
+func sha256Hex(content []byte) string {
+	sum := sha256.Sum256(content)
+	return fmt.Sprintf("%x", sum[:])
+}
+
+// uploadTestFile creates a file record for content from req, filling in its hash and size
+// (and a name and content type if unset), then uploads the data as req.UserID
+func uploadTestFile(t *testing.T, ctx context.Context, svc *FileService, content []byte, req domain.CreateFileRequest) *domain.File {
+	t.Helper()
+	req.Hash = sha256Hex(content)
+	req.Size = int64(len(content))
+	if req.Name == "" {
+		req.Name = "test.txt"
+	}
+	if req.ContentType == "" {
+		req.ContentType = contentTypePlain
+	}
+
+	_, err := svc.CreateFile(ctx, req, 0)
+	require.NoError(t, err)
+	file, err := svc.UploadFileData(ctx, req.Hash, bytes.NewReader(content), 0, req.UserID)
+	require.NoError(t, err)
+	require.True(t, file.Finished())
+	return file
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/zqz/web/backend/internal/domain"
+	"github.com/zqz/web/backend/internal/repository"
+	"github.com/zqz/web/backend/internal/telemetry"
+)
+
+var (
+	// ErrIdentityNotFound is returned when an identity does not exist or belongs to another user
+	ErrIdentityNotFound = errors.New("identity not found")
+
+	// ErrIdentityInUse is returned when linking an identity that already signs in another user
+	ErrIdentityInUse = errors.New("identity is already linked to another user")
+
+	// ErrLastIdentity is returned when unlinking would leave a user with no way to sign in
+	ErrLastIdentity = errors.New("cannot unlink the only way to sign in")
+)
+
+// ListIdentities returns the identities a user can sign in with, oldest first
+func (s *UserService) ListIdentities(ctx context.Context, userID int32) ([]*domain.Identity, error) {
+	ctx, span := telemetry.Start(ctx, "UserService.ListIdentities")
+	defer span.End()
+
+	rows, err := s.repo.Identities.ListByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list identities: %w", err)
+	}
+	identities := make([]*domain.Identity, len(rows))
+	for i, row := range rows {
+		identities[i] = dbIdentityToDomain(row)
+	}
+	return identities, nil
+}
+
+// LinkIdentity lets userID also sign in with a provider account. Linking an identity the
+// user already has is a no-op; one linked to someone else returns ErrIdentityInUse.
+func (s *UserService) LinkIdentity(ctx context.Context, userID int32, provider, providerID, email string) (*domain.Identity, error) {
+	ctx, span := telemetry.Start(ctx, "UserService.LinkIdentity")
+	defer span.End()
+
+	if provider == "" || providerID == "" {
+		return nil, errors.New("invalid request: provider and provider ID are required")
+	}
+
+	existing, err := s.repo.Identities.Get(ctx, provider, providerID)
+	switch {
+	case err == nil && existing.UserID == userID:
+		return dbIdentityToDomain(existing), nil
+	case err == nil:
+		return nil, ErrIdentityInUse
+	case !errors.Is(err, repository.ErrNotFound):
+		return nil, fmt.Errorf("failed to check existing identity: %w", err)
+	}
+
+	// The identity and its audit event are committed together
+	var row *repository.UserIdentity
+	err = s.repo.WithTransaction(ctx, func(ctx context.Context, repo *repository.Repository) error {
+		if _, err := lockUser(ctx, repo, userID); err != nil {
+			return err
+		}
+		var err error
+		row, err = repo.Identities.Create(ctx, repository.CreateUserIdentityParams{
+			UserID:     userID,
+			Provider:   provider,
+			ProviderID: providerID,
+			Email:      email,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to link identity: %w", err)
+		}
+		return auditUser(ctx, repo, domain.AuditIdentityLink, userID, nil, identityState(row))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dbIdentityToDomain(row), nil
+}
+
+// UnlinkIdentity removes one of the user's identities, unless it is their last one
+func (s *UserService) UnlinkIdentity(ctx context.Context, userID, identityID int32) error {
+	ctx, span := telemetry.Start(ctx, "UserService.UnlinkIdentity")
+	defer span.End()
+
+	// With the user locked, concurrent unlinks can't remove their last two identities at once
+	return s.repo.WithTransaction(ctx, func(ctx context.Context, repo *repository.Repository) error {
+		if _, err := lockUser(ctx, repo, userID); err != nil {
+			if errors.Is(err, ErrUserNotFound) {
+				return ErrIdentityNotFound
+			}
+			return err
+		}
+		rows, err := repo.Identities.ListByUserID(ctx, userID)
+		if err != nil {
+			return fmt.Errorf("failed to list identities: %w", err)
+		}
+		var target *repository.UserIdentity
+		for _, row := range rows {
+			if row.ID == identityID {
+				target = row
+			}
+		}
+		if target == nil {
+			return ErrIdentityNotFound
+		}
+		if len(rows) == 1 {
+			return ErrLastIdentity
+		}
+
+		if err := repo.Identities.Delete(ctx, identityID, userID); err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return ErrIdentityNotFound
+			}
+			return fmt.Errorf("failed to unlink identity: %w", err)
+		}
+		return auditUser(ctx, repo, domain.AuditIdentityUnlink, userID, identityState(target), nil)
+	})
+}
+
+// identityState is the part of an identity the audit log records; never the password hash
+func identityState(i *repository.UserIdentity) map[string]any {
+	return map[string]any{
+		"identity_id": i.ID,
+		"provider":    i.Provider,
+		"provider_id": i.ProviderID,
+	}
+}
+
+func dbIdentityToDomain(i *repository.UserIdentity) *domain.Identity {
+	return &domain.Identity{
+		ID:          i.ID,
+		UserID:      i.UserID,
+		Provider:    i.Provider,
+		ProviderID:  i.ProviderID,
+		Email:       i.Email,
+		HasPassword: i.PasswordHash != nil,
+		CreatedAt:   i.CreatedAt,
+	}
+}
@@ -0,0 +1,207 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zqz/web/backend/internal/domain"
+	"github.com/zqz/web/backend/internal/repository"
+	"github.com/zqz/web/backend/internal/tests"
+)
+
+func TestLinkAndUnlinkIdentities(t *testing.T) {
+	ctx := context.Background()
+	pg, cleanup := tests.SetupTestDB(t, ctx)
+	defer cleanup()
+
+	repo := repository.NewRepository(pg.Pool)
+	svc := NewUserService(repo)
+
+	user, err := svc.GetOrCreateUser(ctx, domain.CreateUserRequest{
+		Name: testOwnerName, Email: testOwnerEmail, Provider: testProviderGoogle, ProviderID: testOwnerProviderID, Role: testRoleMember,
+	})
+	require.NoError(t, err)
+	other, err := svc.GetOrCreateUser(ctx, domain.CreateUserRequest{
+		Name: "Other", Email: "other@example.com", Provider: testProviderGoogle, ProviderID: "other-456", Role: testRoleMember,
+	})
+	require.NoError(t, err)
+
+	identities, err := svc.ListIdentities(ctx, user.ID)
+	require.NoError(t, err)
+	require.Len(t, identities, 1)
+	assert.Equal(t, testProviderGoogle, identities[0].Provider)
+	assert.ErrorIs(t, svc.UnlinkIdentity(ctx, user.ID, identities[0].ID), ErrLastIdentity)
+
+	linked, err := svc.LinkIdentity(ctx, user.ID, domain.ProviderGitHub, "gh-1", "owner@users.example.com")
+	require.NoError(t, err)
+	again, err := svc.LinkIdentity(ctx, user.ID, domain.ProviderGitHub, "gh-1", "owner@users.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, linked.ID, again.ID)
+	_, err = svc.LinkIdentity(ctx, other.ID, domain.ProviderGitHub, "gh-1", "")
+	assert.ErrorIs(t, err, ErrIdentityInUse)
+
+	// Either identity now signs in as the same user
+	viaGitHub, err := svc.GetOrCreateUser(ctx, domain.CreateUserRequest{
+		Name: "Someone", Email: "someone@example.com", Provider: domain.ProviderGitHub, ProviderID: "gh-1",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, viaGitHub.ID)
+
+	// Only the owner can unlink it
+	assert.ErrorIs(t, svc.UnlinkIdentity(ctx, other.ID, linked.ID), ErrIdentityNotFound)
+	require.NoError(t, svc.UnlinkIdentity(ctx, user.ID, identities[0].ID))
+	identities, err = svc.ListIdentities(ctx, user.ID)
+	require.NoError(t, err)
+	require.Len(t, identities, 1)
+	assert.Equal(t, domain.ProviderGitHub, identities[0].Provider)
+
+	_, total, err := NewAuditService(repo).ListEvents(ctx, domain.AuditFilter{Action: domain.AuditIdentityUnlink}, 10, 0)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, total)
+}
+
+func TestLocalAccounts(t *testing.T) {
+	ctx := context.Background()
+	pg, cleanup := tests.SetupTestDB(t, ctx)
+	defer cleanup()
+
+	repo := repository.NewRepository(pg.Pool)
+	svc := NewUserService(repo)
+
+	user, err := svc.RegisterLocal(ctx, domain.RegisterLocalRequest{Email: " Carol@Example.com ", Password: "correct horse"})
+	require.NoError(t, err)
+	assert.Equal(t, "carol@example.com", user.Email)
+	assert.Equal(t, "carol", user.Name)
+
+	_, err = svc.RegisterLocal(ctx, domain.RegisterLocalRequest{Email: "carol@example.com", Password: "another one"})
+	assert.ErrorIs(t, err, ErrEmailTaken)
+	_, err = svc.RegisterLocal(ctx, domain.RegisterLocalRequest{Email: "not an email", Password: "correct horse"})
+	assert.ErrorIs(t, err, ErrInvalidEmail)
+	_, err = svc.RegisterLocal(ctx, domain.RegisterLocalRequest{Email: "dave@example.com", Password: "short"})
+	assert.ErrorIs(t, err, ErrInvalidAccountPassword)
+
+	signedIn, err := svc.AuthenticateLocal(ctx, "CAROL@example.com", "correct horse")
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, signedIn.ID)
+	_, err = svc.AuthenticateLocal(ctx, "carol@example.com", "wrong")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	_, err = svc.AuthenticateLocal(ctx, "nobody@example.com", "correct horse")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	// A user from an external provider can add a password for their own email
+	google, err := svc.GetOrCreateUser(ctx, domain.CreateUserRequest{
+		Name: testOwnerName, Email: testOwnerEmail, Provider: testProviderGoogle, ProviderID: testOwnerProviderID, Role: testRoleMember,
+	})
+	require.NoError(t, err)
+	identity, err := svc.SetLocalPassword(ctx, google.ID, "a new password")
+	require.NoError(t, err)
+	assert.True(t, identity.HasPassword)
+	signedIn, err = svc.AuthenticateLocal(ctx, testOwnerEmail, "a new password")
+	require.NoError(t, err)
+	assert.Equal(t, google.ID, signedIn.ID)
+
+	// Registering with that email is refused rather than creating a second account
+	_, err = svc.RegisterLocal(ctx, domain.RegisterLocalRequest{Email: testOwnerEmail, Password: "correct horse"})
+	assert.ErrorIs(t, err, ErrEmailTaken)
+}
+
+func TestLocalLoginIsRateLimited(t *testing.T) {
+	ctx := context.Background()
+	pg, cleanup := tests.SetupTestDB(t, ctx)
+	defer cleanup()
+
+	svc := NewUserService(repository.NewRepository(pg.Pool))
+	_, err := svc.RegisterLocal(ctx, domain.RegisterLocalRequest{Email: "erin@example.com", Password: "correct horse"})
+	require.NoError(t, err)
+
+	for range loginAttemptBurst {
+		_, err = svc.AuthenticateLocal(ctx, "erin@example.com", "wrong")
+		require.ErrorIs(t, err, ErrInvalidCredentials)
+	}
+	_, err = svc.AuthenticateLocal(ctx, "erin@example.com", "correct horse")
+	assert.ErrorIs(t, err, ErrTooManyLoginAttempts)
+}
+
+func TestLocalLoginConcurrentGuesses(t *testing.T) {
+	ctx := context.Background()
+	pg, cleanup := tests.SetupTestDB(t, ctx)
+	defer cleanup()
+
+	svc := NewUserService(repository.NewRepository(pg.Pool))
+	_, err := svc.RegisterLocal(ctx, domain.RegisterLocalRequest{Email: "frank@example.com", Password: "correct horse"})
+	require.NoError(t, err)
+
+	// Guesses sent at once still only get the burst between them
+	const guesses = 3 * loginAttemptBurst
+	var wg sync.WaitGroup
+	errs := make(chan error, guesses)
+	for range guesses {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := svc.AuthenticateLocal(ctx, "frank@example.com", "wrong")
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	wrong := 0
+	for err := range errs {
+		if errors.Is(err, ErrInvalidCredentials) {
+			wrong++
+		} else {
+			assert.ErrorIs(t, err, ErrTooManyLoginAttempts)
+		}
+	}
+	assert.Equal(t, loginAttemptBurst, wrong)
+}
+
+func TestArgon2KeyIsBounded(t *testing.T) {
+	for range cap(argon2Slots) {
+		argon2Slots <- struct{}{}
+	}
+	done := make(chan struct{})
+	go func() {
+		argon2Key([]byte("correct horse"), make([]byte, argon2SaltLen), 1, 8, 1, argon2KeyLen)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("hashed while every slot was taken")
+	case <-time.After(50 * time.Millisecond):
+	}
+	for range cap(argon2Slots) {
+		<-argon2Slots
+	}
+	<-done
+}
+
+func TestAccountPasswordHash(t *testing.T) {
+	hash, err := hashAccountPassword("correct horse")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$"))
+
+	ok, err := verifyAccountPassword(hash, "correct horse")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = verifyAccountPassword(hash, "correct horsE")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	other, err := hashAccountPassword("correct horse")
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, other, "salts should differ")
+
+	_, err = verifyAccountPassword("$2a$10$notargon", "x")
+	assert.Error(t, err)
+	_, err = hashAccountPassword(strings.Repeat("x", maxAccountPasswordLen+1))
+	assert.ErrorIs(t, err, ErrInvalidAccountPassword)
+}
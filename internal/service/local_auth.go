@@ -0,0 +1,255 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/mail"
+	"runtime"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+
+	"github.com/zqz/web/backend/internal/domain"
+	"github.com/zqz/web/backend/internal/repository"
+	"github.com/zqz/web/backend/internal/telemetry"
+)
+
+const (
+	minAccountPasswordLen = 8
+	maxAccountPasswordLen = 1024
+	maxEmailLen           = 254
+
+	// argon2id parameters for account passwords (OWASP's minimum recommendation)
+	argon2Time    = 2
+	argon2Memory  = 19 * 1024 // KiB
+	argon2Threads = 1
+	argon2KeyLen  = 32
+	argon2SaltLen = 16
+
+	// Failed sign-ins per email: a burst of 10, then one more per minute
+	loginAttemptBurst  = 10
+	loginAttemptRefill = time.Minute
+)
+
+// argon2Slots bounds how many argon2 hashes run at once; see argon2Key
+var argon2Slots = make(chan struct{}, runtime.GOMAXPROCS(0))
+
+var (
+	// ErrInvalidCredentials is returned when an email and password don't match a local account
+	ErrInvalidCredentials = errors.New("invalid email or password")
+
+	// ErrTooManyLoginAttempts is returned when an email has had too many recent failed sign-ins
+	ErrTooManyLoginAttempts = errors.New("too many sign-in attempts, try again later")
+
+	// ErrEmailTaken is returned when registering an email that already belongs to an account
+	ErrEmailTaken = errors.New("an account with this email already exists")
+
+	// ErrInvalidEmail is returned for an email address that can't be used for a local account
+	ErrInvalidEmail = errors.New("invalid email address")
+
+	// ErrInvalidAccountPassword is returned for an account password that is too short or too long
+	ErrInvalidAccountPassword = errors.New("password must be 8 to 1024 characters")
+)
+
+// RegisterLocal creates a user who signs in with an email and password. Existing users
+// add a password to their account with SetLocalPassword instead.
+func (s *UserService) RegisterLocal(ctx context.Context, req domain.RegisterLocalRequest) (*domain.User, error) {
+	ctx, span := telemetry.Start(ctx, "UserService.RegisterLocal")
+	defer span.End()
+
+	email, err := normalizeEmail(req.Email)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := hashAccountPassword(req.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.repo.Identities.Get(ctx, domain.ProviderLocal, email); err == nil {
+		return nil, ErrEmailTaken
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return nil, fmt.Errorf("failed to check existing identity: %w", err)
+	}
+	if _, err := s.repo.Users.GetByEmail(ctx, email); err == nil {
+		return nil, ErrEmailTaken
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return nil, fmt.Errorf("failed to check existing user: %w", err)
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name, _, _ = strings.Cut(email, "@")
+	}
+	return s.createUser(ctx, domain.CreateUserRequest{
+		Name:       name,
+		Email:      email,
+		Provider:   domain.ProviderLocal,
+		ProviderID: email,
+		Role:       domain.RoleMember,
+	}, &hash)
+}
+
+// AuthenticateLocal returns the user a local email and password belong to. Failed
+// attempts are rate-limited per email (ErrTooManyLoginAttempts).
+func (s *UserService) AuthenticateLocal(ctx context.Context, email, password string) (*domain.User, error) {
+	ctx, span := telemetry.Start(ctx, "UserService.AuthenticateLocal")
+	defer span.End()
+
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	// Take the attempt up front so concurrent guesses can't all pass a full bucket
+	refund, ok := s.loginLimiter.reserve(email)
+	if !ok {
+		return nil, ErrTooManyLoginAttempts
+	}
+
+	identity, err := s.repo.Identities.Get(ctx, domain.ProviderLocal, email)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		refund()
+		return nil, fmt.Errorf("failed to get identity: %w", err)
+	}
+	if identity == nil || identity.PasswordHash == nil {
+		// Spend as long as a real check so response times don't reveal which emails have accounts
+		argon2Key([]byte(password), make([]byte, argon2SaltLen), argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+		return nil, ErrInvalidCredentials
+	}
+	ok, err = verifyAccountPassword(*identity.PasswordHash, password)
+	if err != nil {
+		refund()
+		return nil, fmt.Errorf("failed to check password: %w", err)
+	}
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+	refund()
+	return s.GetUserByID(ctx, identity.UserID)
+}
+
+// SetLocalPassword lets a user sign in with their account email and password, linking a
+// local identity if they don't have one yet or replacing its password if they do
+func (s *UserService) SetLocalPassword(ctx context.Context, userID int32, password string) (*domain.Identity, error) {
+	ctx, span := telemetry.Start(ctx, "UserService.SetLocalPassword")
+	defer span.End()
+
+	user, err := s.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	email, err := normalizeEmail(user.Email)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := hashAccountPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	// The password and its audit event are committed together
+	var identity *repository.UserIdentity
+	err = s.repo.WithTransaction(ctx, func(ctx context.Context, repo *repository.Repository) error {
+		if _, err := lockUser(ctx, repo, userID); err != nil {
+			return err
+		}
+		var err error
+		identity, err = repo.Identities.Get(ctx, domain.ProviderLocal, email)
+		switch {
+		case err == nil && identity.UserID != userID:
+			return ErrEmailTaken
+		case err == nil:
+			if err := repo.Identities.SetPasswordHash(ctx, identity.ID, &hash); err != nil {
+				return fmt.Errorf("failed to set password: %w", err)
+			}
+			identity.PasswordHash = &hash
+		case errors.Is(err, repository.ErrNotFound):
+			identity, err = repo.Identities.Create(ctx, repository.CreateUserIdentityParams{
+				UserID:       userID,
+				Provider:     domain.ProviderLocal,
+				ProviderID:   email,
+				Email:        email,
+				PasswordHash: &hash,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to link identity: %w", err)
+			}
+		default:
+			return fmt.Errorf("failed to check existing identity: %w", err)
+		}
+		return auditUser(ctx, repo, domain.AuditIdentityPassword, userID, nil, identityState(identity))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dbIdentityToDomain(identity), nil
+}
+
+// argon2Key is argon2.IDKey, run by at most one caller per CPU at a time. Each hash takes
+// memory KiB (19 MiB with our parameters) while it runs, so without the bound a flood of
+// sign-ins, wrong or not, could run the server out of memory.
+func argon2Key(password, salt []byte, time, memory uint32, threads uint8, keyLen uint32) []byte {
+	argon2Slots <- struct{}{}
+	defer func() { <-argon2Slots }()
+	return argon2.IDKey(password, salt, time, memory, threads, keyLen)
+}
+
+// normalizeEmail lowercases a bare email address, the key local identities are stored under
+func normalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if len(email) > maxEmailLen {
+		return "", ErrInvalidEmail
+	}
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "", ErrInvalidEmail
+	}
+	return email, nil
+}
+
+// hashAccountPassword returns password's argon2id hash in the PHC string format
+func hashAccountPassword(password string) (string, error) {
+	if len(password) < minAccountPasswordLen || len(password) > maxAccountPasswordLen {
+		return "", ErrInvalidAccountPassword
+	}
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+	key := argon2Key([]byte(password), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, argon2Memory, argon2Time, argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// verifyAccountPassword checks password against a hash from hashAccountPassword, using the
+// parameters stored in the hash so they can be raised later without invalidating old hashes
+func verifyAccountPassword(encoded, password string) (bool, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return false, errors.New("unsupported password hash")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, errors.New("unsupported argon2 version")
+	}
+	var memory, iterations uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &threads); err != nil {
+		return false, fmt.Errorf("invalid argon2 parameters: %w", err)
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, fmt.Errorf("invalid salt: %w", err)
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, fmt.Errorf("invalid key: %w", err)
+	}
+	got := argon2Key([]byte(password), salt, iterations, memory, threads, uint32(len(want)))
+	return subtle.ConstantTimeCompare(got, want) == 1, nil
+}
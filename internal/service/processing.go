@@ -0,0 +1,198 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/zqz/web/backend/internal/domain"
+	"github.com/zqz/web/backend/internal/metrics"
+	"github.com/zqz/web/backend/internal/repository"
+	"github.com/zqz/web/backend/internal/telemetry"
+)
+
+const (
+	// jobMaxAttempts is how many times a processor runs before its job is marked failed
+	jobMaxAttempts = 5
+
+	jobBackoffBase = 5 * time.Second
+	jobBackoffMax  = 10 * time.Minute
+
+	// requeueBatchSize is how many files RequeueImages reads per query
+	requeueBatchSize = 500
+)
+
+// enqueueProcessors queues one job per registered processor for a completed file. repo is
+// the transaction that completes the file, so a file is never finished without its jobs.
+func (s *FileService) enqueueProcessors(ctx context.Context, repo *repository.Repository, file *domain.File) error {
+	for _, p := range s.processors {
+		_, err := repo.Jobs.Enqueue(ctx, repository.EnqueueProcessingJobParams{
+			FileID:      file.ID,
+			Processor:   p.Name(),
+			MaxAttempts: jobMaxAttempts,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to enqueue processor %s: %w", p.Name(), err)
+		}
+	}
+	return nil
+}
+
+// RequeueImages queues the named processor again for every fully uploaded image, or only
+// for images without a thumbnail when missingThumbnail is set. Jobs that already exist are
+// reset to pending. Returns the number of jobs queued.
+func (s *FileService) RequeueImages(ctx context.Context, name string, missingThumbnail bool) (int, error) {
+	if !slices.ContainsFunc(s.processors, func(p Processor) bool { return p.Name() == name }) {
+		return 0, fmt.Errorf("%w: %s", ErrUnknownProcessor, name)
+	}
+
+	queued := 0
+	afterID := int32(0)
+	for {
+		files, err := s.repo.Files.ListCompletedImages(ctx, afterID, missingThumbnail, requeueBatchSize)
+		if err != nil {
+			return queued, fmt.Errorf("failed to list images: %w", err)
+		}
+		for _, f := range files {
+			_, err := s.repo.Jobs.Enqueue(ctx, repository.EnqueueProcessingJobParams{
+				FileID:      f.ID,
+				Processor:   name,
+				MaxAttempts: jobMaxAttempts,
+			})
+			if err != nil {
+				return queued, fmt.Errorf("failed to enqueue processor %s: %w", name, err)
+			}
+			queued++
+		}
+		if len(files) < requeueBatchSize {
+			return queued, nil
+		}
+		afterID = files[len(files)-1].ID
+	}
+}
+
+// ProcessNextJob claims and runs one queued processing job.
+// Returns false when no job is ready. A processor failure is recorded on the job
+// (retried with backoff, or marked failed after jobMaxAttempts) and also returned.
+func (s *FileService) ProcessNextJob(ctx context.Context) (bool, error) {
+	job, err := s.repo.Jobs.Claim(ctx)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to claim job: %w", err)
+	}
+
+	ctx, span := telemetry.Start(ctx, "processor "+job.Processor, trace.WithAttributes(
+		attribute.Int64("file.id", int64(job.FileID)),
+		attribute.Int("job.attempt", int(job.Attempts)),
+	))
+	defer span.End()
+
+	start := time.Now()
+	runErr := s.runJob(ctx, job)
+	telemetry.RecordError(span, runErr)
+	metrics.ProcessorDuration.WithLabelValues(job.Processor).Observe(time.Since(start).Seconds())
+	if runErr == nil {
+		if err := s.repo.Jobs.Complete(ctx, job.ID); err != nil {
+			return true, fmt.Errorf("failed to complete job: %w", err)
+		}
+		return true, nil
+	}
+	metrics.ProcessorFailures.WithLabelValues(job.Processor).Inc()
+
+	if job.Attempts >= job.MaxAttempts {
+		if err := s.repo.Jobs.Fail(ctx, job.ID, runErr.Error()); err != nil {
+			return true, fmt.Errorf("failed to mark job failed: %w", err)
+		}
+	} else {
+		runAt := time.Now().UTC().Add(jobBackoff(job.Attempts))
+		if err := s.repo.Jobs.Retry(ctx, job.ID, runErr.Error(), runAt); err != nil {
+			return true, fmt.Errorf("failed to reschedule job: %w", err)
+		}
+	}
+
+	return true, fmt.Errorf("processor %s on file %d (attempt %d/%d): %w", job.Processor, job.FileID, job.Attempts, job.MaxAttempts, runErr)
+}
+
+// ReleaseStaleJobs returns jobs stuck in running for longer than timeout
+// (e.g. the worker died mid-job) to the queue
+func (s *FileService) ReleaseStaleJobs(ctx context.Context, timeout time.Duration) (int64, error) {
+	n, err := s.repo.Jobs.ReleaseStale(ctx, time.Now().UTC().Add(-timeout))
+	if err != nil {
+		return 0, fmt.Errorf("failed to release stale jobs: %w", err)
+	}
+	return n, nil
+}
+
+func (s *FileService) runJob(ctx context.Context, job *repository.ProcessingJob) error {
+	var proc Processor
+	for _, p := range s.processors {
+		if p.Name() == job.Processor {
+			proc = p
+			break
+		}
+	}
+	if proc == nil {
+		return fmt.Errorf("unknown processor %q", job.Processor)
+	}
+
+	dbFile, err := s.repo.Files.GetByID(ctx, job.FileID)
+	if err != nil {
+		return fmt.Errorf("failed to get file: %w", err)
+	}
+
+	return proc.Process(ctx, dbFileToDoamin(dbFile), s.storage, s.repo)
+}
+
+// LoadProcessing attaches the file's per-processor job states to file.Processing
+func (s *FileService) LoadProcessing(ctx context.Context, file *domain.File) error {
+	ctx, span := telemetry.Start(ctx, "FileService.LoadProcessing")
+	defer span.End()
+
+	dbJobs, err := s.repo.Jobs.ListByFileID(ctx, file.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list processing jobs: %w", err)
+	}
+
+	file.Processing = make([]*domain.ProcessingJob, len(dbJobs))
+	for i, j := range dbJobs {
+		file.Processing[i] = dbJobToDomain(j)
+	}
+	return nil
+}
+
+// jobBackoff returns the delay before retrying after the given attempt (1-based):
+// 5s, 10s, 20s, ... capped at 10 minutes
+func jobBackoff(attempt int32) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	d := jobBackoffBase
+	for i := int32(1); i < attempt; i++ {
+		d *= 2
+		if d >= jobBackoffMax {
+			return jobBackoffMax
+		}
+	}
+	return d
+}
+
+func dbJobToDomain(j *repository.ProcessingJob) *domain.ProcessingJob {
+	return &domain.ProcessingJob{
+		ID:          j.ID,
+		FileID:      j.FileID,
+		Processor:   j.Processor,
+		Status:      j.Status,
+		Attempts:    j.Attempts,
+		MaxAttempts: j.MaxAttempts,
+		LastError:   j.LastError,
+		RunAt:       j.RunAt,
+		UpdatedAt:   j.UpdatedAt,
+	}
+}
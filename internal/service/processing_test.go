@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zqz/web/backend/internal/domain"
+	"github.com/zqz/web/backend/internal/repository"
+	"github.com/zqz/web/backend/internal/service/storage"
+	"github.com/zqz/web/backend/internal/tests"
+)
+
+// flakyProcessor fails its first failures calls, then succeeds
+type flakyProcessor struct {
+	failures int
+	calls    int
+}
+
+func (p *flakyProcessor) Name() string { return "flaky" }
+
+func (p *flakyProcessor) Process(ctx context.Context, file *domain.File, stor storage.Storage, repo *repository.Repository) error {
+	p.calls++
+	if p.calls <= p.failures {
+		return errors.New("boom")
+	}
+	return nil
+}
+
+func TestJobBackoff(t *testing.T) {
+	assert.Equal(t, 5*time.Second, jobBackoff(0))
+	assert.Equal(t, 5*time.Second, jobBackoff(1))
+	assert.Equal(t, 10*time.Second, jobBackoff(2))
+	assert.Equal(t, 40*time.Second, jobBackoff(4))
+	assert.Equal(t, jobBackoffMax, jobBackoff(20))
+}
+
+func TestFileServiceProcessingRunsOnQueue(t *testing.T) {
+	ctx := context.Background()
+	pg, cleanup := tests.SetupTestDB(t, ctx)
+	defer cleanup()
+
+	repo := repository.NewRepository(pg.Pool)
+	stor, err := storage.NewDiskStorage(t.TempDir())
+	require.NoError(t, err)
+
+	svc := NewFileService(repo, stor)
+	proc := &flakyProcessor{}
+	svc.AddProcessor(proc)
+
+	file := uploadTestFile(t, ctx, svc, []byte("queued"), domain.CreateFileRequest{})
+
+	// Upload returns before any processor runs
+	assert.Equal(t, 0, proc.calls)
+	require.NoError(t, svc.LoadProcessing(ctx, file))
+	require.Len(t, file.Processing, 1)
+	assert.Equal(t, "flaky", file.Processing[0].Processor)
+	assert.Equal(t, domain.JobStatusPending, file.Processing[0].Status)
+
+	worked, err := svc.ProcessNextJob(ctx)
+	require.NoError(t, err)
+	assert.True(t, worked)
+	assert.Equal(t, 1, proc.calls)
+
+	require.NoError(t, svc.LoadProcessing(ctx, file))
+	assert.Equal(t, domain.JobStatusSucceeded, file.Processing[0].Status)
+	assert.Equal(t, int32(1), file.Processing[0].Attempts)
+
+	worked, err = svc.ProcessNextJob(ctx)
+	require.NoError(t, err)
+	assert.False(t, worked)
+}
+
+func TestFileServiceProcessingRetriesThenFails(t *testing.T) {
+	ctx := context.Background()
+	pg, cleanup := tests.SetupTestDB(t, ctx)
+	defer cleanup()
+
+	repo := repository.NewRepository(pg.Pool)
+	stor, err := storage.NewDiskStorage(t.TempDir())
+	require.NoError(t, err)
+
+	svc := NewFileService(repo, stor)
+	proc := &flakyProcessor{failures: jobMaxAttempts}
+	svc.AddProcessor(proc)
+
+	file := uploadTestFile(t, ctx, svc, []byte("always fails"), domain.CreateFileRequest{})
+
+	for attempt := 1; attempt <= jobMaxAttempts; attempt++ {
+		worked, err := svc.ProcessNextJob(ctx)
+		require.Error(t, err)
+		assert.True(t, worked)
+
+		require.NoError(t, svc.LoadProcessing(ctx, file))
+		job := file.Processing[0]
+		assert.Equal(t, int32(attempt), job.Attempts)
+		assert.Equal(t, "boom", job.LastError)
+
+		if attempt < jobMaxAttempts {
+			assert.Equal(t, domain.JobStatusPending, job.Status)
+			assert.True(t, job.RunAt.After(time.Now().UTC()), "retry should be scheduled with backoff")
+
+			// Nothing is runnable until the backoff elapses
+			worked, err = svc.ProcessNextJob(ctx)
+			require.NoError(t, err)
+			assert.False(t, worked)
+
+			require.NoError(t, repo.Jobs.Retry(ctx, job.ID, job.LastError, time.Now().UTC().Add(-time.Second)))
+		} else {
+			assert.Equal(t, domain.JobStatusFailed, job.Status)
+		}
+	}
+
+	worked, err := svc.ProcessNextJob(ctx)
+	require.NoError(t, err)
+	assert.False(t, worked)
+}
@@ -41,7 +41,7 @@ func (p *ThumbnailProcessor) Process(ctx context.Context, file *domain.File, sto
 	}
 
 	// Get file data
-	reader, err := stor.Get(file.Hash)
+	reader, err := stor.Get(ctx, file.Hash)
 	if err != nil {
 		return fmt.Errorf("failed to get file data: %w", err)
 	}
@@ -74,7 +74,7 @@ func (p *ThumbnailProcessor) Process(ctx context.Context, file *domain.File, sto
 	thumbnailHash := fmt.Sprintf("%x", sum[:])
 
 	// Store thumbnail
-	if err := stor.Put(thumbnailHash, bytes.NewReader(buf.Bytes())); err != nil {
+	if err := stor.Put(ctx, thumbnailHash, bytes.NewReader(buf.Bytes())); err != nil {
 		// Ignore already exists errors
 		if err != storage.ErrAlreadyExists {
 			return fmt.Errorf("failed to store thumbnail: %w", err)
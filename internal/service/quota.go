@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/zqz/web/backend/internal/domain"
+	"github.com/zqz/web/backend/internal/repository"
+	"github.com/zqz/web/backend/internal/telemetry"
+)
+
+const settingDefaultStorageQuota = "default_storage_quota"
+
+// GetStorageUsage returns the user's total stored bytes (including uploads in progress)
+// and their effective quota: the per-user override, else the site default. Admins are unlimited.
+func (s *FileService) GetStorageUsage(ctx context.Context, userID int32) (domain.StorageUsage, error) {
+	ctx, span := telemetry.Start(ctx, "FileService.GetStorageUsage")
+	defer span.End()
+
+	return s.storageUsage(ctx, s.repo, userID)
+}
+
+// storageUsage is GetStorageUsage reading through repo, which may be a transaction
+func (s *FileService) storageUsage(ctx context.Context, repo *repository.Repository, userID int32) (domain.StorageUsage, error) {
+	user, err := repo.Users.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return domain.StorageUsage{}, ErrUserNotFound
+		}
+		return domain.StorageUsage{}, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	used, err := repo.Files.TotalSizeByUserID(ctx, userID)
+	if err != nil {
+		return domain.StorageUsage{}, fmt.Errorf("failed to sum file sizes: %w", err)
+	}
+
+	usage := domain.StorageUsage{Used: used}
+	if domain.RoleCan(user.Role, domain.PermUnlimitedFiles) {
+		return usage, nil
+	}
+	if user.StorageQuotaOverride != nil && *user.StorageQuotaOverride > 0 {
+		usage.Quota = *user.StorageQuotaOverride
+		return usage, nil
+	}
+
+	val, err := repo.Settings.Get(ctx, settingDefaultStorageQuota)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return domain.StorageUsage{}, fmt.Errorf("failed to get setting: %w", err)
+	}
+	if err == nil && val != "" {
+		if n, err := strconv.ParseInt(val, 10, 64); err == nil && n > 0 {
+			usage.Quota = n
+		}
+	}
+	return usage, nil
+}
+
+// checkStorageQuota returns ErrStorageQuotaExceeded if size more bytes would exceed the user's quota.
+// To make the check hold until the file is inserted, run both in one transaction that
+// has locked the user (see lockStorageQuota).
+func (s *FileService) checkStorageQuota(ctx context.Context, repo *repository.Repository, userID int32, size int64) error {
+	usage, err := s.storageUsage(ctx, repo, userID)
+	if err != nil {
+		return err
+	}
+	if !usage.Allows(size) {
+		return ErrStorageQuotaExceeded
+	}
+	return nil
+}
+
+// lockStorageQuota checks the user's quota inside a transaction and locks their row, so
+// concurrent uploads by the same user wait for this one's file to be inserted before
+// checking theirs
+func (s *FileService) lockStorageQuota(ctx context.Context, repo *repository.Repository, userID int32, size int64) error {
+	if err := repo.Users.Lock(ctx, userID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrUserNotFound
+		}
+		return fmt.Errorf("failed to lock user: %w", err)
+	}
+	return s.checkStorageQuota(ctx, repo, userID, size)
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zqz/web/backend/internal/domain"
+	"github.com/zqz/web/backend/internal/repository"
+	"github.com/zqz/web/backend/internal/service/storage"
+	"github.com/zqz/web/backend/internal/tests"
+)
+
+func TestStorageUsageAllows(t *testing.T) {
+	assert.True(t, domain.StorageUsage{Used: 1 << 40}.Allows(1<<40), "no quota is unlimited")
+	assert.True(t, domain.StorageUsage{Used: 60, Quota: 100}.Allows(40))
+	assert.False(t, domain.StorageUsage{Used: 60, Quota: 100}.Allows(41))
+	assert.Equal(t, 60, domain.StorageUsage{Used: 60, Quota: 100}.Percent())
+	assert.Equal(t, 0, domain.StorageUsage{Used: 60}.Percent())
+}
+
+func TestFileServiceStorageQuota(t *testing.T) {
+	ctx := context.Background()
+	pg, cleanup := tests.SetupTestDB(t, ctx)
+	defer cleanup()
+
+	repo := repository.NewRepository(pg.Pool)
+	stor, err := storage.NewDiskStorage(t.TempDir())
+	require.NoError(t, err)
+	svc := NewFileService(repo, stor)
+	userSvc := NewUserService(repo)
+
+	user, err := userSvc.GetOrCreateUser(ctx, domain.CreateUserRequest{
+		Name:       "QuotaUser",
+		Email:      "quota@example.com",
+		Provider:   testProviderGoogle,
+		ProviderID: "google-quota",
+		Role:       testRoleMember,
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, repo.Settings.Set(ctx, settingDefaultStorageQuota, "1000"))
+
+	usage, err := svc.GetStorageUsage(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, domain.StorageUsage{Used: 0, Quota: 1000}, usage)
+
+	// Incomplete uploads count against the quota
+	_, err = svc.CreateFile(ctx, domain.CreateFileRequest{
+		Name: "a.bin", Hash: testHash1, Size: 600, ContentType: contentTypePlain, UserID: &user.ID,
+	}, 0)
+	require.NoError(t, err)
+
+	_, err = svc.CreateFile(ctx, domain.CreateFileRequest{
+		Name: "b.bin", Hash: testHash2, Size: 500, ContentType: contentTypePlain, UserID: &user.ID,
+	}, 0)
+	assert.ErrorIs(t, err, ErrStorageQuotaExceeded)
+
+	_, err = svc.CreateFile(ctx, domain.CreateFileRequest{
+		Name: "b.bin", Hash: testHash2, Size: 400, ContentType: contentTypePlain, UserID: &user.ID,
+	}, 0)
+	require.NoError(t, err)
+
+	usage, err = svc.GetStorageUsage(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1000), usage.Used)
+
+	// The per-user override wins over the site default
+	override := int64(2000)
+	_, err = userSvc.SetStorageQuota(ctx, user.ID, &override)
+	require.NoError(t, err)
+
+	_, err = svc.CreateFile(ctx, domain.CreateFileRequest{
+		Name: "c.bin", Hash: testHash3, Size: 1000, ContentType: contentTypePlain, UserID: &user.ID,
+	}, 0)
+	require.NoError(t, err)
+
+	usage, err = svc.GetStorageUsage(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, domain.StorageUsage{Used: 2000, Quota: 2000}, usage)
+
+	_, err = userSvc.SetStorageQuota(ctx, 99999, &override)
+	assert.ErrorIs(t, err, ErrUserNotFound)
+}
+
+func TestFileServiceStorageQuotaConcurrentUploads(t *testing.T) {
+	ctx := context.Background()
+	pg, cleanup := tests.SetupTestDB(t, ctx)
+	defer cleanup()
+
+	repo := repository.NewRepository(pg.Pool)
+	stor, err := storage.NewDiskStorage(t.TempDir())
+	require.NoError(t, err)
+	svc := NewFileService(repo, stor)
+
+	user := createTestUser(t, ctx, repo, "racer")
+	require.NoError(t, repo.Settings.Set(ctx, settingDefaultStorageQuota, "1000"))
+
+	// Each upload fits on its own, but only two fit together
+	const uploads = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, uploads)
+	for i := range uploads {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := svc.CreateFile(ctx, domain.CreateFileRequest{
+				Name: "race.bin", Hash: fmt.Sprintf("%064x", i+1), Size: 400, ContentType: contentTypePlain, UserID: &user,
+			}, 0)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	created := 0
+	for err := range errs {
+		if err == nil {
+			created++
+			continue
+		}
+		assert.ErrorIs(t, err, ErrStorageQuotaExceeded)
+	}
+	assert.Equal(t, 2, created)
+
+	usage, err := svc.GetStorageUsage(ctx, user)
+	require.NoError(t, err)
+	assert.Equal(t, int64(800), usage.Used)
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// reapBatchSize is how many expired files are purged per query
+const reapBatchSize = 100
+
+// ReapExpiredFiles deletes files past their expiry time or download limit, along
+// with their thumbnails and stored data. Returns the number of files deleted.
+func (s *FileService) ReapExpiredFiles(ctx context.Context) (int, error) {
+	deleted := 0
+	for {
+		dbFiles, err := s.repo.Files.ListExpired(ctx, reapBatchSize)
+		if err != nil {
+			return deleted, fmt.Errorf("failed to list expired files: %w", err)
+		}
+
+		for _, f := range dbFiles {
+			if err := s.purgeFile(ctx, dbFileToDoamin(f), nil); err != nil {
+				return deleted, fmt.Errorf("failed to purge file %d: %w", f.ID, err)
+			}
+			deleted++
+		}
+
+		if len(dbFiles) < reapBatchSize {
+			return deleted, nil
+		}
+	}
+}
+
+// FileReaper periodically deletes expired files, abandoned incomplete uploads, data left
+// by uploads stored by hash and spent single-use download links in the background
+type FileReaper struct {
+	fileSvc  *FileService
+	logger   *zerolog.Logger
+	interval time.Duration
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewFileReaper creates a reaper that runs every interval. interval <= 0 disables it.
+func NewFileReaper(fileSvc *FileService, logger *zerolog.Logger, interval time.Duration) *FileReaper {
+	return &FileReaper{
+		fileSvc:  fileSvc,
+		logger:   logger,
+		interval: interval,
+	}
+}
+
+// Start launches the reaper. It runs until Stop is called.
+func (r *FileReaper) Start() {
+	if r.interval <= 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+
+	r.wg.Add(1)
+	go r.run(ctx)
+}
+
+// Stop signals the reaper and waits for the current pass to finish
+func (r *FileReaper) Stop() {
+	if r.cancel == nil {
+		return
+	}
+	r.cancel()
+	r.wg.Wait()
+	r.cancel = nil
+}
+
+func (r *FileReaper) run(ctx context.Context) {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := r.fileSvc.ReapExpiredFiles(ctx)
+		if err != nil && ctx.Err() == nil {
+			r.logger.Error().Err(err).Msg("failed to reap expired files")
+		}
+		if n > 0 {
+			r.logger.Info().Int("files", n).Msg("deleted expired files")
+		}
+		if _, err := r.fileSvc.DeleteExpiredSignedURLUses(ctx); err != nil && ctx.Err() == nil {
+			r.logger.Error().Err(err).Msg("failed to delete expired signed URL uses")
+		}
+		if _, err := r.fileSvc.DeleteExpiredUploadClaims(ctx); err != nil && ctx.Err() == nil {
+			r.logger.Error().Err(err).Msg("failed to delete expired upload claims")
+		}
+		n, err = r.fileSvc.ReapStaleUploads(ctx)
+		if err != nil && ctx.Err() == nil {
+			r.logger.Error().Err(err).Msg("failed to reap stale uploads")
+		}
+		if n > 0 {
+			r.logger.Info().Int("uploads", n).Msg("deleted stale incomplete uploads")
+		}
+		n, err = r.fileSvc.ReapLegacyUploads(ctx)
+		if err != nil && ctx.Err() == nil {
+			r.logger.Error().Err(err).Msg("failed to reap legacy uploads")
+		}
+		if n > 0 {
+			r.logger.Info().Int("objects", n).Msg("deleted data of uploads stored by hash")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,339 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zqz/web/backend/internal/domain"
+	"github.com/zqz/web/backend/internal/repository"
+	"github.com/zqz/web/backend/internal/service/storage"
+	"github.com/zqz/web/backend/internal/tests"
+)
+
+func TestFileServiceCreateFileExpiryValidation(t *testing.T) {
+	ctx := context.Background()
+	pg, cleanup := tests.SetupTestDB(t, ctx)
+	defer cleanup()
+
+	repo := repository.NewRepository(pg.Pool)
+	stor, err := storage.NewDiskStorage(t.TempDir())
+	require.NoError(t, err)
+	svc := NewFileService(repo, stor)
+
+	past := time.Now().UTC().Add(-time.Minute)
+	_, err = svc.CreateFile(ctx, domain.CreateFileRequest{
+		Name: "a.txt", Hash: testHash1, Size: 1, ContentType: contentTypePlain, ExpiresAt: &past,
+	}, 0)
+	assert.ErrorIs(t, err, ErrInvalidExpiry)
+
+	zero := int32(0)
+	_, err = svc.CreateFile(ctx, domain.CreateFileRequest{
+		Name: "a.txt", Hash: testHash1, Size: 1, ContentType: contentTypePlain, MaxDownloads: &zero,
+	}, 0)
+	assert.ErrorIs(t, err, ErrInvalidExpiry)
+}
+
+func TestFileServiceCreateFileDefaultTTL(t *testing.T) {
+	ctx := context.Background()
+	pg, cleanup := tests.SetupTestDB(t, ctx)
+	defer cleanup()
+
+	repo := repository.NewRepository(pg.Pool)
+	stor, err := storage.NewDiskStorage(t.TempDir())
+	require.NoError(t, err)
+	svc := NewFileService(repo, stor)
+
+	require.NoError(t, repo.Settings.Set(ctx, settingDefaultFileTTLHours, "24"))
+
+	file, err := svc.CreateFile(ctx, domain.CreateFileRequest{
+		Name: "a.txt", Hash: testHash1, Size: 1, ContentType: contentTypePlain,
+	}, 0)
+	require.NoError(t, err)
+	require.NotNil(t, file.ExpiresAt)
+	assert.WithinDuration(t, time.Now().UTC().Add(24*time.Hour), *file.ExpiresAt, time.Minute)
+
+	// An explicit expiry wins over the default
+	explicit := time.Now().UTC().Add(time.Hour)
+	file, err = svc.CreateFile(ctx, domain.CreateFileRequest{
+		Name: "b.txt", Hash: testHash2, Size: 1, ContentType: contentTypePlain, ExpiresAt: &explicit,
+	}, 0)
+	require.NoError(t, err)
+	require.NotNil(t, file.ExpiresAt)
+	assert.WithinDuration(t, explicit, *file.ExpiresAt, time.Second)
+}
+
+func TestFileServiceDownloadLimit(t *testing.T) {
+	ctx := context.Background()
+	pg, cleanup := tests.SetupTestDB(t, ctx)
+	defer cleanup()
+
+	repo := repository.NewRepository(pg.Pool)
+	stor, err := storage.NewDiskStorage(t.TempDir())
+	require.NoError(t, err)
+	svc := NewFileService(repo, stor)
+
+	limit := int32(2)
+	file := uploadTestFile(t, ctx, svc, []byte("twice"), domain.CreateFileRequest{MaxDownloads: &limit})
+
+	for i := 1; i <= 2; i++ {
+		reader, got, err := svc.DownloadFile(ctx, file.Slug, nil, false)
+		require.NoError(t, err)
+		reader.Close()
+		require.NoError(t, svc.RecordDownload(ctx, got, got.Size))
+		assert.Equal(t, int32(i), got.DownloadCount)
+	}
+
+	_, _, err = svc.DownloadFile(ctx, file.Slug, nil, false)
+	assert.ErrorIs(t, err, ErrFileExpired)
+	assert.ErrorIs(t, svc.RecordDownload(ctx, file, file.Size), ErrFileExpired)
+}
+
+func TestFileServiceRecordDownloadMetersBytes(t *testing.T) {
+	ctx := context.Background()
+	pg, cleanup := tests.SetupTestDB(t, ctx)
+	defer cleanup()
+
+	repo := repository.NewRepository(pg.Pool)
+	stor, err := storage.NewDiskStorage(t.TempDir())
+	require.NoError(t, err)
+	svc := NewFileService(repo, stor)
+
+	limit := int32(1)
+	file := uploadTestFile(t, ctx, svc, []byte("0123456789"), domain.CreateFileRequest{MaxDownloads: &limit})
+
+	// A download cut short and resumed adds up to one
+	require.NoError(t, svc.RecordDownload(ctx, file, 10))
+	require.NoError(t, svc.RefundDownload(ctx, file, 6))
+	require.NoError(t, svc.RecordDownload(ctx, file, 6))
+	assert.Equal(t, int32(1), file.DownloadCount)
+
+	// Ranges that skip the first byte still use up the limit
+	assert.ErrorIs(t, svc.RecordDownload(ctx, file, 9), ErrFileExpired)
+}
+
+func TestFileServiceUpdateFileExpiry(t *testing.T) {
+	ctx := context.Background()
+	pg, cleanup := tests.SetupTestDB(t, ctx)
+	defer cleanup()
+
+	repo := repository.NewRepository(pg.Pool)
+	stor, err := storage.NewDiskStorage(t.TempDir())
+	require.NoError(t, err)
+	svc := NewFileService(repo, stor)
+
+	admin := int32(1)
+	file := uploadTestFile(t, ctx, svc, []byte("update me"), domain.CreateFileRequest{})
+
+	at := time.Now().UTC().Add(2 * time.Hour)
+	limit := int32(5)
+	updated, err := svc.UpdateFile(ctx, file.Slug, UpdateFileRequest{ExpiresAt: &at, MaxDownloads: &limit}, &admin, true)
+	require.NoError(t, err)
+	require.NotNil(t, updated.ExpiresAt)
+	assert.WithinDuration(t, at, *updated.ExpiresAt, time.Second)
+	require.NotNil(t, updated.MaxDownloads)
+	assert.Equal(t, limit, *updated.MaxDownloads)
+
+	// Changing only the limit keeps the expiry; zero values clear both
+	clearLimit := int32(0)
+	updated, err = svc.UpdateFile(ctx, file.Slug, UpdateFileRequest{MaxDownloads: &clearLimit}, &admin, true)
+	require.NoError(t, err)
+	assert.NotNil(t, updated.ExpiresAt)
+	assert.Nil(t, updated.MaxDownloads)
+
+	never := time.Time{}
+	updated, err = svc.UpdateFile(ctx, file.Slug, UpdateFileRequest{ExpiresAt: &never}, &admin, true)
+	require.NoError(t, err)
+	assert.Nil(t, updated.ExpiresAt)
+
+	// An invalid expiry rejects the whole update: the rename and password aren't applied either
+	past := time.Now().UTC().Add(-time.Hour)
+	name, password := "renamed.txt", "secret"
+	_, err = svc.UpdateFile(ctx, file.Slug, UpdateFileRequest{Name: &name, Password: &password, ExpiresAt: &past}, &admin, true)
+	assert.ErrorIs(t, err, ErrInvalidExpiry)
+
+	unchanged, err := svc.GetFileBySlug(ctx, file.Slug, &admin, true)
+	require.NoError(t, err)
+	assert.Equal(t, file.Name, unchanged.Name)
+	assert.Nil(t, unchanged.PasswordHash)
+}
+
+func TestFileServiceReapExpiredFiles(t *testing.T) {
+	ctx := context.Background()
+	pg, cleanup := tests.SetupTestDB(t, ctx)
+	defer cleanup()
+
+	repo := repository.NewRepository(pg.Pool)
+	stor, err := storage.NewDiskStorage(t.TempDir())
+	require.NoError(t, err)
+	svc := NewFileService(repo, stor)
+
+	soon := time.Now().UTC().Add(time.Hour)
+	expired := uploadTestFile(t, ctx, svc, []byte("short lived"), domain.CreateFileRequest{ExpiresAt: &soon})
+	kept := uploadTestFile(t, ctx, svc, []byte("long lived"), domain.CreateFileRequest{})
+
+	// Move the expiry into the past
+	_, err = repo.Files.SetExpiry(ctx, repository.SetFileExpiryParams{
+		ID:        expired.ID,
+		ExpiresAt: pgtype.Timestamp{Time: time.Now().UTC().Add(-time.Minute), Valid: true},
+	})
+	require.NoError(t, err)
+
+	_, _, err = svc.DownloadFile(ctx, expired.Slug, nil, false)
+	assert.ErrorIs(t, err, ErrFileExpired)
+
+	n, err := svc.ReapExpiredFiles(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	_, err = svc.GetFileBySlug(ctx, expired.Slug, nil, true)
+	assert.ErrorIs(t, err, ErrFileNotFound)
+	exists, err := stor.Exists(ctx, expired.Hash)
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	_, err = svc.GetFileBySlug(ctx, kept.Slug, nil, true)
+	assert.NoError(t, err)
+
+	n, err = svc.ReapExpiredFiles(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+}
+
+func TestFileServiceReapStaleUploads(t *testing.T) {
+	ctx := context.Background()
+	pg, cleanup := tests.SetupTestDB(t, ctx)
+	defer cleanup()
+
+	repo := repository.NewRepository(pg.Pool)
+	stor, err := storage.NewDiskStorage(t.TempDir())
+	require.NoError(t, err)
+	svc := NewFileService(repo, stor)
+
+	ttl, err := svc.IncompleteUploadTTL(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, DefaultIncompleteUploadTTL, ttl)
+
+	// Two partial uploads and a staged tus upload; the first and the tus upload are then abandoned
+	partial := func(content []byte) *domain.File {
+		hash := sha256Hex(content)
+		_, err := svc.CreateFile(ctx, domain.CreateFileRequest{
+			Name: "partial.txt", Hash: hash, Size: int64(len(content)), ContentType: contentTypePlain,
+		}, 0)
+		require.NoError(t, err)
+		file, err := svc.UploadFileData(ctx, hash, bytes.NewReader(content[:4]), 0, nil)
+		require.NoError(t, err)
+		require.False(t, file.Finished())
+		return file
+	}
+	stale := partial([]byte("abandoned upload"))
+	active := partial([]byte("still uploading"))
+
+	tusContent := []byte("staged through tus")
+	upload, err := svc.CreateTusUpload(ctx, domain.CreateFileRequest{
+		Name: "tus.txt", Size: int64(len(tusContent)), ContentType: contentTypePlain,
+	}, 0)
+	require.NoError(t, err)
+	_, err = svc.WriteTusUpload(ctx, upload.ID, nil, 0, bytes.NewReader(tusContent[:4]), 0)
+	require.NoError(t, err)
+
+	_, err = pg.Pool.Exec(ctx, "UPDATE files SET updated_at = NOW() - INTERVAL '3 hours' WHERE id = $1", stale.ID)
+	require.NoError(t, err)
+	_, err = pg.Pool.Exec(ctx, "UPDATE tus_uploads SET updated_at = NOW() - INTERVAL '3 hours' WHERE id = $1", upload.ID)
+	require.NoError(t, err)
+
+	// Nothing is old enough for the default timeout
+	n, err := svc.ReapStaleUploads(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+
+	require.NoError(t, repo.Settings.Set(ctx, settingIncompleteUploadTTLHours, "2"))
+	stats, err := svc.IncompleteUploadStats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2*time.Hour, stats.TTL)
+	assert.Equal(t, int64(2), stats.Uploads)
+	assert.Equal(t, int64(8), stats.Bytes)
+	assert.Equal(t, int64(1), stats.Stale)
+	assert.Equal(t, int64(4), stats.StaleBytes)
+
+	n, err = svc.ReapStaleUploads(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	_, err = repo.Files.GetByID(ctx, stale.ID)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	_, err = repo.Blobs.Get(ctx, stale.Hash)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	for _, key := range []string{partialKey(stale.ID), tusStagingKey(upload.ID)} {
+		exists, err := stor.Exists(ctx, key)
+		require.NoError(t, err)
+		assert.False(t, exists, key)
+	}
+	_, err = svc.GetTusUpload(ctx, upload.ID, nil)
+	assert.ErrorIs(t, err, ErrTusUploadNotFound)
+
+	_, err = repo.Files.GetByID(ctx, active.ID)
+	assert.NoError(t, err)
+	exists, err := stor.Exists(ctx, partialKey(active.ID))
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	// The abandoned hash can be uploaded again from scratch
+	file, err := svc.CreateFile(ctx, domain.CreateFileRequest{
+		Name: "again.txt", Hash: stale.Hash, Size: stale.Size, ContentType: contentTypePlain,
+	}, 0)
+	require.NoError(t, err)
+	assert.Zero(t, file.BytesReceived)
+
+	// A timeout of 0 turns the sweeper off
+	require.NoError(t, repo.Settings.Set(ctx, settingIncompleteUploadTTLHours, "0"))
+	_, err = pg.Pool.Exec(ctx, "UPDATE files SET updated_at = NOW() - INTERVAL '30 days'")
+	require.NoError(t, err)
+	n, err = svc.ReapStaleUploads(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+}
+
+func TestFileServiceReapLegacyUploads(t *testing.T) {
+	ctx := context.Background()
+	pg, cleanup := tests.SetupTestDB(t, ctx)
+	defer cleanup()
+
+	repo := repository.NewRepository(pg.Pool)
+	stor, err := storage.NewDiskStorage(t.TempDir())
+	require.NoError(t, err)
+	svc := NewFileService(repo, stor)
+
+	// Data an upload stored under its hash before progress moved to file records
+	_, err = stor.Append(ctx, testHash1, bytes.NewReader([]byte("half")))
+	require.NoError(t, err)
+	require.NoError(t, stor.Put(ctx, testHash1+chunkKeyInfix+"8", bytes.NewReader([]byte("ahead"))))
+
+	// The same content since uploaded in full; its blob now lives under the hash
+	done := uploadTestFile(t, ctx, svc, []byte("uploaded again"), domain.CreateFileRequest{})
+
+	_, err = pg.Pool.Exec(ctx, "INSERT INTO legacy_upload_objects (key, hash) VALUES ($1, $2), ($3, $2), ($4, $4)",
+		testHash1, testHash1, testHash1+chunkKeyInfix+"8", done.Hash)
+	require.NoError(t, err)
+
+	n, err := svc.ReapLegacyUploads(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	for _, key := range []string{testHash1, testHash1 + chunkKeyInfix + "8"} {
+		exists, err := stor.Exists(ctx, key)
+		require.NoError(t, err)
+		assert.False(t, exists, key)
+	}
+	exists, err := stor.Exists(ctx, done.Hash)
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	left, err := repo.Blobs.ListLegacyUploads(ctx, 10)
+	require.NoError(t, err)
+	assert.Empty(t, left)
+}
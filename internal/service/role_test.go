@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zqz/web/backend/internal/domain"
+	"github.com/zqz/web/backend/internal/repository"
+	"github.com/zqz/web/backend/internal/service/storage"
+	"github.com/zqz/web/backend/internal/tests"
+)
+
+func TestSetRole(t *testing.T) {
+	ctx := context.Background()
+	pg, cleanup := tests.SetupTestDB(t, ctx)
+	defer cleanup()
+
+	repo := repository.NewRepository(pg.Pool)
+	svc := NewUserService(repo)
+
+	admin, err := svc.GetOrCreateUser(ctx, domain.CreateUserRequest{
+		Name: "Admin", Email: "admin@example.com", Provider: testProviderGoogle, ProviderID: "admin-1",
+	})
+	require.NoError(t, err)
+	require.Equal(t, domain.RoleAdmin, admin.Role)
+	member, err := svc.GetOrCreateUser(ctx, domain.CreateUserRequest{
+		Name: "Member", Email: "member@example.com", Provider: testProviderGoogle, ProviderID: "member-1",
+	})
+	require.NoError(t, err)
+
+	_, err = svc.SetRole(ctx, member.ID, "superuser")
+	assert.ErrorIs(t, err, ErrInvalidRole)
+	_, err = svc.SetRole(ctx, admin.ID, domain.RoleModerator)
+	assert.ErrorIs(t, err, ErrLastAdmin)
+
+	moderator, err := svc.SetRole(ctx, member.ID, domain.RoleModerator)
+	require.NoError(t, err)
+	assert.True(t, moderator.Can(domain.PermBanUsers))
+	assert.False(t, moderator.Can(domain.PermManageSettings))
+
+	// With a second admin the first can step down
+	_, err = svc.SetRole(ctx, member.ID, domain.RoleAdmin)
+	require.NoError(t, err)
+	demoted, err := svc.SetRole(ctx, admin.ID, domain.RoleReadOnly)
+	require.NoError(t, err)
+	assert.False(t, demoted.Can(domain.PermUploadFiles))
+}
+
+func TestRolesGateUploadsAndModeration(t *testing.T) {
+	ctx := context.Background()
+	pg, cleanup := tests.SetupTestDB(t, ctx)
+	defer cleanup()
+
+	repo := repository.NewRepository(pg.Pool)
+	stor, err := storage.NewDiskStorage(t.TempDir())
+	require.NoError(t, err)
+	svc := NewFileService(repo, stor)
+
+	owner, err := repo.Users.Create(ctx, repository.CreateUserParams{
+		Name: testOwnerName, Email: testOwnerEmail, Provider: testProviderGoogle, ProviderID: testOwnerProviderID, Role: testRoleMember,
+	})
+	require.NoError(t, err)
+	reader, err := repo.Users.Create(ctx, repository.CreateUserParams{
+		Name: "Reader", Email: "reader@example.com", Provider: testProviderGoogle, ProviderID: "reader-1", Role: domain.RoleReadOnly,
+	})
+	require.NoError(t, err)
+
+	_, err = svc.CreateFile(ctx, domain.CreateFileRequest{
+		Name: "nope.txt", Hash: testHash2, Size: 100, ContentType: contentTypePlain, UserID: &reader.ID,
+	}, 0)
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+
+	file, err := svc.CreateFile(ctx, domain.CreateFileRequest{
+		Name: "mine.txt", Hash: testHash1, Size: 100, ContentType: contentTypePlain, UserID: &owner.ID, Private: true,
+	}, 0)
+	require.NoError(t, err)
+
+	// The service trusts the caller's moderator flag, which handlers derive from domain.PermModerateFiles
+	_, err = svc.GetFileBySlug(ctx, file.Slug, &reader.ID, false)
+	assert.ErrorIs(t, err, ErrFileNotFound)
+	_, err = svc.GetFileBySlug(ctx, file.Slug, &reader.ID, true)
+	assert.NoError(t, err)
+	assert.NoError(t, svc.DeleteFile(ctx, file.Slug, &reader.ID, true))
+}
+
+func TestReadOnlyUsersCantManageTheirFiles(t *testing.T) {
+	ctx := context.Background()
+	pg, cleanup := tests.SetupTestDB(t, ctx)
+	defer cleanup()
+
+	repo := repository.NewRepository(pg.Pool)
+	stor, err := storage.NewDiskStorage(t.TempDir())
+	require.NoError(t, err)
+	svc := NewFileService(repo, stor)
+	albums := NewAlbumService(repo, svc)
+
+	owner := createTestUser(t, ctx, repo, "demoted")
+	file, err := svc.CreateFile(ctx, domain.CreateFileRequest{
+		Name: "mine.txt", Hash: testHash1, Size: 100, ContentType: contentTypePlain, UserID: &owner,
+	}, 0)
+	require.NoError(t, err)
+	album, err := albums.CreateAlbum(ctx, owner, domain.CreateAlbumRequest{Name: "Mine"})
+	require.NoError(t, err)
+
+	readOnly := domain.RoleReadOnly
+	_, err = repo.Users.Update(ctx, repository.UpdateUserParams{ID: owner, Role: &readOnly})
+	require.NoError(t, err)
+
+	// Files they already own can still be read, but not changed, shared or deleted
+	_, err = svc.GetFileBySlug(ctx, file.Slug, &owner, false)
+	require.NoError(t, err)
+	name := "renamed.txt"
+	_, err = svc.UpdateFile(ctx, file.Slug, UpdateFileRequest{Name: &name}, &owner, false)
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+	password := "hunter22"
+	_, err = svc.UpdateFile(ctx, file.Slug, UpdateFileRequest{Password: &password}, &owner, false)
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+	_, _, err = svc.SignDownloadURL(ctx, file.Slug, &owner, false, time.Hour, false)
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+	assert.ErrorIs(t, svc.DeleteFile(ctx, file.Slug, &owner, false), ErrPermissionDenied)
+
+	_, err = albums.CreateAlbum(ctx, owner, domain.CreateAlbumRequest{Name: "Another"})
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+	_, err = albums.UpdateAlbum(ctx, album.Slug, domain.UpdateAlbumRequest{Name: &name}, &owner, false)
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+	assert.ErrorIs(t, albums.DeleteAlbum(ctx, album.Slug, &owner, false), ErrPermissionDenied)
+
+	// Moderators act through their own permission
+	_, err = svc.UpdateFile(ctx, file.Slug, UpdateFileRequest{Name: &name}, &owner, true)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,320 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/zqz/web/backend/internal/repository"
+	"github.com/zqz/web/backend/internal/service/storage"
+)
+
+// DefaultScrubMinAge is how old a stored file must be before Scrub calls it an orphan.
+// Uploads write data before (or while) the rows that reference it, so younger files may
+// belong to an upload in flight.
+const DefaultScrubMinAge = time.Hour
+
+// scrubThumbnailBatchSize is how many thumbnails Scrub reads per query
+const scrubThumbnailBatchSize = 500
+
+// ScrubOptions controls a Scrub run
+type ScrubOptions struct {
+	// CheckHash re-hashes every completed blob, which reads all stored data
+	CheckHash bool
+	// Apply deletes orphaned files and thumbnail rows whose data is missing. Otherwise Scrub only reports.
+	Apply bool
+	// MinAge is how old an unreferenced file must be to count as an orphan
+	MinAge time.Duration
+}
+
+// ScrubReport is the result of Scrub
+type ScrubReport struct {
+	StorageReport // Problems with blobs and thumbnails the database knows about
+
+	Options    ScrubOptions
+	StartedAt  time.Time
+	FinishedAt time.Time
+
+	Objects     int              // Files found in storage
+	Orphans     []storage.Object // Stored files nothing in the database refers to
+	OrphanBytes int64
+
+	DeletedOrphans    int // Orphans removed (Apply only)
+	DeletedThumbnails int // Thumbnail rows removed because their data is missing (Apply only)
+}
+
+// Scrub reconciles storage with the database. It checks completed blobs like VerifyStorage,
+// finds thumbnail rows without data, and lists stored files that no blob, thumbnail, tus
+// upload, unfinished file or parked chunk refers to. With opts.Apply it deletes the orphans and the dangling
+// thumbnail rows (the image can be re-queued for a new thumbnail). Blobs with missing or
+// damaged data are only reported: the files using them belong to users.
+func (s *FileService) Scrub(ctx context.Context, opts ScrubOptions) (*ScrubReport, error) {
+	report := &ScrubReport{Options: opts, StartedAt: time.Now()}
+	defer func() { report.FinishedAt = time.Now() }()
+
+	blobs := make(map[string]bool)
+	if err := s.verifyBlobs(ctx, opts.CheckHash, &report.StorageReport, func(hash string) { blobs[hash] = true }); err != nil {
+		return report, err
+	}
+
+	missing, err := s.missingThumbnails(ctx, report)
+	if err != nil {
+		return report, err
+	}
+
+	cutoff := report.StartedAt.Add(-opts.MinAge)
+	err = s.storage.List(ctx, func(o storage.Object) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		report.Objects++
+		if o.ModTime.After(cutoff) {
+			return nil
+		}
+		referenced, err := s.referenced(ctx, o.Key, blobs)
+		if err != nil {
+			return err
+		}
+		if !referenced {
+			report.Orphans = append(report.Orphans, o)
+			report.OrphanBytes += o.Size
+		}
+		return nil
+	})
+	if err != nil {
+		return report, fmt.Errorf("failed to list storage: %w", err)
+	}
+
+	if !opts.Apply {
+		return report, nil
+	}
+
+	for _, t := range missing {
+		if err := s.repo.Thumbnails.Delete(ctx, t.ID); err != nil {
+			return report, fmt.Errorf("failed to delete thumbnail %d: %w", t.ID, err)
+		}
+		report.DeletedThumbnails++
+	}
+	for _, o := range report.Orphans {
+		deleted, err := s.deleteOrphan(ctx, o.Key)
+		if err != nil {
+			return report, err
+		}
+		if deleted {
+			report.DeletedOrphans++
+		}
+	}
+
+	return report, nil
+}
+
+// missingThumbnails adds a problem to report for every thumbnail row whose data isn't stored and returns those rows
+func (s *FileService) missingThumbnails(ctx context.Context, report *ScrubReport) ([]*repository.Thumbnail, error) {
+	var missing []*repository.Thumbnail
+	var after int32
+	for {
+		thumbnails, err := s.repo.Thumbnails.List(ctx, after, scrubThumbnailBatchSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list thumbnails: %w", err)
+		}
+		for _, t := range thumbnails {
+			exists, err := s.storage.Exists(ctx, t.Hash)
+			if err != nil {
+				return nil, fmt.Errorf("failed to check thumbnail %d: %w", t.ID, err)
+			}
+			if !exists {
+				missing = append(missing, t)
+				report.Problems = append(report.Problems, StorageProblem{
+					Hash:    t.Hash,
+					Problem: StorageProblemThumbnailMissing,
+					Detail:  fmt.Sprintf("thumbnail %d of file %d", t.ID, t.FileID),
+				})
+			}
+		}
+		if len(thumbnails) < scrubThumbnailBatchSize {
+			return missing, nil
+		}
+		after = thumbnails[len(thumbnails)-1].ID
+	}
+}
+
+// referenced reports whether anything in the database refers to the storage key.
+// blobs holds the known blob hashes; when nil the blobs table is queried instead.
+func (s *FileService) referenced(ctx context.Context, key string, blobs map[string]bool) (bool, error) {
+	if id, ok := strings.CutPrefix(key, tusStagingPrefix); ok {
+		return rowExists(s.repo.TusUploads.Get(ctx, id))
+	}
+	if strings.HasPrefix(key, uploadStagingPrefix) {
+		// Only ever held for the length of a request
+		return false, nil
+	}
+	if fileID, _, ok := parseChunkKey(key); ok {
+		chunks, err := s.repo.Chunks.ListByFileID(ctx, fileID)
+		if err != nil {
+			return false, fmt.Errorf("failed to list chunks: %w", err)
+		}
+		for _, c := range chunks {
+			if c.Key == key {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	if fileID, ok := parsePartialKey(key); ok {
+		// Kept until the record's upload completes
+		f, err := s.repo.Files.GetByID(ctx, fileID)
+		if errors.Is(err, repository.ErrNotFound) {
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to look up storage reference: %w", err)
+		}
+		return f.BytesReceived < f.Size, nil
+	}
+
+	if blobs != nil {
+		if blobs[key] {
+			return true, nil
+		}
+	} else if ok, err := rowExists(s.repo.Blobs.Get(ctx, key)); ok || err != nil {
+		return ok, err
+	}
+
+	n, err := s.repo.Thumbnails.CountByHash(ctx, key)
+	if err != nil {
+		return false, fmt.Errorf("failed to count thumbnails: %w", err)
+	}
+	return n > 0, nil
+}
+
+// rowExists turns the result of a repository lookup into whether the row exists
+func rowExists(_ any, err error) (bool, error) {
+	if errors.Is(err, repository.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to look up storage reference: %w", err)
+	}
+	return true, nil
+}
+
+// deleteOrphan deletes an orphaned storage key unless something has started using it since it was listed
+func (s *FileService) deleteOrphan(ctx context.Context, key string) (bool, error) {
+	fileID, _, ok := parseChunkKey(key)
+	if !ok {
+		fileID, ok = parsePartialKey(key)
+	}
+	if ok {
+		// Leave the key alone while a request is writing the upload
+		_, release, err := s.claimUpload(ctx, partialKey(fileID))
+		if errors.Is(err, ErrUploadInProgress) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		defer release()
+	}
+
+	referenced, err := s.referenced(ctx, key, nil)
+	if err != nil || referenced {
+		return false, err
+	}
+	if err := s.storage.Delete(ctx, key); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to delete %s: %w", key, err)
+	}
+	return true, nil
+}
+
+// ScrubStatus is what StorageScrubber knows about the current and last scrub
+type ScrubStatus struct {
+	Running bool
+	Last    *ScrubReport // Nil until a scrub has finished
+	Err     error        // Why the last scrub stopped early, if it did
+}
+
+// StorageScrubber runs Scrub in the background, one at a time, and remembers the last result
+type StorageScrubber struct {
+	fileSvc *FileService
+	logger  *zerolog.Logger
+
+	mu      sync.Mutex
+	running bool
+	last    *ScrubReport
+	lastErr error
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewStorageScrubber creates an idle scrubber
+func NewStorageScrubber(fileSvc *FileService, logger *zerolog.Logger) *StorageScrubber {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &StorageScrubber{
+		fileSvc: fileSvc,
+		logger:  logger,
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// Start begins a scrub and returns immediately. Returns ErrScrubRunning if one is in progress.
+func (sc *StorageScrubber) Start(opts ScrubOptions) error {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if sc.running {
+		return ErrScrubRunning
+	}
+	if err := sc.ctx.Err(); err != nil {
+		return err
+	}
+	sc.running = true
+
+	sc.wg.Add(1)
+	go sc.run(opts)
+	return nil
+}
+
+// Status returns whether a scrub is running and the result of the last one
+func (sc *StorageScrubber) Status() ScrubStatus {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return ScrubStatus{Running: sc.running, Last: sc.last, Err: sc.lastErr}
+}
+
+// Stop cancels a running scrub and waits for it to return
+func (sc *StorageScrubber) Stop() {
+	sc.cancel()
+	sc.wg.Wait()
+}
+
+func (sc *StorageScrubber) run(opts ScrubOptions) {
+	defer sc.wg.Done()
+
+	report, err := sc.fileSvc.Scrub(sc.ctx, opts)
+	if err != nil && sc.ctx.Err() == nil {
+		sc.logger.Error().Err(err).Msg("storage scrub failed")
+	}
+	sc.logger.Info().
+		Bool("apply", opts.Apply).
+		Int("checked", report.Checked).
+		Int("problems", len(report.Problems)).
+		Int("orphans", len(report.Orphans)).
+		Int("deleted", report.DeletedOrphans).
+		Msg("storage scrub finished")
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.running = false
+	sc.last = report
+	sc.lastErr = err
+}
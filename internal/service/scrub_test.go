@@ -0,0 +1,125 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zqz/web/backend/internal/domain"
+	"github.com/zqz/web/backend/internal/repository"
+	"github.com/zqz/web/backend/internal/service/storage"
+	"github.com/zqz/web/backend/internal/tests"
+)
+
+func TestParseChunkKey(t *testing.T) {
+	fileID, offset, ok := parseChunkKey(chunkKey(42, 1024, "f00d"))
+	assert.True(t, ok)
+	assert.Equal(t, int32(42), fileID)
+	assert.Equal(t, int64(1024), offset)
+	fileID, offset, ok = parseChunkKey(partialKey(42) + ".chunk-16")
+	assert.True(t, ok, "keys from before chunks had a token")
+	assert.Equal(t, int32(42), fileID)
+	assert.Equal(t, int64(16), offset)
+
+	_, _, ok = parseChunkKey(partialKey(42))
+	assert.False(t, ok)
+	_, _, ok = parseChunkKey(testHash1 + ".chunk-16")
+	assert.False(t, ok)
+	_, _, ok = parseChunkKey(partialKey(42) + ".chunk-x")
+	assert.False(t, ok)
+
+	fileID, ok = parsePartialKey(partialKey(42))
+	assert.True(t, ok)
+	assert.Equal(t, int32(42), fileID)
+	_, ok = parsePartialKey(testHash1)
+	assert.False(t, ok)
+}
+
+func TestFileServiceScrub(t *testing.T) {
+	ctx := context.Background()
+	pg, cleanup := tests.SetupTestDB(t, ctx)
+	defer cleanup()
+
+	repo := repository.NewRepository(pg.Pool)
+	dir := t.TempDir()
+	stor, err := storage.NewDiskStorage(dir)
+	require.NoError(t, err)
+	svc := NewFileService(repo, stor)
+
+	content := []byte("scrub me")
+	file := uploadTestFile(t, ctx, svc, content, domain.CreateFileRequest{})
+
+	// An unfinished upload's data is kept however old it is
+	unfinished, err := svc.CreateFile(ctx, domain.CreateFileRequest{
+		Name: "half.txt", Hash: testHash2, Size: 100, ContentType: contentTypePlain,
+	}, 0)
+	require.NoError(t, err)
+	_, err = svc.UploadFileData(ctx, testHash2, bytes.NewReader([]byte("half")), 0, nil)
+	require.NoError(t, err)
+
+	// A thumbnail row whose data was never stored
+	_, err = repo.Thumbnails.Create(ctx, repository.CreateThumbnailParams{FileID: file.ID, Hash: testHash2, Width: 1, Height: 1})
+	require.NoError(t, err)
+
+	// Leftovers nothing refers to, and one written too recently to judge
+	old := time.Now().Add(-2 * time.Hour)
+	orphans := []string{testHash3, "upload-abandoned", chunkKey(unfinished.ID+1, 16, "f00d"), partialKey(unfinished.ID + 1), "tus-gone"}
+	for _, key := range orphans {
+		require.NoError(t, stor.Put(ctx, key, bytes.NewReader([]byte("orphan"))))
+		require.NoError(t, os.Chtimes(filepath.Join(dir, key), old, old))
+	}
+	require.NoError(t, stor.Put(ctx, "upload-in-flight", bytes.NewReader([]byte("new"))))
+	require.NoError(t, os.Chtimes(filepath.Join(dir, file.Hash), old, old))
+	require.NoError(t, os.Chtimes(filepath.Join(dir, partialKey(unfinished.ID)), old, old))
+
+	opts := ScrubOptions{MinAge: time.Hour}
+	report, err := svc.Scrub(ctx, opts)
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Checked)
+	assert.Equal(t, 8, report.Objects)
+	require.Len(t, report.Problems, 1)
+	assert.Equal(t, StorageProblemThumbnailMissing, report.Problems[0].Problem)
+	assert.Len(t, report.Orphans, len(orphans))
+	assert.Equal(t, int64(len(orphans)*len("orphan")), report.OrphanBytes)
+	assert.Zero(t, report.DeletedOrphans)
+	exists, err := stor.Exists(ctx, testHash3)
+	require.NoError(t, err)
+	assert.True(t, exists, "a dry run deletes nothing")
+
+	opts.Apply = true
+	report, err = svc.Scrub(ctx, opts)
+	require.NoError(t, err)
+	assert.Equal(t, len(orphans), report.DeletedOrphans)
+	assert.Equal(t, 1, report.DeletedThumbnails)
+	for _, key := range orphans {
+		exists, err := stor.Exists(ctx, key)
+		require.NoError(t, err)
+		assert.False(t, exists, key)
+	}
+	for _, key := range []string{file.Hash, "upload-in-flight", partialKey(unfinished.ID)} {
+		exists, err := stor.Exists(ctx, key)
+		require.NoError(t, err)
+		assert.True(t, exists, key)
+	}
+	thumbnails, err := repo.Thumbnails.ListByFileID(ctx, file.ID)
+	require.NoError(t, err)
+	assert.Empty(t, thumbnails)
+
+	// Damage the blob without changing its size: only a hash check notices
+	require.NoError(t, os.WriteFile(filepath.Join(dir, file.Hash), []byte("scrub us"), 0o644))
+	report, err = svc.Scrub(ctx, ScrubOptions{MinAge: time.Hour})
+	require.NoError(t, err)
+	assert.Empty(t, report.Problems)
+	report, err = svc.Scrub(ctx, ScrubOptions{MinAge: time.Hour, CheckHash: true, Apply: true})
+	require.NoError(t, err)
+	require.Len(t, report.Problems, 1)
+	assert.Equal(t, StorageProblemHashMismatch, report.Problems[0].Problem)
+	exists, err = stor.Exists(ctx, file.Hash)
+	require.NoError(t, err)
+	assert.True(t, exists, "damaged blobs are reported, not deleted")
+}
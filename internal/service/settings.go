@@ -0,0 +1,45 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/zqz/web/backend/internal/domain"
+	"github.com/zqz/web/backend/internal/repository"
+	"github.com/zqz/web/backend/internal/telemetry"
+)
+
+// SettingsService changes site settings (admin only; caller must enforce). Settings are
+// read straight from the repository; writes go through here so they are audited.
+type SettingsService struct {
+	repo *repository.Repository
+}
+
+// NewSettingsService creates a new settings service
+func NewSettingsService(repo *repository.Repository) *SettingsService {
+	return &SettingsService{repo: repo}
+}
+
+// Set stores value under key
+func (s *SettingsService) Set(ctx context.Context, key, value string) error {
+	ctx, span := telemetry.Start(ctx, "SettingsService.Set")
+	defer span.End()
+
+	// The change and its audit event are committed together
+	return s.repo.WithTransaction(ctx, func(ctx context.Context, repo *repository.Repository) error {
+		var before any
+		old, err := repo.Settings.Get(ctx, key)
+		switch {
+		case err == nil:
+			before = map[string]any{"value": old}
+		case !errors.Is(err, repository.ErrNotFound):
+			return fmt.Errorf("failed to get setting: %w", err)
+		}
+
+		if err := repo.Settings.Set(ctx, key, value); err != nil {
+			return fmt.Errorf("failed to set setting: %w", err)
+		}
+		return recordAudit(ctx, repo, domain.AuditSettingUpdate, domain.AuditTargetSetting, key, before, map[string]any{"value": value})
+	})
+}
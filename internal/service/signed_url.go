@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/zqz/web/backend/internal/domain"
+	"github.com/zqz/web/backend/internal/telemetry"
+)
+
+const (
+	// DefaultSignedURLTTL is used when a signed URL is requested without a lifetime
+	DefaultSignedURLTTL = time.Hour
+	maxSignedURLTTL     = 7 * 24 * time.Hour
+)
+
+// DownloadSignature grants access to one file's download without a session
+type DownloadSignature struct {
+	ExpiresAt time.Time
+	// Nonce is set for single-use URLs
+	Nonce     string
+	Signature string
+}
+
+// Query encodes the signature as URL query parameters
+func (d DownloadSignature) Query() url.Values {
+	q := url.Values{}
+	q.Set("expires", strconv.FormatInt(d.ExpiresAt.Unix(), 10))
+	if d.Nonce != "" {
+		q.Set("nonce", d.Nonce)
+	}
+	q.Set("sig", d.Signature)
+	return q
+}
+
+// SingleUse reports whether the URL stops working after its first request
+func (d DownloadSignature) SingleUse() bool {
+	return d.Nonce != ""
+}
+
+// ParseDownloadSignature reads a signature from URL query parameters.
+// Returns false if the request isn't signed; a malformed signature fails verification later.
+func ParseDownloadSignature(q url.Values) (DownloadSignature, bool) {
+	sig := q.Get("sig")
+	if sig == "" {
+		return DownloadSignature{}, false
+	}
+	unix, _ := strconv.ParseInt(q.Get("expires"), 10, 64)
+	return DownloadSignature{
+		ExpiresAt: time.Unix(unix, 0).UTC(),
+		Nonce:     q.Get("nonce"),
+		Signature: sig,
+	}, true
+}
+
+// SignDownloadURL creates a signature that lets anyone holding it download the
+// file until ttl has passed (or, if singleUse, only once). Only the owner or a moderator can sign.
+func (s *FileService) SignDownloadURL(ctx context.Context, slug string, userID *int32, moderator bool, ttl time.Duration, singleUse bool) (*domain.File, DownloadSignature, error) {
+	ctx, span := telemetry.Start(ctx, "FileService.SignDownloadURL")
+	defer span.End()
+
+	if ttl <= 0 || ttl > maxSignedURLTTL {
+		return nil, DownloadSignature{}, ErrInvalidSignedURLTTL
+	}
+
+	if err := s.checkCanManageFiles(ctx, userID, moderator); err != nil {
+		return nil, DownloadSignature{}, err
+	}
+
+	file, err := s.GetFileBySlug(ctx, slug, userID, moderator)
+	if err != nil {
+		return nil, DownloadSignature{}, err
+	}
+	if userID == nil || (!file.IsOwnedBy(*userID) && !moderator) {
+		return nil, DownloadSignature{}, ErrUnauthorized
+	}
+
+	d := DownloadSignature{ExpiresAt: time.Now().UTC().Add(ttl).Truncate(time.Second)}
+	if singleUse {
+		nonce := make([]byte, 16)
+		rand.Read(nonce)
+		d.Nonce = base64.RawURLEncoding.EncodeToString(nonce)
+	}
+	d.Signature = s.signDownload(slug, d)
+	return file, d, nil
+}
+
+// DownloadFileSigned returns a reader for a file using a signed URL in place of a
+// session. Visibility and share passwords don't apply; the owner granted access by signing.
+// A single-use signature is not spent here: call UseSignedURL before sending the file.
+func (s *FileService) DownloadFileSigned(ctx context.Context, slug string, d DownloadSignature) (io.ReadSeekCloser, *domain.File, error) {
+	ctx, span := telemetry.Start(ctx, "FileService.DownloadFileSigned")
+	defer span.End()
+
+	if !hmac.Equal([]byte(d.Signature), []byte(s.signDownload(slug, d))) {
+		return nil, nil, ErrInvalidSignature
+	}
+	if !time.Now().Before(d.ExpiresAt) {
+		return nil, nil, ErrSignedURLExpired
+	}
+
+	file, err := s.GetFileBySlug(ctx, slug, nil, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Signing doesn't get around a ban that hides the owner's files
+	hidden, err := s.hiddenByBan(ctx, file, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if hidden {
+		return nil, nil, ErrFileNotFound
+	}
+	if err := checkDownloadable(file); err != nil {
+		return nil, nil, err
+	}
+
+	reader, err := s.openFile(ctx, file)
+	if err != nil {
+		return nil, nil, err
+	}
+	return reader, file, nil
+}
+
+// UseSignedURL spends a single-use signature checked by DownloadFileSigned. Returns
+// ErrSignedURLExpired if it has been used before. Signatures without a nonce are left alone.
+func (s *FileService) UseSignedURL(ctx context.Context, d DownloadSignature) error {
+	if !d.SingleUse() {
+		return nil
+	}
+	first, err := s.repo.SignedURLs.Use(ctx, d.Nonce, d.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to record signed URL use: %w", err)
+	}
+	if !first {
+		return ErrSignedURLExpired
+	}
+	return nil
+}
+
+// DeleteExpiredSignedURLUses forgets used single-use nonces whose URLs have expired anyway
+func (s *FileService) DeleteExpiredSignedURLUses(ctx context.Context) (int64, error) {
+	n, err := s.repo.SignedURLs.DeleteExpired(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired signed URL uses: %w", err)
+	}
+	return n, nil
+}
+
+func (s *FileService) signDownload(slug string, d DownloadSignature) string {
+	mac := hmac.New(sha256.New, s.urlKey)
+	mac.Write([]byte(slug + "\n" + strconv.FormatInt(d.ExpiresAt.Unix(), 10) + "\n" + d.Nonce))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadSignatureQueryRoundTrip(t *testing.T) {
+	d := DownloadSignature{ExpiresAt: time.Unix(1700000000, 0).UTC(), Nonce: "n0nce", Signature: "sig"}
+	got, ok := ParseDownloadSignature(d.Query())
+	require.True(t, ok)
+	assert.Equal(t, d, got)
+	assert.True(t, got.SingleUse())
+
+	_, ok = ParseDownloadSignature(nil)
+	assert.False(t, ok)
+}
+
+func TestFileServiceDownloadFileSignedRejects(t *testing.T) {
+	ctx := context.Background()
+	svc := NewFileService(nil, nil)
+	svc.SetSigningSecret("test-secret")
+
+	valid := DownloadSignature{ExpiresAt: time.Now().UTC().Add(time.Hour).Truncate(time.Second)}
+	valid.Signature = svc.signDownload("abc123", valid)
+
+	// Signed for another slug
+	_, _, err := svc.DownloadFileSigned(ctx, "other", valid)
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+
+	// Expiry extended without re-signing
+	tampered := valid
+	tampered.ExpiresAt = valid.ExpiresAt.Add(time.Hour)
+	_, _, err = svc.DownloadFileSigned(ctx, "abc123", tampered)
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+
+	// Signed by a server with a different secret
+	other := NewFileService(nil, nil)
+	other.SetSigningSecret("another-secret")
+	_, _, err = other.DownloadFileSigned(ctx, "abc123", valid)
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+
+	expired := DownloadSignature{ExpiresAt: time.Now().UTC().Add(-time.Minute).Truncate(time.Second)}
+	expired.Signature = svc.signDownload("abc123", expired)
+	_, _, err = svc.DownloadFileSigned(ctx, "abc123", expired)
+	assert.ErrorIs(t, err, ErrSignedURLExpired)
+}
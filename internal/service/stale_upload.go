@@ -0,0 +1,205 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/zqz/web/backend/internal/repository"
+	"github.com/zqz/web/backend/internal/service/storage"
+)
+
+// settingIncompleteUploadTTLHours is how many hours an unfinished upload may go without data before it is swept
+const settingIncompleteUploadTTLHours = "incomplete_upload_ttl_hours"
+
+// DefaultIncompleteUploadTTL applies when the incomplete_upload_ttl_hours setting is unset or invalid
+const DefaultIncompleteUploadTTL = 24 * time.Hour
+
+// staleUploadBatchSize is how many stale uploads are removed per query
+const staleUploadBatchSize = 100
+
+// IncompleteUploads summarises unfinished uploads for the admin panel
+type IncompleteUploads struct {
+	TTL        time.Duration // 0 = never swept
+	Uploads    int64
+	Bytes      int64
+	Stale      int64 // Inactive for longer than TTL; removed on the next sweep
+	StaleBytes int64
+}
+
+// IncompleteUploadTTL returns how long an unfinished upload may go without receiving data
+// before ReapStaleUploads removes it. 0 means never.
+func (s *FileService) IncompleteUploadTTL(ctx context.Context) (time.Duration, error) {
+	val, err := s.repo.Settings.Get(ctx, settingIncompleteUploadTTLHours)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return DefaultIncompleteUploadTTL, nil
+		}
+		return 0, fmt.Errorf("failed to get setting: %w", err)
+	}
+	hours, err := strconv.ParseInt(val, 10, 64)
+	if err != nil || hours < 0 {
+		return DefaultIncompleteUploadTTL, nil
+	}
+	return time.Duration(hours) * time.Hour, nil
+}
+
+// IncompleteUploadStats counts unfinished uploads and the space their data takes up
+func (s *FileService) IncompleteUploadStats(ctx context.Context) (*IncompleteUploads, error) {
+	ttl, err := s.IncompleteUploadTTL(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// With sweeping disabled nothing is older than the zero time, so nothing is stale
+	var cutoff time.Time
+	if ttl > 0 {
+		cutoff = time.Now().UTC().Add(-ttl)
+	}
+	stats, err := s.repo.Files.IncompleteUploadStats(ctx, cutoff)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count incomplete uploads: %w", err)
+	}
+
+	return &IncompleteUploads{
+		TTL:        ttl,
+		Uploads:    stats.Uploads,
+		Bytes:      stats.Bytes,
+		Stale:      stats.StaleUploads,
+		StaleBytes: stats.StaleBytes,
+	}, nil
+}
+
+// ReapStaleUploads removes uploads that have received no data for longer than
+// IncompleteUploadTTL: unfinished file records with their partial data and parked
+// chunks, and abandoned tus uploads with their staged data. Returns the number of
+// file records and tus uploads removed.
+func (s *FileService) ReapStaleUploads(ctx context.Context) (int, error) {
+	ttl, err := s.IncompleteUploadTTL(ctx)
+	if err != nil || ttl <= 0 {
+		return 0, err
+	}
+	cutoff := time.Now().UTC().Add(-ttl)
+
+	removed := 0
+	for {
+		dbFiles, err := s.repo.Files.ListStaleIncomplete(ctx, cutoff, staleUploadBatchSize)
+		if err != nil {
+			return removed, fmt.Errorf("failed to list stale uploads: %w", err)
+		}
+
+		for _, f := range dbFiles {
+			ok, err := s.purgeStaleFile(ctx, f)
+			if err != nil {
+				return removed, fmt.Errorf("failed to purge stale upload %d: %w", f.ID, err)
+			}
+			if ok {
+				removed++
+			}
+		}
+
+		if len(dbFiles) < staleUploadBatchSize {
+			break
+		}
+	}
+
+	for {
+		uploads, err := s.repo.TusUploads.ListStale(ctx, cutoff, staleUploadBatchSize)
+		if err != nil {
+			return removed, fmt.Errorf("failed to list stale tus uploads: %w", err)
+		}
+
+		for _, u := range uploads {
+			if u.Hash == nil {
+				if err := s.storage.Delete(ctx, tusStagingKey(u.ID)); err != nil && !errors.Is(err, storage.ErrNotFound) {
+					return removed, fmt.Errorf("failed to delete tus upload data: %w", err)
+				}
+			}
+			if err := s.repo.TusUploads.Delete(ctx, u.ID); err != nil {
+				return removed, fmt.Errorf("failed to delete tus upload: %w", err)
+			}
+			removed++
+		}
+
+		if len(uploads) < staleUploadBatchSize {
+			return removed, nil
+		}
+	}
+}
+
+// ReapLegacyUploads deletes the data of uploads that were in progress when upload progress
+// moved from hashes to file records; the migration queued their storage keys. An unfinished
+// upload's data was stored under its hash, which is also where the blob goes once the content
+// is uploaded again, so that key is only deleted while the blob isn't complete. Returns the
+// number of keys dealt with.
+func (s *FileService) ReapLegacyUploads(ctx context.Context) (int, error) {
+	removed := 0
+	for {
+		objects, err := s.repo.Blobs.ListLegacyUploads(ctx, staleUploadBatchSize)
+		if err != nil {
+			return removed, fmt.Errorf("failed to list legacy uploads: %w", err)
+		}
+
+		for _, o := range objects {
+			if err := s.purgeLegacyUpload(ctx, o); err != nil {
+				return removed, err
+			}
+			removed++
+		}
+
+		if len(objects) < staleUploadBatchSize {
+			return removed, nil
+		}
+	}
+}
+
+// purgeLegacyUpload deletes one storage key queued by the migration to per-record uploads
+func (s *FileService) purgeLegacyUpload(ctx context.Context, o *repository.LegacyUploadObject) error {
+	return s.repo.WithTransaction(ctx, func(ctx context.Context, repo *repository.Repository) error {
+		stored := false
+		if o.Key == o.Hash {
+			// Lock the blob row like completeUpload does, so the blob can't be stored meanwhile
+			blob, err := repo.Blobs.GetForUpdate(ctx, o.Hash)
+			if err != nil && !errors.Is(err, repository.ErrNotFound) {
+				return fmt.Errorf("failed to lock blob: %w", err)
+			}
+			stored = blob != nil && blob.CompletedAt.Valid
+		}
+		if !stored {
+			if err := s.storage.Delete(ctx, o.Key); err != nil && !errors.Is(err, storage.ErrNotFound) {
+				return fmt.Errorf("failed to delete legacy upload data %s: %w", o.Key, err)
+			}
+		}
+		if err := repo.Blobs.DeleteLegacyUpload(ctx, o.Key); err != nil {
+			return fmt.Errorf("failed to delete legacy upload %s: %w", o.Key, err)
+		}
+		return nil
+	})
+}
+
+// purgeStaleFile purges an unfinished file unless data for it arrived after it was listed or is arriving now
+func (s *FileService) purgeStaleFile(ctx context.Context, f *repository.File) (bool, error) {
+	_, release, err := s.claimUpload(ctx, partialKey(f.ID))
+	if errors.Is(err, ErrUploadInProgress) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer release()
+
+	current, err := s.repo.Files.GetByID(ctx, f.ID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if current.BytesReceived != f.BytesReceived || current.BytesReceived >= current.Size {
+		return false, nil
+	}
+
+	return true, s.purgeFile(ctx, dbFileToDoamin(current), nil)
+}
@@ -1,8 +1,10 @@
 package storage
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 )
@@ -25,7 +27,7 @@ func NewDiskStorage(basePath string) (*DiskStorage, error) {
 }
 
 // Put stores data with the given key
-func (d *DiskStorage) Put(key string, data io.Reader) error {
+func (d *DiskStorage) Put(_ context.Context, key string, data io.Reader) error {
 	path := d.fullPath(key)
 
 	// Check if file already exists
@@ -50,7 +52,7 @@ func (d *DiskStorage) Put(key string, data io.Reader) error {
 }
 
 // Append appends data to an existing file or creates it if it doesn't exist
-func (d *DiskStorage) Append(key string, data io.Reader) (int64, error) {
+func (d *DiskStorage) Append(_ context.Context, key string, data io.Reader) (int64, error) {
 	path := d.fullPath(key)
 
 	// Open file for append, create if doesn't exist
@@ -69,8 +71,20 @@ func (d *DiskStorage) Append(key string, data io.Reader) (int64, error) {
 	return n, nil
 }
 
+// Finalize is a no-op for disk storage: appended data is readable immediately
+func (d *DiskStorage) Finalize(_ context.Context, key string) error {
+	if _, err := os.Stat(d.fullPath(key)); err != nil {
+		if os.IsNotExist(err) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("failed to get file info: %w", err)
+	}
+
+	return nil
+}
+
 // Get retrieves data for the given key
-func (d *DiskStorage) Get(key string) (io.ReadCloser, error) {
+func (d *DiskStorage) Get(_ context.Context, key string) (io.ReadSeekCloser, error) {
 	path := d.fullPath(key)
 
 	file, err := os.Open(path)
@@ -85,7 +99,7 @@ func (d *DiskStorage) Get(key string) (io.ReadCloser, error) {
 }
 
 // Delete removes the file with the given key
-func (d *DiskStorage) Delete(key string) error {
+func (d *DiskStorage) Delete(_ context.Context, key string) error {
 	path := d.fullPath(key)
 
 	err := os.Remove(path)
@@ -100,7 +114,7 @@ func (d *DiskStorage) Delete(key string) error {
 }
 
 // Exists checks if a file exists
-func (d *DiskStorage) Exists(key string) (bool, error) {
+func (d *DiskStorage) Exists(_ context.Context, key string) (bool, error) {
 	path := d.fullPath(key)
 
 	_, err := os.Stat(path)
@@ -115,7 +129,7 @@ func (d *DiskStorage) Exists(key string) (bool, error) {
 }
 
 // Size returns the size of the file in bytes
-func (d *DiskStorage) Size(key string) (int64, error) {
+func (d *DiskStorage) Size(_ context.Context, key string) (int64, error) {
 	path := d.fullPath(key)
 
 	info, err := os.Stat(path)
@@ -129,9 +143,31 @@ func (d *DiskStorage) Size(key string) (int64, error) {
 	return info.Size(), nil
 }
 
-// Path returns the full path to the file
-func (d *DiskStorage) Path(key string) string {
-	return d.fullPath(key)
+// List calls fn for every file under the base directory
+func (d *DiskStorage) List(ctx context.Context, fn func(Object) error) error {
+	return filepath.WalkDir(d.basePath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		info, err := entry.Info()
+		if os.IsNotExist(err) {
+			return nil // Deleted since the directory was read
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get file info: %w", err)
+		}
+		key, err := filepath.Rel(d.basePath, path)
+		if err != nil {
+			return err
+		}
+		return fn(Object{Key: filepath.ToSlash(key), Size: info.Size(), ModTime: info.ModTime()})
+	})
 }
 
 // fullPath returns the full filesystem path for a given key
@@ -0,0 +1,464 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// minPartSize is the smallest part S3 accepts for every part but the last one.
+const minPartSize = 5 * 1024 * 1024
+
+// S3Config holds connection settings for an S3-compatible object store
+type S3Config struct {
+	Endpoint  string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	Region    string
+	UseSSL    bool
+	Prefix    string
+	PartSize  int64
+}
+
+// S3Storage implements Storage interface on top of an S3-compatible object store (AWS S3, MinIO, ...).
+//
+// Appends are staged in a multipart upload: data is cut into parts of PartSize bytes and any
+// remainder is kept in a small "tail" object until the next Append. Finalize uploads the tail as
+// the last part and completes the multipart upload, which makes the object readable under its key.
+//
+// The staged state lives only in the bucket: every Append lists the key's multipart upload and
+// rewrites its tail. Two Appends to the same key at once would both read the same tail and part
+// numbers and corrupt the object, so callers must hold a lock on the key that is shared by every
+// server using the bucket (FileService serializes writes per hash and per tus upload).
+type S3Storage struct {
+	core     *minio.Core
+	bucket   string
+	prefix   string
+	partSize int64
+}
+
+// NewS3Storage creates a new S3 storage instance, creating the bucket if it doesn't exist
+func NewS3Storage(ctx context.Context, cfg S3Config) (*S3Storage, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, errors.New("s3 endpoint and bucket are required")
+	}
+
+	core, err := minio.NewCore(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: cfg.UseSSL,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create s3 client: %w", err)
+	}
+
+	exists, err := core.BucketExists(ctx, cfg.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check bucket: %w", err)
+	}
+	if !exists {
+		if err := core.MakeBucket(ctx, cfg.Bucket, minio.MakeBucketOptions{Region: cfg.Region}); err != nil {
+			return nil, fmt.Errorf("failed to create bucket: %w", err)
+		}
+	}
+
+	partSize := cfg.PartSize
+	if partSize < minPartSize {
+		partSize = minPartSize
+	}
+
+	prefix := strings.Trim(cfg.Prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	return &S3Storage{
+		core:     core,
+		bucket:   cfg.Bucket,
+		prefix:   prefix,
+		partSize: partSize,
+	}, nil
+}
+
+// Put stores data with the given key
+func (s *S3Storage) Put(ctx context.Context, key string, data io.Reader) error {
+	exists, err := s.Exists(ctx, key)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrAlreadyExists
+	}
+
+	if _, err := s.core.Client.PutObject(ctx, s.bucket, s.objectKey(key), data, -1, minio.PutObjectOptions{}); err != nil {
+		return fmt.Errorf("failed to put object: %w", err)
+	}
+
+	return nil
+}
+
+// Append appends data to the pending multipart upload for key, starting one if needed.
+// The object is not readable through Get until Finalize is called.
+func (s *S3Storage) Append(ctx context.Context, key string, data io.Reader) (int64, error) {
+	if _, err := s.stat(ctx, s.objectKey(key)); err == nil {
+		return 0, ErrAlreadyExists
+	} else if !errors.Is(err, ErrNotFound) {
+		return 0, err
+	}
+
+	pending, err := s.pending(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+
+	// Start from the previous tail so every flushed part is exactly partSize bytes
+	buf := bytes.NewBuffer(make([]byte, 0, s.partSize))
+	if pending.tailSize > 0 {
+		if err := s.readTail(ctx, key, buf); err != nil {
+			return 0, err
+		}
+	}
+
+	var written int64
+	for {
+		n, readErr := io.CopyN(buf, data, s.partSize-int64(buf.Len()))
+		written += n
+
+		if int64(buf.Len()) == s.partSize {
+			if err := s.flushPart(ctx, key, pending, buf); err != nil {
+				return written, err
+			}
+		}
+
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			// Keep whatever was read so Size stays in sync with what the caller sent
+			if err := s.writeTail(ctx, key, buf); err != nil {
+				return written, err
+			}
+			return written, fmt.Errorf("failed to append to object: %w", readErr)
+		}
+	}
+
+	if err := s.writeTail(ctx, key, buf); err != nil {
+		return written, err
+	}
+
+	return written, nil
+}
+
+// Finalize completes the pending multipart upload for key so the object becomes readable
+func (s *S3Storage) Finalize(ctx context.Context, key string) error {
+	pending, err := s.pending(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	if pending.uploadID == "" && pending.tailSize == 0 {
+		exists, err := s.Exists(ctx, key)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrNotFound
+		}
+		return nil
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, pending.tailSize))
+	if pending.tailSize > 0 {
+		if err := s.readTail(ctx, key, buf); err != nil {
+			return err
+		}
+	}
+
+	if pending.uploadID == "" {
+		// Everything fit in the tail: a plain put is enough
+		if _, err := s.core.Client.PutObject(ctx, s.bucket, s.objectKey(key), buf, int64(buf.Len()), minio.PutObjectOptions{}); err != nil {
+			return fmt.Errorf("failed to put object: %w", err)
+		}
+	} else {
+		if buf.Len() > 0 {
+			if err := s.flushPart(ctx, key, pending, buf); err != nil {
+				return err
+			}
+		}
+		if _, err := s.core.CompleteMultipartUpload(ctx, s.bucket, s.objectKey(key), pending.uploadID, pending.parts, minio.PutObjectOptions{}); err != nil {
+			return fmt.Errorf("failed to complete multipart upload: %w", err)
+		}
+	}
+
+	if err := s.core.Client.RemoveObject(ctx, s.bucket, s.tailKey(key), minio.RemoveObjectOptions{}); err != nil && !isS3NotFound(err) {
+		return fmt.Errorf("failed to remove staged tail: %w", err)
+	}
+
+	return nil
+}
+
+// Get retrieves data for the given key. Seeking on the returned object issues ranged GETs
+func (s *S3Storage) Get(ctx context.Context, key string) (io.ReadSeekCloser, error) {
+	obj, err := s.core.Client.GetObject(ctx, s.bucket, s.objectKey(key), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object: %w", err)
+	}
+
+	// GetObject is lazy; Stat surfaces missing keys before the caller starts reading
+	if _, err := obj.Stat(); err != nil {
+		obj.Close()
+		if isS3NotFound(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get object: %w", err)
+	}
+
+	return obj, nil
+}
+
+// Delete removes the object with the given key along with any pending upload
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	found := false
+
+	if _, err := s.stat(ctx, s.objectKey(key)); err == nil {
+		found = true
+		if err := s.core.Client.RemoveObject(ctx, s.bucket, s.objectKey(key), minio.RemoveObjectOptions{}); err != nil {
+			return fmt.Errorf("failed to delete object: %w", err)
+		}
+	} else if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+
+	pending, err := s.pending(ctx, key)
+	if err != nil {
+		return err
+	}
+	if pending.uploadID != "" {
+		found = true
+		if err := s.core.AbortMultipartUpload(ctx, s.bucket, s.objectKey(key), pending.uploadID); err != nil && !isS3NotFound(err) {
+			return fmt.Errorf("failed to abort multipart upload: %w", err)
+		}
+	}
+	if pending.tailSize > 0 {
+		found = true
+		if err := s.core.Client.RemoveObject(ctx, s.bucket, s.tailKey(key), minio.RemoveObjectOptions{}); err != nil && !isS3NotFound(err) {
+			return fmt.Errorf("failed to delete staged tail: %w", err)
+		}
+	}
+
+	if !found {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Exists checks if a finalized object exists
+func (s *S3Storage) Exists(ctx context.Context, key string) (bool, error) {
+	_, err := s.stat(ctx, s.objectKey(key))
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// List calls fn for every finalized object under the prefix. Pending multipart
+// uploads and their staged tails are not listed
+func (s *S3Storage) List(ctx context.Context, fn func(Object) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for info := range s.core.Client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: s.prefix, Recursive: true}) {
+		if info.Err != nil {
+			return fmt.Errorf("failed to list objects: %w", info.Err)
+		}
+		key := strings.TrimPrefix(info.Key, s.prefix)
+		if strings.HasPrefix(key, ".partial/") {
+			continue
+		}
+		if err := fn(Object{Key: key, Size: info.Size, ModTime: info.LastModified}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Size returns the size of the object in bytes, or the number of bytes appended so far
+// when the upload has not been finalized yet
+func (s *S3Storage) Size(ctx context.Context, key string) (int64, error) {
+	info, err := s.stat(ctx, s.objectKey(key))
+	if err == nil {
+		return info.Size, nil
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return 0, err
+	}
+
+	pending, err := s.pending(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	if pending.uploadID == "" && pending.tailSize == 0 {
+		return 0, ErrNotFound
+	}
+
+	return pending.partsSize + pending.tailSize, nil
+}
+
+// pendingUpload describes an in-progress Append sequence for a key
+type pendingUpload struct {
+	uploadID  string
+	parts     []minio.CompletePart
+	partsSize int64
+	tailSize  int64
+}
+
+// pending looks up the multipart upload and staged tail for key
+func (s *S3Storage) pending(ctx context.Context, key string) (*pendingUpload, error) {
+	p := &pendingUpload{}
+	objectKey := s.objectKey(key)
+
+	uploads, err := s.core.ListMultipartUploads(ctx, s.bucket, objectKey, "", "", "", 1000)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list multipart uploads: %w", err)
+	}
+	for _, u := range uploads.Uploads {
+		if u.Key == objectKey {
+			p.uploadID = u.UploadID
+			break
+		}
+	}
+
+	if p.uploadID != "" {
+		marker := 0
+		for {
+			res, err := s.core.ListObjectParts(ctx, s.bucket, objectKey, p.uploadID, marker, 1000)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list upload parts: %w", err)
+			}
+			for _, part := range res.ObjectParts {
+				p.parts = append(p.parts, minio.CompletePart{PartNumber: part.PartNumber, ETag: part.ETag})
+				p.partsSize += part.Size
+			}
+			if !res.IsTruncated {
+				break
+			}
+			marker = res.NextPartNumberMarker
+		}
+		sort.Slice(p.parts, func(i, j int) bool { return p.parts[i].PartNumber < p.parts[j].PartNumber })
+	}
+
+	info, err := s.stat(ctx, s.tailKey(key))
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	if err == nil {
+		p.tailSize = info.Size
+	}
+
+	return p, nil
+}
+
+// flushPart uploads buf as the next part of the pending upload and resets buf
+func (s *S3Storage) flushPart(ctx context.Context, key string, p *pendingUpload, buf *bytes.Buffer) error {
+	objectKey := s.objectKey(key)
+
+	if p.uploadID == "" {
+		uploadID, err := s.core.NewMultipartUpload(ctx, s.bucket, objectKey, minio.PutObjectOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to start multipart upload: %w", err)
+		}
+		p.uploadID = uploadID
+	}
+
+	partNumber := 1
+	if len(p.parts) > 0 {
+		partNumber = p.parts[len(p.parts)-1].PartNumber + 1
+	}
+
+	size := int64(buf.Len())
+	part, err := s.core.PutObjectPart(ctx, s.bucket, objectKey, p.uploadID, partNumber, bytes.NewReader(buf.Bytes()), size, minio.PutObjectPartOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to upload part: %w", err)
+	}
+
+	p.parts = append(p.parts, minio.CompletePart{PartNumber: part.PartNumber, ETag: part.ETag})
+	p.partsSize += size
+	buf.Reset()
+
+	return nil
+}
+
+// readTail appends the staged tail for key to buf
+func (s *S3Storage) readTail(ctx context.Context, key string, buf *bytes.Buffer) error {
+	obj, err := s.core.Client.GetObject(ctx, s.bucket, s.tailKey(key), minio.GetObjectOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to read staged tail: %w", err)
+	}
+	defer obj.Close()
+
+	if _, err := io.Copy(buf, obj); err != nil {
+		return fmt.Errorf("failed to read staged tail: %w", err)
+	}
+
+	return nil
+}
+
+// writeTail replaces the staged tail for key with the contents of buf (removing it when empty)
+func (s *S3Storage) writeTail(ctx context.Context, key string, buf *bytes.Buffer) error {
+	if buf.Len() == 0 {
+		if err := s.core.Client.RemoveObject(ctx, s.bucket, s.tailKey(key), minio.RemoveObjectOptions{}); err != nil && !isS3NotFound(err) {
+			return fmt.Errorf("failed to remove staged tail: %w", err)
+		}
+		return nil
+	}
+
+	if _, err := s.core.Client.PutObject(ctx, s.bucket, s.tailKey(key), bytes.NewReader(buf.Bytes()), int64(buf.Len()), minio.PutObjectOptions{}); err != nil {
+		return fmt.Errorf("failed to write staged tail: %w", err)
+	}
+
+	return nil
+}
+
+// stat returns object info, mapping a missing key to ErrNotFound
+func (s *S3Storage) stat(ctx context.Context, objectKey string) (minio.ObjectInfo, error) {
+	info, err := s.core.Client.StatObject(ctx, s.bucket, objectKey, minio.StatObjectOptions{})
+	if err != nil {
+		if isS3NotFound(err) {
+			return info, ErrNotFound
+		}
+		return info, fmt.Errorf("failed to stat object: %w", err)
+	}
+
+	return info, nil
+}
+
+// objectKey returns the bucket key for a storage key
+func (s *S3Storage) objectKey(key string) string {
+	return s.prefix + key
+}
+
+// tailKey returns the bucket key holding the not-yet-flushed bytes of an Append sequence
+func (s *S3Storage) tailKey(key string) string {
+	return s.prefix + ".partial/" + key
+}
+
+// isS3NotFound reports whether err is a missing key/upload error from the S3 API
+func isS3NotFound(err error) bool {
+	resp := minio.ToErrorResponse(err)
+	return resp.StatusCode == http.StatusNotFound || resp.Code == minio.NoSuchKey || resp.Code == minio.NoSuchUpload
+}
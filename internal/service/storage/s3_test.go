@@ -0,0 +1,167 @@
+package storage_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zqz/web/backend/internal/service/storage"
+	"github.com/zqz/web/backend/internal/tests"
+)
+
+const testPartSize = 5 * 1024 * 1024
+
+func setupS3Storage(t *testing.T, ctx context.Context) (*storage.S3Storage, func()) {
+	t.Helper()
+
+	minio, err := tests.CreateMinioContainer(t, ctx)
+	if err != nil {
+		t.Fatalf("failed to create minio container: %v", err)
+	}
+	cleanup := func() {
+		if err := minio.Terminate(ctx); err != nil {
+			t.Logf("failed to terminate minio container: %v", err)
+		}
+	}
+
+	s3, err := storage.NewS3Storage(ctx, storage.S3Config{
+		Endpoint:  minio.Endpoint,
+		Bucket:    "test-bucket",
+		AccessKey: tests.MinioAccessKey,
+		SecretKey: tests.MinioSecretKey,
+		Prefix:    "files",
+		PartSize:  testPartSize,
+	})
+	if err != nil {
+		cleanup()
+		t.Fatalf("failed to create s3 storage: %v", err)
+	}
+	return s3, cleanup
+}
+
+func readAll(t *testing.T, ctx context.Context, s storage.Storage, key string) []byte {
+	t.Helper()
+	r, err := s.Get(ctx, key)
+	require.NoError(t, err)
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return data
+}
+
+func TestS3Storage(t *testing.T) {
+	ctx := context.Background()
+	s3, cleanup := setupS3Storage(t, ctx)
+	defer cleanup()
+
+	t.Run("put and get", func(t *testing.T) {
+		require.NoError(t, s3.Put(ctx, "put", bytes.NewReader([]byte("hello"))))
+		assert.ErrorIs(t, s3.Put(ctx, "put", bytes.NewReader([]byte("again"))), storage.ErrAlreadyExists)
+		assert.Equal(t, []byte("hello"), readAll(t, ctx, s3, "put"))
+
+		size, err := s3.Size(ctx, "put")
+		require.NoError(t, err)
+		assert.EqualValues(t, 5, size)
+		exists, err := s3.Exists(ctx, "put")
+		require.NoError(t, err)
+		assert.True(t, exists)
+
+		// Reads can seek, for byte ranges
+		r, err := s3.Get(ctx, "put")
+		require.NoError(t, err)
+		_, err = r.Seek(3, io.SeekStart)
+		require.NoError(t, err)
+		rest, err := io.ReadAll(r)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("lo"), rest)
+		require.NoError(t, r.Close())
+	})
+
+	t.Run("append across parts", func(t *testing.T) {
+		// Three appends of 3 MiB: one full part is uploaded, the rest is staged as the tail
+		chunk := 3 * 1024 * 1024
+		content := make([]byte, 3*chunk)
+		_, err := rand.Read(content)
+		require.NoError(t, err)
+
+		for i := range 3 {
+			n, err := s3.Append(ctx, "multi", bytes.NewReader(content[i*chunk:(i+1)*chunk]))
+			require.NoError(t, err)
+			assert.EqualValues(t, chunk, n)
+			size, err := s3.Size(ctx, "multi")
+			require.NoError(t, err)
+			assert.EqualValues(t, (i+1)*chunk, size, "size counts staged data")
+		}
+
+		_, err = s3.Get(ctx, "multi")
+		assert.ErrorIs(t, err, storage.ErrNotFound, "not readable until finalized")
+		exists, err := s3.Exists(ctx, "multi")
+		require.NoError(t, err)
+		assert.False(t, exists)
+
+		require.NoError(t, s3.Finalize(ctx, "multi"))
+		assert.Equal(t, content, readAll(t, ctx, s3, "multi"))
+		require.NoError(t, s3.Finalize(ctx, "multi"), "finalizing twice is harmless")
+
+		_, err = s3.Append(ctx, "multi", bytes.NewReader([]byte("more")))
+		assert.ErrorIs(t, err, storage.ErrAlreadyExists)
+	})
+
+	t.Run("append smaller than a part", func(t *testing.T) {
+		_, err := s3.Append(ctx, "small", bytes.NewReader([]byte("ab")))
+		require.NoError(t, err)
+		_, err = s3.Append(ctx, "small", bytes.NewReader([]byte("cd")))
+		require.NoError(t, err)
+		require.NoError(t, s3.Finalize(ctx, "small"))
+		assert.Equal(t, []byte("abcd"), readAll(t, ctx, s3, "small"))
+	})
+
+	t.Run("missing keys", func(t *testing.T) {
+		_, err := s3.Get(ctx, "missing")
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+		_, err = s3.Size(ctx, "missing")
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+		assert.ErrorIs(t, s3.Finalize(ctx, "missing"), storage.ErrNotFound)
+		assert.ErrorIs(t, s3.Delete(ctx, "missing"), storage.ErrNotFound)
+	})
+
+	t.Run("list skips pending appends", func(t *testing.T) {
+		_, err := s3.Append(ctx, "pending", bytes.NewReader([]byte("staged")))
+		require.NoError(t, err)
+
+		var keys []string
+		require.NoError(t, s3.List(ctx, func(o storage.Object) error {
+			keys = append(keys, o.Key)
+			if o.Key == "put" {
+				assert.EqualValues(t, 5, o.Size)
+			}
+			return nil
+		}))
+		sort.Strings(keys)
+		assert.Equal(t, []string{"multi", "put", "small"}, keys)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		require.NoError(t, s3.Delete(ctx, "put"))
+		_, err := s3.Get(ctx, "put")
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+
+		// Deleting a pending append discards the staged data
+		require.NoError(t, s3.Delete(ctx, "pending"))
+		_, err = s3.Size(ctx, "pending")
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+	})
+
+	t.Run("cancelled context", func(t *testing.T) {
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+		assert.Error(t, s3.Put(cancelled, "cancelled", bytes.NewReader([]byte("x"))))
+		_, err := s3.Size(ctx, "cancelled")
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+	})
+}
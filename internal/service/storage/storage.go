@@ -1,8 +1,10 @@
 package storage
 
 import (
+	"context"
 	"errors"
 	"io"
+	"time"
 )
 
 var (
@@ -13,31 +15,50 @@ var (
 	ErrAlreadyExists = errors.New("file already exists in storage")
 )
 
-// Storage defines the interface for file storage operations
+// Storage defines the interface for file storage operations. Every call takes the
+// caller's context, so a cancelled request stops waiting on the backend.
+//
+// Writes to one key (Put, Append, Finalize, Delete) must come from one writer at a time;
+// backends don't serialize them themselves.
 type Storage interface {
 	// Put stores data with the given key
 	// Returns an error if the file already exists
-	Put(key string, data io.Reader) error
+	Put(ctx context.Context, key string, data io.Reader) error
 
 	// Append appends data to an existing file or creates it if it doesn't exist
-	Append(key string, data io.Reader) (int64, error)
+	Append(ctx context.Context, key string, data io.Reader) (int64, error)
 
-	// Get retrieves data for the given key
+	// Finalize marks an appended file as complete. Backends that stage appends
+	// (e.g. multipart uploads) only make the data readable through Get after this.
+	// Returns ErrNotFound if nothing was appended under the key
+	Finalize(ctx context.Context, key string) error
+
+	// Get retrieves data for the given key. The reader is seekable so callers
+	// can serve byte ranges without reading the whole file
 	// Returns ErrNotFound if the key doesn't exist
-	Get(key string) (io.ReadCloser, error)
+	Get(ctx context.Context, key string) (io.ReadSeekCloser, error)
 
 	// Delete removes the file with the given key
 	// Returns ErrNotFound if the key doesn't exist
-	Delete(key string) error
+	Delete(ctx context.Context, key string) error
 
 	// Exists checks if a file exists
-	Exists(key string) (bool, error)
+	Exists(ctx context.Context, key string) (bool, error)
 
-	// Size returns the size of the file in bytes
+	// Size returns the size of the file in bytes, including appended data that
+	// has not been finalized yet
 	// Returns ErrNotFound if the key doesn't exist
-	Size(key string) (int64, error)
+	Size(ctx context.Context, key string) (int64, error)
+
+	// List calls fn for every stored file, in no particular order, and stops
+	// at the first error fn returns. Appends that have not been finalized may
+	// be left out
+	List(ctx context.Context, fn func(Object) error) error
+}
 
-	// Path returns the full path to the file (for disk storage)
-	// May return empty string for non-disk storage implementations
-	Path(key string) string
+// Object describes a stored file as returned by List
+type Object struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
 }
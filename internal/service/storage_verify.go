@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/zqz/web/backend/internal/service/storage"
+)
+
+// verifyBatchSize is how many blobs VerifyStorage reads per query
+const verifyBatchSize = 500
+
+// Problems VerifyStorage can find with a blob's stored data
+const (
+	StorageProblemMissing      = "missing"
+	StorageProblemSizeMismatch = "size mismatch"
+	StorageProblemHashMismatch = "hash mismatch"
+	// StorageProblemThumbnailMissing is a thumbnail row without stored data; Scrub finds these
+	StorageProblemThumbnailMissing = "thumbnail missing"
+)
+
+// StorageProblem is a blob whose stored data doesn't match the database
+type StorageProblem struct {
+	Hash    string
+	Problem string // One of the StorageProblem* constants
+	Detail  string
+}
+
+// StorageReport is the result of VerifyStorage
+type StorageReport struct {
+	Checked  int
+	Problems []StorageProblem
+}
+
+// VerifyStorage checks that the data for every completed blob exists with the recorded size
+// and, when checkHash is set, still hashes to its SHA-256 (which reads every byte).
+// Blobs still being uploaded are skipped. It only reports; nothing is changed.
+func (s *FileService) VerifyStorage(ctx context.Context, checkHash bool) (*StorageReport, error) {
+	report := &StorageReport{}
+	return report, s.verifyBlobs(ctx, checkHash, report, func(string) {})
+}
+
+// verifyBlobs adds the problems with completed blobs to report and calls seen with the hash
+// of every blob, complete or not
+func (s *FileService) verifyBlobs(ctx context.Context, checkHash bool, report *StorageReport, seen func(hash string)) error {
+	after := ""
+	for {
+		blobs, err := s.repo.Blobs.List(ctx, after, verifyBatchSize)
+		if err != nil {
+			return fmt.Errorf("failed to list blobs: %w", err)
+		}
+		for _, b := range blobs {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			seen(b.Hash)
+			if !b.CompletedAt.Valid {
+				continue
+			}
+			report.Checked++
+
+			size, err := s.storage.Size(ctx, b.Hash)
+			switch {
+			case errors.Is(err, storage.ErrNotFound):
+				report.Problems = append(report.Problems, StorageProblem{Hash: b.Hash, Problem: StorageProblemMissing})
+				continue
+			case err != nil:
+				return fmt.Errorf("failed to get size of %s: %w", b.Hash, err)
+			case size != b.Size:
+				report.Problems = append(report.Problems, StorageProblem{
+					Hash:    b.Hash,
+					Problem: StorageProblemSizeMismatch,
+					Detail:  fmt.Sprintf("stored %d bytes, expected %d", size, b.Size),
+				})
+				continue
+			}
+
+			if checkHash {
+				actual, err := s.storedSHA256(ctx, b.Hash)
+				if err != nil {
+					return err
+				}
+				if actual != b.Hash {
+					report.Problems = append(report.Problems, StorageProblem{
+						Hash:    b.Hash,
+						Problem: StorageProblemHashMismatch,
+						Detail:  "data hashes to " + actual,
+					})
+				}
+			}
+		}
+		if len(blobs) < verifyBatchSize {
+			return nil
+		}
+		after = blobs[len(blobs)-1].Hash
+	}
+}
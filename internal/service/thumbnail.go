@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/zqz/web/backend/internal/domain"
+	"github.com/zqz/web/backend/internal/repository"
+	"github.com/zqz/web/backend/internal/service/storage"
+	"github.com/zqz/web/backend/internal/telemetry"
+)
+
+// LoadThumbnail attaches the file's thumbnail to file.Thumbnail, leaving it nil if there is none
+func (s *FileService) LoadThumbnail(ctx context.Context, file *domain.File) error {
+	ctx, span := telemetry.Start(ctx, "FileService.LoadThumbnail")
+	defer span.End()
+
+	t, err := s.repo.Thumbnails.GetByFileID(ctx, file.ID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			file.Thumbnail = nil
+			return nil
+		}
+		return fmt.Errorf("failed to get thumbnail: %w", err)
+	}
+	file.Thumbnail = dbThumbnailToDomain(t)
+	return nil
+}
+
+// OpenThumbnail returns a reader for the file's thumbnail image, or ErrNoThumbnail.
+// Callers check access to the file first (GetFileBySlug); like DownloadFile, thumbnails
+// of expired files are refused.
+func (s *FileService) OpenThumbnail(ctx context.Context, file *domain.File) (io.ReadSeekCloser, *domain.Thumbnail, error) {
+	ctx, span := telemetry.Start(ctx, "FileService.OpenThumbnail")
+	defer span.End()
+
+	if err := checkDownloadable(file); err != nil {
+		return nil, nil, err
+	}
+	if err := s.LoadThumbnail(ctx, file); err != nil {
+		return nil, nil, err
+	}
+	if file.Thumbnail == nil {
+		return nil, nil, ErrNoThumbnail
+	}
+
+	reader, err := s.storage.Get(context.WithoutCancel(ctx), file.Thumbnail.Hash) // streamed past the lookup deadline, like openFile
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, nil, ErrNoThumbnail
+		}
+		return nil, nil, fmt.Errorf("failed to get thumbnail data: %w", err)
+	}
+	return reader, file.Thumbnail, nil
+}
+
+func dbThumbnailToDomain(t *repository.Thumbnail) *domain.Thumbnail {
+	return &domain.Thumbnail{
+		ID:        t.ID,
+		FileID:    t.FileID,
+		Hash:      t.Hash,
+		Width:     t.Width,
+		Height:    t.Height,
+		CreatedAt: timeFromPgType(t.CreatedAt),
+	}
+}
@@ -0,0 +1,307 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/zqz/web/backend/internal/domain"
+	"github.com/zqz/web/backend/internal/repository"
+	"github.com/zqz/web/backend/internal/service/storage"
+	"github.com/zqz/web/backend/internal/telemetry"
+)
+
+// tusStagingPrefix + upload ID is the storage key for tus data whose hash isn't known yet
+const tusStagingPrefix = "tus-"
+
+// TusUpload is the state of an upload created through the tus protocol
+type TusUpload struct {
+	ID     string
+	Size   int64
+	Offset int64
+	// File is the file record receiving the data. It is nil while a staged upload is in progress.
+	File *domain.File
+}
+
+// Finished reports whether every byte of the upload has been received
+func (u *TusUpload) Finished() bool {
+	return u.Offset >= u.Size
+}
+
+// CreateTusUpload starts a tus upload for the caller. When req.Hash is set the upload
+// writes straight into a file record from CreateFile. Otherwise the data is staged under
+// its own key until complete, then hashed and handed to CreateFile and UploadFileData.
+func (s *FileService) CreateTusUpload(ctx context.Context, req domain.CreateFileRequest, maxFileSize int64) (*TusUpload, error) {
+	ctx, span := telemetry.Start(ctx, "FileService.CreateTusUpload")
+	defer span.End()
+
+	params := repository.CreateTusUploadParams{
+		ID:          newUploadID(),
+		UserID:      req.UserID,
+		Size:        req.Size,
+		Name:        req.Name,
+		ContentType: req.ContentType,
+	}
+
+	if req.Hash != "" {
+		file, err := s.CreateFile(ctx, req, maxFileSize)
+		if err != nil {
+			return nil, err
+		}
+		params.Hash = &file.Hash
+	} else {
+		if err := s.checkCanUpload(ctx, req.UserID); err != nil {
+			return nil, err
+		}
+		if err := validateFileFields(req); err != nil {
+			return nil, fmt.Errorf("invalid request: %w", err)
+		}
+		if maxFileSize > 0 && req.Size > maxFileSize {
+			return nil, ErrFileTooLarge
+		}
+		if req.UserID != nil {
+			if err := s.checkStorageQuota(ctx, s.repo, *req.UserID, req.Size); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	row, err := s.repo.TusUploads.Create(ctx, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create upload: %w", err)
+	}
+	return s.tusUpload(ctx, row)
+}
+
+// GetTusUpload returns the caller's tus upload. Uploads belonging to someone else are reported as not found.
+func (s *FileService) GetTusUpload(ctx context.Context, id string, userID *int32) (*TusUpload, error) {
+	ctx, span := telemetry.Start(ctx, "FileService.GetTusUpload")
+	defer span.End()
+
+	row, err := s.getTusUploadRow(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.tusUpload(ctx, row)
+}
+
+// WriteTusUpload appends data at offset, which must equal the upload's current offset.
+// maxFileSize is the caller's effective limit (0 = no limit). Returns ErrUploadInProgress
+// while another request is writing the upload.
+func (s *FileService) WriteTusUpload(ctx context.Context, id string, userID *int32, offset int64, data io.Reader, maxFileSize int64) (*TusUpload, error) {
+	ctx, span := telemetry.Start(ctx, "FileService.WriteTusUpload")
+	defer span.End()
+
+	if err := s.checkNotBanned(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.getTusUploadRow(ctx, id, userID); err != nil {
+		return nil, err
+	}
+
+	ctx, release, err := s.claimUpload(ctx, tusStagingKey(id))
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	// A previous write may have moved the offset or finished the upload since we looked
+	row, err := s.getTusUploadRow(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	upload, err := s.tusUpload(ctx, row)
+	if err != nil {
+		return nil, err
+	}
+	if offset != upload.Offset {
+		return nil, ErrTusOffsetMismatch
+	}
+
+	// Bytes past the declared length are ignored
+	data = io.LimitReader(data, row.Size-upload.Offset)
+
+	if row.Hash != nil {
+		if !upload.Finished() {
+			if err := s.writeTusFileData(ctx, upload.File, offset, data, maxFileSize); err != nil {
+				return nil, err
+			}
+		}
+		return s.tusUpload(ctx, row)
+	}
+
+	if !upload.Finished() {
+		if maxFileSize > 0 && row.Size > maxFileSize {
+			return nil, ErrFileTooLarge
+		}
+		if _, err := s.storage.Append(ctx, tusStagingKey(row.ID), data); err != nil {
+			return nil, fmt.Errorf("failed to write upload data: %w", err)
+		}
+		if err := s.repo.TusUploads.Touch(ctx, row.ID); err != nil {
+			return nil, fmt.Errorf("failed to update upload: %w", err)
+		}
+		if upload, err = s.tusUpload(ctx, row); err != nil {
+			return nil, err
+		}
+	}
+
+	// Also retries a previous attempt that stored every byte but failed to finish
+	if upload.Finished() {
+		if err := s.finishTusUpload(ctx, row, maxFileSize); err != nil {
+			return nil, err
+		}
+		return s.tusUpload(ctx, row)
+	}
+	return upload, nil
+}
+
+// DeleteTusUpload terminates the caller's tus upload and discards its partial data.
+// A file that has finished uploading is kept; it is deleted through DeleteFile like any other.
+func (s *FileService) DeleteTusUpload(ctx context.Context, id string, userID *int32) error {
+	ctx, span := telemetry.Start(ctx, "FileService.DeleteTusUpload")
+	defer span.End()
+
+	if err := s.checkNotBanned(ctx, userID); err != nil {
+		return err
+	}
+
+	if _, err := s.getTusUploadRow(ctx, id, userID); err != nil {
+		return err
+	}
+
+	ctx, release, err := s.claimUpload(ctx, tusStagingKey(id))
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	row, err := s.getTusUploadRow(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+
+	if row.Hash != nil {
+		upload, err := s.tusUpload(ctx, row)
+		if err != nil && !errors.Is(err, ErrTusUploadNotFound) {
+			return err
+		}
+		if err == nil && !upload.File.Finished() {
+			if err := s.purgeFile(ctx, upload.File, nil); err != nil {
+				return err
+			}
+		}
+	} else if err := s.storage.Delete(ctx, tusStagingKey(row.ID)); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("failed to delete upload data: %w", err)
+	}
+
+	if err := s.repo.TusUploads.Delete(ctx, row.ID); err != nil {
+		return fmt.Errorf("failed to delete upload: %w", err)
+	}
+	return nil
+}
+
+// finishTusUpload moves a complete staged upload into a content-addressed file record
+func (s *FileService) finishTusUpload(ctx context.Context, row *repository.TusUpload, maxFileSize int64) error {
+	key := tusStagingKey(row.ID)
+	if err := s.storage.Finalize(ctx, key); err != nil {
+		return fmt.Errorf("failed to finalize upload data: %w", err)
+	}
+	hash, err := s.storedSHA256(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	file, err := s.createFile(ctx, domain.CreateFileRequest{
+		Name:        row.Name,
+		Hash:        hash,
+		Size:        row.Size,
+		ContentType: row.ContentType,
+		UserID:      row.UserID,
+	}, maxFileSize, true)
+	if err != nil {
+		// Limits may have changed since the upload started; it can't be completed now
+		s.storage.Delete(ctx, key)
+		_ = s.repo.TusUploads.Delete(ctx, row.ID)
+		return err
+	}
+	if _, err := s.copyStaged(ctx, key, file, maxFileSize); err != nil {
+		return err
+	}
+
+	if err := s.repo.TusUploads.SetHash(ctx, row.ID, hash); err != nil {
+		return fmt.Errorf("failed to update upload: %w", err)
+	}
+	row.Hash = &hash
+	s.storage.Delete(ctx, key) // Ignore errors
+
+	return nil
+}
+
+// getTusUploadRow loads an upload row, hiding uploads that belong to another user
+func (s *FileService) getTusUploadRow(ctx context.Context, id string, userID *int32) (*repository.TusUpload, error) {
+	row, err := s.repo.TusUploads.Get(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrTusUploadNotFound
+		}
+		return nil, fmt.Errorf("failed to get upload: %w", err)
+	}
+
+	owned := row.UserID == nil && userID == nil ||
+		row.UserID != nil && userID != nil && *row.UserID == *userID
+	if !owned {
+		return nil, ErrTusUploadNotFound
+	}
+	return row, nil
+}
+
+// tusUpload reads an upload's current offset from its file record or staged data
+func (s *FileService) tusUpload(ctx context.Context, row *repository.TusUpload) (*TusUpload, error) {
+	upload := &TusUpload{ID: row.ID, Size: row.Size}
+
+	if row.Hash != nil {
+		file, err := s.GetFileByHash(ctx, *row.Hash, row.UserID)
+		if err != nil {
+			if errors.Is(err, ErrFileNotFound) {
+				// The file record was deleted out from under the upload
+				return nil, ErrTusUploadNotFound
+			}
+			return nil, err
+		}
+		upload.File = file
+		upload.Offset = file.BytesReceived
+		return upload, nil
+	}
+
+	size, err := s.storage.Size(ctx, tusStagingKey(row.ID))
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("failed to get upload size: %w", err)
+	}
+	upload.Offset = size
+	return upload, nil
+}
+
+// writeTusFileData appends data at offset to the file record behind a tus upload. The offset
+// is checked again once the record's claim is held, since chunk requests write the record too.
+func (s *FileService) writeTusFileData(ctx context.Context, file *domain.File, offset int64, data io.Reader, maxFileSize int64) error {
+	return s.writeUpload(ctx, file.ID, func(ctx context.Context, received int64) (int64, error) {
+		if offset != received {
+			return received, ErrTusOffsetMismatch
+		}
+		return s.appendFileData(ctx, file.ID, file.Size, data, maxFileSize, received)
+	})
+}
+
+func tusStagingKey(id string) string {
+	return tusStagingPrefix + id
+}
+
+func newUploadID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zqz/web/backend/internal/domain"
+	"github.com/zqz/web/backend/internal/repository"
+	"github.com/zqz/web/backend/internal/service/storage"
+	"github.com/zqz/web/backend/internal/tests"
+)
+
+func TestFileServiceTusStagedUploadSharesBlob(t *testing.T) {
+	ctx := context.Background()
+	pg, cleanup := tests.SetupTestDB(t, ctx)
+	defer cleanup()
+
+	repo := repository.NewRepository(pg.Pool)
+	stor, err := storage.NewDiskStorage(t.TempDir())
+	require.NoError(t, err)
+	svc := NewFileService(repo, stor)
+
+	alice := createTestUser(t, ctx, repo, "alice")
+	bob := createTestUser(t, ctx, repo, "bob")
+
+	content := []byte("content sent through tus")
+	hash := uploadTestFile(t, ctx, svc, content, domain.CreateFileRequest{Name: "alice.txt", UserID: &alice}).Hash
+
+	upload, err := svc.CreateTusUpload(ctx, domain.CreateFileRequest{
+		Name: "bob.txt", Size: int64(len(content)), ContentType: contentTypePlain, UserID: &bob,
+	}, 0)
+	require.NoError(t, err)
+	assert.Nil(t, upload.File)
+
+	// Other users can't see the upload
+	_, err = svc.GetTusUpload(ctx, upload.ID, &alice)
+	assert.ErrorIs(t, err, ErrTusUploadNotFound)
+
+	_, err = svc.WriteTusUpload(ctx, upload.ID, &bob, 1, bytes.NewReader(content), 0)
+	assert.ErrorIs(t, err, ErrTusOffsetMismatch)
+
+	upload, err = svc.WriteTusUpload(ctx, upload.ID, &bob, 0, bytes.NewReader(content[:5]), 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), upload.Offset)
+
+	upload, err = svc.WriteTusUpload(ctx, upload.ID, &bob, 5, bytes.NewReader(content[5:]), 0)
+	require.NoError(t, err)
+	require.True(t, upload.Finished())
+	require.NotNil(t, upload.File)
+	assert.Equal(t, hash, upload.File.Hash)
+	assert.Equal(t, "bob.txt", upload.File.Name)
+	assert.True(t, upload.File.IsOwnedBy(bob))
+
+	blob, err := repo.Blobs.Get(ctx, hash)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), blob.RefCount)
+
+	// The staged copy is gone once the data is attached to the file record
+	exists, err := stor.Exists(ctx, tusStagingKey(upload.ID))
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestFileServiceWriteTusUploadConcurrentWrites(t *testing.T) {
+	ctx := context.Background()
+	pg, cleanup := tests.SetupTestDB(t, ctx)
+	defer cleanup()
+
+	repo := repository.NewRepository(pg.Pool)
+	stor, err := storage.NewDiskStorage(t.TempDir())
+	require.NoError(t, err)
+	svc := NewFileService(repo, stor)
+
+	alice := createTestUser(t, ctx, repo, "alice")
+	content := []byte("only one write at offset zero")
+
+	upload, err := svc.CreateTusUpload(ctx, domain.CreateFileRequest{
+		Name: "race.txt", Size: int64(len(content)), ContentType: contentTypePlain, UserID: &alice,
+	}, 0)
+	require.NoError(t, err)
+
+	// Every write sends the first half at offset 0; exactly one may append it, and the rest
+	// find it in progress or already done
+	const writers = 10
+	half := content[:len(content)/2]
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := svc.WriteTusUpload(ctx, upload.ID, &alice, 0, bytes.NewReader(half), 0)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	succeeded := 0
+	for err := range errs {
+		if err == nil {
+			succeeded++
+			continue
+		}
+		if !errors.Is(err, ErrUploadInProgress) {
+			assert.ErrorIs(t, err, ErrTusOffsetMismatch)
+		}
+	}
+	assert.Equal(t, 1, succeeded)
+
+	upload, err = svc.GetTusUpload(ctx, upload.ID, &alice)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(half)), upload.Offset)
+
+	upload, err = svc.WriteTusUpload(ctx, upload.ID, &alice, upload.Offset, bytes.NewReader(content[len(half):]), 0)
+	require.NoError(t, err)
+	require.True(t, upload.Finished())
+	assert.Equal(t, sha256Hex(content), upload.File.Hash)
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/zqz/web/backend/internal/domain"
+	"github.com/zqz/web/backend/internal/telemetry"
+)
+
+// uploadStagingPrefix + random ID is the storage key for a one-shot upload while it is hashed
+const uploadStagingPrefix = "upload-"
+
+// UploadFile stores a file sent whole in one request. The data is staged while it is
+// hashed, then goes through CreateFile (size limits, quota) and UploadFileData like a
+// two-step upload, except that content already stored is not copied again.
+// req.Hash and req.Size are filled in from the data.
+func (s *FileService) UploadFile(ctx context.Context, req domain.CreateFileRequest, data io.Reader, maxFileSize int64) (*domain.File, error) {
+	ctx, span := telemetry.Start(ctx, "FileService.UploadFile")
+	defer span.End()
+
+	// Fail before reading a body that would be thrown away
+	if err := s.checkCanUpload(ctx, req.UserID); err != nil {
+		return nil, err
+	}
+
+	key := uploadStagingPrefix + newUploadID()
+	h := sha256.New()
+	reader := io.TeeReader(data, h)
+	if maxFileSize > 0 {
+		reader = newMaxBytesReader(reader, maxFileSize)
+	}
+	if err := s.storage.Put(ctx, key, reader); err != nil {
+		s.storage.Delete(ctx, key)
+		if errors.Is(err, ErrFileTooLarge) {
+			return nil, ErrFileTooLarge
+		}
+		return nil, fmt.Errorf("failed to store upload: %w", err)
+	}
+	defer s.storage.Delete(ctx, key) // Ignore errors
+
+	size, err := s.storage.Size(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get upload size: %w", err)
+	}
+	req.Hash = fmt.Sprintf("%x", h.Sum(nil))
+	req.Size = size
+
+	file, err := s.createFile(ctx, req, maxFileSize, true)
+	if err != nil {
+		return nil, err
+	}
+	return s.copyStaged(ctx, key, file, maxFileSize)
+}
+
+// copyStaged feeds staged data for a file record created from it into UploadFileData,
+// starting after whatever the record has already received
+func (s *FileService) copyStaged(ctx context.Context, key string, file *domain.File, maxFileSize int64) (*domain.File, error) {
+	if err := s.loadProgress(ctx, file); err != nil {
+		return nil, err
+	}
+	if file.Finished() {
+		return file, nil
+	}
+
+	reader, err := s.storage.Get(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open upload data: %w", err)
+	}
+	defer reader.Close()
+
+	if _, err := reader.Seek(file.BytesReceived, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to seek upload data: %w", err)
+	}
+	return s.UploadFileData(ctx, file.Hash, reader, maxFileSize, file.UserID)
+}
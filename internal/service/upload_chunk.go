@@ -0,0 +1,441 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zqz/web/backend/internal/domain"
+	"github.com/zqz/web/backend/internal/repository"
+	"github.com/zqz/web/backend/internal/service/storage"
+	"github.com/zqz/web/backend/internal/telemetry"
+)
+
+// partialKeyPrefix + file ID is the storage key for a file record's data while it is uploaded
+const partialKeyPrefix = "partial-"
+
+// chunkKeyInfix separates the partial key and offset in the storage key of a parked chunk
+const chunkKeyInfix = ".chunk-"
+
+// uploadClaimTTL is how long a claim on upload data lasts if its writer stops renewing it
+const uploadClaimTTL = time.Minute
+
+// UploadFileChunk writes length bytes of the caller's file starting at offset. Chunks may
+// arrive in any order and in parallel: a chunk that reaches the end of the data received so
+// far is appended (skipping bytes already stored) by whichever request holds the upload's
+// claim, while one further ahead, or one arriving while another request writes, is parked
+// under a storage key of its own until the writer gets to it. Resending a chunk is harmless.
+func (s *FileService) UploadFileChunk(ctx context.Context, hash string, offset, length int64, data io.Reader, maxFileSize int64, userID *int32) (*domain.File, error) {
+	ctx, span := telemetry.Start(ctx, "FileService.UploadFileChunk")
+	defer span.End()
+
+	if err := s.checkNotBanned(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	dbFile, err := s.repo.Files.GetByHashAndUserID(ctx, hash, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrFileNotFound
+		}
+		return nil, fmt.Errorf("failed to get file: %w", err)
+	}
+	if maxFileSize > 0 && dbFile.Size > maxFileSize {
+		return nil, ErrFileTooLarge
+	}
+	if offset < 0 || length <= 0 || offset+length > dbFile.Size {
+		return nil, ErrInvalidChunk
+	}
+
+	if offset <= dbFile.BytesReceived {
+		err := s.writeUpload(ctx, dbFile.ID, func(ctx context.Context, received int64) (int64, error) {
+			return s.appendChunkData(ctx, dbFile.ID, offset, length, data, received)
+		})
+		if !errors.Is(err, ErrUploadInProgress) {
+			if err != nil {
+				return nil, err
+			}
+			return s.GetFileByHash(ctx, hash, userID)
+		}
+	}
+
+	// Park chunks that are ahead, or that another request is writing past, without the claim;
+	// whoever holds it drains them before giving it up
+	if err := s.parkChunk(ctx, dbFile.ID, offset, length, data); err != nil {
+		return nil, err
+	}
+	if err := s.writeUpload(ctx, dbFile.ID, nil); err != nil && !errors.Is(err, ErrUploadInProgress) {
+		return nil, err
+	}
+	return s.GetFileByHash(ctx, hash, userID)
+}
+
+// appendChunkData appends the part of a chunk past received to its file's data, or parks the
+// chunk if the data ends before it (a failed verification can start the data over)
+func (s *FileService) appendChunkData(ctx context.Context, fileID int32, offset, length int64, data io.Reader, received int64) (int64, error) {
+	if offset > received {
+		return received, s.parkChunk(ctx, fileID, offset, length, data)
+	}
+	end := offset + length
+	if end <= received {
+		return received, nil
+	}
+	if _, err := io.CopyN(io.Discard, data, received-offset); err != nil {
+		return received, ErrIncompleteChunk
+	}
+	n, err := s.storage.Append(ctx, partialKey(fileID), io.LimitReader(data, end-received))
+	received += n
+	if err != nil {
+		return received, fmt.Errorf("failed to write file data: %w", err)
+	}
+	if received < end {
+		return received, ErrIncompleteChunk
+	}
+	return received, nil
+}
+
+// writeUpload claims a file record's data and, unless the upload is already complete, calls
+// write (if not nil) with the number of bytes stored so it can add to them and return the new
+// total. It then appends parked chunks that continue the data, records bytes_received and
+// completes the upload once every byte is stored. Chunks parked while the claim was held are
+// drained before returning. Returns ErrUploadInProgress, without calling write, if another
+// request holds the claim; that request drains whatever is parked meanwhile.
+func (s *FileService) writeUpload(ctx context.Context, fileID int32, write func(ctx context.Context, received int64) (int64, error)) error {
+	for first := true; ; first = false {
+		claimCtx, release, err := s.claimUpload(ctx, partialKey(fileID))
+		if err != nil {
+			if !first && errors.Is(err, ErrUploadInProgress) {
+				return nil
+			}
+			return err
+		}
+		err = s.writeClaimedUpload(claimCtx, fileID, write)
+		release()
+		if err != nil {
+			return err
+		}
+		write = nil
+
+		// A chunk parked just before the claim was released would otherwise wait for the next request
+		drainable, err := s.hasDrainableChunks(ctx, fileID)
+		if err != nil || !drainable {
+			return err
+		}
+	}
+}
+
+// writeClaimedUpload does writeUpload's work once it holds the claim
+func (s *FileService) writeClaimedUpload(ctx context.Context, fileID int32, write func(ctx context.Context, received int64) (int64, error)) error {
+	// The previous writer may have completed (and verified) the file
+	file, err := s.repo.Files.GetByID(ctx, fileID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrFileNotFound
+		}
+		return fmt.Errorf("failed to get file: %w", err)
+	}
+	if file.BytesReceived >= file.Size {
+		return nil
+	}
+
+	// What storage holds is the truth; bytes_received may lag it after a crash
+	received, err := s.storedSize(ctx, partialKey(fileID))
+	if err != nil {
+		return err
+	}
+	if write != nil {
+		if received, err = write(ctx, received); err != nil {
+			_ = s.repo.Files.SetBytesReceived(context.WithoutCancel(ctx), fileID, received)
+			return err
+		}
+	}
+
+	// Pick up chunks that arrived out of order; verifies SHA-256 once everything is stored
+	return s.drainChunks(ctx, file, received)
+}
+
+// hasDrainableChunks reports whether an unfinished file has a parked chunk that continues its data
+func (s *FileService) hasDrainableChunks(ctx context.Context, fileID int32) (bool, error) {
+	file, err := s.repo.Files.GetByID(ctx, fileID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to get file: %w", err)
+	}
+	if file.BytesReceived >= file.Size {
+		return false, nil
+	}
+	chunks, err := s.repo.Chunks.ListByFileID(ctx, fileID)
+	if err != nil {
+		return false, fmt.Errorf("failed to list chunks: %w", err)
+	}
+	return len(chunks) > 0 && chunks[0].StartOffset <= file.BytesReceived, nil
+}
+
+// claimUpload makes the caller the only writer of the data under key, across every instance
+// sharing the database. It returns a context to write with and a func that gives the claim
+// up. The claim is a row, not a lock, so no connection is held while data streams in: it is
+// renewed in the background and expires if the process dies. Should a renewal fail, the
+// returned context is canceled to stop the write. Returns ErrUploadInProgress if another
+// request holds the claim.
+func (s *FileService) claimUpload(ctx context.Context, key string) (context.Context, func(), error) {
+	token := newUploadID()
+	ok, err := s.repo.Claims.Claim(ctx, key, token, uploadClaimTTL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to claim upload: %w", err)
+	}
+	if !ok {
+		return nil, nil, ErrUploadInProgress
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(uploadClaimTTL / 4)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if ok, err := s.repo.Claims.Claim(ctx, key, token, uploadClaimTTL); err != nil || !ok {
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	return ctx, func() {
+		cancel()
+		<-stopped
+		_ = s.repo.Claims.Release(context.WithoutCancel(ctx), key, token)
+	}, nil
+}
+
+// DeleteExpiredUploadClaims forgets claims left behind by writers that stopped without giving them up
+func (s *FileService) DeleteExpiredUploadClaims(ctx context.Context) (int64, error) {
+	n, err := s.repo.Claims.DeleteExpired(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired upload claims: %w", err)
+	}
+	return n, nil
+}
+
+// parkChunk stores a chunk that starts past the data written so far under a storage key of
+// its own, then records it. A chunk at the same offset as one already parked replaces it if
+// longer and is dropped otherwise; any other overlap is rejected. Only the check and update
+// of the chunk rows is serialized, so concurrent resends upload in parallel without
+// clobbering each other's data.
+func (s *FileService) parkChunk(ctx context.Context, fileID int32, offset, length int64, data io.Reader) error {
+	// Reject (or drop) the chunk before storing it where possible; checked again below
+	chunks, err := s.repo.Chunks.ListByFileID(ctx, fileID)
+	if err != nil {
+		return fmt.Errorf("failed to list chunks: %w", err)
+	}
+	if parked, err := parkedAt(chunks, offset, length); err != nil || (parked != nil && parked.Size >= length) {
+		return err
+	}
+
+	key := chunkKey(fileID, offset, newUploadID())
+	if err := s.storage.Put(ctx, key, io.LimitReader(data, length)); err != nil {
+		s.storage.Delete(ctx, key)
+		return fmt.Errorf("failed to store chunk: %w", err)
+	}
+	if n, err := s.storage.Size(ctx, key); err != nil || n < length {
+		s.storage.Delete(ctx, key)
+		return ErrIncompleteChunk
+	}
+
+	unused := key // Whichever of this chunk's data and the data it replaces is left over
+	err = s.repo.WithTransaction(ctx, func(ctx context.Context, repo *repository.Repository) error {
+		if err := repo.XactLock(ctx, repository.LockFileUpload, strconv.FormatInt(int64(fileID), 10)); err != nil {
+			return fmt.Errorf("failed to lock upload: %w", err)
+		}
+		chunks, err := repo.Chunks.ListByFileID(ctx, fileID)
+		if err != nil {
+			return fmt.Errorf("failed to list chunks: %w", err)
+		}
+		parked, err := parkedAt(chunks, offset, length)
+		if err != nil || (parked != nil && parked.Size >= length) {
+			return err
+		}
+		if err := repo.Chunks.Create(ctx, fileID, offset, length, key); err != nil {
+			return fmt.Errorf("failed to record chunk: %w", err)
+		}
+		unused = ""
+		if parked != nil {
+			unused = parked.Key
+		}
+		return nil
+	})
+	if unused != "" {
+		s.storage.Delete(ctx, unused) // Ignore errors
+	}
+	return err
+}
+
+// parkedAt returns the chunk parked at offset, if any. Returns ErrChunkOverlap if the range
+// of length bytes at offset overlaps a chunk parked at a different offset.
+func parkedAt(chunks []*repository.UploadChunk, offset, length int64) (*repository.UploadChunk, error) {
+	var parked *repository.UploadChunk
+	for _, c := range chunks {
+		if c.StartOffset == offset {
+			parked = c
+			continue
+		}
+		if offset < c.StartOffset+c.Size && c.StartOffset < offset+length {
+			return nil, ErrChunkOverlap
+		}
+	}
+	return parked, nil
+}
+
+// drainChunks appends parked chunks that continue the first received bytes, updates
+// bytes_received and completes the upload once all bytes are stored. Callers hold the upload's claim.
+func (s *FileService) drainChunks(ctx context.Context, file *repository.File, received int64) error {
+	chunks, err := s.repo.Chunks.ListByFileID(ctx, file.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list chunks: %w", err)
+	}
+
+	for _, c := range chunks {
+		if c.StartOffset > received {
+			break
+		}
+		if end := c.StartOffset + c.Size; end > received {
+			n, err := s.appendChunk(ctx, c, received)
+			received += n
+			if err != nil {
+				_ = s.repo.Files.SetBytesReceived(context.WithoutCancel(ctx), file.ID, received)
+				return err
+			}
+		}
+		// A longer resend may have replaced the row meanwhile; it is left for the next drain
+		if err := s.repo.Chunks.Delete(ctx, file.ID, c.StartOffset, c.Key); err != nil {
+			return fmt.Errorf("failed to delete chunk: %w", err)
+		}
+		s.storage.Delete(ctx, c.Key)
+	}
+
+	if received >= file.Size {
+		return s.completeUpload(ctx, file)
+	}
+	if received != file.BytesReceived {
+		if err := s.repo.Files.SetBytesReceived(ctx, file.ID, received); err != nil {
+			return fmt.Errorf("failed to update bytes_received: %w", err)
+		}
+	}
+	return nil
+}
+
+// appendChunk appends the part of a parked chunk past received to its file's data
+func (s *FileService) appendChunk(ctx context.Context, c *repository.UploadChunk, received int64) (int64, error) {
+	reader, err := s.storage.Get(ctx, c.Key)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open chunk: %w", err)
+	}
+	defer reader.Close()
+
+	if _, err := reader.Seek(received-c.StartOffset, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("failed to seek chunk: %w", err)
+	}
+	n, err := s.storage.Append(ctx, partialKey(c.FileID), io.LimitReader(reader, c.StartOffset+c.Size-received))
+	if err != nil {
+		return n, fmt.Errorf("failed to write file data: %w", err)
+	}
+	return n, nil
+}
+
+// discardChunks deletes every parked chunk for a file record
+func (s *FileService) discardChunks(ctx context.Context, fileID int32) {
+	chunks, err := s.repo.Chunks.ListByFileID(ctx, fileID)
+	if err != nil {
+		return
+	}
+	for _, c := range chunks {
+		s.storage.Delete(ctx, c.Key)
+	}
+	_ = s.repo.Chunks.DeleteByFileID(ctx, fileID)
+}
+
+// receivedRanges lists the byte ranges stored for an incomplete file, including parked chunks
+func (s *FileService) receivedRanges(ctx context.Context, file *domain.File) ([]domain.ByteRange, error) {
+	chunks, err := s.repo.Chunks.ListByFileID(ctx, file.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list chunks: %w", err)
+	}
+
+	var ranges []domain.ByteRange
+	if file.BytesReceived > 0 {
+		ranges = append(ranges, domain.ByteRange{Start: 0, End: file.BytesReceived})
+	}
+	for _, c := range chunks {
+		r := domain.ByteRange{Start: c.StartOffset, End: c.StartOffset + c.Size}
+		if n := len(ranges); n > 0 && r.Start <= ranges[n-1].End {
+			ranges[n-1].End = max(ranges[n-1].End, r.End)
+			continue
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, nil
+}
+
+// storedSize returns how many bytes are stored under key (0 if none)
+func (s *FileService) storedSize(ctx context.Context, key string) (int64, error) {
+	size, err := s.storage.Size(ctx, key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to get file size: %w", err)
+	}
+	return size, nil
+}
+
+func partialKey(fileID int32) string {
+	return partialKeyPrefix + strconv.FormatInt(int64(fileID), 10)
+}
+
+// parsePartialKey reverses partialKey, reporting whether key is a partial key at all
+func parsePartialKey(key string) (int32, bool) {
+	id, ok := strings.CutPrefix(key, partialKeyPrefix)
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(id, 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return int32(n), true
+}
+
+// chunkKey is the storage key of a chunk parked at offset; token tells resends apart
+func chunkKey(fileID int32, offset int64, token string) string {
+	return partialKey(fileID) + chunkKeyInfix + strconv.FormatInt(offset, 10) + "." + token
+}
+
+// parseChunkKey reverses chunkKey, reporting whether key is a chunk key at all. Keys
+// without a token, from before parked chunks had one, parse as well.
+func parseChunkKey(key string) (int32, int64, bool) {
+	partial, rest, ok := strings.Cut(key, chunkKeyInfix)
+	if !ok {
+		return 0, 0, false
+	}
+	offset, _, _ := strings.Cut(rest, ".")
+	fileID, ok := parsePartialKey(partial)
+	if !ok {
+		return 0, 0, false
+	}
+	n, err := strconv.ParseInt(offset, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return fileID, n, true
+}
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zqz/web/backend/internal/domain"
+	"github.com/zqz/web/backend/internal/repository"
+	"github.com/zqz/web/backend/internal/service/storage"
+	"github.com/zqz/web/backend/internal/tests"
+)
+
+func TestFileServiceUploadFileChunkOutOfOrder(t *testing.T) {
+	ctx := context.Background()
+	pg, cleanup := tests.SetupTestDB(t, ctx)
+	defer cleanup()
+
+	repo := repository.NewRepository(pg.Pool)
+	stor, err := storage.NewDiskStorage(t.TempDir())
+	require.NoError(t, err)
+	svc := NewFileService(repo, stor)
+
+	alice := createTestUser(t, ctx, repo, "alice")
+	content := []byte("0123456789abcdefghij")
+	hash := sha256Hex(content)
+
+	_, err = svc.CreateFile(ctx, domain.CreateFileRequest{
+		Name: "chunks.txt", Hash: hash, Size: int64(len(content)), ContentType: contentTypePlain, UserID: &alice,
+	}, 0)
+	require.NoError(t, err)
+
+	chunk := func(start, end int64) (*domain.File, error) {
+		return svc.UploadFileChunk(ctx, hash, start, end-start, bytes.NewReader(content[start:end]), 0, &alice)
+	}
+
+	// Last chunk first: parked, nothing contiguous yet
+	file, err := chunk(15, 20)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), file.BytesReceived)
+	assert.Equal(t, []domain.ByteRange{{Start: 15, End: 20}}, file.ReceivedRanges)
+
+	// Resending it is accepted; a different chunk overlapping it is not
+	_, err = chunk(15, 20)
+	require.NoError(t, err)
+	_, err = chunk(12, 17)
+	assert.ErrorIs(t, err, ErrChunkOverlap)
+	_, err = chunk(18, 21)
+	assert.ErrorIs(t, err, ErrInvalidChunk)
+
+	file, err = chunk(0, 5)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), file.BytesReceived)
+	assert.Equal(t, []domain.ByteRange{{Start: 0, End: 5}, {Start: 15, End: 20}}, file.ReceivedRanges)
+
+	// A retried chunk overlapping received data only adds the new bytes
+	file, err = chunk(0, 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), file.BytesReceived)
+
+	// Filling the gap drains the parked chunk and completes the upload
+	file, err = chunk(10, 15)
+	require.NoError(t, err)
+	assert.True(t, file.Finished())
+
+	reader, _, err := svc.DownloadFile(ctx, file.Slug, &alice, false)
+	require.NoError(t, err)
+	defer reader.Close()
+	var got bytes.Buffer
+	_, err = got.ReadFrom(reader)
+	require.NoError(t, err)
+	assert.Equal(t, content, got.Bytes())
+
+	chunks, err := repo.Chunks.ListByFileID(ctx, file.ID)
+	require.NoError(t, err)
+	assert.Empty(t, chunks)
+}
+
+func TestFileServiceUploadFileChunkParallel(t *testing.T) {
+	ctx := context.Background()
+	pg, cleanup := tests.SetupTestDB(t, ctx)
+	defer cleanup()
+
+	repo := repository.NewRepository(pg.Pool)
+	stor, err := storage.NewDiskStorage(t.TempDir())
+	require.NoError(t, err)
+	svc := NewFileService(repo, stor)
+
+	alice := createTestUser(t, ctx, repo, "alice")
+	content := bytes.Repeat([]byte("parallel chunk upload "), 500)
+	hash := sha256Hex(content)
+
+	_, err = svc.CreateFile(ctx, domain.CreateFileRequest{
+		Name: "parallel.txt", Hash: hash, Size: int64(len(content)), ContentType: contentTypePlain, UserID: &alice,
+	}, 0)
+	require.NoError(t, err)
+
+	const chunkSize = 1000
+	var wg sync.WaitGroup
+	errs := make(chan error, len(content)/chunkSize+1)
+	for start := 0; start < len(content); start += chunkSize {
+		end := min(start+chunkSize, len(content))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := svc.UploadFileChunk(ctx, hash, int64(start), int64(end-start), bytes.NewReader(content[start:end]), 0, &alice)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	file, err := svc.GetFileByHash(ctx, hash, &alice)
+	require.NoError(t, err)
+	assert.True(t, file.Finished())
+	blob, err := repo.Blobs.Get(ctx, hash)
+	require.NoError(t, err)
+	assert.True(t, blob.CompletedAt.Valid)
+}
+
+func TestFileServiceUploadFileChunkWhileClaimed(t *testing.T) {
+	ctx := context.Background()
+	pg, cleanup := tests.SetupTestDB(t, ctx)
+	defer cleanup()
+
+	repo := repository.NewRepository(pg.Pool)
+	dir := t.TempDir()
+	stor, err := storage.NewDiskStorage(dir)
+	require.NoError(t, err)
+	svc := NewFileService(repo, stor)
+
+	alice := createTestUser(t, ctx, repo, "alice")
+	content := []byte("0123456789abcdefghij")
+	hash := sha256Hex(content)
+
+	created, err := svc.CreateFile(ctx, domain.CreateFileRequest{
+		Name: "claimed.txt", Hash: hash, Size: int64(len(content)), ContentType: contentTypePlain, UserID: &alice,
+	}, 0)
+	require.NoError(t, err)
+
+	// Another writer holds the upload: chunks are parked instead of waiting for it
+	ok, err := repo.Claims.Claim(ctx, partialKey(created.ID), "other", time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := svc.UploadFileChunk(ctx, hash, 0, 10, bytes.NewReader(content[:10]), 0, &alice)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	chunks, err := repo.Chunks.ListByFileID(ctx, created.ID)
+	require.NoError(t, err)
+	require.Len(t, chunks, 1, "resends share one row")
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "superseded resends are deleted")
+
+	_, err = svc.UploadFileData(ctx, hash, bytes.NewReader(content), 0, &alice)
+	assert.ErrorIs(t, err, ErrUploadInProgress)
+
+	// Once the claim is gone the next chunk drains the parked one
+	require.NoError(t, repo.Claims.Release(ctx, partialKey(created.ID), "other"))
+	file, err := svc.UploadFileChunk(ctx, hash, 10, 10, bytes.NewReader(content[10:]), 0, &alice)
+	require.NoError(t, err)
+	assert.True(t, file.Finished())
+}
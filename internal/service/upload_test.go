@@ -0,0 +1,60 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zqz/web/backend/internal/domain"
+	"github.com/zqz/web/backend/internal/repository"
+	"github.com/zqz/web/backend/internal/service/storage"
+	"github.com/zqz/web/backend/internal/tests"
+)
+
+func TestFileServiceUploadFile(t *testing.T) {
+	ctx := context.Background()
+	pg, cleanup := tests.SetupTestDB(t, ctx)
+	defer cleanup()
+
+	repo := repository.NewRepository(pg.Pool)
+	dir := t.TempDir()
+	stor, err := storage.NewDiskStorage(dir)
+	require.NoError(t, err)
+	svc := NewFileService(repo, stor)
+
+	alice := createTestUser(t, ctx, repo, "alice")
+	bob := createTestUser(t, ctx, repo, "bob")
+
+	content := []byte("uploaded in one request")
+	hash := sha256Hex(content)
+
+	aliceFile, err := svc.UploadFile(ctx, domain.CreateFileRequest{
+		Name: "alice.txt", ContentType: contentTypePlain, UserID: &alice,
+	}, bytes.NewReader(content), 0)
+	require.NoError(t, err)
+	assert.Equal(t, hash, aliceFile.Hash)
+	assert.Equal(t, int64(len(content)), aliceFile.Size)
+	assert.True(t, aliceFile.Finished())
+
+	// The same bytes again share the blob
+	bobFile, err := svc.UploadFile(ctx, domain.CreateFileRequest{
+		Name: "bob.txt", ContentType: contentTypePlain, UserID: &bob,
+	}, bytes.NewReader(content), 0)
+	require.NoError(t, err)
+	assert.NotEqual(t, aliceFile.Slug, bobFile.Slug)
+	blob, err := repo.Blobs.Get(ctx, hash)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), blob.RefCount)
+
+	// Too large: rejected and nothing left behind
+	_, err = svc.UploadFile(ctx, domain.CreateFileRequest{
+		Name: "big.txt", ContentType: contentTypePlain, UserID: &alice,
+	}, bytes.NewReader(bytes.Repeat([]byte("x"), 100)), 10)
+	assert.ErrorIs(t, err, ErrFileTooLarge)
+
+	reader, _, err := svc.DownloadFile(ctx, bobFile.Slug, &bob, false)
+	require.NoError(t, err)
+	reader.Close()
+}
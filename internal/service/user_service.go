@@ -5,78 +5,127 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/zqz/web/backend/internal/domain"
 	"github.com/zqz/web/backend/internal/repository"
+	"github.com/zqz/web/backend/internal/telemetry"
 )
 
 var hexColourRegex = regexp.MustCompile(`^#[0-9A-Fa-f]{6}$`)
 
+// maxBanReasonLen caps the reason shown to a banned user
+const maxBanReasonLen = 500
+
 var (
 	// ErrUserNotFound is returned when a user is not found
 	ErrUserNotFound = errors.New("user not found")
 
 	// ErrUserAlreadyExists is returned when trying to create a user that already exists
 	ErrUserAlreadyExists = errors.New("user already exists")
+
+	// ErrInvalidRole is returned when setting a role that doesn't exist
+	ErrInvalidRole = errors.New("invalid role")
+
+	// ErrLastAdmin is returned when changing the role of the only admin
+	ErrLastAdmin = errors.New("cannot change the role of the last admin")
+
+	// ErrInvalidBan is returned for a ban reason that is too long or an expiry that has passed
+	ErrInvalidBan = errors.New("invalid ban")
 )
 
 // UserService handles user business logic
 type UserService struct {
-	repo *repository.Repository
+	repo         *repository.Repository
+	loginLimiter *attemptLimiter // failed sign-ins, keyed by lowercased email
 }
 
 // NewUserService creates a new user service
 func NewUserService(repo *repository.Repository) *UserService {
 	return &UserService{
-		repo: repo,
+		repo:         repo,
+		loginLimiter: newAttemptLimiter(loginAttemptBurst, loginAttemptRefill),
 	}
 }
 
-// GetOrCreateUser gets an existing user or creates a new one based on provider ID
+// GetOrCreateUser returns the user an identity from a login provider is linked to,
+// creating the user (and linking the identity) on first sign-in
 func (s *UserService) GetOrCreateUser(ctx context.Context, req domain.CreateUserRequest) (*domain.User, error) {
+	ctx, span := telemetry.Start(ctx, "UserService.GetOrCreateUser")
+	defer span.End()
+
 	// Validate request
 	if err := validateCreateUserRequest(req); err != nil {
 		return nil, fmt.Errorf("invalid request: %w", err)
 	}
 
-	// Try to find existing user by provider ID
-	dbUser, err := s.repo.Users.GetByProviderID(ctx, req.ProviderID)
+	// Try to find the user the identity is linked to
+	identity, err := s.repo.Identities.Get(ctx, req.Provider, req.ProviderID)
 	if err != nil && !errors.Is(err, repository.ErrNotFound) {
-		return nil, fmt.Errorf("failed to check existing user: %w", err)
+		return nil, fmt.Errorf("failed to check existing identity: %w", err)
 	}
 
-	if dbUser != nil {
+	if identity != nil {
 		// User exists, return it
-		return dbUserToDomain(dbUser), nil
+		return s.GetUserByID(ctx, identity.UserID)
 	}
 
+	return s.createUser(ctx, req, nil)
+}
+
+// createUser creates a user along with the identity they signed up with
+func (s *UserService) createUser(ctx context.Context, req domain.CreateUserRequest, passwordHash *string) (*domain.User, error) {
 	// Check if this is the first user (make them admin)
 	role := req.Role
 	if role == "" {
-		role = "member" // Default role
+		role = domain.RoleMember // Default role
 	}
 
-	count, err := s.repo.Users.Count(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("failed to count users: %w", err)
-	}
+	var dbUser *repository.User
+	err := s.repo.WithTransaction(ctx, func(ctx context.Context, repo *repository.Repository) error {
+		// Serialize signups so two first users can't both see an empty table
+		if err := repo.XactLock(ctx, repository.LockUserSignup, "first-user"); err != nil {
+			return fmt.Errorf("failed to lock signups: %w", err)
+		}
+		count, err := repo.Users.Count(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to count users: %w", err)
+		}
 
-	if count == 0 {
-		// First user becomes admin
-		role = "admin"
-	}
+		if count == 0 {
+			// First user becomes admin
+			role = domain.RoleAdmin
+		}
 
-	// Create new user
-	dbUser, err = s.repo.Users.Create(ctx, repository.CreateUserParams{
-		Name:       req.Name,
-		Email:      req.Email,
-		Provider:   req.Provider,
-		ProviderID: req.ProviderID,
-		Role:       role,
+		// Create new user
+		dbUser, err = repo.Users.Create(ctx, repository.CreateUserParams{
+			Name:       req.Name,
+			Email:      req.Email,
+			Provider:   req.Provider,
+			ProviderID: req.ProviderID,
+			Role:       role,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create user: %w", err)
+		}
+
+		// Rolls back the user too, so there is never a user nobody can sign in as
+		_, err = repo.Identities.Create(ctx, repository.CreateUserIdentityParams{
+			UserID:       dbUser.ID,
+			Provider:     req.Provider,
+			ProviderID:   req.ProviderID,
+			Email:        req.Email,
+			PasswordHash: passwordHash,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create identity: %w", err)
+		}
+		return nil
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to create user: %w", err)
+		return nil, err
 	}
 
 	return dbUserToDomain(dbUser), nil
@@ -84,6 +133,9 @@ func (s *UserService) GetOrCreateUser(ctx context.Context, req domain.CreateUser
 
 // GetUserByID retrieves a user by ID
 func (s *UserService) GetUserByID(ctx context.Context, id int32) (*domain.User, error) {
+	ctx, span := telemetry.Start(ctx, "UserService.GetUserByID")
+	defer span.End()
+
 	dbUser, err := s.repo.Users.GetByID(ctx, id)
 	if err != nil {
 		if errors.Is(err, repository.ErrNotFound) {
@@ -97,6 +149,9 @@ func (s *UserService) GetUserByID(ctx context.Context, id int32) (*domain.User,
 
 // GetUserByProviderID retrieves a user by their OAuth provider ID
 func (s *UserService) GetUserByProviderID(ctx context.Context, providerID string) (*domain.User, error) {
+	ctx, span := telemetry.Start(ctx, "UserService.GetUserByProviderID")
+	defer span.End()
+
 	dbUser, err := s.repo.Users.GetByProviderID(ctx, providerID)
 	if err != nil {
 		if errors.Is(err, repository.ErrNotFound) {
@@ -108,32 +163,153 @@ func (s *UserService) GetUserByProviderID(ctx context.Context, providerID string
 	return dbUserToDomain(dbUser), nil
 }
 
-// SetBanned sets the banned status of a user (admin only; caller must enforce).
-func (s *UserService) SetBanned(ctx context.Context, userID int32, banned bool) (*domain.User, error) {
-	dbUser, err := s.repo.Users.SetBanned(ctx, userID, banned)
+// GetUserByEmail retrieves a user by email address
+func (s *UserService) GetUserByEmail(ctx context.Context, email string) (*domain.User, error) {
+	ctx, span := telemetry.Start(ctx, "UserService.GetUserByEmail")
+	defer span.End()
+
+	dbUser, err := s.repo.Users.GetByEmail(ctx, email)
 	if err != nil {
 		if errors.Is(err, repository.ErrNotFound) {
 			return nil, ErrUserNotFound
 		}
-		return nil, fmt.Errorf("failed to set banned: %w", err)
+		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
+
 	return dbUserToDomain(dbUser), nil
 }
 
+// SetRole changes a user's role to one of domain.Roles (needs domain.PermManageUsers; caller must enforce).
+// The last admin can't be given another role, so someone can always manage the site.
+func (s *UserService) SetRole(ctx context.Context, userID int32, role string) (*domain.User, error) {
+	ctx, span := telemetry.Start(ctx, "UserService.SetRole")
+	defer span.End()
+
+	if !domain.ValidRole(role) {
+		return nil, ErrInvalidRole
+	}
+	return s.updateUser(ctx, userID, func(ctx context.Context, repo *repository.Repository, before *repository.User) (*repository.User, error) {
+		if before.Role == domain.RoleAdmin && role != domain.RoleAdmin {
+			admins, err := repo.Users.CountByRole(ctx, domain.RoleAdmin)
+			if err != nil {
+				return nil, fmt.Errorf("failed to count admins: %w", err)
+			}
+			if admins <= 1 {
+				return nil, ErrLastAdmin
+			}
+		}
+		dbUser, err := repo.Users.Update(ctx, repository.UpdateUserParams{ID: userID, Role: &role})
+		if err != nil {
+			return nil, fmt.Errorf("failed to set role: %w", err)
+		}
+		return dbUser, auditUser(ctx, repo, domain.AuditUserRole, userID, map[string]any{"role": before.Role}, map[string]any{"role": dbUser.Role})
+	})
+}
+
+// SetBanned bans a user with no reason or expiry, or lifts their ban (admin only; caller must enforce).
+func (s *UserService) SetBanned(ctx context.Context, userID int32, banned bool) (*domain.User, error) {
+	if banned {
+		return s.BanUser(ctx, userID, domain.BanRequest{})
+	}
+	return s.UnbanUser(ctx, userID)
+}
+
+// BanUser bans a user (admin only; caller must enforce). A banned user can still sign
+// in and read, but every change they try to make is refused until the ban expires or is lifted.
+func (s *UserService) BanUser(ctx context.Context, userID int32, req domain.BanRequest) (*domain.User, error) {
+	ctx, span := telemetry.Start(ctx, "UserService.BanUser")
+	defer span.End()
+
+	req.Reason = strings.TrimSpace(req.Reason)
+	if len(req.Reason) > maxBanReasonLen {
+		return nil, ErrInvalidBan
+	}
+	if req.Until != nil && !req.Until.After(time.Now()) {
+		return nil, ErrInvalidBan
+	}
+	var reason *string
+	if req.Reason != "" {
+		reason = &req.Reason
+	}
+	var until *time.Time
+	if req.Until != nil {
+		t := req.Until.UTC()
+		until = &t
+	}
+	return s.setBan(ctx, domain.AuditUserBan, repository.SetUserBannedParams{
+		ID:            userID,
+		Banned:        true,
+		BanReason:     reason,
+		BannedUntil:   pgTimestampFromPtr(until),
+		BanHidesFiles: req.HideFiles,
+	})
+}
+
+// UnbanUser lifts a user's ban and shows their files again (admin only; caller must enforce).
+func (s *UserService) UnbanUser(ctx context.Context, userID int32) (*domain.User, error) {
+	ctx, span := telemetry.Start(ctx, "UserService.UnbanUser")
+	defer span.End()
+
+	return s.setBan(ctx, domain.AuditUserUnban, repository.SetUserBannedParams{ID: userID})
+}
+
+func (s *UserService) setBan(ctx context.Context, action string, params repository.SetUserBannedParams) (*domain.User, error) {
+	return s.updateUser(ctx, params.ID, func(ctx context.Context, repo *repository.Repository, before *repository.User) (*repository.User, error) {
+		dbUser, err := repo.Users.SetBanned(ctx, params)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set banned: %w", err)
+		}
+		return dbUser, auditUser(ctx, repo, action, params.ID, banState(before), banState(dbUser))
+	})
+}
+
+// banState is the part of a user the audit log records for bans
+func banState(u *repository.User) map[string]any {
+	return map[string]any{
+		"banned":     u.Banned,
+		"reason":     u.BanReason,
+		"until":      timePtrFromPgType(u.BannedUntil),
+		"hide_files": u.BanHidesFiles,
+	}
+}
+
 // SetMaxFileSize sets the max file size override for a user (admin only; caller must enforce). nil = use site default.
 func (s *UserService) SetMaxFileSize(ctx context.Context, userID int32, maxBytes *int64) (*domain.User, error) {
-	dbUser, err := s.repo.Users.SetMaxFileSize(ctx, userID, maxBytes)
-	if err != nil {
-		if errors.Is(err, repository.ErrNotFound) {
-			return nil, ErrUserNotFound
+	ctx, span := telemetry.Start(ctx, "UserService.SetMaxFileSize")
+	defer span.End()
+
+	return s.updateUser(ctx, userID, func(ctx context.Context, repo *repository.Repository, before *repository.User) (*repository.User, error) {
+		dbUser, err := repo.Users.SetMaxFileSize(ctx, userID, maxBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set max file size: %w", err)
 		}
-		return nil, fmt.Errorf("failed to set max file size: %w", err)
-	}
-	return dbUserToDomain(dbUser), nil
+		return dbUser, auditUser(ctx, repo, domain.AuditUserMaxFileSize, userID,
+			map[string]any{"max_file_size": before.MaxFileSizeOverride},
+			map[string]any{"max_file_size": dbUser.MaxFileSizeOverride})
+	})
+}
+
+// SetStorageQuota sets the total storage quota override for a user (admin only; caller must enforce). nil = use site default.
+func (s *UserService) SetStorageQuota(ctx context.Context, userID int32, quotaBytes *int64) (*domain.User, error) {
+	ctx, span := telemetry.Start(ctx, "UserService.SetStorageQuota")
+	defer span.End()
+
+	return s.updateUser(ctx, userID, func(ctx context.Context, repo *repository.Repository, before *repository.User) (*repository.User, error) {
+		dbUser, err := repo.Users.SetStorageQuota(ctx, userID, quotaBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set storage quota: %w", err)
+		}
+		return dbUser, auditUser(ctx, repo, domain.AuditUserStorageQuota, userID,
+			map[string]any{"storage_quota": before.StorageQuotaOverride},
+			map[string]any{"storage_quota": dbUser.StorageQuotaOverride})
+	})
 }
 
 // ListUsers returns a paginated list of users
 func (s *UserService) ListUsers(ctx context.Context, limit, offset int32) ([]*domain.User, error) {
+	ctx, span := telemetry.Start(ctx, "UserService.ListUsers")
+	defer span.End()
+
 	dbUsers, err := s.repo.Users.List(ctx, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list users: %w", err)
@@ -150,6 +326,9 @@ func (s *UserService) ListUsers(ctx context.Context, limit, offset int32) ([]*do
 // UpdateProfile updates the current user's display tag and colour.
 // displayTag must be 1-3 chars (or empty to clear). colour must be hex #RRGGBB or empty to clear.
 func (s *UserService) UpdateProfile(ctx context.Context, userID int32, displayTag, colour string) (*domain.User, error) {
+	ctx, span := telemetry.Start(ctx, "UserService.UpdateProfile")
+	defer span.End()
+
 	displayTag = strings.TrimSpace(displayTag)
 	colour = strings.TrimSpace(colour)
 	if displayTag != "" && (len([]rune(displayTag)) < 1 || len([]rune(displayTag)) > 3) {
@@ -165,21 +344,60 @@ func (s *UserService) UpdateProfile(ctx context.Context, userID int32, displayTa
 	if colour != "" {
 		colourPtr = &colour
 	}
-	dbUser, err := s.repo.Users.UpdateProfile(ctx, repository.UpdateUserProfileParams{
-		ID:         userID,
-		DisplayTag: tagPtr,
-		Colour:     colourPtr,
+	return s.updateUser(ctx, userID, func(ctx context.Context, repo *repository.Repository, before *repository.User) (*repository.User, error) {
+		dbUser, err := repo.Users.UpdateProfile(ctx, repository.UpdateUserProfileParams{
+			ID:         userID,
+			DisplayTag: tagPtr,
+			Colour:     colourPtr,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to update profile: %w", err)
+		}
+		return dbUser, auditUser(ctx, repo, domain.AuditUserProfile, userID,
+			map[string]any{"display_tag": before.DisplayTag, "colour": before.Colour},
+			map[string]any{"display_tag": dbUser.DisplayTag, "colour": dbUser.Colour})
+	})
+}
+
+// Helper functions
+
+// updateUser runs change in a transaction with the user's row locked, passing the user as it
+// was. change makes the update and records its audit event, so both commit together.
+func (s *UserService) updateUser(ctx context.Context, userID int32, change func(ctx context.Context, repo *repository.Repository, before *repository.User) (*repository.User, error)) (*domain.User, error) {
+	var dbUser *repository.User
+	err := s.repo.WithTransaction(ctx, func(ctx context.Context, repo *repository.Repository) error {
+		before, err := lockUser(ctx, repo, userID)
+		if err != nil {
+			return err
+		}
+		dbUser, err = change(ctx, repo, before)
+		return err
 	})
 	if err != nil {
+		return nil, err
+	}
+	return dbUserToDomain(dbUser), nil
+}
+
+// lockUser loads the user an audited change is about to modify, locking their row until the
+// transaction repo belongs to ends
+func lockUser(ctx context.Context, repo *repository.Repository, userID int32) (*repository.User, error) {
+	if err := repo.Users.Lock(ctx, userID); err != nil {
 		if errors.Is(err, repository.ErrNotFound) {
 			return nil, ErrUserNotFound
 		}
-		return nil, fmt.Errorf("failed to update profile: %w", err)
+		return nil, fmt.Errorf("failed to lock user: %w", err)
 	}
-	return dbUserToDomain(dbUser), nil
+	dbUser, err := repo.Users.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	return dbUser, nil
 }
 
-// Helper functions
+func auditUser(ctx context.Context, repo *repository.Repository, action string, userID int32, before, after any) error {
+	return recordAudit(ctx, repo, action, domain.AuditTargetUser, strconv.Itoa(int(userID)), before, after)
+}
 
 func validateCreateUserRequest(req domain.CreateUserRequest) error {
 	if req.Name == "" {
@@ -195,23 +413,26 @@ func validateCreateUserRequest(req domain.CreateUserRequest) error {
 		return errors.New("provider ID is required")
 	}
 	if req.Role == "" {
-		req.Role = "member" // Default role
+		req.Role = domain.RoleMember // Default role
 	}
 	return nil
 }
 
 func dbUserToDomain(u *repository.User) *domain.User {
 	out := &domain.User{
-		ID:                  u.ID,
-		Name:                u.Name,
-		Email:               u.Email,
-		Provider:            u.Provider,
-		ProviderID:          u.ProviderID,
-		Role:                u.Role,
-		Banned:              u.Banned,
-		MaxFileSizeOverride: u.MaxFileSizeOverride,
-		CreatedAt:           u.CreatedAt,
-		UpdatedAt:           u.UpdatedAt,
+		ID:                   u.ID,
+		Name:                 u.Name,
+		Email:                u.Email,
+		Provider:             u.Provider,
+		ProviderID:           u.ProviderID,
+		Role:                 u.Role,
+		Banned:               u.Banned,
+		BannedUntil:          timePtrFromPgType(u.BannedUntil),
+		BanHidesFiles:        u.BanHidesFiles,
+		MaxFileSizeOverride:  u.MaxFileSizeOverride,
+		StorageQuotaOverride: u.StorageQuotaOverride,
+		CreatedAt:            u.CreatedAt,
+		UpdatedAt:            u.UpdatedAt,
 	}
 	if u.DisplayTag != nil {
 		out.DisplayTag = *u.DisplayTag
@@ -219,5 +440,8 @@ func dbUserToDomain(u *repository.User) *domain.User {
 	if u.Colour != nil {
 		out.Colour = *u.Colour
 	}
+	if u.BanReason != nil {
+		out.BanReason = *u.BanReason
+	}
 	return out
 }
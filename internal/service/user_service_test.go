@@ -2,8 +2,13 @@ package service
 
 import (
 	"context"
+	"fmt"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/zqz/web/backend/internal/domain"
@@ -91,6 +96,46 @@ func TestUserServiceGetOrCreateUserSecondUserIsMember(t *testing.T) {
 	assert.Equal(t, testRoleMember, second.Role)
 }
 
+func TestUserServiceGetOrCreateUserConcurrentFirstUsers(t *testing.T) {
+	ctx := context.Background()
+	pg, cleanup := tests.SetupTestDB(t, ctx)
+	defer cleanup()
+
+	repo := repository.NewRepository(pg.Pool)
+	svc := NewUserService(repo)
+
+	const signups = 5
+	roles := make(chan string, signups)
+	var wg sync.WaitGroup
+	for i := range signups {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			user, err := svc.GetOrCreateUser(ctx, domain.CreateUserRequest{
+				Name:       fmt.Sprintf("User %d", i),
+				Email:      fmt.Sprintf("user%d@example.com", i),
+				Provider:   testProviderGoogle,
+				ProviderID: fmt.Sprintf("google-%d", i),
+				Role:       testRoleMember,
+			})
+			assert.NoError(t, err)
+			if user != nil {
+				roles <- user.Role
+			}
+		}()
+	}
+	wg.Wait()
+	close(roles)
+
+	admins := 0
+	for role := range roles {
+		if role == domain.RoleAdmin {
+			admins++
+		}
+	}
+	assert.Equal(t, 1, admins, "only the first user becomes admin")
+}
+
 func TestUserServiceGetOrCreateUserValidationErrors(t *testing.T) {
 	ctx := context.Background()
 	pg, cleanup := tests.SetupTestDB(t, ctx)
@@ -346,3 +391,106 @@ func TestUserServiceUpdateProfileValidationErrors(t *testing.T) {
 	_, err = svc.UpdateProfile(ctx, 99999, "A", "#ffffff")
 	assert.ErrorIs(t, err, ErrUserNotFound)
 }
+
+func TestUserServiceAPITokenLifecycle(t *testing.T) {
+	ctx := context.Background()
+	pg, cleanup := tests.SetupTestDB(t, ctx)
+	defer cleanup()
+
+	repo := repository.NewRepository(pg.Pool)
+	svc := NewUserService(repo)
+
+	owner, err := svc.GetOrCreateUser(ctx, domain.CreateUserRequest{
+		Name:       "TokenOwner",
+		Email:      "tokens@example.com",
+		Provider:   testProviderGoogle,
+		ProviderID: "google-tokens",
+		Role:       testRoleMember,
+	})
+	require.NoError(t, err)
+
+	expiresAt := time.Now().Add(24 * time.Hour)
+	plaintext, token, err := svc.CreateAPIToken(ctx, owner.ID, domain.CreateAPITokenRequest{
+		Name:      "ci",
+		Scopes:    []string{domain.ScopeUpload},
+		ExpiresAt: &expiresAt,
+	})
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(plaintext, apiTokenPrefix))
+	assert.Equal(t, "ci", token.Name)
+	assert.Equal(t, []string{domain.ScopeUpload}, token.Scopes)
+	require.NotNil(t, token.ExpiresAt)
+	assert.Nil(t, token.LastUsedAt)
+
+	// Only the hash is stored
+	stored, err := repo.APITokens.GetByHash(ctx, hashAPIToken(plaintext))
+	require.NoError(t, err)
+	assert.NotEqual(t, plaintext, stored.TokenHash)
+
+	user, authed, err := svc.AuthenticateAPIToken(ctx, plaintext)
+	require.NoError(t, err)
+	assert.Equal(t, owner.ID, user.ID)
+	assert.Equal(t, token.ID, authed.ID)
+	assert.True(t, authed.HasScope(domain.ScopeUpload))
+	assert.False(t, authed.HasScope(domain.ScopeDelete))
+
+	tokens, err := svc.ListAPITokens(ctx, owner.ID)
+	require.NoError(t, err)
+	require.Len(t, tokens, 1)
+	assert.NotNil(t, tokens[0].LastUsedAt)
+
+	// Another user cannot revoke the token
+	err = svc.RevokeAPIToken(ctx, owner.ID+1, token.ID)
+	assert.ErrorIs(t, err, ErrAPITokenNotFound)
+
+	require.NoError(t, svc.RevokeAPIToken(ctx, owner.ID, token.ID))
+	_, _, err = svc.AuthenticateAPIToken(ctx, plaintext)
+	assert.ErrorIs(t, err, ErrInvalidAPIToken)
+}
+
+func TestUserServiceAPITokenValidationAndExpiry(t *testing.T) {
+	ctx := context.Background()
+	pg, cleanup := tests.SetupTestDB(t, ctx)
+	defer cleanup()
+
+	repo := repository.NewRepository(pg.Pool)
+	svc := NewUserService(repo)
+
+	owner, err := svc.GetOrCreateUser(ctx, domain.CreateUserRequest{
+		Name:       "TokenExpiry",
+		Email:      "expiry@example.com",
+		Provider:   testProviderGoogle,
+		ProviderID: "google-expiry",
+		Role:       testRoleMember,
+	})
+	require.NoError(t, err)
+
+	_, _, err = svc.CreateAPIToken(ctx, owner.ID, domain.CreateAPITokenRequest{Name: "  "})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "name is required")
+
+	_, _, err = svc.CreateAPIToken(ctx, owner.ID, domain.CreateAPITokenRequest{Name: "x", Scopes: []string{"admin"}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown scope")
+
+	past := time.Now().Add(-time.Hour)
+	_, _, err = svc.CreateAPIToken(ctx, owner.ID, domain.CreateAPITokenRequest{Name: "x", ExpiresAt: &past})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "expiry must be in the future")
+
+	// A token that has since expired is rejected
+	expired := "upl_expired"
+	_, err = repo.APITokens.Create(ctx, repository.CreateAPITokenParams{
+		UserID:    owner.ID,
+		Name:      "old",
+		TokenHash: hashAPIToken(expired),
+		Scopes:    []string{},
+		ExpiresAt: pgtype.Timestamp{Time: past, Valid: true},
+	})
+	require.NoError(t, err)
+	_, _, err = svc.AuthenticateAPIToken(ctx, expired)
+	assert.ErrorIs(t, err, ErrAPITokenExpired)
+
+	_, _, err = svc.AuthenticateAPIToken(ctx, "not-a-token")
+	assert.ErrorIs(t, err, ErrInvalidAPIToken)
+}
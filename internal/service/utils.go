@@ -25,3 +25,19 @@ func timeFromPgType(t pgtype.Timestamp) time.Time {
 	}
 	return t.Time
 }
+
+// timePtrFromPgType converts a nullable pgtype.Timestamp to *time.Time
+func timePtrFromPgType(t pgtype.Timestamp) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// pgTimestampFromPtr converts *time.Time to a nullable pgtype.Timestamp
+func pgTimestampFromPtr(t *time.Time) pgtype.Timestamp {
+	if t == nil {
+		return pgtype.Timestamp{}
+	}
+	return pgtype.Timestamp{Time: *t, Valid: true}
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// staleJobTimeout is how long a job may stay running before another worker may claim it
+const staleJobTimeout = 15 * time.Minute
+
+// ProcessingWorkers is a pool of goroutines draining the processing job queue
+type ProcessingWorkers struct {
+	fileSvc      *FileService
+	logger       *zerolog.Logger
+	concurrency  int
+	pollInterval time.Duration
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewProcessingWorkers creates a worker pool. concurrency <= 0 disables it.
+func NewProcessingWorkers(fileSvc *FileService, logger *zerolog.Logger, concurrency int, pollInterval time.Duration) *ProcessingWorkers {
+	if pollInterval <= 0 {
+		pollInterval = time.Second
+	}
+	return &ProcessingWorkers{
+		fileSvc:      fileSvc,
+		logger:       logger,
+		concurrency:  concurrency,
+		pollInterval: pollInterval,
+	}
+}
+
+// Start launches the workers. They run until Stop is called.
+func (w *ProcessingWorkers) Start() {
+	if w.concurrency <= 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w.cancel = cancel
+
+	w.wg.Add(1)
+	go w.releaseStale(ctx)
+
+	for i := 0; i < w.concurrency; i++ {
+		w.wg.Add(1)
+		go w.run(ctx, i)
+	}
+
+	w.logger.Info().Int("workers", w.concurrency).Msg("processing workers started")
+}
+
+// Stop signals the workers and waits for in-flight jobs to finish
+func (w *ProcessingWorkers) Stop() {
+	if w.cancel == nil {
+		return
+	}
+	w.cancel()
+	w.wg.Wait()
+	w.cancel = nil
+}
+
+func (w *ProcessingWorkers) run(ctx context.Context, id int) {
+	defer w.wg.Done()
+
+	for {
+		// A job that has started is allowed to finish and record its result
+		worked, err := w.fileSvc.ProcessNextJob(context.WithoutCancel(ctx))
+		if err != nil {
+			w.logger.Error().Err(err).Int("worker", id).Msg("processing job failed")
+		}
+
+		if worked {
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(w.pollInterval):
+		}
+	}
+}
+
+func (w *ProcessingWorkers) releaseStale(ctx context.Context) {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		n, err := w.fileSvc.ReleaseStaleJobs(ctx, staleJobTimeout)
+		if err != nil && ctx.Err() == nil {
+			w.logger.Error().Err(err).Msg("failed to release stale processing jobs")
+		} else if n > 0 {
+			w.logger.Warn().Int64("jobs", n).Msg("released stale processing jobs")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/zqz/web/backend/internal/service/storage"
+)
+
+// Storage returns s with every call made in a span under the call's context. Calls whose
+// context isn't traced get no span.
+func Storage(s storage.Storage) storage.Storage {
+	return &tracedStorage{inner: s}
+}
+
+type tracedStorage struct {
+	inner storage.Storage
+}
+
+func (t *tracedStorage) start(ctx context.Context, op, key string) (context.Context, trace.Span) {
+	if !traced(ctx) {
+		return ctx, trace.SpanFromContext(context.Background()) // no-op
+	}
+	return tracer().Start(ctx, "storage."+op, trace.WithAttributes(attribute.String("storage.key", key)))
+}
+
+func (t *tracedStorage) Put(ctx context.Context, key string, data io.Reader) error {
+	ctx, span := t.start(ctx, "Put", key)
+	defer span.End()
+	err := t.inner.Put(ctx, key, data)
+	recordStorageError(span, err)
+	return err
+}
+
+func (t *tracedStorage) Append(ctx context.Context, key string, data io.Reader) (int64, error) {
+	ctx, span := t.start(ctx, "Append", key)
+	defer span.End()
+	n, err := t.inner.Append(ctx, key, data)
+	span.SetAttributes(attribute.Int64("storage.bytes", n))
+	recordStorageError(span, err)
+	return n, err
+}
+
+func (t *tracedStorage) Finalize(ctx context.Context, key string) error {
+	ctx, span := t.start(ctx, "Finalize", key)
+	defer span.End()
+	err := t.inner.Finalize(ctx, key)
+	recordStorageError(span, err)
+	return err
+}
+
+// Get's span stays open until the reader is closed, so it covers reading the data too
+func (t *tracedStorage) Get(ctx context.Context, key string) (io.ReadSeekCloser, error) {
+	ctx, span := t.start(ctx, "Get", key)
+	r, err := t.inner.Get(ctx, key)
+	if err != nil {
+		recordStorageError(span, err)
+		span.End()
+		return nil, err
+	}
+	return &tracedReader{ReadSeekCloser: r, span: span}, nil
+}
+
+func (t *tracedStorage) Delete(ctx context.Context, key string) error {
+	ctx, span := t.start(ctx, "Delete", key)
+	defer span.End()
+	err := t.inner.Delete(ctx, key)
+	recordStorageError(span, err)
+	return err
+}
+
+func (t *tracedStorage) Exists(ctx context.Context, key string) (bool, error) {
+	ctx, span := t.start(ctx, "Exists", key)
+	defer span.End()
+	ok, err := t.inner.Exists(ctx, key)
+	recordStorageError(span, err)
+	return ok, err
+}
+
+func (t *tracedStorage) Size(ctx context.Context, key string) (int64, error) {
+	ctx, span := t.start(ctx, "Size", key)
+	defer span.End()
+	n, err := t.inner.Size(ctx, key)
+	recordStorageError(span, err)
+	return n, err
+}
+
+func (t *tracedStorage) List(ctx context.Context, fn func(storage.Object) error) error {
+	ctx, span := t.start(ctx, "List", "")
+	defer span.End()
+	err := t.inner.List(ctx, fn)
+	recordStorageError(span, err)
+	return err
+}
+
+// recordStorageError records err on span, except ErrNotFound, which callers routinely expect
+func recordStorageError(span trace.Span, err error) {
+	if !errors.Is(err, storage.ErrNotFound) {
+		RecordError(span, err)
+	}
+}
+
+// tracedReader ends its Get span on Close, recording how much was read
+type tracedReader struct {
+	io.ReadSeekCloser
+	span  trace.Span
+	bytes int64
+}
+
+func (r *tracedReader) Read(p []byte) (int, error) {
+	n, err := r.ReadSeekCloser.Read(p)
+	r.bytes += int64(n)
+	return n, err
+}
+
+func (r *tracedReader) Close() error {
+	err := r.ReadSeekCloser.Close()
+	r.span.SetAttributes(attribute.Int64("storage.bytes", r.bytes))
+	r.span.End()
+	return err
+}
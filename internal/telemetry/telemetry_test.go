@@ -0,0 +1,94 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/zqz/web/backend/internal/service/storage"
+)
+
+func TestQueryName(t *testing.T) {
+	assert.Equal(t, "GetFileBySlug", queryName("-- name: GetFileBySlug :one\nSELECT 1"))
+	assert.Equal(t, "query", queryName("SELECT 1"))
+	assert.Equal(t, "query", queryName("-- name: "))
+}
+
+func TestStorage(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { _ = provider.Shutdown(context.Background()) })
+
+	disk, err := storage.NewDiskStorage(t.TempDir())
+	require.NoError(t, err)
+
+	s := Storage(disk)
+
+	// Calls without a span in the context get none
+	_, err = s.Exists(context.Background(), "key")
+	require.NoError(t, err)
+	assert.Empty(t, rec.Ended())
+
+	ctx, parent := Start(context.Background(), "request")
+	assert.NotEmpty(t, TraceID(ctx))
+
+	require.NoError(t, s.Put(ctx, "key", strings.NewReader("data")))
+	r, err := s.Get(ctx, "key")
+	require.NoError(t, err)
+	assert.Len(t, rec.Ended(), 1, "Get's span is open until the reader is closed")
+	_, err = io.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	assert.ErrorIs(t, s.Delete(ctx, "missing"), storage.ErrNotFound)
+	_, err = s.Append(ctx, "key/bad", strings.NewReader("x"))
+	require.Error(t, err)
+	parent.End()
+
+	spans := rec.Ended()
+	require.Len(t, spans, 5)
+	for _, span := range spans[:4] {
+		assert.Equal(t, parent.SpanContext().SpanID(), span.Parent().SpanID())
+	}
+	assert.Equal(t, "storage.Put", spans[0].Name())
+	assert.Equal(t, "storage.Get", spans[1].Name())
+	assert.Contains(t, spans[1].Attributes(), storageBytes(4))
+	assert.Equal(t, "storage.Delete", spans[2].Name())
+	assert.Equal(t, codes.Unset, spans[2].Status().Code, "ErrNotFound is not a failure")
+	assert.Equal(t, "storage.Append", spans[3].Name())
+	assert.Equal(t, codes.Error, spans[3].Status().Code)
+}
+
+func TestRecordError(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { _ = provider.Shutdown(context.Background()) })
+
+	_, span := Start(context.Background(), "ok")
+	RecordError(span, nil)
+	span.End()
+	_, span = Start(context.Background(), "failed")
+	RecordError(span, errors.New("boom"))
+	span.End()
+
+	spans := rec.Ended()
+	require.Len(t, spans, 2)
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+	assert.Equal(t, "boom", spans[1].Status().Description)
+}
+
+func storageBytes(n int64) attribute.KeyValue {
+	return attribute.Int64("storage.bytes", n)
+}
@@ -0,0 +1,51 @@
+package tests
+
+import (
+	"context"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+const (
+	MinioAccessKey = "minioadmin"
+	MinioSecretKey = "minioadmin"
+)
+
+// MinioContainer is a MinIO server for testing the S3 storage backend
+type MinioContainer struct {
+	testcontainers.Container
+	Endpoint string // host:port, without a scheme
+}
+
+// CreateMinioContainer starts a MinIO server reachable with MinioAccessKey and MinioSecretKey
+func CreateMinioContainer(t *testing.T, ctx context.Context) (*MinioContainer, error) {
+	logger := log.Default()
+	container, err := testcontainers.Run(ctx,
+		"minio/minio:RELEASE.2024-01-16T16-07-38Z",
+		testcontainers.WithExposedPorts("9000/tcp"),
+		testcontainers.WithEnv(map[string]string{
+			"MINIO_ROOT_USER":     MinioAccessKey,
+			"MINIO_ROOT_PASSWORD": MinioSecretKey,
+		}),
+		testcontainers.WithCmd("server", "/data"),
+		testcontainers.WithWaitStrategy(wait.ForHTTP("/minio/health/live").WithPort("9000/tcp")),
+		testcontainers.WithLogger(logger),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint, err := container.PortEndpoint(ctx, "9000/tcp", "")
+	if err != nil {
+		return nil, err
+	}
+
+	return &MinioContainer{
+		Container: container,
+		Endpoint:  strings.TrimPrefix(endpoint, "http://"),
+	}, nil
+}